@@ -0,0 +1,57 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdAnnotate creates a new cobra.Command for the annotate subcommand.
+func NewCmdAnnotate(options *[]crane.Option) *cobra.Command {
+	var annotations map[string]string
+	var newTag string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "annotate IMAGE",
+		Short: "Add annotations to the manifest of a remote image or index, without downloading its layers",
+		Example: `# Annotate ubuntu:latest and push it as ubuntu:annotated
+crane annotate ubuntu -a org.opencontainers.image.source=https://example.com -t annotated
+
+# Remove an annotation, overwriting the original tag
+crane annotate ubuntu -a org.opencontainers.image.source= --force`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			// Copy the options, so appending to them can't clobber the caller's.
+			opts := append([]crane.Option{}, *options...)
+			if force {
+				opts = append(opts, crane.Force)
+			}
+			digest, err := crane.Annotate(args[0], annotations, newTag, opts...)
+			if err != nil {
+				return err
+			}
+			fmt.Println(digest)
+			return nil
+		},
+	}
+	cmd.Flags().StringToStringVarP(&annotations, "annotation", "a", nil, "Annotations to set, or to remove if the value is empty")
+	cmd.Flags().StringVarP(&newTag, "tag", "t", "", "Tag to push the annotated manifest to. If not provided, overwrite the original tag, which requires --force.")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite the original tag if --tag is not provided, or if it is the same as the original")
+	return cmd
+}
@@ -23,12 +23,25 @@ import (
 
 // NewCmdConfig creates a new cobra.Command for the config subcommand.
 func NewCmdConfig(options *[]crane.Option) *cobra.Command {
-	return &cobra.Command{
+	var normalize, keepTimestamps bool
+	cmd := &cobra.Command{
 		Use:   "config IMAGE",
 		Short: "Get the config of an image",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
-			cfg, err := crane.Config(args[0], *options...)
+			var (
+				cfg []byte
+				err error
+			)
+			if normalize {
+				opts := append([]crane.Option{}, *options...)
+				if keepTimestamps {
+					opts = append(opts, crane.KeepTimestamps)
+				}
+				cfg, err = crane.ConfigNormalized(args[0], opts...)
+			} else {
+				cfg, err = crane.Config(args[0], *options...)
+			}
 			if err != nil {
 				return fmt.Errorf("fetching config: %w", err)
 			}
@@ -36,4 +49,7 @@ func NewCmdConfig(options *[]crane.Option) *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&normalize, "normalize", false, "Print the config with sorted keys and without volatile fields, so that it can be diffed")
+	cmd.Flags().BoolVar(&keepTimestamps, "keep-timestamps", false, "With --normalize, keep the creation timestamps")
+	return cmd
 }
@@ -21,14 +21,21 @@ import (
 
 // NewCmdCopy creates a new cobra.Command for the copy subcommand.
 func NewCmdCopy(options *[]crane.Option) *cobra.Command {
-	return &cobra.Command{
+	var checkpoint string
+	cmd := &cobra.Command{
 		Use:     "copy SRC DST",
 		Aliases: []string{"cp"},
 		Short:   "Efficiently copy a remote image from src to dst while retaining the digest value",
 		Args:    cobra.ExactArgs(2),
 		RunE: func(_ *cobra.Command, args []string) error {
 			src, dst := args[0], args[1]
-			return crane.Copy(src, dst, *options...)
+			opts := *options
+			if checkpoint != "" {
+				opts = append(opts, crane.WithCheckpoint(checkpoint))
+			}
+			return crane.Copy(src, dst, opts...)
 		},
 	}
+	cmd.Flags().StringVar(&checkpoint, "checkpoint", "", "Path to a file recording copied blobs, so that an interrupted copy can be resumed")
+	return cmd
 }
@@ -34,7 +34,10 @@ import (
 
 // NewCmdFlatten creates a new cobra.Command for the flatten subcommand.
 func NewCmdFlatten(options *[]crane.Option) *cobra.Command {
-	var dst string
+	var (
+		dst          string
+		reproducible bool
+	)
 
 	flattenCmd := &cobra.Command{
 		Use:   "flatten",
@@ -66,7 +69,7 @@ func NewCmdFlatten(options *[]crane.Option) *cobra.Command {
 			}
 			repo := newRef.Context()
 
-			flat, err := flatten(ref, repo, cmd.Parent().Use, o)
+			flat, err := flatten(ref, repo, cmd.Parent().Use, reproducible, o)
 			if err != nil {
 				log.Fatalf("flattening %s: %v", ref, err)
 			}
@@ -76,7 +79,8 @@ func NewCmdFlatten(options *[]crane.Option) *cobra.Command {
 				log.Fatalf("digesting new image: %v", err)
 			}
 
-			if _, ok := ref.(name.Digest); ok {
+			switch ref.(type) {
+			case name.Digest, name.TaggedDigest:
 				newRef = repo.Digest(digest.String())
 			}
 
@@ -87,10 +91,11 @@ func NewCmdFlatten(options *[]crane.Option) *cobra.Command {
 		},
 	}
 	flattenCmd.Flags().StringVarP(&dst, "tag", "t", "", "New tag to apply to flattened image. If not provided, push by digest to the original image repository.")
+	flattenCmd.Flags().BoolVar(&reproducible, "reproducible", false, "Write the flattened layer in a canonical form (sorted entries, zeroed timestamps), so that the same filesystem always flattens to the same digest.")
 	return flattenCmd
 }
 
-func flatten(ref name.Reference, repo name.Repository, use string, o crane.Options) (partial.Describable, error) {
+func flatten(ref name.Reference, repo name.Repository, use string, reproducible bool, o crane.Options) (partial.Describable, error) {
 	desc, err := remote.Get(ref, o.Remote...)
 	if err != nil {
 		return nil, fmt.Errorf("pulling %s: %w", ref, err)
@@ -101,13 +106,13 @@ func flatten(ref name.Reference, repo name.Repository, use string, o crane.Optio
 		if err != nil {
 			return nil, err
 		}
-		return flattenIndex(idx, repo, use, o)
+		return flattenIndex(idx, repo, use, reproducible, o)
 	} else if desc.MediaType.IsImage() {
 		img, err := desc.Image()
 		if err != nil {
 			return nil, err
 		}
-		return flattenImage(img, repo, use, o)
+		return flattenImage(img, repo, use, reproducible, o)
 	}
 
 	return nil, fmt.Errorf("can't flatten %s", desc.MediaType)
@@ -127,7 +132,7 @@ type remoteIndex interface {
 	Manifests() ([]partial.Describable, error)
 }
 
-func flattenIndex(old v1.ImageIndex, repo name.Repository, use string, o crane.Options) (partial.Describable, error) {
+func flattenIndex(old v1.ImageIndex, repo name.Repository, use string, reproducible bool, o crane.Options) (partial.Describable, error) {
 	ri, ok := old.(remoteIndex)
 	if !ok {
 		return nil, fmt.Errorf("unexpected index")
@@ -152,7 +157,7 @@ func flattenIndex(old v1.ImageIndex, repo name.Repository, use string, o crane.O
 			return nil, err
 		}
 
-		flattened, err := flattenChild(m, repo, use, o)
+		flattened, err := flattenChild(m, repo, use, reproducible, o)
 		if err != nil {
 			return nil, err
 		}
@@ -187,18 +192,18 @@ func flattenIndex(old v1.ImageIndex, repo name.Repository, use string, o crane.O
 	return idx, nil
 }
 
-func flattenChild(old partial.Describable, repo name.Repository, use string, o crane.Options) (partial.Describable, error) {
+func flattenChild(old partial.Describable, repo name.Repository, use string, reproducible bool, o crane.Options) (partial.Describable, error) {
 	if idx, ok := old.(v1.ImageIndex); ok {
-		return flattenIndex(idx, repo, use, o)
+		return flattenIndex(idx, repo, use, reproducible, o)
 	} else if img, ok := old.(v1.Image); ok {
-		return flattenImage(img, repo, use, o)
+		return flattenImage(img, repo, use, reproducible, o)
 	}
 
 	logs.Warn.Printf("can't flatten %T, skipping", old)
 	return old, nil
 }
 
-func flattenImage(old v1.Image, repo name.Repository, use string, o crane.Options) (partial.Describable, error) {
+func flattenImage(old v1.Image, repo name.Repository, use string, reproducible bool, o crane.Options) (partial.Describable, error) {
 	digest, err := old.Digest()
 	if err != nil {
 		return nil, fmt.Errorf("getting old digest: %w", err)
@@ -228,8 +233,13 @@ func flattenImage(old v1.Image, repo name.Repository, use string, o crane.Option
 		return nil, fmt.Errorf("mutating config: %w", err)
 	}
 
+	var extractOpts []mutate.ExtractOption
+	if reproducible {
+		extractOpts = append(extractOpts, mutate.Canonicalize())
+	}
+
 	// TODO: Make compression configurable?
-	layer := stream.NewLayer(mutate.Extract(old), stream.WithCompressionLevel(gzip.BestCompression))
+	layer := stream.NewLayer(mutate.Extract(old, extractOpts...), stream.WithCompressionLevel(gzip.BestCompression))
 	if err := remote.WriteLayer(repo, layer, o.Remote...); err != nil {
 		return nil, fmt.Errorf("uploading layer: %w", err)
 	}
@@ -0,0 +1,144 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestFlattenReproducible(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/flatten")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	o := crane.GetOptions()
+	flat := func(ref name.Reference) v1.Image {
+		t.Helper()
+		d, err := flatten(ref, ref.Context(), "crane", true, o)
+		if err != nil {
+			t.Fatalf("flatten(%s) = %v", ref, err)
+		}
+		img, ok := d.(v1.Image)
+		if !ok {
+			t.Fatalf("flatten(%s) = %T, want v1.Image", ref, d)
+		}
+		return img
+	}
+	digest := func(img v1.Image) v1.Hash {
+		t.Helper()
+		h, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	layerDigest := func(img v1.Image) v1.Hash {
+		t.Helper()
+		ls, err := img.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ls) != 1 {
+			t.Fatalf("got %d layers, want 1", len(ls))
+		}
+		h, err := ls[0].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	first, second := flat(ref), flat(ref)
+	if got, want := digest(second), digest(first); got != want {
+		t.Errorf("flattening twice: got %v, want %v", got, want)
+	}
+
+	// The same filesystem, written in a different order with different
+	// timestamps, flattens to the same layer.
+	var layers []v1.Hash
+	for i, files := range [][]tar.Header{{
+		{Name: "a", Size: 1, ModTime: time.Unix(1, 0)},
+		{Name: "b", Size: 1, ModTime: time.Unix(2, 0)},
+	}, {
+		{Name: "b", Size: 1, ModTime: time.Unix(3, 0)},
+		{Name: "a", Size: 1, ModTime: time.Unix(4, 0)},
+	}} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range files {
+			hdr := hdr
+			hdr.Mode = 0644
+			if err := tw.WriteHeader(&hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(hdr.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.AppendLayers(empty.Image, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := ref.Context().Tag(fmt.Sprintf("files-%d", i))
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layerDigest(flat(ref)))
+	}
+	if layers[0] != layers[1] {
+		t.Errorf("flattening the same files: got layers %v and %v, want the same", layers[0], layers[1])
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdIndex creates a new cobra.Command for the index subcommand.
+func NewCmdIndex(options *[]crane.Option) *cobra.Command {
+	var (
+		tag            string
+		allowDuplicate bool
+		childPlatforms []string
+	)
+
+	indexCmd := &cobra.Command{
+		Use:   "index IMAGE...",
+		Short: "Create a multi-platform index from existing images",
+		Long: `This sub-command pushes an OCI image index that references each of the given
+images, using the platform from each image's config file.`,
+		Example: `# Combine per-platform images into a single index
+crane index -t example.com/app:latest example.com/app:amd64 example.com/app:arm64
+
+# Override the platform of an image
+crane index -t example.com/app:latest example.com/app:amd64 example.com/app:armv7 \
+  --child-platform example.com/app:armv7=linux/arm/v7`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			opts := *options
+			for _, cp := range childPlatforms {
+				parts := strings.SplitN(cp, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("parsing --child-platform %q: expected IMAGE=os/arch[/variant]", cp)
+				}
+				p, err := parsePlatform(parts[1])
+				if err != nil {
+					return err
+				}
+				if p == nil {
+					return fmt.Errorf("parsing --child-platform %q: platform must not be %q", cp, "all")
+				}
+				opts = append(opts, crane.WithChildPlatform(parts[0], *p))
+			}
+			if allowDuplicate {
+				opts = append(opts, crane.AllowDuplicatePlatforms)
+			}
+			return crane.Index(args, tag, opts...)
+		},
+	}
+	indexCmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag to apply to the index")
+	indexCmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Allow more than one image with the same platform")
+	indexCmd.Flags().StringArrayVar(&childPlatforms, "child-platform", nil, "Override the platform of an image, in the form IMAGE=os/arch[/variant][:osversion]")
+	indexCmd.MarkFlagRequired("tag")
+
+	return indexCmd
+}
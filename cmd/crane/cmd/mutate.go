@@ -15,14 +15,9 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/google/go-containerregistry/pkg/crane"
-	"github.com/google/go-containerregistry/pkg/name"
-	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/spf13/cobra"
 )
 
@@ -32,107 +27,55 @@ func NewCmdMutate(options *[]crane.Option) *cobra.Command {
 	var annotations map[string]string
 	var entrypoint, cmd []string
 	var envVars map[string]string
+	var user, workdir string
 	var newLayers []string
+	var replaceEnv, replaceLabels bool
 
 	var newRef string
+	var force bool
 
 	mutateCmd := &cobra.Command{
 		Use:   "mutate",
 		Short: "Modify image labels and annotations. The container must be pushed to a registry, and the manifest is updated there.",
 		Args:  cobra.ExactArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
-			// Pull image and get config.
-			ref := args[0]
-
-			if len(annotations) != 0 {
-				desc, err := crane.Head(ref, *options...)
-				if err != nil {
-					return err
-				}
-				if desc.MediaType.IsIndex() {
-					return errors.New("mutating annotations on an index is not yet supported")
-				}
-			}
-
-			img, err := crane.Pull(ref, *options...)
-			if err != nil {
-				return fmt.Errorf("pulling %s: %w", ref, err)
-			}
-			if len(newLayers) != 0 {
-				img, err = crane.Append(img, newLayers...)
-				if err != nil {
-					return fmt.Errorf("appending %v: %w", newLayers, err)
-				}
+		RunE: func(c *cobra.Command, args []string) error {
+			opts := []crane.MutateOption{
+				crane.MutateWithOptions(*options...),
+				crane.MutateLabels(labels),
+				crane.MutateAnnotations(annotations),
+				crane.MutateEnv(envVars),
+				crane.MutateAppend(newLayers...),
 			}
-			cfg, err := img.ConfigFile()
-			if err != nil {
-				return err
-			}
-			cfg = cfg.DeepCopy()
-
-			// Set labels.
-			if cfg.Config.Labels == nil {
-				cfg.Config.Labels = map[string]string{}
+			if len(entrypoint) > 0 {
+				opts = append(opts, crane.MutateEntrypoint(entrypoint...))
 			}
-
-			if err := validateKeyVals(labels); err != nil {
-				return err
+			if len(cmd) > 0 {
+				opts = append(opts, crane.MutateCmd(cmd...))
 			}
-
-			for k, v := range labels {
-				cfg.Config.Labels[k] = v
+			if c.Flags().Changed("user") {
+				opts = append(opts, crane.MutateUser(user))
 			}
-
-			if err := validateKeyVals(annotations); err != nil {
-				return err
+			if c.Flags().Changed("workdir") {
+				opts = append(opts, crane.MutateWorkdir(workdir))
 			}
-
-			// set envvars if specified
-			if err := setEnvVars(cfg, envVars); err != nil {
-				return err
+			if replaceEnv {
+				opts = append(opts, crane.MutateReplaceEnv)
 			}
-
-			// Set entrypoint.
-			if len(entrypoint) > 0 {
-				cfg.Config.Entrypoint = entrypoint
-				cfg.Config.Cmd = nil // This matches Docker's behavior.
+			if replaceLabels {
+				opts = append(opts, crane.MutateReplaceLabels)
 			}
-
-			// Set cmd.
-			if len(cmd) > 0 {
-				cfg.Config.Cmd = cmd
+			if newRef != "" {
+				opts = append(opts, crane.MutateTag(newRef))
 			}
-
-			// Mutate and write image.
-			img, err = mutate.Config(img, cfg.Config)
-			if err != nil {
-				return fmt.Errorf("mutating config: %w", err)
+			if force {
+				opts = append(opts, crane.MutateForce)
 			}
 
-			img = mutate.Annotations(img, annotations).(v1.Image)
-
-			// If the new ref isn't provided, write over the original image.
-			// If that ref was provided by digest (e.g., output from
-			// another crane command), then strip that and push the
-			// mutated image by digest instead.
-			if newRef == "" {
-				newRef = ref
-			}
-			digest, err := img.Digest()
+			digest, err := crane.Mutate(args[0], opts...)
 			if err != nil {
-				return fmt.Errorf("digesting new image: %w", err)
-			}
-			r, err := name.ParseReference(newRef)
-			if err != nil {
-				return fmt.Errorf("parsing %s: %w", newRef, err)
-			}
-			if _, ok := r.(name.Digest); ok {
-				newRef = r.Context().Digest(digest.String()).String()
-			}
-			if err := crane.Push(img, newRef, *options...); err != nil {
-				return fmt.Errorf("pushing %s: %w", newRef, err)
+				return err
 			}
-			fmt.Println(r.Context().Digest(digest.String()))
+			fmt.Println(digest)
 			return nil
 		},
 	}
@@ -141,45 +84,12 @@ func NewCmdMutate(options *[]crane.Option) *cobra.Command {
 	mutateCmd.Flags().StringToStringVarP(&envVars, "env", "e", nil, "New envvar to add")
 	mutateCmd.Flags().StringSliceVar(&entrypoint, "entrypoint", nil, "New entrypoint to set")
 	mutateCmd.Flags().StringSliceVar(&cmd, "cmd", nil, "New cmd to set")
+	mutateCmd.Flags().StringVarP(&user, "user", "u", "", "New user to set")
+	mutateCmd.Flags().StringVarP(&workdir, "workdir", "w", "", "New working dir to set")
+	mutateCmd.Flags().BoolVar(&replaceEnv, "replace-env", false, "Replace the existing envvars instead of adding to them")
+	mutateCmd.Flags().BoolVar(&replaceLabels, "replace-labels", false, "Replace the existing labels instead of adding to them")
 	mutateCmd.Flags().StringVarP(&newRef, "tag", "t", "", "New tag to apply to mutated image. If not provided, push by digest to the original image repository.")
+	mutateCmd.Flags().BoolVar(&force, "force", false, "Overwrite the original tag if --tag is not provided, or if it is the same as the original")
 	mutateCmd.Flags().StringSliceVar(&newLayers, "append", []string{}, "Path to tarball to append to image")
 	return mutateCmd
 }
-
-// validateKeyVals ensures no values are empty, returns error if they are
-func validateKeyVals(kvPairs map[string]string) error {
-	for label, value := range kvPairs {
-		if value == "" {
-			return fmt.Errorf("parsing label %q, value is empty", label)
-		}
-	}
-	return nil
-}
-
-// setEnvVars override envvars in a config
-func setEnvVars(cfg *v1.ConfigFile, envVars map[string]string) error {
-	newEnv := make([]string, 0, len(cfg.Config.Env))
-	for _, old := range cfg.Config.Env {
-		split := strings.SplitN(old, "=", 2)
-		if len(split) != 2 {
-			return fmt.Errorf("invalid key value pair in config: %s", old)
-		}
-		// keep order so override if specified again
-		oldKey := split[0]
-		if v, ok := envVars[oldKey]; ok {
-			newEnv = append(newEnv, fmt.Sprintf("%s=%s", oldKey, v))
-			delete(envVars, oldKey)
-		} else {
-			newEnv = append(newEnv, old)
-		}
-	}
-	isWindows := cfg.OS == "windows"
-	for k, v := range envVars {
-		if isWindows {
-			k = strings.ToUpper(k)
-		}
-		newEnv = append(newEnv, fmt.Sprintf("%s=%s", k, v))
-	}
-	cfg.Config.Env = newEnv
-	return nil
-}
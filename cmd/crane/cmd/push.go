@@ -35,11 +35,24 @@ func NewCmdPush(options *[]crane.Option) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "push PATH IMAGE",
 		Short: "Push local image contents to a remote registry",
-		Long:  `If the PATH is a directory, it will be read as an OCI image layout. Otherwise, PATH is assumed to be a docker-style tarball.`,
-		Args:  cobra.ExactArgs(2),
+		Long: `If the PATH is a directory, it will be read as an OCI image layout. Otherwise, PATH is assumed to be a docker-style tarball.
+
+If the PATH is "-", the tarball is read from stdin, e.g. docker save foo | crane push - IMAGE. Since layers are read more than once, stdin is buffered in a temporary file, which needs as much free disk as the tarball is large.`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(_ *cobra.Command, args []string) error {
 			path, tag := args[0], args[1]
 
+			if path == "-" {
+				if index {
+					return fmt.Errorf("--index is not supported when reading a tarball from stdin")
+				}
+				digest, err := crane.PushTarball(os.Stdin, tag, *options...)
+				if err != nil {
+					return err
+				}
+				return writeImageRefs(imageRefs, digest)
+			}
+
 			img, err := loadImage(path, index)
 			if err != nil {
 				return err
@@ -70,14 +83,7 @@ func NewCmdPush(options *[]crane.Option) *cobra.Command {
 				return fmt.Errorf("cannot push type (%T) to registry", img)
 			}
 
-			digest := ref.Context().Digest(h.String())
-			if imageRefs != "" {
-				return ioutil.WriteFile(imageRefs, []byte(digest.String()), 0600)
-			}
-			// TODO(mattmoor): think about printing the digest to standard out
-			// to facilitate command composition similar to ko build.
-
-			return nil
+			return writeImageRefs(imageRefs, ref.Context().Digest(h.String()).String())
 		},
 	}
 	cmd.Flags().BoolVar(&index, "index", false, "push a collection of images as a single index, currently required if PATH contains multiple images")
@@ -85,6 +91,17 @@ func NewCmdPush(options *[]crane.Option) *cobra.Command {
 	return cmd
 }
 
+// writeImageRefs writes the digest reference of the pushed image to path, if
+// one was given.
+func writeImageRefs(path, digest string) error {
+	// TODO(mattmoor): think about printing the digest to standard out
+	// to facilitate command composition similar to ko build.
+	if path == "" {
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(digest), 0600)
+}
+
 func loadImage(path string, index bool) (partial.WithRawManifest, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
@@ -87,6 +87,7 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 	}
 
 	commands := []*cobra.Command{
+		NewCmdAnnotate(&options),
 		NewCmdAppend(&options),
 		NewCmdBlob(&options),
 		NewCmdAuth("crane", "auth"),
@@ -97,6 +98,7 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 		NewCmdDigest(&options),
 		NewCmdExport(&options),
 		NewCmdFlatten(&options),
+		NewCmdIndex(&options),
 		NewCmdList(&options),
 		NewCmdManifest(&options),
 		NewCmdOptimize(&options),
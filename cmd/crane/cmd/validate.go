@@ -36,16 +36,10 @@ func NewCmdValidate(options *[]crane.Option) *cobra.Command {
 		Short: "Validate that an image is well-formed",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(_ *cobra.Command, args []string) error {
-			for flag, maker := range map[string]func(string, ...crane.Option) (v1.Image, error){
-				tarballPath: makeTarball,
-				remoteRef:   crane.Pull,
-			} {
-				if flag == "" {
-					continue
-				}
-				img, err := maker(flag, *options...)
+			if tarballPath != "" {
+				img, err := makeTarball(tarballPath)
 				if err != nil {
-					return fmt.Errorf("failed to read image %s: %w", flag, err)
+					return fmt.Errorf("failed to read image %s: %w", tarballPath, err)
 				}
 
 				opt := []validate.Option{}
@@ -53,21 +47,32 @@ func NewCmdValidate(options *[]crane.Option) *cobra.Command {
 					opt = append(opt, validate.Fast)
 				}
 				if err := validate.Image(img, opt...); err != nil {
-					fmt.Printf("FAIL: %s: %v\n", flag, err)
+					fmt.Printf("FAIL: %s: %v\n", tarballPath, err)
+					return err
+				}
+				fmt.Printf("PASS: %s\n", tarballPath)
+			}
+			if remoteRef != "" {
+				opt := *options
+				if fast {
+					opt = append(opt, crane.FastValidation)
+				}
+				if err := crane.Validate(remoteRef, opt...); err != nil {
+					fmt.Printf("FAIL: %s: %v\n", remoteRef, err)
 					return err
 				}
-				fmt.Printf("PASS: %s\n", flag)
+				fmt.Printf("PASS: %s\n", remoteRef)
 			}
 			return nil
 		},
 	}
 	validateCmd.Flags().StringVar(&tarballPath, "tarball", "", "Path to tarball to validate")
-	validateCmd.Flags().StringVar(&remoteRef, "remote", "", "Name of remote image to validate")
+	validateCmd.Flags().StringVar(&remoteRef, "remote", "", "Name of remote image or index to validate; use --platform to only validate one image of an index")
 	validateCmd.Flags().BoolVar(&fast, "fast", false, "Skip downloading/digesting layers")
 
 	return validateCmd
 }
 
-func makeTarball(path string, _ ...crane.Option) (v1.Image, error) {
+func makeTarball(path string) (v1.Image, error) {
 	return tarball.ImageFromPath(path, nil)
 }
@@ -0,0 +1,94 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewFake(start)
+	if got := f.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, want %v", got, start)
+	}
+
+	soon, later, stopped := f.NewTimer(time.Second), f.NewTimer(time.Minute), f.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("Stop() = false for a pending timer")
+	}
+	if got, want := f.Timers(), 2; got != want {
+		t.Errorf("Timers() = %d, want %d", got, want)
+	}
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-soon.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	select {
+	case got := <-soon.C():
+		if want := start.Add(time.Second); !got.Equal(want) {
+			t.Errorf("timer fired at %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("timer didn't fire")
+	}
+	if soon.Stop() {
+		t.Error("Stop() = true for a fired timer")
+	}
+
+	// Sleep doesn't block, but moves time along.
+	f.Sleep(time.Minute)
+	select {
+	case <-later.C():
+	default:
+		t.Fatal("Sleep() didn't fire the timer")
+	}
+	select {
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if diff := cmp.Diff([]time.Duration{time.Minute}, f.Sleeps()); diff != "" {
+		t.Errorf("Sleeps() (-want +got) = %s", diff)
+	}
+	if got, want := f.Now(), start.Add(time.Second+time.Minute); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+
+	// Timers that are already due fire straight away.
+	select {
+	case <-f.NewTimer(0).C():
+	default:
+		t.Error("NewTimer(0) didn't fire")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if OrReal(nil) != Real {
+		t.Error("OrReal(nil) != Real")
+	}
+	f := NewFake(time.Time{})
+	if OrReal(f) != f {
+		t.Error("OrReal(f) != f")
+	}
+}
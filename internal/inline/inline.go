@@ -0,0 +1,48 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inline embeds blob contents in the data field of descriptors.
+package inline
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/internal/verify"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Eligible reports whether the blob desc describes should be inlined given a
+// threshold in bytes.
+func Eligible(desc v1.Descriptor, threshold int64) bool {
+	return threshold > 0 && desc.Data == nil && desc.Size <= threshold && desc.MediaType.IsDistributable()
+}
+
+// Layer reads the compressed contents of l, which must match desc.
+func Layer(l v1.Layer, desc v1.Descriptor) ([]byte, error) {
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(rc, desc.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.Descriptor(v1.Descriptor{Digest: desc.Digest, Size: desc.Size, Data: b}); err != nil {
+		return nil, fmt.Errorf("inlining layer %s: %w", desc.Digest, err)
+	}
+	return b, nil
+}
@@ -12,11 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package redact contains a simple context signal for redacting requests.
+// Package redact contains a simple context signal for redacting requests, and
+// helpers to keep credentials out of logs and error messages.
 package redact
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
 )
 
 type contextKey string
@@ -33,3 +38,91 @@ func FromContext(ctx context.Context) (bool, string) {
 	reason, ok := ctx.Value(redactKey).(string)
 	return ok, reason
 }
+
+// The set of query string keys that we expect to send as part of the registry
+// protocol. Anything else is potentially dangerous to leak, as it's probably
+// from a redirect. These redirects often included tokens or signed URLs.
+var paramAllowlist = map[string]struct{}{
+	// Token exchange
+	"scope":   {},
+	"service": {},
+	// Cross-repo mounting
+	"mount": {},
+	"from":  {},
+	// Layer PUT
+	"digest": {},
+	// Listing tags and catalog
+	"n":    {},
+	"last": {},
+}
+
+// URL returns a copy of original without its password, if any, and with the
+// values of all the query parameters not in paramAllowlist redacted.
+func URL(original *url.URL) *url.URL {
+	qs := original.Query()
+	for k, v := range qs {
+		for i := range v {
+			if _, ok := paramAllowlist[k]; !ok {
+				// key is not in the Allowlist
+				v[i] = "REDACTED"
+			}
+		}
+	}
+	redacted := *original
+	if _, ok := redacted.User.Password(); ok {
+		redacted.User = url.UserPassword(redacted.User.Username(), "REDACTED")
+	}
+	redacted.RawQuery = qs.Encode()
+	return &redacted
+}
+
+// The headers that carry credentials.
+var secretHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Header returns a copy of h with the values of any headers that carry
+// credentials redacted.
+func Header(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, k := range secretHeaders {
+		if redacted.Get(k) != "" {
+			redacted.Set(k, "<redacted>")
+		}
+	}
+	return redacted
+}
+
+// The JSON fields that carry credentials, in auth configs and token responses.
+var secretFields = map[string]struct{}{
+	"auth":          {},
+	"password":      {},
+	"identitytoken": {},
+	"registrytoken": {},
+	"token":         {},
+	"access_token":  {},
+	"refresh_token": {},
+	"id_token":      {},
+}
+
+// JSON returns b with the values of any top-level fields that carry
+// credentials redacted. If b isn't a JSON object, it's omitted entirely.
+func JSON(b []byte) string {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "<redacted: not a JSON object>"
+	}
+	for k := range m {
+		if _, ok := secretFields[strings.ToLower(k)]; ok {
+			m[k] = json.RawMessage(`"REDACTED"`)
+		}
+	}
+	redacted, err := json.Marshal(m)
+	if err != nil {
+		return "<redacted>"
+	}
+	return string(redacted)
+}
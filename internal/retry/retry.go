@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/internal/retry/wait"
 )
 
@@ -57,21 +58,29 @@ type Predicate func(error) (retry bool)
 // exponential backoff. If the predicate is never satisfied, it will return the
 // last error returned by f.
 func Retry(f func() error, p Predicate, backoff wait.Backoff) (err error) {
+	return RetryWithClock(f, p, backoff, clock.Real)
+}
+
+// RetryWithClock is like Retry, but waits between attempts with c, so that
+// tests can use a fake clock. A nil c is the real clock.
+func RetryWithClock(f func() error, p Predicate, backoff wait.Backoff, c clock.Clock) (err error) {
 	if f == nil {
 		return fmt.Errorf("nil f passed to retry")
 	}
 	if p == nil {
 		return fmt.Errorf("nil p passed to retry")
 	}
+	c = clock.OrReal(c)
 
-	condition := func() (bool, error) {
-		err = f()
-		if p(err) {
-			return false, nil
+	// This is wait.ExponentialBackoff, sleeping with c.
+	for backoff.Steps > 0 {
+		if err = f(); !p(err) {
+			return err
 		}
-		return true, err
+		if backoff.Steps == 1 {
+			break
+		}
+		c.Sleep(backoff.Step())
 	}
-
-	wait.ExponentialBackoff(backoff, condition)
-	return
+	return err
 }
@@ -18,6 +18,10 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/internal/clock"
 )
 
 type temp struct{}
@@ -88,3 +92,31 @@ func TestNil(t *testing.T) {
 		t.Errorf("got nil when passing in nil p")
 	}
 }
+
+func TestRetryWithClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	backoff := Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Steps:    4,
+	}
+	count := 0
+	err := RetryWithClock(func() error {
+		count++
+		return temp{}
+	}, IsTemporary, backoff, c)
+	if err != (temp{}) {
+		t.Errorf("RetryWithClock() = %v, want %v", err, temp{})
+	}
+	if count != 4 {
+		t.Errorf("called f %d times, want 4", count)
+	}
+	// There's no sleep after the last attempt.
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if diff := cmp.Diff(want, c.Sleeps()); diff != "" {
+		t.Errorf("sleeps (-want +got) = %s", diff)
+	}
+	if got, want := c.Now(), time.Unix(7, 0); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
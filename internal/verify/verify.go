@@ -50,13 +50,34 @@ func (v Error) Error() string {
 		v.want.Algorithm, v.gotSize, v.got, v.want)
 }
 
+// SizeError is returned when the content is shorter or longer than expected.
+type SizeError struct {
+	// Got is the number of bytes read. If the content is too long, reading
+	// stops at the first unexpected byte, so this is Want+1.
+	Got int64
+	// Want is the expected size.
+	Want int64
+}
+
+func (v SizeError) Error() string {
+	if v.Got > v.Want {
+		return fmt.Sprintf("error verifying size; got more than %d bytes", v.Want)
+	}
+	return fmt.Sprintf("error verifying size; got %d, want %d", v.Got, v.Want)
+}
+
 // Read implements io.Reader
 func (vc *verifyReader) Read(b []byte) (int, error) {
 	n, err := vc.inner.Read(b)
 	vc.gotSize += int64(n)
+	if vc.wantSize != SizeUnknown && vc.gotSize > vc.wantSize {
+		// Fail as soon as we see the first unexpected byte, rather than
+		// waiting for a (possibly never-ending) stream to finish.
+		return n - int(vc.gotSize-vc.wantSize), SizeError{Got: vc.gotSize, Want: vc.wantSize}
+	}
 	if err == io.EOF {
 		if vc.wantSize != SizeUnknown && vc.gotSize != vc.wantSize {
-			return n, fmt.Errorf("error verifying size; got %d, want %d", vc.gotSize, vc.wantSize)
+			return n, SizeError{Got: vc.gotSize, Want: vc.wantSize}
 		}
 		got := hex.EncodeToString(vc.hasher.Sum(nil))
 		if want := vc.expected.Hex; got != want {
@@ -74,8 +95,9 @@ func (vc *verifyReader) Read(b []byte) (int, error) {
 // the provided v1.Hash before io.EOF is returned.
 //
 // The reader will only be read up to size bytes, to prevent resource
-// exhaustion. If EOF is returned before size bytes are read, an error is
-// returned.
+// exhaustion: as soon as it yields more than size bytes, a SizeError is
+// returned without reading any further. If EOF is returned before size bytes
+// are read, a SizeError is returned too.
 //
 // A size of SizeUnknown (-1) indicates disables size verification when the size
 // is unknown ahead of time.
@@ -86,7 +108,9 @@ func ReadCloser(r io.ReadCloser, size int64, h v1.Hash) (io.ReadCloser, error) {
 	}
 	r2 := io.TeeReader(r, w) // pass all writes to the hasher.
 	if size != SizeUnknown {
-		r2 = io.LimitReader(r2, size) // if we know the size, limit to that size.
+		// If we know the size, limit to that size, plus one byte so that we
+		// can tell when there's too much content.
+		r2 = io.LimitReader(r2, size+1)
 	}
 	return &and.ReadCloser{
 		Reader: &verifyReader{
@@ -107,7 +131,11 @@ func Descriptor(d v1.Descriptor) error {
 		return errors.New("error verifying descriptor; Data == nil")
 	}
 
-	h, sz, err := v1.SHA256(bytes.NewReader(d.Data))
+	algorithm := d.Digest.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	h, sz, err := v1.ComputeHash(algorithm, bytes.NewReader(d.Data))
 	if err != nil {
 		return err
 	}
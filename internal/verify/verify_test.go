@@ -145,3 +145,67 @@ func TestDescriptor(t *testing.T) {
 		}
 	}
 }
+
+// endless is an io.Reader that never runs out of data.
+type endless struct{}
+
+func (endless) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 'a'
+	}
+	return len(b), nil
+}
+
+func TestSizeErrors(t *testing.T) {
+	want := "This is the input string."
+
+	for _, tc := range []struct {
+		desc string
+		size int64
+		msg  string
+	}{{
+		desc: "too long",
+		size: 3,
+		msg:  "error verifying size; got more than 3 bytes",
+	}, {
+		desc: "too short",
+		size: 100,
+		msg:  "error verifying size; got 25, want 100",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			rc, err := ReadCloser(ioutil.NopCloser(strings.NewReader(want)), tc.size, mustHash(want, t))
+			if err != nil {
+				t.Fatal("ReadCloser() =", err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			var serr SizeError
+			if !errors.As(err, &serr) {
+				t.Fatalf("ReadAll() = %v; want SizeError", err)
+			}
+			if serr.Want != tc.size {
+				t.Errorf("Want = %d, want %d", serr.Want, tc.size)
+			}
+			if got := err.Error(); got != tc.msg {
+				t.Errorf("Error() = %q, want %q", got, tc.msg)
+			}
+			if int64(len(b)) > tc.size {
+				t.Errorf("read %d bytes, want at most %d", len(b), tc.size)
+			}
+		})
+	}
+}
+
+func TestEndlessStream(t *testing.T) {
+	// This would never finish if we waited for EOF.
+	rc, err := ReadCloser(ioutil.NopCloser(endless{}), 1<<20, mustHash("", t))
+	if err != nil {
+		t.Fatal("ReadCloser() =", err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	if !errors.As(err, &SizeError{}) {
+		t.Fatalf("ReadAll() = %v; want SizeError", err)
+	}
+	if len(b) != 1<<20 {
+		t.Errorf("read %d bytes, want %d", len(b), 1<<20)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	want := "This is the input string."
+	unzipped, err := UnzipReadCloser(ioutil.NopCloser(bytes.NewReader(compress(t, want))))
+	if err != nil {
+		t.Fatal("UnzipReadCloser() =", err)
+	}
+	defer unzipped.Close()
+
+	b, err := ioutil.ReadAll(unzipped)
+	if err != nil {
+		t.Error("ReadAll() =", err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("ReadAll(); got %q, want %q", got, want)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		want bool
+	}{
+		{"empty", []byte{}, false},
+		{"short", []byte{'\x28', '\xb5'}, false},
+		{"plain", []byte("not compressed at all"), false},
+		{"zstd", compress(t, "compressed"), true},
+	} {
+		got, pr, err := Peek(bytes.NewReader(tc.in))
+		if err != nil {
+			t.Fatalf("%s: Peek() = %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: Peek() = %t, want %t", tc.name, got, tc.want)
+		}
+		// The returned reader should still yield all of the input.
+		b, err := ioutil.ReadAll(pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, tc.in) {
+			t.Errorf("%s: ReadAll() = %q, want %q", tc.name, b, tc.in)
+		}
+	}
+}
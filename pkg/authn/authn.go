@@ -14,6 +14,8 @@
 
 package authn
 
+import "fmt"
+
 // AuthConfig contains authorization information for connecting to a Registry
 // Inlined what we use from github.com/docker/cli/cli/config/types
 type AuthConfig struct {
@@ -29,6 +31,21 @@ type AuthConfig struct {
 	RegistryToken string `json:"registrytoken,omitempty"`
 }
 
+// String implements fmt.Stringer, so that logging an AuthConfig doesn't leak
+// credentials; only the Username is shown.
+func (a AuthConfig) String() string {
+	return fmt.Sprintf("{Username:%s Password:%s Auth:%s IdentityToken:%s RegistryToken:%s}",
+		a.Username, mask(a.Password), mask(a.Auth), mask(a.IdentityToken), mask(a.RegistryToken))
+}
+
+// mask hides a secret, while still showing whether it's set.
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
 // Authenticator is used to authenticate Docker transports.
 type Authenticator interface {
 	// Authorization returns the value to use in an http transport's Authorization header.
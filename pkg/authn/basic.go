@@ -14,6 +14,8 @@
 
 package authn
 
+import "fmt"
+
 // Basic implements Authenticator for basic authentication.
 type Basic struct {
 	Username string
@@ -27,3 +29,8 @@ func (b *Basic) Authorization() (*AuthConfig, error) {
 		Password: b.Password,
 	}, nil
 }
+
+// String implements fmt.Stringer without revealing the Password.
+func (b *Basic) String() string {
+	return fmt.Sprintf("{Username:%s Password:%s}", b.Username, mask(b.Password))
+}
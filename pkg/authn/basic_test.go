@@ -15,7 +15,9 @@
 package authn
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -31,3 +33,25 @@ func TestBasic(t *testing.T) {
 		t.Errorf("Authorization(); got %v, want %v", got, want)
 	}
 }
+
+func TestBasicString(t *testing.T) {
+	basic := &Basic{Username: "foo", Password: "hunter2"}
+	cfg, err := basic.Authorization()
+	if err != nil {
+		t.Fatalf("Authorization() = %v", err)
+	}
+	for _, s := range []string{
+		fmt.Sprint(basic),
+		fmt.Sprintf("%+v", basic),
+		fmt.Sprint(cfg),
+		fmt.Sprintf("%v", *cfg),
+		fmt.Sprint(&Bearer{Token: "hunter2"}),
+	} {
+		if strings.Contains(s, "hunter2") {
+			t.Errorf("formatted credentials leak the secret: %s", s)
+		}
+	}
+	if s := fmt.Sprint(cfg); !strings.Contains(s, "foo") {
+		t.Errorf("formatted AuthConfig should include the username: %s", s)
+	}
+}
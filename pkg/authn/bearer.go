@@ -14,6 +14,8 @@
 
 package authn
 
+import "fmt"
+
 // Bearer implements Authenticator for bearer authentication.
 type Bearer struct {
 	Token string `json:"token"`
@@ -25,3 +27,8 @@ func (b *Bearer) Authorization() (*AuthConfig, error) {
 		RegistryToken: b.Token,
 	}, nil
 }
+
+// String implements fmt.Stringer without revealing the Token.
+func (b *Bearer) String() string {
+	return fmt.Sprintf("{Token:%s}", mask(b.Token))
+}
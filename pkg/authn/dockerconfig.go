@@ -0,0 +1,62 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/cli/cli/config/configfile"
+)
+
+// configFileKeychain implements Keychain for an in-memory docker config file.
+type configFileKeychain struct {
+	cf *configfile.ConfigFile
+}
+
+// NewFromDockerConfigJSON returns a Keychain that resolves credentials from
+// the contents of a docker config file, e.g. the data of a Kubernetes pull
+// secret, without reading anything from disk.
+//
+// Both the ".dockerconfigjson" format, where credentials are nested under
+// "auths", and the legacy ".dockercfg" format, where they are not, are
+// supported. Credential helpers referenced by the config are not used.
+func NewFromDockerConfigJSON(data []byte) (Keychain, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("parsing docker config: %w", err)
+	}
+
+	// The legacy format is just the contents of "auths".
+	if _, ok := probe["auths"]; !ok {
+		data = append(append([]byte(`{"auths":`), data...), '}')
+	}
+
+	cf := configfile.New("")
+	if err := cf.LoadFromReader(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("parsing docker config: %w", err)
+	}
+	// Only consult the auths we just parsed.
+	cf.CredentialsStore = ""
+	cf.CredentialHelpers = nil
+
+	return &configFileKeychain{cf: cf}, nil
+}
+
+// Resolve implements Keychain.
+func (k *configFileKeychain) Resolve(target Resource) (Authenticator, error) {
+	return resolveFromConfigFile(k.cf, target)
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestNewFromDockerConfigJSON(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("foo:bar"))
+	for _, tc := range []struct {
+		desc string
+		data string
+	}{{
+		desc: "dockerconfigjson",
+		data: fmt.Sprintf(`{"auths": {"https://registry.example.com/v1/": {"auth": %q}}}`, auth),
+	}, {
+		desc: "dockercfg",
+		data: fmt.Sprintf(`{"registry.example.com": {"auth": %q, "email": "foo@example.com"}}`, auth),
+	}, {
+		desc: "username and password",
+		data: `{"auths": {"registry.example.com": {"username": "foo", "password": "bar"}}}`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			kc, err := NewFromDockerConfigJSON([]byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reg, err := name.NewRegistry("registry.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err := kc.Resolve(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := a.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Username != "foo" || cfg.Password != "bar" {
+				t.Errorf("Resolve(%s) = %+v, want foo/bar", reg, cfg)
+			}
+
+			other, err := name.NewRegistry("gcr.io")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err = kc.Resolve(other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a != Anonymous {
+				t.Errorf("Resolve(%s) = %v, want Anonymous", other, a)
+			}
+		})
+	}
+
+	if _, err := NewFromDockerConfigJSON([]byte("not json")); err == nil {
+		t.Error("NewFromDockerConfigJSON(invalid): got nil want err")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"os"
+	"strings"
+)
+
+// envKeychain implements Keychain by reading credentials from environment
+// variables.
+type envKeychain struct {
+	prefix string
+}
+
+// NewEnvKeychain returns a Keychain that reads credentials for a registry from
+// the environment variables <PREFIX>_<HOST>_USERNAME and <PREFIX>_<HOST>_PASSWORD.
+//
+// <HOST> is the registry hostname, sanitized by upper-casing it and replacing
+// every character that isn't a letter or digit (e.g. dots, colons and dashes)
+// with an underscore. For example, with the prefix "REGISTRY", credentials for
+// "localhost:5000" are read from REGISTRY_LOCALHOST_5000_USERNAME and
+// REGISTRY_LOCALHOST_5000_PASSWORD, and credentials for Docker Hub are read
+// from REGISTRY_INDEX_DOCKER_IO_USERNAME and REGISTRY_INDEX_DOCKER_IO_PASSWORD.
+//
+// If the username variable isn't set, this falls back to Anonymous.
+func NewEnvKeychain(prefix string) Keychain {
+	return &envKeychain{prefix: prefix}
+}
+
+// Resolve implements Keychain.
+func (e *envKeychain) Resolve(target Resource) (Authenticator, error) {
+	key := e.prefix + "_" + sanitizeEnvHost(target.RegistryStr())
+	username, ok := os.LookupEnv(key + "_USERNAME")
+	if !ok || username == "" {
+		return Anonymous, nil
+	}
+	return FromConfig(AuthConfig{
+		Username: username,
+		Password: os.Getenv(key + "_PASSWORD"),
+	}), nil
+}
+
+// sanitizeEnvHost converts a registry hostname into a string that is safe to
+// use as part of an environment variable name.
+func sanitizeEnvHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, host)
+}
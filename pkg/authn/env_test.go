@@ -0,0 +1,74 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestSanitizeEnvHost(t *testing.T) {
+	for _, tc := range []struct {
+		host, want string
+	}{
+		{"gcr.io", "GCR_IO"},
+		{"localhost:5000", "LOCALHOST_5000"},
+		{"my-registry.example.com:443", "MY_REGISTRY_EXAMPLE_COM_443"},
+		{"index.docker.io", "INDEX_DOCKER_IO"},
+	} {
+		if got := sanitizeEnvHost(tc.host); got != tc.want {
+			t.Errorf("sanitizeEnvHost(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestEnvKeychain(t *testing.T) {
+	os.Setenv("TEST_LOCALHOST_5000_USERNAME", "user")
+	os.Setenv("TEST_LOCALHOST_5000_PASSWORD", "pass")
+	defer os.Unsetenv("TEST_LOCALHOST_5000_USERNAME")
+	defer os.Unsetenv("TEST_LOCALHOST_5000_PASSWORD")
+
+	kc := NewEnvKeychain("TEST")
+
+	reg, err := name.NewRegistry("localhost:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := kc.Resolve(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := auth.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Username != "user" || cfg.Password != "pass" {
+		t.Errorf("Resolve(%s) = %+v, want user/pass", reg, cfg)
+	}
+
+	other, err := name.NewRegistry("gcr.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err = kc.Resolve(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != Anonymous {
+		t.Errorf("Resolve(%s) = %v, want Anonymous", other, auth)
+	}
+}
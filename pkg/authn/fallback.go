@@ -0,0 +1,51 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+// Fallback is implemented by Authenticators that have other credentials to
+// offer if the registry rejects the ones they provide, e.g. with a 401 or 429.
+// Transports that see such a response replace the Authenticator with the one
+// returned by Fallback and retry the request.
+type Fallback interface {
+	Authenticator
+
+	// Fallback returns the Authenticator to use next, or nil if there's
+	// nothing else to try.
+	Fallback() Authenticator
+}
+
+// anonymousFirst implements Fallback by authenticating anonymously until the
+// registry rejects that, then falling back to next.
+type anonymousFirst struct {
+	next Authenticator
+}
+
+// AnonymousFirst returns an Authenticator that tries anonymous access first
+// and only falls back to next's credentials if the registry responds with a
+// 401 or 429, e.g. for public images on registries that rate limit anonymous
+// pulls.
+func AnonymousFirst(next Authenticator) Authenticator {
+	return &anonymousFirst{next: next}
+}
+
+// Authorization implements Authenticator.
+func (a *anonymousFirst) Authorization() (*AuthConfig, error) {
+	return Anonymous.Authorization()
+}
+
+// Fallback implements Fallback.
+func (a *anonymousFirst) Fallback() Authenticator {
+	return a.next
+}
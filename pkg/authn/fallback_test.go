@@ -0,0 +1,41 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnonymousFirst(t *testing.T) {
+	next := FromConfig(AuthConfig{Username: "foo", Password: "bar"})
+	auth := AnonymousFirst(next)
+
+	cfg, err := auth.Authorization()
+	if err != nil {
+		t.Fatalf("Authorization() = %v", err)
+	}
+	if want := (&AuthConfig{}); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Authorization(); got %v, wanted {}", cfg)
+	}
+
+	fb, ok := auth.(Fallback)
+	if !ok {
+		t.Fatal("AnonymousFirst() does not implement Fallback")
+	}
+	if got := fb.Fallback(); got != next {
+		t.Errorf("Fallback(); got %v, wanted %v", got, next)
+	}
+}
@@ -51,7 +51,8 @@ type defaultKeychain struct {
 }
 
 var (
-	// DefaultKeychain implements Keychain by interpreting the docker config file.
+	// DefaultKeychain implements Keychain by interpreting the docker config file,
+	// honoring $DOCKER_CONFIG and Podman's $REGISTRY_AUTH_FILE.
 	DefaultKeychain Keychain = &defaultKeychain{}
 )
 
@@ -66,51 +67,67 @@ func (dk *defaultKeychain) Resolve(target Resource) (Authenticator, error) {
 	dk.mu.Lock()
 	defer dk.mu.Unlock()
 
-	// Podman users may have their container registry auth configured in a
-	// different location, that Docker packages aren't aware of.
-	// If the Docker config file isn't found, we'll fallback to look where
-	// Podman configures it, and parse that as a Docker auth config instead.
-
-	// First, check $HOME/.docker/config.json
-	foundDockerConfig := false
-	home, err := homedir.Dir()
-	if err == nil {
-		if _, err := os.Stat(filepath.Join(home, ".docker/config.json")); err == nil {
-			foundDockerConfig = true
-		}
+	cf, err := loadConfigFile()
+	if err != nil {
+		return nil, err
 	}
-	// If $HOME/.docker/config.json isn't found, check $DOCKER_CONFIG (if set)
-	if !foundDockerConfig && os.Getenv("DOCKER_CONFIG") != "" {
-		if _, err := os.Stat(filepath.Join(os.Getenv("DOCKER_CONFIG"), "config.json")); err == nil {
-			foundDockerConfig = true
-		}
+	if cf == nil {
+		return Anonymous, nil
 	}
-	// If either of those locations are found, load it using Docker's
-	// config.Load, which may fail if the config can't be parsed.
-	//
-	// If neither was found, look for Podman's auth at
-	// $XDG_RUNTIME_DIR/containers/auth.json and attempt to load it as a
-	// Docker config.
-	//
-	// If neither are found, fallback to Anonymous.
-	var cf *configfile.ConfigFile
-	if foundDockerConfig {
-		cf, err = config.Load(os.Getenv("DOCKER_CONFIG"))
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		f, err := os.Open(filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "containers/auth.json"))
-		if err != nil {
-			return Anonymous, nil
+	return resolveFromConfigFile(cf, target)
+}
+
+// loadConfigFile loads the first config file found in the following places,
+// or returns nil if there is none:
+//
+//   - $DOCKER_CONFIG/config.json, if $DOCKER_CONFIG is set
+//   - $REGISTRY_AUTH_FILE, if set, as used by Podman and Buildah
+//   - $HOME/.docker/config.json
+//   - $XDG_RUNTIME_DIR/containers/auth.json, where Podman stores auth by default
+//
+// Podman's auth files use the same format as Docker's config file, so we
+// parse them as such.
+func loadConfigFile() (*configfile.ConfigFile, error) {
+	exists := func(path string) bool {
+		s, err := os.Stat(path)
+		return err == nil && !s.IsDir()
+	}
+
+	// Docker config directories are loaded with config.Load, which also
+	// takes care of the credential stores configured in them.
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" && exists(filepath.Join(dir, config.ConfigFileName)) {
+		return config.Load(dir)
+	}
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" && exists(path) {
+		return loadAuthFile(path)
+	}
+	if home, err := homedir.Dir(); err == nil {
+		if dir := filepath.Join(home, ".docker"); exists(filepath.Join(dir, config.ConfigFileName)) {
+			return config.Load(dir)
 		}
-		defer f.Close()
-		cf, err = config.LoadFromReader(f)
-		if err != nil {
-			return nil, err
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if path := filepath.Join(dir, "containers/auth.json"); exists(path) {
+			return loadAuthFile(path)
 		}
 	}
+	return nil, nil
+}
+
+// loadAuthFile parses the Podman-style auth file at path as a Docker config
+// file.
+func loadAuthFile(path string) (*configfile.ConfigFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return config.LoadFromReader(f)
+}
 
+// resolveFromConfigFile looks up the credentials for target in cf, falling
+// back to Anonymous if there are none.
+func resolveFromConfigFile(cf *configfile.ConfigFile, target Resource) (Authenticator, error) {
 	// See:
 	// https://github.com/google/ko/issues/90
 	// https://github.com/moby/moby/blob/fc01c2b481097a6057bec3cd1ab2d7b4488c50c4/registry/config.go#L397-L404
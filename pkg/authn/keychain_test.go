@@ -26,6 +26,7 @@ import (
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/mitchellh/go-homedir"
 )
 
 var (
@@ -186,6 +187,120 @@ func TestPodmanConfig(t *testing.T) {
 	}
 }
 
+func TestConfigFileLookup(t *testing.T) {
+	vars := []string{"HOME", "DOCKER_CONFIG", "REGISTRY_AUTH_FILE", "XDG_RUNTIME_DIR"}
+	for _, v := range vars {
+		old, ok := os.LookupEnv(v)
+		defer func(v string) {
+			if ok {
+				os.Setenv(v, old)
+			} else {
+				os.Unsetenv(v)
+			}
+		}(v)
+	}
+
+	// homedir caches $HOME, which we change below.
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	// Write a config in each of the supported locations, authenticating as a
+	// different user for each.
+	tmp := t.TempDir()
+	write := func(path, user string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf(`{"auths": {"test.io": {"auth": %q}}}`, encode(user, "pass"))
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(tmp, "docker-config/config.json"), "docker-config")
+	write(filepath.Join(tmp, "auth-file.json"), "auth-file")
+	write(filepath.Join(tmp, "home/.docker/config.json"), "home")
+	write(filepath.Join(tmp, "xdg/containers/auth.json"), "xdg")
+	missing := filepath.Join(tmp, "missing")
+
+	for _, tc := range []struct {
+		desc string
+		env  map[string]string
+		want string
+	}{{
+		desc: "DOCKER_CONFIG first",
+		env: map[string]string{
+			"DOCKER_CONFIG":      filepath.Join(tmp, "docker-config"),
+			"REGISTRY_AUTH_FILE": filepath.Join(tmp, "auth-file.json"),
+		},
+		want: "docker-config",
+	}, {
+		desc: "REGISTRY_AUTH_FILE without DOCKER_CONFIG",
+		env: map[string]string{
+			"REGISTRY_AUTH_FILE": filepath.Join(tmp, "auth-file.json"),
+		},
+		want: "auth-file",
+	}, {
+		desc: "REGISTRY_AUTH_FILE with missing DOCKER_CONFIG",
+		env: map[string]string{
+			"DOCKER_CONFIG":      missing,
+			"REGISTRY_AUTH_FILE": filepath.Join(tmp, "auth-file.json"),
+		},
+		want: "auth-file",
+	}, {
+		desc: "HOME without either",
+		want: "home",
+	}, {
+		desc: "HOME with missing DOCKER_CONFIG and REGISTRY_AUTH_FILE",
+		env: map[string]string{
+			"DOCKER_CONFIG":      missing,
+			"REGISTRY_AUTH_FILE": filepath.Join(missing, "auth.json"),
+		},
+		want: "home",
+	}, {
+		desc: "XDG_RUNTIME_DIR without HOME config",
+		env: map[string]string{
+			"HOME": missing,
+		},
+		want: "xdg",
+	}, {
+		desc: "nothing configured",
+		env: map[string]string{
+			"HOME":            missing,
+			"XDG_RUNTIME_DIR": missing,
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, v := range vars {
+				os.Unsetenv(v)
+			}
+			os.Setenv("HOME", filepath.Join(tmp, "home"))
+			os.Setenv("XDG_RUNTIME_DIR", filepath.Join(tmp, "xdg"))
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+			}
+
+			auth, err := DefaultKeychain.Resolve(testRegistry)
+			if err != nil {
+				t.Fatalf("Resolve() = %v", err)
+			}
+			if tc.want == "" {
+				if auth != Anonymous {
+					t.Errorf("expected Anonymous, got %v", auth)
+				}
+				return
+			}
+			got, err := auth.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &AuthConfig{Username: tc.want, Password: "pass"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
 func encode(user, pass string) string {
 	delimited := fmt.Sprintf("%s:%s", user, pass)
 	return base64.StdEncoding.EncodeToString([]byte(delimited))
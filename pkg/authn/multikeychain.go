@@ -39,3 +39,30 @@ func (mk *multiKeychain) Resolve(target Resource) (Authenticator, error) {
 	}
 	return Anonymous, nil
 }
+
+type overrideKeychain struct {
+	explicit Authenticator
+	fallback Keychain
+}
+
+// Assert that our override keychain implements Keychain.
+var _ (Keychain) = (*overrideKeychain)(nil)
+
+// OverrideKeychain returns a keychain that resolves every target to explicit,
+// unless explicit is nil or Anonymous, in which case targets are resolved by
+// fallback. This is the usual precedence for a CLI, where credentials passed
+// as flags override those from e.g. the docker config.
+func OverrideKeychain(explicit Authenticator, fallback Keychain) Keychain {
+	return &overrideKeychain{explicit: explicit, fallback: fallback}
+}
+
+// Resolve implements Keychain.
+func (ovk *overrideKeychain) Resolve(target Resource) (Authenticator, error) {
+	if ovk.explicit != nil && ovk.explicit != Anonymous {
+		return ovk.explicit, nil
+	}
+	if ovk.fallback == nil {
+		return Anonymous, nil
+	}
+	return ovk.fallback.Resolve(target)
+}
@@ -85,6 +85,65 @@ func TestMultiKeychain(t *testing.T) {
 	}
 }
 
+func TestOverrideKeychain(t *testing.T) {
+	explicit := &Basic{Username: "explicit", Password: "secret"}
+	one := &Basic{Username: "one", Password: "secret"}
+
+	regOne, _ := name.NewRegistry("one.gcr.io", name.StrictValidation)
+	regTwo, _ := name.NewRegistry("two.gcr.io", name.StrictValidation)
+
+	fallback := fixedKeychain{regOne: one}
+
+	tests := []struct {
+		name string
+		reg  name.Registry
+		kc   Keychain
+		want Authenticator
+	}{{
+		name: "explicit wins over keychain",
+		reg:  regOne,
+		kc:   OverrideKeychain(explicit, fallback),
+		want: explicit,
+	}, {
+		name: "explicit used for all hosts",
+		reg:  regTwo,
+		kc:   OverrideKeychain(explicit, fallback),
+		want: explicit,
+	}, {
+		name: "anonymous falls back to keychain",
+		reg:  regOne,
+		kc:   OverrideKeychain(Anonymous, fallback),
+		want: one,
+	}, {
+		name: "nil falls back to keychain",
+		reg:  regOne,
+		kc:   OverrideKeychain(nil, fallback),
+		want: one,
+	}, {
+		name: "fallback has no match",
+		reg:  regTwo,
+		kc:   OverrideKeychain(Anonymous, fallback),
+		want: Anonymous,
+	}, {
+		name: "no fallback",
+		reg:  regOne,
+		kc:   OverrideKeychain(nil, nil),
+		want: Anonymous,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.kc.Resolve(test.reg)
+			if err != nil {
+				t.Errorf("Resolve() = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Resolve() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
 type fixedKeychain map[Resource]Authenticator
 
 var _ Keychain = (fixedKeychain)(nil)
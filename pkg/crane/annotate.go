@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Force is an Option for Annotate that allows it to overwrite the tag it read
+// the manifest from.
+func Force(o *Options) {
+	o.force = true
+}
+
+// Annotate merges annotations into the annotations of the manifest of the
+// remote image or index ref, and pushes the result as newTag. An empty value
+// removes the annotation of that name. For an index, only the index itself is
+// annotated, not its children.
+//
+// Only the manifest is fetched and pushed, so no blobs are downloaded. Like
+// Tag, newTag may be a tag in the repository of ref or a full reference in
+// the same repository. If newTag is empty, the manifest is pushed to ref
+// itself, which requires the Force option when ref is a tag.
+//
+// It returns the digest of the annotated manifest.
+func Annotate(ref string, annotations map[string]string, newTag string, opt ...Option) (v1.Hash, error) {
+	o := makeOptions(opt...)
+	src, err := name.ParseReference(ref, o.Name...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("parsing reference %q: %w", ref, err)
+	}
+
+	var dst name.Tag
+	switch {
+	case newTag == "":
+		tag, ok := src.(name.Tag)
+		if !ok {
+			return v1.Hash{}, fmt.Errorf("annotating %q by digest requires a new tag", ref)
+		}
+		dst = tag
+	case strings.ContainsAny(newTag, "/:"):
+		if dst, err = name.NewTag(newTag, o.Name...); err != nil {
+			return v1.Hash{}, fmt.Errorf("parsing reference %q: %w", newTag, err)
+		}
+		if dst.Context().String() != src.Context().String() {
+			return v1.Hash{}, fmt.Errorf("cannot annotate %q into a different repository %q", ref, dst.Context())
+		}
+	default:
+		dst = src.Context().Tag(newTag)
+	}
+	if dst.Name() == src.Name() && !o.force {
+		return v1.Hash{}, fmt.Errorf("refusing to overwrite %q without force", dst)
+	}
+
+	desc, err := remote.Get(src, o.Remote...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("fetching %q: %w", ref, err)
+	}
+	raw, err := mergeAnnotations(desc.Manifest, annotations)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, sz, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	annotated := &remote.Descriptor{
+		Manifest: raw,
+		Descriptor: v1.Descriptor{
+			MediaType: desc.MediaType,
+			Size:      sz,
+			Digest:    h,
+		},
+	}
+	if err := remote.Tag(dst, annotated, o.Remote...); err != nil {
+		return v1.Hash{}, err
+	}
+	return h, nil
+}
+
+// mergeAnnotations returns the raw manifest with annotations merged into its
+// "annotations" field, leaving everything else as is.
+func mergeAnnotations(raw []byte, annotations map[string]string) ([]byte, error) {
+	// Decode into raw messages rather than a v1.Manifest or v1.IndexManifest,
+	// so that we don't drop anything we don't know about.
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	merged := map[string]string{}
+	if b, ok := m["annotations"]; ok {
+		if err := json.Unmarshal(b, &merged); err != nil {
+			return nil, fmt.Errorf("parsing manifest annotations: %w", err)
+		}
+	}
+	for k, v := range annotations {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	if len(merged) == 0 {
+		delete(m, "annotations")
+	} else {
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return nil, err
+		}
+		m["annotations"] = b
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// WithCheckpoint is an Option for Copy that records each blob that has been
+// copied to the destination in a JSON file at path, keyed by digest. If the
+// copy fails partway, running it again with the same checkpoint skips any
+// recorded blobs that still exist at the destination.
+//
+// Blobs are tracked using remote.WithPerLayerProgress, alongside any
+// per-layer progress reporting passed in via the remote options.
+func WithCheckpoint(path string) Option {
+	return func(o *Options) {
+		o.checkpoint = path
+	}
+}
+
+// checkpointBlob is the value recorded in a checkpoint for each blob.
+type checkpointBlob struct {
+	Size int64 `json:"size"`
+}
+
+// checkpoint tracks the blobs that have been copied during Copy.
+type checkpoint struct {
+	path string
+
+	mu    sync.Mutex
+	blobs map[v1.Hash]checkpointBlob
+
+	wg sync.WaitGroup
+}
+
+// loadCheckpoint reads the checkpoint at path, if it exists.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:  path,
+		blobs: map[v1.Hash]checkpointBlob{},
+	}
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.blobs); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// verify returns the recorded blobs that still exist in repo, forgetting
+// about any that don't.
+func (c *checkpoint) verify(repo name.Repository, o Options) ([]v1.Hash, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing := make([]v1.Hash, 0, len(c.blobs))
+	for h := range c.blobs {
+		l, err := remote.Layer(repo.Digest(h.String()), o.Remote...)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := partial.Exists(l)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			logs.Progress.Printf("checkpointed blob %s no longer exists in %s", h, repo)
+			delete(c.blobs, h)
+			continue
+		}
+		existing = append(existing, h)
+	}
+	return existing, nil
+}
+
+// track implements remote.LayerProgressFunc, recording h once its channel is
+// closed without an error.
+func (c *checkpoint) track(h v1.Hash) chan<- v1.Update {
+	updates := make(chan v1.Update, 100)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		var (
+			size   int64
+			failed bool
+		)
+		for u := range updates {
+			if u.Error != nil {
+				failed = true
+			}
+			size = u.Total
+		}
+		if failed {
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.blobs[h] = checkpointBlob{Size: size}
+		if err := c.save(); err != nil {
+			logs.Warn.Printf("writing checkpoint %s: %v", c.path, err)
+		}
+	}()
+	return updates
+}
+
+// wait blocks until every tracked blob has been recorded.
+func (c *checkpoint) wait() {
+	c.wg.Wait()
+}
+
+// save atomically writes the checkpoint to c.path. c.mu must be held.
+func (c *checkpoint) save() error {
+	b, err := json.Marshal(c.blobs)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
@@ -14,6 +14,12 @@
 
 package crane
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
 // Config returns the config file for the remote image ref.
 func Config(ref string, opt ...Option) ([]byte, error) {
 	i, _, err := getImage(ref, opt...)
@@ -22,3 +28,58 @@ func Config(ref string, opt ...Option) ([]byte, error) {
 	}
 	return i.RawConfigFile()
 }
+
+// KeepTimestamps is an Option for ConfigNormalized that keeps the creation
+// timestamps of the image and its history.
+func KeepTimestamps(o *Options) {
+	o.keepTimestamps = true
+}
+
+// ConfigNormalized returns the config file for the remote image ref in a form
+// that's stable to diff: indented, with sorted keys, and without the fields
+// that change every time the same image is rebuilt, i.e. the ID of the build
+// container and, unless KeepTimestamps is given, the creation timestamps.
+//
+// Fields that aren't part of v1.ConfigFile are preserved.
+func ConfigNormalized(ref string, opt ...Option) ([]byte, error) {
+	o := makeOptions(opt...)
+	raw, err := Config(ref, opt...)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeConfig(raw, o.keepTimestamps)
+}
+
+func normalizeConfig(raw []byte, keepTimestamps bool) ([]byte, error) {
+	// Decode into generic values rather than a v1.ConfigFile, so that we don't
+	// drop or reformat anything we don't know about.
+	var cfg map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+
+	delete(cfg, "container")
+	if !keepTimestamps {
+		delete(cfg, "created")
+		if history, ok := cfg["history"].([]interface{}); ok {
+			for _, h := range history {
+				if h, ok := h.(map[string]interface{}); ok {
+					delete(h, "created")
+				}
+			}
+		}
+	}
+
+	// encoding/json sorts map keys. Don't escape HTML, so that e.g. "&&" in
+	// history entries stays readable.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
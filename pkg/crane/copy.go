@@ -15,16 +15,23 @@
 package crane
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/google/go-containerregistry/internal/legacy"
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // Copy copies a remote image or index from src to dst.
+//
+// Layers are streamed from the source registry straight into the upload to
+// the destination, with their digests verified as they go, so no layer is
+// ever held in memory or on disk in full. If an upload is retried, the layer
+// is fetched again from the source.
 func Copy(src, dst string, opt ...Option) error {
 	o := makeOptions(opt...)
 	srcRef, err := name.ParseReference(src, o.Name...)
@@ -43,6 +50,19 @@ func Copy(src, dst string, opt ...Option) error {
 		return fmt.Errorf("fetching %q: %w", src, err)
 	}
 
+	if o.checkpoint != "" {
+		cp, err := loadCheckpoint(o.checkpoint)
+		if err != nil {
+			return err
+		}
+		existing, err := cp.verify(dstRef.Context(), o)
+		if err != nil {
+			return fmt.Errorf("verifying checkpoint: %w", err)
+		}
+		defer cp.wait()
+		o.Remote = append(o.Remote, remote.WithExistingBlobs(existing...), remote.WithPerLayerProgress(cp.track))
+	}
+
 	switch desc.MediaType {
 	case types.OCIImageIndex, types.DockerManifestList:
 		// Handle indexes separately.
@@ -86,3 +106,61 @@ func copyIndex(desc *remote.Descriptor, dstRef name.Reference, o Options) error
 	}
 	return remote.WriteIndex(dstRef, idx, o.Remote...)
 }
+
+// CopyBlobStore copies the image or index with the given manifest digest, and
+// everything it references, from src to dst. It can move images between any
+// two stores, e.g. from a registry (see remote.BlobStore) to a bucket in
+// object storage (see objectstore.NewBlobStore).
+//
+// Non-distributable layers aren't copied, as Copy doesn't copy them either.
+func CopyBlobStore(src, dst v1.BlobStore, h v1.Hash) error {
+	return copyBlobStore(src, dst, h, map[v1.Hash]bool{})
+}
+
+// copyBlobStore copies the manifest h and what it references, skipping any
+// blobs in seen and adding the rest to it.
+func copyBlobStore(src, dst v1.BlobStore, h v1.Hash, seen map[v1.Hash]bool) error {
+	raw, desc, err := src.GetManifest(h)
+	if err != nil {
+		return fmt.Errorf("fetching manifest %s: %w", h, err)
+	}
+	if desc.MediaType.IsIndex() {
+		idx, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		for _, child := range idx.Manifests {
+			if seen[child.Digest] {
+				continue
+			}
+			seen[child.Digest] = true
+			if err := copyBlobStore(src, dst, child.Digest, seen); err != nil {
+				return err
+			}
+		}
+	} else {
+		// Assume anything else is an image, as Copy does.
+		m, err := v1.ParseManifest(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		for _, blob := range append([]v1.Descriptor{m.Config}, m.Layers...) {
+			if seen[blob.Digest] || !blob.MediaType.IsDistributable() {
+				continue
+			}
+			seen[blob.Digest] = true
+			rc, err := src.GetBlob(blob.Digest)
+			if err != nil {
+				return fmt.Errorf("fetching blob %s: %w", blob.Digest, err)
+			}
+			if err := dst.PutBlob(blob.Digest, rc); err != nil {
+				return fmt.Errorf("writing blob %s: %w", blob.Digest, err)
+			}
+		}
+	}
+	if err := dst.PutManifest(*desc, raw); err != nil {
+		return fmt.Errorf("writing manifest %s: %w", h, err)
+	}
+	logs.Progress.Printf("copied manifest %s", h)
+	return nil
+}
@@ -17,6 +17,7 @@ package crane_test
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -27,8 +28,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/internal/compare"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
@@ -37,8 +42,11 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/objectstore"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
 
 // TODO(jonjohnsonjr): Test crane.Copy failures.
@@ -222,6 +230,61 @@ func TestCraneRegistry(t *testing.T) {
 	}
 }
 
+func TestTagWithoutBlobs(t *testing.T) {
+	var blobGets int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			atomic.AddInt32(&blobGets, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/tag", u.Host)
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"retag", src + ":full"} {
+		atomic.StoreInt32(&blobGets, 0)
+		if err := crane.Tag(src, tag); err != nil {
+			t.Fatalf("Tag(%q): %v", tag, err)
+		}
+		if n := atomic.LoadInt32(&blobGets); n != 0 {
+			t.Errorf("Tag(%q) fetched %d blobs, want 0", tag, n)
+		}
+	}
+
+	// Tagging into a different repository copies the image.
+	other := fmt.Sprintf("%s/test/other:v1", u.Host)
+	if err := crane.Tag(src, other); err != nil {
+		t.Fatalf("Tag(%q): %v", other, err)
+	}
+
+	for _, ref := range []string{src + ":retag", src + ":full", other} {
+		got, err := crane.Digest(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want.String() {
+			t.Errorf("Digest(%q) = %s, want %s", ref, got, want)
+		}
+	}
+}
+
 func TestCraneCopyIndex(t *testing.T) {
 	// Set up a fake registry.
 	s := httptest.NewServer(registry.New())
@@ -265,6 +328,200 @@ func TestCraneCopyIndex(t *testing.T) {
 	}
 }
 
+// memBucket is an objectstore.Bucket that keeps objects in memory.
+type memBucket struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *memBucket) Get(key string) (io.ReadCloser, error) {
+	b.Lock()
+	defer b.Unlock()
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", key)
+	}
+	return ioutil.NopCloser(bytes.NewReader(o)), nil
+}
+
+func (b *memBucket) Put(key string, r io.Reader) error {
+	o, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.objects[key] = o
+	return nil
+}
+
+func TestCraneCopyBlobStore(t *testing.T) {
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := name.ParseReference(fmt.Sprintf("%s/test/crane", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := name.NewRepository(fmt.Sprintf("%s/test/crane/copy", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load up the registry.
+	idx, err := random.Index(1024, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(src, idx); err != nil {
+		t.Fatal(err)
+	}
+	h, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy from the registry to a bucket, and back to another repository.
+	srcStore, err := remote.BlobStore(src.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := objectstore.NewBlobStore(&memBucket{objects: map[string][]byte{}}, "oci")
+	dstStore, err := remote.BlobStore(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.CopyBlobStore(srcStore, bucket, h); err != nil {
+		t.Fatalf("CopyBlobStore(registry, bucket) = %v", err)
+	}
+	if err := crane.CopyBlobStore(bucket, dstStore, h); err != nil {
+		t.Fatalf("CopyBlobStore(bucket, registry) = %v", err)
+	}
+
+	got, err := remote.Index(dst.Digest(h.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(got); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+}
+
+func TestCraneCopyCheckpoint(t *testing.T) {
+	// Set up a fake registry that counts blob existence checks.
+	var heads int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/blobs/") {
+			atomic.AddInt32(&heads, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := fmt.Sprintf("%s/test/crane", u.Host)
+	dst := fmt.Sprintf("%s/test/crane/copy", u.Host)
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{m.Config.Digest.String(): true}
+	for _, l := range m.Layers {
+		want[l.Digest.String()] = true
+	}
+
+	checkpoint := path.Join(t.TempDir(), "checkpoint.json")
+	readCheckpoint := func() map[string]bool {
+		t.Helper()
+		b, err := ioutil.ReadFile(checkpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var blobs map[string]struct {
+			Size int64 `json:"size"`
+		}
+		if err := json.Unmarshal(b, &blobs); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for h := range blobs {
+			got[h] = true
+		}
+		return got
+	}
+
+	// Per-layer progress passed in via the remote options still gets reported.
+	var mu sync.Mutex
+	reported := map[string]bool{}
+	progress := func(o *crane.Options) {
+		o.Remote = append(o.Remote, remote.WithPerLayerProgress(func(h v1.Hash) chan<- v1.Update {
+			mu.Lock()
+			defer mu.Unlock()
+			reported[h.String()] = true
+			return make(chan v1.Update, 100)
+		}))
+	}
+	if err := crane.Copy(src, dst, progress, crane.WithCheckpoint(checkpoint)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, readCheckpoint()); diff != "" {
+		t.Errorf("checkpoint (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff(want, reported); diff != "" {
+		t.Errorf("reported progress (-want +got) = %s", diff)
+	}
+
+	// Resuming should only check for each recorded blob once.
+	atomic.StoreInt32(&heads, 0)
+	if err := crane.Copy(src, dst, crane.WithCheckpoint(checkpoint)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt32(&heads), int32(len(want)); got != want {
+		t.Errorf("got %d blob HEAD requests, want %d", got, want)
+	}
+
+	// Blobs that don't exist at the destination are dropped and copied again.
+	b, err := ioutil.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("{"), []byte(`{"sha256:0000000000000000000000000000000000000000000000000000000000000000":{"size":1},`), 1)
+	if err := ioutil.WriteFile(checkpoint, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	other := fmt.Sprintf("%s/test/crane/other", u.Host)
+	if err := crane.Copy(src, other, crane.WithCheckpoint(checkpoint)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, readCheckpoint()); diff != "" {
+		t.Errorf("checkpoint (-want +got) = %s", diff)
+	}
+	copied, err := crane.Pull(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(copied); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
 func TestWithPlatform(t *testing.T) {
 	// Set up a fake registry with a platform-specific image.
 	s := httptest.NewServer(registry.New())
@@ -297,86 +554,539 @@ func TestWithPlatform(t *testing.T) {
 		})
 	}
 
-	idx := mutate.AppendManifests(empty.Index, imgs...)
-
-	src := path.Join(u.Host, "src")
-	dst := path.Join(u.Host, "dst")
-
-	ref, err := name.ParseReference(src)
+	idx := mutate.AppendManifests(empty.Index, imgs...)
+
+	src := path.Join(u.Host, "src")
+	dst := path.Join(u.Host, "dst")
+
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Populate registry so we can copy from it.
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := crane.Copy(src, dst, crane.WithPlatform(imgs[1].Platform)); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := crane.Manifest(src, crane.WithPlatform(imgs[1].Platform))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := crane.Manifest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(want) {
+		t.Errorf("Manifest(%q) != Manifest(%q): (\n\n%s\n\n!=\n\n%s\n\n)", dst, src, string(got), string(want))
+	}
+
+	arch := "real fake doors"
+
+	// Now do a fake platform, should fail
+	if _, err := crane.Manifest(src, crane.WithPlatform(&v1.Platform{
+		OS:           "does-not-exist",
+		Architecture: arch,
+	})); err == nil {
+		t.Error("crane.Manifest(fake platform): got nil want err")
+	} else if !strings.Contains(err.Error(), arch) {
+		t.Errorf("crane.Manifest(fake platform): expected %q in error, got: %v", arch, err)
+	}
+}
+
+func TestCraneIndex(t *testing.T) {
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children := []string{}
+	for _, plat := range []string{
+		"linux/amd64",
+		"linux/arm64",
+		"linux/arm64",
+	} {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(plat, "/")
+		cf.OS, cf.Architecture = parts[0], parts[1]
+		img, err = mutate.ConfigFile(img, cf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		child := fmt.Sprintf("%s/test/child:%d", u.Host, len(children))
+		if err := crane.Push(img, child); err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, child)
+	}
+	dst := fmt.Sprintf("%s/test/index", u.Host)
+
+	if err := crane.Index(children, dst); err == nil {
+		t.Error("Index(duplicate platforms): got nil want err")
+	}
+
+	armv8 := v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	if err := crane.Index(children, dst, crane.WithChildPlatform(children[2], armv8)); err != nil {
+		t.Fatalf("Index(override platform): %v", err)
+	}
+	if err := crane.Index(children, dst, crane.AllowDuplicatePlatforms); err != nil {
+		t.Fatalf("Index(allow duplicates): %v", err)
+	}
+
+	ref, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := remote.Index(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(m.Manifests), len(children); got != want {
+		t.Fatalf("len(Manifests): got %d, want %d", got, want)
+	}
+	for i, desc := range m.Manifests {
+		want, err := crane.Digest(children[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := desc.Digest.String(); got != want {
+			t.Errorf("Manifests[%d].Digest: got %s, want %s", i, got, want)
+		}
+	}
+	if got, want := m.Manifests[1].Platform.String(), "linux/arm64"; got != want {
+		t.Errorf("Manifests[1].Platform: got %s, want %s", got, want)
+	}
+}
+
+func TestCraneMutate(t *testing.T) {
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.Config.Env = []string{"PATH=/bin", "OLD=1"}
+	cf.Config.Labels = map[string]string{"old": "label"}
+	img, err = mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/mutate:latest", u.Host)
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+	srcDigest, err := crane.Digest(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := fmt.Sprintf("%s/test/mutate:new", u.Host)
+	got, err := crane.Mutate(src,
+		crane.MutateEntrypoint("/app"),
+		crane.MutateEnv(map[string]string{"OLD": "2", "NEW": "3"}),
+		crane.MutateLabels(map[string]string{"new": "label", "empty": ""}),
+		crane.MutateAnnotations(map[string]string{"foo": "bar", "empty": ""}),
+		crane.MutateUser("nobody"),
+		crane.MutateWorkdir("/work"),
+		crane.MutateTag(dst),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstDigest, err := crane.Digest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%s/test/mutate@%s", u.Host, dstDigest); got != want {
+		t.Errorf("Mutate: got %s, want %s", got, want)
+	}
+
+	mutated, err := crane.Pull(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcf, err := mutated.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"PATH=/bin", "OLD=2", "NEW=3"}, mcf.Config.Env); diff != "" {
+		t.Errorf("Env (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"old": "label", "new": "label", "empty": ""}, mcf.Config.Labels); diff != "" {
+		t.Errorf("Labels (-want +got) = %s", diff)
+	}
+	if got, want := mcf.Config.User, "nobody"; got != want {
+		t.Errorf("User: got %q, want %q", got, want)
+	}
+	if got, want := mcf.Config.WorkingDir, "/work"; got != want {
+		t.Errorf("WorkingDir: got %q, want %q", got, want)
+	}
+	m, err := mutated.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Annotations["foo"], "bar"; got != want {
+		t.Errorf("Annotations[foo]: got %q, want %q", got, want)
+	}
+	if got, ok := m.Annotations["empty"]; ok {
+		t.Errorf("Annotations[empty]: got %q, want it removed", got)
+	}
+
+	// Replacing instead of appending.
+	if _, err := crane.Mutate(src,
+		crane.MutateEnv(map[string]string{"ONLY": "this"}),
+		crane.MutateLabels(map[string]string{"only": "this"}),
+		crane.MutateReplaceEnv,
+		crane.MutateReplaceLabels,
+		crane.MutateForce,
+	); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := crane.Config(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcf, err := v1.ParseConfigFile(bytes.NewReader(replaced))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"ONLY=this"}, rcf.Config.Env); diff != "" {
+		t.Errorf("Env (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"only": "this"}, rcf.Config.Labels); diff != "" {
+		t.Errorf("Labels (-want +got) = %s", diff)
+	}
+
+	// Without force, the original tag is left alone.
+	forced, err := crane.Digest(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forced == srcDigest {
+		t.Errorf("MutateForce did not overwrite %s", src)
+	}
+	if _, err := crane.Mutate(src, crane.MutateUser("root")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := crane.Digest(src); err != nil {
+		t.Fatal(err)
+	} else if got != forced {
+		t.Errorf("Mutate without force overwrote %s", src)
+	}
+	if _, err := crane.Mutate(src, crane.MutateTag(src)); err == nil {
+		t.Error("Mutate to the same tag without force: expected error")
+	}
+}
+
+func TestCraneTarball(t *testing.T) {
+	t.Parallel()
+	// Write an image as a tarball.
+	tmp, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("test/crane@%s", digest)
+
+	if err := crane.Save(img, src, tmp.Name()); err != nil {
+		t.Errorf("Save: %v", err)
+	}
+
+	// Make sure the image we load has a matching digest.
+	img, err = crane.Load(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != digest {
+		t.Errorf("digest mismatch: %v != %v", d, digest)
+	}
+}
+
+func TestCranePushTarball(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/crane:stdin", u.Host)
+	tag, err := name.NewTag(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stream the tarball through a pipe, which can't be re-read.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tarball.Write(tag, img, pw))
+	}()
+
+	ref, err := crane.PushTarball(pr, dst)
+	if err != nil {
+		t.Fatalf("PushTarball: %v", err)
+	}
+	if want := tag.Context().Digest(digest.String()).String(); ref != want {
+		t.Errorf("PushTarball() = %s, want %s", ref, want)
+	}
+
+	pulled, err := crane.Pull(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(pulled); err != nil {
+		t.Errorf("validate.Image: %v", err)
+	}
+
+	// Broken input should fail without leaving a spooled tarball behind.
+	if _, err := crane.PushTarball(strings.NewReader("not a tarball"), dst); err == nil {
+		t.Error("PushTarball(garbage) = nil, want error")
+	}
+
+	// A regular file is read in place, from wherever it's positioned.
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prefix := "skipped"
+	if _, err := f.WriteString(prefix); err != nil {
+		t.Fatal(err)
+	}
+	if err := tarball.Write(tag, img, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(int64(len(prefix)), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if ref, err := crane.PushTarball(f, dst); err != nil {
+		t.Errorf("PushTarball(file): %v", err)
+	} else if want := tag.Context().Digest(digest.String()).String(); ref != want {
+		t.Errorf("PushTarball(file) = %s, want %s", ref, want)
+	}
+}
+
+func TestCranePullCacheDir(t *testing.T) {
+	t.Parallel()
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	isLayer := map[string]bool{}
+	for _, l := range layers {
+		digest, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		isLayer[digest.String()] = true
+	}
+
+	var layerGets int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && isLayer[path.Base(r.URL.Path)] {
+			atomic.AddInt32(&layerGets, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Populate registry so we can copy from it.
-	if err := remote.WriteIndex(ref, idx); err != nil {
+	src := fmt.Sprintf("%s/test/crane:cache", u.Host)
+	if err := crane.Push(img, src); err != nil {
 		t.Fatal(err)
 	}
 
-	if err := crane.Copy(src, dst, crane.WithPlatform(imgs[1].Platform)); err != nil {
-		t.Fatal(err)
+	dir := t.TempDir()
+	readLayers := func() {
+		t.Helper()
+		pulled, err := crane.Pull(src, crane.WithCacheDir(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers, err := pulled.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range layers {
+			rc, err := l.Compressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+				t.Fatal(err)
+			}
+			rc.Close()
+		}
 	}
 
-	want, err := crane.Manifest(src, crane.WithPlatform(imgs[1].Platform))
-	if err != nil {
-		t.Fatal(err)
+	readLayers()
+	if got, want := atomic.LoadInt32(&layerGets), int32(3); got != want {
+		t.Errorf("first pull: got %d blob GETs, want %d", got, want)
 	}
-	got, err := crane.Manifest(dst)
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if string(got) != string(want) {
-		t.Errorf("Manifest(%q) != Manifest(%q): (\n\n%s\n\n!=\n\n%s\n\n)", dst, src, string(got), string(want))
+	if got, want := len(files), 3; got != want {
+		t.Errorf("got %d cached files, want %d", got, want)
+	}
+	for _, fi := range files {
+		if strings.Contains(fi.Name(), ".lock") || strings.Contains(fi.Name(), ".tmp-") {
+			t.Errorf("unexpected file left in cache: %s", fi.Name())
+		}
 	}
 
-	arch := "real fake doors"
-
-	// Now do a fake platform, should fail
-	if _, err := crane.Manifest(src, crane.WithPlatform(&v1.Platform{
-		OS:           "does-not-exist",
-		Architecture: arch,
-	})); err == nil {
-		t.Error("crane.Manifest(fake platform): got nil want err")
-	} else if !strings.Contains(err.Error(), arch) {
-		t.Errorf("crane.Manifest(fake platform): expected %q in error, got: %v", arch, err)
+	// The second pull should read all the layers from the cache.
+	readLayers()
+	if got, want := atomic.LoadInt32(&layerGets), int32(3); got != want {
+		t.Errorf("second pull: got %d blob GETs, want %d", got, want)
 	}
 }
 
-func TestCraneTarball(t *testing.T) {
+func TestValidate(t *testing.T) {
 	t.Parallel()
-	// Write an image as a tarball.
-	tmp, err := ioutil.TempFile("", "")
+	img, err := random.Image(1024, 2)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(tmp.Name())
-
-	img, err := random.Image(1024, 5)
+	layers, err := img.Layers()
 	if err != nil {
 		t.Fatal(err)
 	}
-	digest, err := img.Digest()
+	digest, err := layers[0].Digest()
 	if err != nil {
 		t.Fatal(err)
 	}
-	src := fmt.Sprintf("test/crane@%s", digest)
 
-	if err := crane.Save(img, src, tmp.Name()); err != nil {
-		t.Errorf("Save: %v", err)
+	// Once corrupt is set, serve garbage for the first layer.
+	var corrupt int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&corrupt) != 0 && r.Method == http.MethodGet && path.Base(r.URL.Path) == digest.String() {
+			w.Write([]byte("garbage"))
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// Make sure the image we load has a matching digest.
-	img, err = crane.Load(tmp.Name())
+	src := fmt.Sprintf("%s/test/crane:validate", u.Host)
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Validate(src); err != nil {
+		t.Errorf("Validate(%s) = %v", src, err)
+	}
+
+	linux := v1.Platform{OS: "linux", Architecture: "amd64"}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add: img,
+		Descriptor: v1.Descriptor{
+			Platform: &linux,
+		},
+	})
+	ref, err := name.ParseReference(fmt.Sprintf("%s/test/crane:index", u.Host))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Validate(ref.String()); err != nil {
+		t.Errorf("Validate(%s) = %v", ref, err)
+	}
+	if err := crane.Validate(ref.String(), crane.WithPlatform(&linux)); err != nil {
+		t.Errorf("Validate(%s, %s) = %v", ref, linux, err)
+	}
+	other := v1.Platform{OS: "linux", Architecture: "arm64"}
+	if err := crane.Validate(ref.String(), crane.WithPlatform(&other)); err == nil {
+		t.Errorf("Validate(%s, %s) = nil, expected err", ref, other)
+	}
 
-	d, err := img.Digest()
+	// Images in an index must have a platform.
+	noPlatform := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+	ref, err = name.ParseReference(fmt.Sprintf("%s/test/crane:noplatform", u.Host))
 	if err != nil {
 		t.Fatal(err)
 	}
-	if d != digest {
-		t.Errorf("digest mismatch: %v != %v", d, digest)
+	if err := remote.WriteIndex(ref, noPlatform); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Validate(ref.String()); err == nil || !strings.Contains(err.Error(), "missing a platform") {
+		t.Errorf("Validate(%s) = %v, expected missing platform err", ref, err)
+	}
+
+	// Layer contents are only checked without FastValidation.
+	atomic.StoreInt32(&corrupt, 1)
+	if err := crane.Validate(src); err == nil {
+		t.Errorf("Validate(%s) with corrupt layer = nil, expected err", src)
+	}
+	if err := crane.Validate(src, crane.FastValidation); err != nil {
+		t.Errorf("Validate(%s, FastValidation) with corrupt layer = %v", src, err)
 	}
 }
 
@@ -518,6 +1228,278 @@ func TestStreamingAppend(t *testing.T) {
 	}
 }
 
+func TestConfigNormalized(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Push the same image twice, with only the volatile fields changed.
+	push := func(tag string, created time.Time, container string) string {
+		cf, err := base.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf = cf.DeepCopy()
+		cf.Created = v1.Time{Time: created}
+		cf.Container = container
+		cf.History = []v1.History{{
+			Created:   v1.Time{Time: created},
+			CreatedBy: "RUN make && make install",
+		}}
+		img, err := mutate.ConfigFile(base, cf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := fmt.Sprintf("%s/test/normalized:%s", u.Host, tag)
+		if err := crane.Push(img, ref); err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+	a := push("a", time.Unix(1000, 0).UTC(), "abc")
+	b := push("b", time.Unix(2000, 0).UTC(), "def")
+
+	rawA, err := crane.Config(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawB, err := crane.Config(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(rawA, rawB) {
+		t.Fatal("raw configs are equal, want them to differ")
+	}
+
+	normA, err := crane.ConfigNormalized(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normB, err := crane.ConfigNormalized(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(normA), string(normB)); diff != "" {
+		t.Errorf("ConfigNormalized() (-a +b): %s", diff)
+	}
+	for _, field := range []string{`"created"`, `"container"`} {
+		if bytes.Contains(normA, []byte(field)) {
+			t.Errorf("ConfigNormalized() = %s, want no %s field", normA, field)
+		}
+	}
+	if !bytes.Contains(normA, []byte("make && make install")) {
+		t.Errorf("ConfigNormalized() = %s, want unescaped history", normA)
+	}
+
+	// It's still the same config.
+	var got, want v1.ConfigFile
+	if err := json.Unmarshal(normA, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(rawA, &want); err != nil {
+		t.Fatal(err)
+	}
+	want.Created, want.Container, want.History[0].Created = v1.Time{}, "", v1.Time{}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ConfigNormalized() (-want +got): %s", diff)
+	}
+
+	keptA, err := crane.ConfigNormalized(a, crane.KeepTimestamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptB, err := crane.ConfigNormalized(b, crane.KeepTimestamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keptA, keptB) {
+		t.Errorf("ConfigNormalized(KeepTimestamps) = %s for both, want them to differ", keptA)
+	}
+	if n := bytes.Count(keptA, []byte(`"created"`)); n != 2 {
+		t.Errorf("ConfigNormalized(KeepTimestamps) has %d created fields, want 2", n)
+	}
+}
+
+func TestCopyStreamsLayers(t *testing.T) {
+	img, err := random.Image(1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The destination signals as soon as it starts receiving the layer, i.e.
+	// more than the config could account for.
+	receiving := make(chan struct{})
+	var once sync.Once
+	dstReg := registry.New()
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			r.Body = &signalReader{ReadCloser: r.Body, signal: func() { once.Do(func() { close(receiving) }) }}
+		}
+		dstReg.ServeHTTP(w, r)
+	}))
+	defer dst.Close()
+
+	// The source only sends the second half of the layer once the destination
+	// has seen the first half, which can't happen if Copy buffers the layer.
+	srcReg := registry.New()
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+digest.String()) {
+			srcReg.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		srcReg.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-receiving:
+		case <-time.After(5 * time.Second):
+			t.Error("destination didn't receive anything before the source finished")
+		}
+		w.Write(body[len(body)/2:])
+	}))
+	defer src.Close()
+
+	srcRef := strings.TrimPrefix(src.URL, "http://") + "/test/stream"
+	dstRef := strings.TrimPrefix(dst.URL, "http://") + "/test/stream"
+	if err := crane.Push(img, srcRef); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Copy(srcRef, dstRef); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := crane.Pull(dstRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compare.Images(img, copied); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signalReader calls signal once it has read more than 64KB.
+type signalReader struct {
+	io.ReadCloser
+	signal func()
+	count  int
+}
+
+func (r *signalReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += n
+	if r.count > 64*1024 {
+		r.signal()
+	}
+	return n, err
+}
+
+// bufferedImage reads each layer fully into memory before handing it to
+// remote.Write, to compare with streaming the layer straight through.
+type bufferedImage struct {
+	v1.Image
+}
+
+func (i *bufferedImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	buffered := make([]v1.Layer, 0, len(layers))
+	for _, l := range layers {
+		buffered = append(buffered, &bufferedLayer{l})
+	}
+	return buffered, nil
+}
+
+type bufferedLayer struct {
+	v1.Layer
+}
+
+func (l *bufferedLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func BenchmarkCopy(b *testing.B) {
+	const size = 50 * 1024 * 1024
+	img, err := random.Image(size, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	src := httptest.NewServer(registry.New())
+	defer src.Close()
+	srcRef := strings.TrimPrefix(src.URL, "http://") + "/test/copy"
+	if err := crane.Push(img, srcRef); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name string
+		copy func(dst string) error
+	}{{
+		name: "streaming",
+		copy: func(dst string) error {
+			return crane.Copy(srcRef, dst)
+		},
+	}, {
+		name: "buffered",
+		copy: func(dst string) error {
+			pulled, err := crane.Pull(srcRef)
+			if err != nil {
+				return err
+			}
+			return crane.Push(&bufferedImage{pulled}, dst)
+		},
+	}} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				// Use a new registry every time, so the layer is never already there.
+				b.StopTimer()
+				dst := httptest.NewServer(registry.New())
+				b.StartTimer()
+
+				if err := bc.copy(strings.TrimPrefix(dst.URL, "http://") + "/test/copy"); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				dst.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
 func TestBadInputs(t *testing.T) {
 	t.Parallel()
 	invalid := "/dev/null/@@@@@@"
@@ -558,11 +1540,16 @@ func TestBadInputs(t *testing.T) {
 		{"Optimize(404, invalid)", crane.Optimize(valid404, invalid, []string{})},
 		{"Optimize(404, 404)", crane.Optimize(valid404, valid404, []string{})},
 		// These return multiple values, which are hard to use as expressions.
+		{"Annotate(invalid)", e(crane.Annotate(invalid, nil, "tag"))},
+		{"Annotate(404)", e(crane.Annotate(valid404, nil, "tag"))},
+		{"Annotate(invalid tag)", e(crane.Annotate(valid404, nil, "in/valid:"))},
 		{"Pull(invalid)", e(crane.Pull(invalid))},
 		{"Digest(invalid)", e(crane.Digest(invalid))},
 		{"Manifest(invalid)", e(crane.Manifest(invalid))},
 		{"Config(invalid)", e(crane.Config(invalid))},
 		{"Config(404)", e(crane.Config(valid404))},
+		{"ConfigNormalized(invalid)", e(crane.ConfigNormalized(invalid))},
+		{"ConfigNormalized(404)", e(crane.ConfigNormalized(valid404))},
 		{"ListTags(invalid)", e(crane.ListTags(invalid))},
 		{"ListTags(404)", e(crane.ListTags(valid404))},
 		{"Append(_, invalid)", e(crane.Append(nil, invalid))},
@@ -577,3 +1564,111 @@ func TestBadInputs(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotate(t *testing.T) {
+	var blobGets int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			atomic.AddInt32(&blobGets, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.Annotations(img, map[string]string{"keep": "me", "drop": "me"}).(v1.Image)
+	src := fmt.Sprintf("%s/test/annotate", u.Host)
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := crane.Annotate(src, map[string]string{"new": "value", "drop": ""}, "annotated")
+	if err != nil {
+		t.Fatalf("Annotate: %v", err)
+	}
+	if n := atomic.LoadInt32(&blobGets); n != 0 {
+		t.Errorf("Annotate fetched %d blobs, want 0", n)
+	}
+
+	annotated, err := crane.Pull(src + ":annotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := annotated.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"keep": "me", "new": "value"}, m.Annotations); diff != "" {
+		t.Errorf("Annotations (-want +got): %s", diff)
+	}
+	if err := validate.Image(annotated); err != nil {
+		t.Errorf("validate.Image: %v", err)
+	}
+	if d, err := annotated.Digest(); err != nil {
+		t.Fatal(err)
+	} else if d != h {
+		t.Errorf("Annotate() = %s, want %s", h, d)
+	}
+
+	// The original tag is only overwritten with force.
+	if _, err := crane.Annotate(src, map[string]string{"new": "value"}, ""); err == nil {
+		t.Error("Annotate without force: expected error")
+	}
+	if _, err := crane.Annotate(src, map[string]string{"new": "value"}, "", crane.Force); err != nil {
+		t.Fatalf("Annotate with force: %v", err)
+	}
+	got, err := crane.Digest(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := crane.Digest(src + ":annotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == want {
+		t.Errorf("Annotate with force didn't overwrite %s", src)
+	}
+
+	// Annotating an index only annotates the index itself.
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idxRef := fmt.Sprintf("%s/test/annotate:index", u.Host)
+	ref, err := name.ParseReference(idxRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crane.Annotate(idxRef, map[string]string{"foo": "bar"}, "annotated-index"); err != nil {
+		t.Fatalf("Annotate index: %v", err)
+	}
+	annotatedIdx, err := remote.Index(ref.Context().Tag("annotated-index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := annotatedIdx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"foo": "bar"}, im.Annotations); diff != "" {
+		t.Errorf("index Annotations (-want +got): %s", diff)
+	}
+	orig, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(orig.Manifests, im.Manifests); diff != "" {
+		t.Errorf("index children changed (-want +got): %s", diff)
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// ImageDiff describes how one image differs from another, see Diff.
+type ImageDiff struct {
+	// Layers lists the differences between the layers of the images, by
+	// diff ID.
+	Layers LayerDiff
+
+	// Config lists the differences between the configs of the images.
+	Config ConfigDiff
+
+	// SizeDelta is how many bytes larger (or, if negative, smaller) the
+	// second image's layers and config blob are, compressed.
+	SizeDelta int64
+
+	// Files lists the differences between the flattened filesystems of the
+	// images. It's only populated when WithFileDiff is given.
+	Files *FileDiff
+}
+
+// LayerDiff compares the layers of two images, matching them up by diff ID.
+type LayerDiff struct {
+	// Changed are the layers that are present in both images, but differ.
+	Changed []LayerChange
+	// Added are the diff IDs of the layers that only the new image has.
+	Added []v1.Hash
+	// Removed are the diff IDs of the layers that only the old image has.
+	Removed []v1.Hash
+}
+
+// LayerChange is a layer that differs between two images.
+type LayerChange struct {
+	// Index is the position of the layer, which is the same in both images.
+	Index int
+	// Old and New are the diff IDs of the layer in each image.
+	Old, New v1.Hash
+}
+
+// ConfigDiff lists the differences between the configs of two images. Fields
+// that are the same in both are left empty.
+type ConfigDiff struct {
+	Env        MapDiff
+	Labels     MapDiff
+	Entrypoint *ListChange
+	Cmd        *ListChange
+	User       *ValueChange
+	WorkingDir *ValueChange
+}
+
+// MapDiff lists the differences between two sets of key/value pairs.
+type MapDiff struct {
+	Added   map[string]string
+	Removed map[string]string
+	Changed map[string]ValueChange
+}
+
+// ValueChange is a value that differs between two images.
+type ValueChange struct {
+	Old, New string
+}
+
+// ListChange is a list of values that differs between two images.
+type ListChange struct {
+	Old, New []string
+}
+
+// FileDiff lists the paths that differ between the filesystems of two images.
+type FileDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// WithFileDiff is an Option that makes Diff compare the flattened filesystems
+// of the images too, which requires downloading all of their layers.
+func WithFileDiff(o *Options) {
+	o.fileDiff = true
+}
+
+// Diff reports how the image at refB differs from the image at refA: which
+// layers and config fields changed, and by how much the size of the image
+// changed.
+//
+// Layers are compared by diff ID, so only the manifests and configs of the
+// images are fetched, unless WithFileDiff is given.
+func Diff(refA, refB string, opt ...Option) (*ImageDiff, error) {
+	o := makeOptions(opt...)
+	a, err := Pull(refA, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("pulling %s: %w", refA, err)
+	}
+	b, err := Pull(refB, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("pulling %s: %w", refB, err)
+	}
+	return diffImages(a, b, o.fileDiff)
+}
+
+func diffImages(a, b v1.Image, files bool) (*ImageDiff, error) {
+	cfgA, err := a.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfgB, err := b.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	sizeA, err := imageSize(a)
+	if err != nil {
+		return nil, err
+	}
+	sizeB, err := imageSize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ImageDiff{
+		Layers:    diffLayers(cfgA.RootFS.DiffIDs, cfgB.RootFS.DiffIDs),
+		SizeDelta: sizeB - sizeA,
+	}
+	if d.Config, err = diffConfigs(cfgA.Config, cfgB.Config); err != nil {
+		return nil, err
+	}
+
+	if files {
+		if reflect.DeepEqual(cfgA.RootFS.DiffIDs, cfgB.RootFS.DiffIDs) {
+			// Identical layers make for identical filesystems; don't bother
+			// downloading them.
+			d.Files = &FileDiff{}
+		} else if d.Files, err = diffFiles(a, b); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// imageSize returns the compressed size of img's layers and config blob.
+func imageSize(img v1.Image) (int64, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	size := m.Config.Size
+	for _, l := range m.Layers {
+		size += l.Size
+	}
+	return size, nil
+}
+
+// diffLayers aligns a and b on their longest common subsequence of diff IDs,
+// so that inserting or removing a layer doesn't make every layer after it look
+// changed. Unmatched layers at the same position in both images are reported
+// as changed; the rest are added or removed.
+func diffLayers(a, b []v1.Hash) LayerDiff {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var d LayerDiff
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && j < len(b) && i == j && lcs[i+1][j+1] == lcs[i][j]:
+			// Both layers at this position are unmatched, and skipping both
+			// keeps the alignment optimal.
+			d.Changed = append(d.Changed, LayerChange{Index: i, Old: a[i], New: b[j]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			d.Removed = append(d.Removed, a[i])
+			i++
+		default:
+			d.Added = append(d.Added, b[j])
+			j++
+		}
+	}
+	return d
+}
+
+func diffConfigs(a, b v1.Config) (ConfigDiff, error) {
+	envA, err := envMap(a.Env)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	envB, err := envMap(b.Env)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	d := ConfigDiff{
+		Env:        diffMaps(envA, envB),
+		Labels:     diffMaps(a.Labels, b.Labels),
+		Entrypoint: diffLists(a.Entrypoint, b.Entrypoint),
+		Cmd:        diffLists(a.Cmd, b.Cmd),
+		User:       diffValues(a.User, b.User),
+		WorkingDir: diffValues(a.WorkingDir, b.WorkingDir),
+	}
+	return d, nil
+}
+
+func envMap(env []string) (map[string]string, error) {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid key value pair in config: %s", kv)
+		}
+		m[split[0]] = split[1]
+	}
+	return m, nil
+}
+
+func diffMaps(a, b map[string]string) MapDiff {
+	var d MapDiff
+	for k, old := range a {
+		if n, ok := b[k]; !ok {
+			if d.Removed == nil {
+				d.Removed = map[string]string{}
+			}
+			d.Removed[k] = old
+		} else if n != old {
+			if d.Changed == nil {
+				d.Changed = map[string]ValueChange{}
+			}
+			d.Changed[k] = ValueChange{Old: old, New: n}
+		}
+	}
+	for k, n := range b {
+		if _, ok := a[k]; !ok {
+			if d.Added == nil {
+				d.Added = map[string]string{}
+			}
+			d.Added[k] = n
+		}
+	}
+	return d
+}
+
+func diffLists(a, b []string) *ListChange {
+	if len(a) == len(b) {
+		same := true
+		for i := range a {
+			if a[i] != b[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return nil
+		}
+	}
+	return &ListChange{Old: a, New: b}
+}
+
+func diffValues(a, b string) *ValueChange {
+	if a == b {
+		return nil
+	}
+	return &ValueChange{Old: a, New: b}
+}
+
+// fileEntry summarizes a file in a flattened filesystem, for comparison.
+type fileEntry struct {
+	typeflag byte
+	mode     int64
+	uid, gid int
+	linkname string
+	size     int64
+	digest   string
+}
+
+func diffFiles(a, b v1.Image) (*FileDiff, error) {
+	filesA, err := listFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := listFiles(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &FileDiff{}
+	for p, fa := range filesA {
+		if fb, ok := filesB[p]; !ok {
+			d.Removed = append(d.Removed, p)
+		} else if fa != fb {
+			d.Modified = append(d.Modified, p)
+		}
+	}
+	for p := range filesB {
+		if _, ok := filesA[p]; !ok {
+			d.Added = append(d.Added, p)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Modified)
+	return d, nil
+}
+
+// listFiles flattens img and summarizes each of the files in it.
+func listFiles(img v1.Image) (map[string]fileEntry, error) {
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	files := map[string]fileEntry{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		f := fileEntry{
+			typeflag: hdr.Typeflag,
+			mode:     hdr.Mode,
+			uid:      hdr.Uid,
+			gid:      hdr.Gid,
+			linkname: hdr.Linkname,
+			size:     hdr.Size,
+		}
+		if hdr.FileInfo().Mode().IsRegular() {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, err
+			}
+			f.digest = hex.EncodeToString(h.Sum(nil))
+		}
+		files[strings.TrimPrefix(hdr.Name, "./")] = f
+	}
+}
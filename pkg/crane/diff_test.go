@@ -0,0 +1,187 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func TestDiff(t *testing.T) {
+	var blobGets int32
+	handler := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			atomic.AddInt32(&blobGets, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := crane.Layer(map[string][]byte{
+		"etc/os-release": []byte("base"),
+		"bin/sh":         []byte("shell"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldApp, err := crane.Layer(map[string][]byte{
+		"app/main":   []byte("v1"),
+		"app/legacy": []byte("old"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newApp, err := crane.Layer(map[string][]byte{
+		"app/main": []byte("v2"),
+		"app/new":  []byte("new"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := crane.Layer(map[string][]byte{
+		"etc/config": []byte("extra"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := func(cfg v1.Config, layers ...v1.Layer) v1.Image {
+		t.Helper()
+		img, err := mutate.AppendLayers(empty.Image, layers...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err = mutate.Config(img, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	a := img(v1.Config{
+		Env:        []string{"PATH=/bin", "DEBUG=1"},
+		Labels:     map[string]string{"version": "1", "team": "a"},
+		Entrypoint: []string{"/app/main"},
+		User:       "root",
+	}, base, oldApp)
+	b := img(v1.Config{
+		Env:        []string{"PATH=/bin:/app", "NEW=yes"},
+		Labels:     map[string]string{"version": "2", "team": "a"},
+		Entrypoint: []string{"/app/main"},
+		User:       "nobody",
+	}, base, newApp, extra)
+
+	refA := fmt.Sprintf("%s/test/diff:a", u.Host)
+	refB := fmt.Sprintf("%s/test/diff:b", u.Host)
+	if err := crane.Push(a, refA); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(b, refB); err != nil {
+		t.Fatal(err)
+	}
+	diffID := func(l v1.Layer) v1.Hash {
+		t.Helper()
+		h, err := l.DiffID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	atomic.StoreInt32(&blobGets, 0)
+	d, err := crane.Diff(refA, refB)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	// Only the two config blobs should have been fetched.
+	if got := atomic.LoadInt32(&blobGets); got != 2 {
+		t.Errorf("Diff fetched %d blobs, want 2", got)
+	}
+	if d.Files != nil {
+		t.Errorf("Files = %v, want nil without WithFileDiff", d.Files)
+	}
+
+	wantLayers := crane.LayerDiff{
+		Changed: []crane.LayerChange{{Index: 1, Old: diffID(oldApp), New: diffID(newApp)}},
+		Added:   []v1.Hash{diffID(extra)},
+	}
+	if diff := cmp.Diff(wantLayers, d.Layers); diff != "" {
+		t.Errorf("Layers (-want +got): %s", diff)
+	}
+	wantConfig := crane.ConfigDiff{
+		Env: crane.MapDiff{
+			Added:   map[string]string{"NEW": "yes"},
+			Removed: map[string]string{"DEBUG": "1"},
+			Changed: map[string]crane.ValueChange{"PATH": {Old: "/bin", New: "/bin:/app"}},
+		},
+		Labels: crane.MapDiff{
+			Changed: map[string]crane.ValueChange{"version": {Old: "1", New: "2"}},
+		},
+		User: &crane.ValueChange{Old: "root", New: "nobody"},
+	}
+	if diff := cmp.Diff(wantConfig, d.Config); diff != "" {
+		t.Errorf("Config (-want +got): %s", diff)
+	}
+	extraSize, err := extra.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SizeDelta < extraSize {
+		t.Errorf("SizeDelta = %d, want at least the size of the added layer (%d)", d.SizeDelta, extraSize)
+	}
+
+	d, err = crane.Diff(refA, refB, crane.WithFileDiff)
+	if err != nil {
+		t.Fatalf("Diff(WithFileDiff): %v", err)
+	}
+	wantFiles := &crane.FileDiff{
+		Added:    []string{"app/new", "etc/config"},
+		Removed:  []string{"app/legacy"},
+		Modified: []string{"app/main"},
+	}
+	if diff := cmp.Diff(wantFiles, d.Files); diff != "" {
+		t.Errorf("Files (-want +got): %s", diff)
+	}
+
+	// Comparing an image with itself finds no differences, without
+	// downloading any layers.
+	atomic.StoreInt32(&blobGets, 0)
+	d, err = crane.Diff(refA, refA, crane.WithFileDiff)
+	if err != nil {
+		t.Fatalf("Diff(same): %v", err)
+	}
+	if diff := cmp.Diff(&crane.ImageDiff{Files: &crane.FileDiff{}}, d); diff != "" {
+		t.Errorf("Diff(same) (-want +got): %s", diff)
+	}
+	if got := atomic.LoadInt32(&blobGets); got != 2 {
+		t.Errorf("Diff(same) fetched %d blobs, want 2", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestDiffLayers(t *testing.T) {
+	h := func(s string) v1.Hash {
+		return v1.Hash{Algorithm: "sha256", Hex: s}
+	}
+	x, y, z, n := h("x"), h("y"), h("z"), h("n")
+	for _, tc := range []struct {
+		name string
+		a, b []v1.Hash
+		want LayerDiff
+	}{{
+		name: "same",
+		a:    []v1.Hash{x, y},
+		b:    []v1.Hash{x, y},
+	}, {
+		name: "appended",
+		a:    []v1.Hash{x},
+		b:    []v1.Hash{x, y},
+		want: LayerDiff{Added: []v1.Hash{y}},
+	}, {
+		name: "inserted",
+		a:    []v1.Hash{x, y, z},
+		b:    []v1.Hash{x, n, y, z},
+		want: LayerDiff{Added: []v1.Hash{n}},
+	}, {
+		name: "removed",
+		a:    []v1.Hash{x, y, z},
+		b:    []v1.Hash{y, z},
+		want: LayerDiff{Removed: []v1.Hash{x}},
+	}, {
+		name: "changed",
+		a:    []v1.Hash{x, y, z},
+		b:    []v1.Hash{x, n, z},
+		want: LayerDiff{Changed: []LayerChange{{Index: 1, Old: y, New: n}}},
+	}, {
+		name: "changed and removed",
+		a:    []v1.Hash{x, y, z},
+		b:    []v1.Hash{n},
+		want: LayerDiff{
+			Changed: []LayerChange{{Index: 0, Old: x, New: n}},
+			Removed: []v1.Hash{y, z},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := diffLayers(tc.a, tc.b)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("diffLayers (-want +got): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Index pulls each of the images referenced by children, assembles them into
+// an OCI image index, and pushes it to dst.
+//
+// The platform of each child is read from its config file, unless it has been
+// overridden with WithChildPlatform. By default, it is an error for two
+// children to have the same platform; see AllowDuplicatePlatforms.
+func Index(children []string, dst string, opt ...Option) error {
+	o := makeOptions(opt...)
+	dstRef, err := name.ParseReference(dst, o.Name...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %w", dst, err)
+	}
+
+	adds := make([]mutate.IndexAddendum, 0, len(children))
+	seen := map[string]string{}
+	for _, child := range children {
+		ref, err := name.ParseReference(child, o.Name...)
+		if err != nil {
+			return fmt.Errorf("parsing reference %q: %w", child, err)
+		}
+		img, err := remote.Image(ref, o.Remote...)
+		if err != nil {
+			return fmt.Errorf("reading image %q: %w", child, err)
+		}
+
+		platform, ok := o.childPlatforms[child]
+		if !ok {
+			cf, err := img.ConfigFile()
+			if err != nil {
+				return fmt.Errorf("reading config for %q: %w", child, err)
+			}
+			platform = v1.Platform{
+				OS:           cf.OS,
+				Architecture: cf.Architecture,
+				OSVersion:    cf.OSVersion,
+			}
+		}
+
+		if prev, ok := seen[platform.String()]; ok && !o.allowDuplicatePlatforms {
+			return fmt.Errorf("%q and %q have the same platform %q", prev, child, platform.String())
+		}
+		seen[platform.String()] = child
+
+		logs.Progress.Printf("Adding %v (%s) to index", ref, platform.String())
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &platform,
+			},
+		})
+	}
+
+	idx := mutate.AppendManifests(empty.Index, adds...)
+	return remote.MultiWrite(map[name.Reference]remote.Taggable{dstRef: idx}, o.Remote...)
+}
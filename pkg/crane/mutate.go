@@ -0,0 +1,325 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+type mutateOptions struct {
+	opts []Option
+
+	entrypoint    []string
+	cmd           []string
+	env           map[string]string
+	labels        map[string]string
+	annotations   map[string]string
+	user          *string
+	workdir       *string
+	layers        []string
+	replaceEnv    bool
+	replaceLabels bool
+
+	dst   string
+	force bool
+}
+
+// MutateOption is a functional option for Mutate.
+type MutateOption func(*mutateOptions)
+
+// MutateWithOptions passes the given crane options through to the pull and
+// push performed by Mutate.
+func MutateWithOptions(opt ...Option) MutateOption {
+	return func(o *mutateOptions) {
+		o.opts = append(o.opts, opt...)
+	}
+}
+
+// MutateEntrypoint sets the entrypoint of the image. As with Docker, this also
+// clears the cmd unless MutateCmd is given as well.
+func MutateEntrypoint(entrypoint ...string) MutateOption {
+	return func(o *mutateOptions) {
+		o.entrypoint = entrypoint
+	}
+}
+
+// MutateCmd sets the cmd of the image.
+func MutateCmd(cmd ...string) MutateOption {
+	return func(o *mutateOptions) {
+		o.cmd = cmd
+	}
+}
+
+// MutateEnv sets the given environment variables, keeping any existing ones
+// unless MutateReplaceEnv is also given.
+func MutateEnv(env map[string]string) MutateOption {
+	return func(o *mutateOptions) {
+		if o.env == nil {
+			o.env = map[string]string{}
+		}
+		for k, v := range env {
+			o.env[k] = v
+		}
+	}
+}
+
+// MutateLabels sets the given labels, keeping any existing ones unless
+// MutateReplaceLabels is also given. Labels can be set to an empty value.
+func MutateLabels(labels map[string]string) MutateOption {
+	return func(o *mutateOptions) {
+		if o.labels == nil {
+			o.labels = map[string]string{}
+		}
+		for k, v := range labels {
+			o.labels[k] = v
+		}
+	}
+}
+
+// MutateAnnotations sets the given annotations on the image manifest. An empty
+// value is passed through to mutate.Annotations, which removes that annotation.
+func MutateAnnotations(annotations map[string]string) MutateOption {
+	return func(o *mutateOptions) {
+		if o.annotations == nil {
+			o.annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			o.annotations[k] = v
+		}
+	}
+}
+
+// MutateUser sets the user the image runs as.
+func MutateUser(user string) MutateOption {
+	return func(o *mutateOptions) {
+		o.user = &user
+	}
+}
+
+// MutateWorkdir sets the working directory of the image.
+func MutateWorkdir(dir string) MutateOption {
+	return func(o *mutateOptions) {
+		o.workdir = &dir
+	}
+}
+
+// MutateAppend appends the tarballs at the given paths as new layers, see
+// Append.
+func MutateAppend(paths ...string) MutateOption {
+	return func(o *mutateOptions) {
+		o.layers = append(o.layers, paths...)
+	}
+}
+
+// MutateReplaceEnv replaces the environment of the image with the variables
+// given via MutateEnv, rather than adding to it.
+func MutateReplaceEnv(o *mutateOptions) {
+	o.replaceEnv = true
+}
+
+// MutateReplaceLabels replaces the labels of the image with the labels given
+// via MutateLabels, rather than adding to them.
+func MutateReplaceLabels(o *mutateOptions) {
+	o.replaceLabels = true
+}
+
+// MutateTag pushes the mutated image to dst instead of the original
+// reference.
+func MutateTag(dst string) MutateOption {
+	return func(o *mutateOptions) {
+		o.dst = dst
+	}
+}
+
+// MutateForce allows Mutate to overwrite the tag it read the image from.
+// Without it, the mutated image is pushed by digest when no other destination
+// is given.
+func MutateForce(o *mutateOptions) {
+	o.force = true
+}
+
+// Mutate pulls ref, applies all the given config and manifest edits in one go,
+// and pushes the result. It returns the digest reference of the pushed image.
+//
+// By default, the image is pushed by digest to the repository of ref. Use
+// MutateTag to push to a different tag, and MutateForce to overwrite the tag
+// of ref itself.
+func Mutate(ref string, opts ...MutateOption) (string, error) {
+	mo := &mutateOptions{}
+	for _, opt := range opts {
+		opt(mo)
+	}
+	o := makeOptions(mo.opts...)
+
+	src, err := name.ParseReference(ref, o.Name...)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %w", ref, err)
+	}
+	if err := validateKeyVals(mo.labels); err != nil {
+		return "", err
+	}
+	if err := validateKeyVals(mo.annotations); err != nil {
+		return "", err
+	}
+
+	dst := src
+	if mo.dst != "" {
+		dst, err = name.ParseReference(mo.dst, o.Name...)
+		if err != nil {
+			return "", fmt.Errorf("parsing reference %q: %w", mo.dst, err)
+		}
+	}
+	if _, ok := dst.(name.Tag); ok && dst.Name() == src.Name() && !mo.force {
+		if mo.dst != "" {
+			return "", fmt.Errorf("refusing to overwrite %q without force", dst)
+		}
+		// Push by digest instead, which can't clobber anything.
+		dst = nil
+	}
+
+	if len(mo.annotations) != 0 {
+		desc, err := Head(ref, mo.opts...)
+		if err != nil {
+			return "", err
+		}
+		if desc.MediaType.IsIndex() {
+			return "", errors.New("mutating annotations on an index is not yet supported")
+		}
+	}
+
+	img, err := Pull(ref, mo.opts...)
+	if err != nil {
+		return "", fmt.Errorf("pulling %s: %w", ref, err)
+	}
+	if len(mo.layers) != 0 {
+		img, err = Append(img, mo.layers...)
+		if err != nil {
+			return "", fmt.Errorf("appending %v: %w", mo.layers, err)
+		}
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	cfg = cfg.DeepCopy()
+
+	if mo.replaceLabels {
+		cfg.Config.Labels = map[string]string{}
+	} else if cfg.Config.Labels == nil && len(mo.labels) != 0 {
+		cfg.Config.Labels = map[string]string{}
+	}
+	for k, v := range mo.labels {
+		cfg.Config.Labels[k] = v
+	}
+
+	if mo.replaceEnv {
+		cfg.Config.Env = nil
+	}
+	if err := setEnvVars(cfg, mo.env); err != nil {
+		return "", err
+	}
+
+	if len(mo.entrypoint) > 0 {
+		cfg.Config.Entrypoint = mo.entrypoint
+		cfg.Config.Cmd = nil // This matches Docker's behavior.
+	}
+	if len(mo.cmd) > 0 {
+		cfg.Config.Cmd = mo.cmd
+	}
+	if mo.user != nil {
+		cfg.Config.User = *mo.user
+	}
+	if mo.workdir != nil {
+		cfg.Config.WorkingDir = *mo.workdir
+	}
+
+	img, err = mutate.Config(img, cfg.Config)
+	if err != nil {
+		return "", fmt.Errorf("mutating config: %w", err)
+	}
+	if len(mo.annotations) != 0 {
+		img = mutate.Annotations(img, mo.annotations).(v1.Image)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("digesting new image: %w", err)
+	}
+	// If we aren't pushing to a tag, e.g. because the original ref was provided
+	// by digest, push the mutated image by its new digest instead.
+	if _, ok := dst.(name.Tag); !ok {
+		dst = src.Context().Digest(digest.String())
+	}
+	if err := Push(img, dst.String(), mo.opts...); err != nil {
+		return "", fmt.Errorf("pushing %s: %w", dst, err)
+	}
+	return dst.Context().Digest(digest.String()).String(), nil
+}
+
+// validateKeyVals ensures no keys are empty, returns error if they are. Empty
+// values are fine, e.g. "k=" sets k to "".
+func validateKeyVals(kvPairs map[string]string) error {
+	for key, value := range kvPairs {
+		if key == "" {
+			return fmt.Errorf("parsing %q, key is empty", "="+value)
+		}
+	}
+	return nil
+}
+
+// setEnvVars override envvars in a config
+func setEnvVars(cfg *v1.ConfigFile, envVars map[string]string) error {
+	newEnv := make([]string, 0, len(cfg.Config.Env))
+	seen := map[string]bool{}
+	for _, old := range cfg.Config.Env {
+		split := strings.SplitN(old, "=", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("invalid key value pair in config: %s", old)
+		}
+		// keep order so override if specified again
+		oldKey := split[0]
+		if v, ok := envVars[oldKey]; ok {
+			newEnv = append(newEnv, fmt.Sprintf("%s=%s", oldKey, v))
+			seen[oldKey] = true
+		} else {
+			newEnv = append(newEnv, old)
+		}
+	}
+	keys := make([]string, 0, len(envVars))
+	for k := range envVars {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	isWindows := cfg.OS == "windows"
+	for _, k := range keys {
+		v := envVars[k]
+		if isWindows {
+			k = strings.ToUpper(k)
+		}
+		newEnv = append(newEnv, fmt.Sprintf("%s=%s", k, v))
+	}
+	cfg.Config.Env = newEnv
+	return nil
+}
@@ -29,6 +29,15 @@ type Options struct {
 	Name     []name.Option
 	Remote   []remote.Option
 	Platform *v1.Platform
+
+	allowDuplicatePlatforms bool
+	childPlatforms          map[string]v1.Platform
+	checkpoint              string
+	fileDiff                bool
+	cacheDir                string
+	fastValidation          bool
+	keepTimestamps          bool
+	force                   bool
 }
 
 // GetOptions exposes the underlying []remote.Option, []name.Option, and
@@ -114,3 +123,20 @@ func WithContext(ctx context.Context) Option {
 		o.Remote = append(o.Remote, remote.WithContext(ctx))
 	}
 }
+
+// AllowDuplicatePlatforms is an Option that allows Index to create an index
+// containing more than one image with the same platform.
+func AllowDuplicatePlatforms(o *Options) {
+	o.allowDuplicatePlatforms = true
+}
+
+// WithChildPlatform is an Option for Index that overrides the platform of the
+// image referenced by child, instead of reading it from the image's config.
+func WithChildPlatform(child string, platform v1.Platform) Option {
+	return func(o *Options) {
+		if o.childPlatforms == nil {
+			o.childPlatforms = map[string]v1.Platform{}
+		}
+		o.childPlatforms[child] = platform
+	}
+}
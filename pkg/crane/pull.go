@@ -21,6 +21,7 @@ import (
 	legacy "github.com/google/go-containerregistry/pkg/legacy/tarball"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
@@ -32,6 +33,18 @@ import (
 // ":latest" tag which might be misleading.
 const iWasADigestTag = "i-was-a-digest"
 
+// WithCacheDir is an Option for Pull that caches the layers of pulled images
+// in dir, keyed by digest, see cache.NewFilesystemCache. Layers that are
+// already in the cache are read from there instead of the registry, so images
+// that share base layers only download them once.
+//
+// The cache directory can be shared by concurrent crane invocations.
+func WithCacheDir(dir string) Option {
+	return func(o *Options) {
+		o.cacheDir = dir
+	}
+}
+
 // Pull returns a v1.Image of the remote image src.
 func Pull(src string, opt ...Option) (v1.Image, error) {
 	o := makeOptions(opt...)
@@ -40,7 +53,14 @@ func Pull(src string, opt ...Option) (v1.Image, error) {
 		return nil, fmt.Errorf("parsing reference %q: %w", src, err)
 	}
 
-	return remote.Image(ref, o.Remote...)
+	img, err := remote.Image(ref, o.Remote...)
+	if err != nil {
+		return nil, err
+	}
+	if o.cacheDir != "" {
+		img = cache.Image(img, cache.NewFilesystemCache(o.cacheDir))
+	}
+	return img, nil
 }
 
 // Save writes the v1.Image img as a tarball at path with tag src.
@@ -64,13 +84,16 @@ func MultiSave(imgMap map[string]v1.Image, path string, opt ...Option) error {
 		// been given a digest.
 		// If the original ref was a tag, use that. Otherwise, if it was a
 		// digest, tag the image with :i-was-a-digest instead.
-		tag, ok := ref.(name.Tag)
-		if !ok {
-			d, ok := ref.(name.Digest)
-			if !ok {
-				return fmt.Errorf("ref wasn't a tag or digest")
-			}
-			tag = d.Repository.Tag(iWasADigestTag)
+		var tag name.Tag
+		switch r := ref.(type) {
+		case name.Tag:
+			tag = r
+		case name.TaggedDigest:
+			tag = r.Tag()
+		case name.Digest:
+			tag = r.Repository.Tag(iWasADigestTag)
+		default:
+			return fmt.Errorf("ref wasn't a tag or digest")
 		}
 		tagToImage[tag] = img
 	}
@@ -16,6 +16,9 @@ package crane
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -53,6 +56,78 @@ func Push(img v1.Image, dst string, opt ...Option) error {
 	return remote.Write(tag, img, o.Remote...)
 }
 
+// PushTarball pushes the `docker save` style tarball read from r to a registry
+// as dst, returning the digest reference of the pushed image. This allows
+// pushing straight from a pipe, e.g. `docker save foo | crane push - dst`.
+//
+// Reading an image from a tarball needs random access to re-read its layers,
+// so unless r is a regular file, it's first spooled to a temporary file in
+// os.TempDir(). That keeps memory usage constant at the cost of needing as
+// much free disk as the tarball is large. The temporary file is removed before
+// PushTarball returns, even on failure.
+func PushTarball(r io.Reader, dst string, opt ...Option) (string, error) {
+	o := makeOptions(opt...)
+	ref, err := name.ParseReference(dst, o.Name...)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %w", dst, err)
+	}
+
+	opener, cleanup, err := spool(r)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	img, err := tarball.Image(opener, nil)
+	if err != nil {
+		return "", fmt.Errorf("loading tarball: %w", err)
+	}
+	if err := remote.Write(ref, img, o.Remote...); err != nil {
+		return "", err
+	}
+	h, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	return ref.Context().Digest(h.String()).String(), nil
+}
+
+// spool returns an opener from which the contents of r can be re-read. The
+// rest of a regular file is read in place; anything else is copied to a
+// temporary file, which cleanup removes.
+func spool(r io.Reader) (opener tarball.Opener, cleanup func(), err error) {
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			if offset, err := f.Seek(0, io.SeekCurrent); err == nil {
+				return sectionOpener(f, offset, fi.Size()-offset), func() {}, nil
+			}
+		}
+	}
+
+	tmp, err := ioutil.TempFile("", "crane-tarball-*.tar")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("spooling tarball to %s: %w", tmp.Name(), err)
+	}
+	return sectionOpener(tmp, 0, n), cleanup, nil
+}
+
+// sectionOpener returns an opener for the size bytes of f starting at offset.
+// Since they read f with ReadAt, the readers it opens can be used concurrently.
+func sectionOpener(f *os.File, offset, size int64) tarball.Opener {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(f, offset, size)), nil
+	}
+}
+
 // Upload pushes the v1.Layer to a given repo.
 func Upload(layer v1.Layer, repo string, opt ...Option) error {
 	o := makeOptions(opt...)
@@ -16,24 +16,40 @@ package crane
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 // Tag adds tag to the remote img.
+//
+// Only the manifest of img is fetched and pushed again under tag, so no blobs
+// are downloaded. tag may also be a full reference in another repository, in
+// which case Tag behaves like Copy, mounting blobs from the repository of img
+// where the registry supports it.
 func Tag(img, tag string, opt ...Option) error {
 	o := makeOptions(opt...)
 	ref, err := name.ParseReference(img, o.Name...)
 	if err != nil {
 		return fmt.Errorf("parsing reference %q: %w", img, err)
 	}
+
+	dst := ref.Context().Tag(tag)
+	// Tags can't contain these, so tag must be a full reference.
+	if strings.ContainsAny(tag, "/:") {
+		if dst, err = name.NewTag(tag, o.Name...); err != nil {
+			return fmt.Errorf("parsing reference %q: %w", tag, err)
+		}
+		if dst.Context().String() != ref.Context().String() {
+			return Copy(img, tag, opt...)
+		}
+	}
+
 	desc, err := remote.Get(ref, o.Remote...)
 	if err != nil {
 		return fmt.Errorf("fetching %q: %w", img, err)
 	}
 
-	dst := ref.Context().Tag(tag)
-
 	return remote.Tag(dst, desc, o.Remote...)
 }
@@ -0,0 +1,148 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+// The kinds of image source returned by ParseURI.
+const (
+	// URIRegistry is an image in a registry, see Pull.
+	URIRegistry = "registry"
+	// URIDaemon is an image in the local docker daemon, see pkg/v1/daemon.
+	URIDaemon = "docker-daemon"
+	// URILayout is an image in an OCI image layout directory, see pkg/v1/layout.
+	URILayout = "oci-layout"
+	// URITarball is an image in a `docker save` style tarball, see Load.
+	URITarball = "tarball"
+)
+
+// uriSchemes maps the supported (skopeo-style) transport prefixes to the kind
+// of source they refer to.
+var uriSchemes = []struct {
+	prefix string
+	kind   string
+}{
+	{"docker://", URIRegistry},
+	{"registry://", URIRegistry},
+	{"docker-daemon:", URIDaemon},
+	{"oci-layout:", URILayout},
+	{"oci://", URILayout},
+	{"oci:", URILayout},
+	{"tarball:", URITarball},
+	{"docker-archive:", URITarball},
+}
+
+// ParseURI splits an image source URI into the kind of source it refers to
+// (one of URIRegistry, URIDaemon, URILayout or URITarball) and the remaining
+// reference, which is an image reference for the registry and daemon and a
+// path, optionally followed by ":<name>", for layouts and tarballs.
+//
+// A uri without a recognized prefix is treated as a registry reference.
+func ParseURI(uri string) (kind, ref string, err error) {
+	for _, s := range uriSchemes {
+		if strings.HasPrefix(uri, s.prefix) {
+			kind, ref = s.kind, strings.TrimPrefix(uri, s.prefix)
+			break
+		}
+	}
+	if kind == "" {
+		if i := strings.Index(uri, "://"); i != -1 {
+			return "", "", fmt.Errorf("unsupported scheme %q in %q", uri[:i], uri)
+		}
+		kind, ref = URIRegistry, uri
+	}
+	if ref == "" {
+		return "", "", fmt.Errorf("missing reference in %q", uri)
+	}
+	return kind, ref, nil
+}
+
+// PullURI returns the v1.Image referred to by uri, see ParseURI. Images in the
+// docker daemon aren't supported by crane; use pkg/v1/daemon for those.
+func PullURI(uri string, opt ...Option) (v1.Image, error) {
+	kind, ref, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case URIRegistry:
+		return Pull(ref, opt...)
+	case URITarball:
+		path, tag := splitPathName(ref)
+		return LoadTag(path, tag, opt...)
+	case URILayout:
+		path, name := splitPathName(ref)
+		return loadLayout(path, name)
+	default:
+		return nil, fmt.Errorf("pulling from %s is not supported by crane", kind)
+	}
+}
+
+// splitPathName splits "path:name" at the first colon, since names (e.g.
+// tags) can contain colons of their own. A Windows drive letter, as in
+// "C:\image.tar", isn't treated as a separator.
+func splitPathName(ref string) (path, name string) {
+	start := 0
+	if len(ref) > 2 && ref[1] == ':' && (ref[2] == '\\' || ref[2] == '/') {
+		start = 2
+	}
+	i := strings.Index(ref[start:], ":")
+	if i == -1 {
+		return ref, ""
+	}
+	return ref[:start+i], ref[start+i+1:]
+}
+
+// loadLayout returns the image in the layout at path with the given name, or
+// the only image in the layout if name is empty.
+func loadLayout(path, name string) (v1.Image, error) {
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	matcher := func(desc v1.Descriptor) bool {
+		if !desc.MediaType.IsImage() {
+			return false
+		}
+		return name == "" || match.Name(name)(desc) || match.Annotation("dev.ggcr.image.name", name)(desc)
+	}
+	imgs, err := partial.FindImages(idx, matcher)
+	if err != nil {
+		return nil, err
+	}
+	switch len(imgs) {
+	case 0:
+		if name == "" {
+			return nil, fmt.Errorf("no images found in layout %s", path)
+		}
+		return nil, fmt.Errorf("no image named %q in layout %s", name, path)
+	case 1:
+		return imgs[0], nil
+	default:
+		return nil, fmt.Errorf("multiple matching images in layout %s, specify one with <path>:<name>", path)
+	}
+}
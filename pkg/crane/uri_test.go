@@ -0,0 +1,105 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestParseURI(t *testing.T) {
+	for _, tc := range []struct {
+		uri     string
+		kind    string
+		ref     string
+		wantErr bool
+	}{
+		{uri: "ubuntu", kind: URIRegistry, ref: "ubuntu"},
+		{uri: "localhost:5000/foo:bar", kind: URIRegistry, ref: "localhost:5000/foo:bar"},
+		{uri: "docker://gcr.io/foo/bar", kind: URIRegistry, ref: "gcr.io/foo/bar"},
+		{uri: "registry://gcr.io/foo/bar", kind: URIRegistry, ref: "gcr.io/foo/bar"},
+		{uri: "docker-daemon:busybox:latest", kind: URIDaemon, ref: "busybox:latest"},
+		{uri: "oci-layout:/tmp/layout", kind: URILayout, ref: "/tmp/layout"},
+		{uri: "oci:/tmp/layout:v1", kind: URILayout, ref: "/tmp/layout:v1"},
+		{uri: "oci:///tmp/layout", kind: URILayout, ref: "/tmp/layout"},
+		{uri: "tarball:image.tar", kind: URITarball, ref: "image.tar"},
+		{uri: "docker-archive:image.tar", kind: URITarball, ref: "image.tar"},
+		{uri: "ftp://example.com/image", wantErr: true},
+		{uri: "tarball:", wantErr: true},
+		{uri: "", wantErr: true},
+	} {
+		t.Run(tc.uri, func(t *testing.T) {
+			kind, ref, err := ParseURI(tc.uri)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseURI(%q) = %v, wantErr %t", tc.uri, err, tc.wantErr)
+			}
+			if kind != tc.kind || ref != tc.ref {
+				t.Errorf("ParseURI(%q) = (%q, %q), want (%q, %q)", tc.uri, kind, ref, tc.kind, tc.ref)
+			}
+		})
+	}
+}
+
+func TestPullURI(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "image.tar")
+	if err := Save(img, "example.com/foo:bar", path); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tmp, "layout")
+	if err := MultiSaveOCI(map[string]v1.Image{"example.com/foo:bar": img}, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uri := range []string{
+		"tarball:" + path,
+		"docker-archive:" + path + ":example.com/foo:bar",
+		"oci:" + dir,
+		"oci-layout:" + dir + ":example.com/foo:bar",
+	} {
+		t.Run(uri, func(t *testing.T) {
+			got, err := PullURI(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := got.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != want {
+				t.Errorf("PullURI(%q) digest = %s, want %s", uri, d, want)
+			}
+		})
+	}
+
+	if _, err := PullURI("docker-daemon:busybox"); err == nil {
+		t.Error("PullURI(docker-daemon:) = nil, wanted error")
+	}
+	if _, err := PullURI("oci:" + dir + ":missing"); err == nil {
+		t.Error("PullURI() with missing name = nil, wanted error")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// FastValidation is an Option for Validate that only checks metadata, i.e.
+// manifests and configs, and skips downloading and digesting layers.
+func FastValidation(o *Options) {
+	o.fastValidation = true
+}
+
+// Validate pulls the image or index referenced by ref and checks that it's
+// well-formed, see validate.Image and validate.Index. For indexes, it also
+// checks that every image has a platform.
+//
+// If a platform is given with WithPlatform and ref is an index, only the
+// image for that platform is validated.
+func Validate(ref string, opt ...Option) error {
+	o := makeOptions(opt...)
+	r, err := name.ParseReference(ref, o.Name...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %w", ref, err)
+	}
+	desc, err := remote.Get(r, o.Remote...)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", ref, err)
+	}
+
+	vopt := []validate.Option{}
+	if o.fastValidation {
+		vopt = append(vopt, validate.Fast)
+	}
+
+	if desc.MediaType.IsIndex() && o.Platform == nil {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return fmt.Errorf("reading index %s: %w", ref, err)
+		}
+		errs := []string{}
+		if err := validate.Index(idx, vopt...); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if err := validatePlatforms(idx); err != nil {
+			errs = append(errs, fmt.Sprintf("validating platforms: %v", err))
+		}
+		if len(errs) != 0 {
+			return fmt.Errorf("validating index %s: %s", ref, strings.Join(errs, "\n\n"))
+		}
+		return nil
+	}
+
+	// This resolves an index to the image for the given platform.
+	img, err := desc.Image()
+	if err != nil {
+		return fmt.Errorf("reading image %s: %w", ref, err)
+	}
+	if err := validate.Image(img, vopt...); err != nil {
+		return fmt.Errorf("validating image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// validatePlatforms checks that every image in idx, and in any child indexes,
+// has a platform in its descriptor.
+func validatePlatforms(idx v1.ImageIndex) error {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	errs := []string{}
+	for i, desc := range im.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := validatePlatforms(child); err != nil {
+				errs = append(errs, fmt.Sprintf("index Manifests[%d](%s): %v", i, desc.Digest, err))
+			}
+		case desc.MediaType.IsImage():
+			if desc.Platform == nil {
+				errs = append(errs, fmt.Sprintf("image Manifests[%d](%s) is missing a platform", i, desc.Digest))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
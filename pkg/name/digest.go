@@ -19,7 +19,7 @@ import (
 )
 
 const (
-	// These have the form: sha256:<hex string>
+	// These have the form: sha256:<hex string> (or sha512:<hex string>)
 	// TODO(dekkagaijin): replace with opencontainers/go-digest or docker/distribution's validation.
 	digestChars = "sh:0123456789abcdef"
 	digestDelim = "@"
@@ -61,6 +61,9 @@ func (d Digest) String() string {
 }
 
 func checkDigest(name string) error {
+	if strings.HasPrefix(name, "sha512:") {
+		return checkElement("digest", name, digestChars, 7+128, 7+128)
+	}
 	return checkElement("digest", name, digestChars, 7+64, 7+64)
 }
 
@@ -22,11 +22,14 @@ import (
 
 const validDigest = "sha256:deadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33f"
 
+const validSHA512Digest = "sha512:deadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33f"
+
 var goodStrictValidationDigestNames = []string{
 	"gcr.io/g-convoy/hello-world@" + validDigest,
 	"gcr.io/google.com/project-id/hello-world@" + validDigest,
 	"us.gcr.io/project-id/sub-repo@" + validDigest,
 	"example.text/foo/bar@" + validDigest,
+	"example.text/foo/bar@" + validSHA512Digest,
 }
 
 var goodStrictValidationTagDigestNames = []string{
@@ -48,6 +51,8 @@ var goodWeakValidationTagDigestNames = []string{
 var badDigestNames = []string{
 	"gcr.io/project-id/unknown-alg@unknown:abc123",
 	"gcr.io/project-id/wrong-length@sha256:d34db33fd34db33f",
+	"gcr.io/project-id/wrong-length@" + validDigest[:7] + validSHA512Digest[7:],
+	"gcr.io/project-id/wrong-length@sha512:" + validDigest[7:],
 	"gcr.io/project-id/missing-digest@",
 }
 
@@ -0,0 +1,116 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Match reports whether the reference ref matches the glob pattern.
+//
+// A pattern has the form of a reference, e.g. "gcr.io/project/*:v1", where:
+//
+//   - "*" matches any sequence of characters other than "/"
+//   - "**" matches any sequence of characters, including "/"
+//   - "?" matches any single character other than "/"
+//
+// Both ref and pattern are normalized before matching, so "ubuntu" is
+// matched as "index.docker.io/library/ubuntu:latest", and the pattern
+// "docker.io/library/*" as "index.docker.io/library/*". The registry of a
+// pattern is the part before the first "/", if it contains a ".", ":" or a
+// wildcard, or is "localhost". A pattern that starts with "**" is not
+// normalized.
+//
+// The part of a pattern after ":" matches tags, and after "@" matches digests,
+// e.g. "gcr.io/project/**@sha256:*". A pattern without either matches any
+// tag or digest.
+func Match(pattern, ref string) (bool, error) {
+	if pattern == "" {
+		return false, newErrBadName("empty pattern")
+	}
+	r, err := ParseReference(ref)
+	if err != nil {
+		return false, err
+	}
+
+	repo, sep, id := splitPattern(pattern)
+	if !globMatch(normalizeRepoPattern(repo), r.Context().Name()) {
+		return false, nil
+	}
+
+	switch sep {
+	case "":
+		return true, nil
+	case ":":
+		t, ok := r.(Tag)
+		return ok && globMatch(id, t.TagStr()), nil
+	default:
+		d, ok := r.(Digest)
+		return ok && globMatch(id, d.DigestStr()), nil
+	}
+}
+
+// splitPattern splits a pattern into its repository and identifier parts,
+// returning the separator between them, if any.
+func splitPattern(pattern string) (repo, sep, id string) {
+	if i := strings.Index(pattern, "@"); i != -1 {
+		return pattern[:i], "@", pattern[i+1:]
+	}
+	// A ":" before the last "/" separates the registry from its port.
+	if i := strings.LastIndex(pattern, ":"); i != -1 && i > strings.LastIndex(pattern, "/") {
+		return pattern[:i], ":", pattern[i+1:]
+	}
+	return pattern, "", ""
+}
+
+// normalizeRepoPattern applies the defaults that NewRepository would,
+// treating wildcards in the first component as part of the registry.
+func normalizeRepoPattern(repo string) string {
+	if strings.HasPrefix(repo, "**") {
+		return repo
+	}
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:*?") || parts[0] == "localhost") {
+		return normalizeRegistry(parts[0]) + "/" + parts[1]
+	}
+	if len(parts) == 1 {
+		repo = defaultNamespace + "/" + repo
+	}
+	return DefaultRegistry + "/" + repo
+}
+
+// globMatch reports whether s matches the glob pattern.
+func globMatch(pattern, s string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(s)
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	const digest = "sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	for _, tc := range []struct {
+		pattern, ref string
+		want         bool
+	}{
+		// Default registry, namespace and tag.
+		{"docker.io/library/*:*", "ubuntu", true},
+		{"docker.io/library/*:*", "ubuntu:20.04", true},
+		{"docker.io/library/*:*", "index.docker.io/library/ubuntu:20.04", true},
+		{"docker.io/library/*:latest", "ubuntu", true},
+		{"docker.io/library/*:*", "someone/ubuntu", false},
+		{"ubuntu", "docker.io/library/ubuntu:20.04", true},
+		{"ubuntu:*", "gcr.io/ubuntu:20.04", false},
+		{"someone/*", "someone/ubuntu", true},
+
+		// "*" doesn't cross "/", "**" does.
+		{"gcr.io/project/*", "gcr.io/project/image:v1", true},
+		{"gcr.io/project/*", "gcr.io/project/nested/image:v1", false},
+		{"gcr.io/project/**", "gcr.io/project/nested/image:v1", true},
+		{"gcr.io/project/**", "gcr.io/other/image:v1", false},
+		{"gcr.io/project/im?ge", "gcr.io/project/image", true},
+		{"*.gcr.io/project/*", "us.gcr.io/project/image", true},
+		{"*.gcr.io/project/*", "gcr.io/project/image", false},
+		{"**", "gcr.io/project/nested/image:v1", true},
+		{"localhost:5000/**", "localhost:5000/foo/bar:baz", true},
+		{"localhost:5000/**:v?", "localhost:5000/foo/bar:v1", true},
+		{"localhost:5000/**:v?", "localhost:5000/foo/bar:v10", false},
+
+		// Digests.
+		{"gcr.io/project/image@" + digest, "gcr.io/project/image@" + digest, true},
+		{"gcr.io/project/image@sha256:*", "gcr.io/project/image@" + digest, true},
+		{"gcr.io/project/image@sha256:*", "gcr.io/project/image:v1", false},
+		{"gcr.io/project/image:*", "gcr.io/project/image@" + digest, false},
+		{"gcr.io/project/*", "gcr.io/project/image@" + digest, true},
+	} {
+		got, err := Match(tc.pattern, tc.ref)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %v", tc.pattern, tc.ref, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Match(%q, %q) = %t, want %t", tc.pattern, tc.ref, got, tc.want)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	if _, err := Match("", "ubuntu"); err == nil {
+		t.Error("Match(empty pattern): got nil want err")
+	}
+	if _, err := Match("**", "@@@"); err == nil {
+		t.Error("Match(invalid ref): got nil want err")
+	}
+}
@@ -19,6 +19,9 @@ const (
 	// provided and the default is not overridden.
 	DefaultRegistry      = "index.docker.io"
 	defaultRegistryAlias = "docker.io"
+	// defaultRegistryAPIHost is the host that serves the API of
+	// DefaultRegistry, which is also accepted as an alias for it.
+	defaultRegistryAPIHost = "registry-1.docker.io"
 
 	// DefaultTag is the tag name that will be used if no tag provided and the
 	// default is not overridden.
@@ -30,6 +33,8 @@ type options struct {
 	insecure        bool // secure by default
 	defaultRegistry string
 	defaultTag      string
+	// noDefaultNamespace disables the implicit "library/" for Docker Hub.
+	noDefaultNamespace bool
 }
 
 func makeOptions(opts ...Option) options {
@@ -81,3 +86,15 @@ func WithDefaultTag(t string) Option {
 		opts.defaultTag = t
 	}
 }
+
+// WithoutDefaultNamespace disables the implicit "library/" namespace for
+// single-component Docker Hub repositories, so that "docker.io/ubuntu" refers
+// to the repository "ubuntu" rather than "library/ubuntu". This is useful when
+// mirroring or proxying Docker Hub, where the path must be preserved as given.
+//
+// Repositories on other registries never get a namespace prepended.
+func WithoutDefaultNamespace() Option {
+	return func(opts *options) {
+		opts.noDefaultNamespace = true
+	}
+}
@@ -16,6 +16,7 @@ package name
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Reference defines the interface that consumers use when they can
@@ -37,10 +38,15 @@ type Reference interface {
 }
 
 // ParseReference parses the string as a reference, either by tag or digest.
+// A name with both, e.g. "ubuntu:20.04@sha256:...", is parsed as a
+// TaggedDigest.
 func ParseReference(s string, opts ...Option) (Reference, error) {
 	if t, err := NewTag(s, opts...); err == nil {
 		return t, nil
 	}
+	if td, err := NewTaggedDigest(s, opts...); err == nil {
+		return td, nil
+	}
 	if d, err := NewDigest(s, opts...); err == nil {
 		return d, nil
 	}
@@ -73,3 +79,46 @@ func MustParseReference(s stringConst, opts ...Option) Reference {
 	}
 	return ref
 }
+
+// Split splits s into the canonical registry, repository and identifier (the
+// tag or digest) of the reference it names, after applying any defaults, e.g.
+// "ubuntu" splits into "index.docker.io", "library/ubuntu" and "latest".
+//
+// A bare registry name, like "gcr.io" or "localhost:5000", is split into just
+// the registry, with an empty repository and identifier.
+func Split(s string, opts ...Option) (registry, repository, identifier string, err error) {
+	if isBareRegistry(s) {
+		reg, err := NewRegistry(s, opts...)
+		if err != nil {
+			return "", "", "", err
+		}
+		return reg.RegistryStr(), "", "", nil
+	}
+	ref, err := ParseReference(s, opts...)
+	if err != nil {
+		return "", "", "", err
+	}
+	return ref.Context().RegistryStr(), ref.Context().RepositoryStr(), ref.Identifier(), nil
+}
+
+// isBareRegistry reports whether s looks like a registry rather than an image
+// in the default registry. Since "ubuntu:20.04" is an image, s must be
+// localhost, an IPv6 address or contain a dot, and anything after a colon must
+// be a port.
+func isBareRegistry(s string) bool {
+	if strings.ContainsAny(s, "/@") {
+		return false
+	}
+	host, port := s, ""
+	// The colons in a bracketed IPv6 address without a port aren't a port.
+	if i := strings.LastIndex(s, ":"); i != -1 && !strings.HasSuffix(s, "]") {
+		host, port = s[:i], s[i+1:]
+		if port == "" || strings.Trim(port, "0123456789") != "" {
+			return false
+		}
+	}
+	if strings.HasPrefix(host, "[") {
+		return strings.HasSuffix(host, "]")
+	}
+	return host == "localhost" || strings.Contains(host, ".")
+}
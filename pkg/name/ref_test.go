@@ -76,6 +76,20 @@ func TestParseReference(t *testing.T) {
 		}
 	}
 
+	for _, name := range append(goodStrictValidationTagDigestNames, goodWeakValidationTagDigestNames...) {
+		ref, err := ParseReference(name, WeakValidation)
+		if err != nil {
+			t.Errorf("ParseReference(%q); %v", name, err)
+		}
+		td, err := NewTaggedDigest(name, WeakValidation)
+		if err != nil {
+			t.Errorf("NewTaggedDigest(%q); %v", name, err)
+		}
+		if ref != td {
+			t.Errorf("ParseReference(%q) != NewTaggedDigest(%q); got %v, want %v", name, name, ref, td)
+		}
+	}
+
 	for _, name := range badDigestNames {
 		if _, err := ParseReference(name, WeakValidation); err == nil {
 			t.Errorf("ParseReference(%q); expected error, got none", name)
@@ -155,3 +169,49 @@ const str = "valid/string"
 var _ = MustParseReference(str)
 var _ = MustParseReference("valid/string")
 var _ = MustParseReference("valid/prefix/" + str)
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		ref                              string
+		registry, repository, identifier string
+	}{
+		{"ubuntu", "index.docker.io", "library/ubuntu", "latest"},
+		{"ubuntu:20.04", "index.docker.io", "library/ubuntu", "20.04"},
+		{"docker.io/foo/bar:baz", "index.docker.io", "foo/bar", "baz"},
+		{"gcr.io/foo/bar", "gcr.io", "foo/bar", "latest"},
+		{"localhost:5000/foo:bar", "localhost:5000", "foo", "bar"},
+		{"gcr.io/foo/bar@sha256:deadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33f", "gcr.io", "foo/bar", "sha256:deadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33f"},
+		{"gcr.io", "gcr.io", "", ""},
+		{"localhost", "localhost", "", ""},
+		{"localhost:5000", "localhost:5000", "", ""},
+		{"registry.example.com:443", "registry.example.com:443", "", ""},
+		{"[::1]", "[::1]", "", ""},
+		{"[::1]:5000", "[::1]:5000", "", ""},
+		{"[::1]:5000/foo:bar", "[::1]:5000", "foo", "bar"},
+		{"docker.io", "index.docker.io", "", ""},
+	} {
+		t.Run(tc.ref, func(t *testing.T) {
+			registry, repository, identifier, err := Split(tc.ref)
+			if err != nil {
+				t.Fatalf("Split(%q) = %v", tc.ref, err)
+			}
+			if registry != tc.registry || repository != tc.repository || identifier != tc.identifier {
+				t.Errorf("Split(%q) = (%q, %q, %q), want (%q, %q, %q)", tc.ref, registry, repository, identifier, tc.registry, tc.repository, tc.identifier)
+			}
+		})
+	}
+
+	registry, repository, identifier, err := Split("ubuntu", WithDefaultRegistry("registry.example.com"), WithDefaultTag("stable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry != "registry.example.com" || repository != "ubuntu" || identifier != "stable" {
+		t.Errorf("Split(ubuntu) with defaults = (%q, %q, %q)", registry, repository, identifier)
+	}
+
+	for _, ref := range []string{"", "UPPER/case", "gcr.io/foo@sha256:nope", "gcr.io/foo:bad:tag"} {
+		if _, _, _, err := Split(ref); err == nil {
+			t.Errorf("Split(%q) = nil, want error", ref)
+		}
+	}
+}
@@ -37,10 +37,24 @@ type Registry struct {
 }
 
 // RegistryStr returns the registry component of the Registry.
+//
+// Aliases of Docker Hub ("docker.io", "index.docker.io" and
+// "registry-1.docker.io") are all normalized to DefaultRegistry, so this is
+// suitable for comparing registries. Use APIHost for the host to connect to.
 func (r Registry) RegistryStr() string {
 	return r.registry
 }
 
+// APIHost returns the host (and port, if any) that serves the registry's API.
+// This is the same as RegistryStr, except for Docker Hub, whose API is served
+// by "registry-1.docker.io".
+func (r Registry) APIHost() string {
+	if r.registry == DefaultRegistry {
+		return defaultRegistryAPIHost
+	}
+	return r.registry
+}
+
 // Name returns the name from which the Registry was derived.
 func (r Registry) Name() string {
 	return r.RegistryStr()
@@ -118,15 +132,21 @@ func NewRegistry(name string, opts ...Option) (Registry, error) {
 	if name == "" {
 		name = opt.defaultRegistry
 	}
-	// Rewrite "docker.io" to "index.docker.io".
-	// See: https://github.com/google/go-containerregistry/issues/68
-	if name == defaultRegistryAlias {
-		name = DefaultRegistry
-	}
+	name = normalizeRegistry(name)
 
 	return Registry{registry: name, insecure: opt.insecure}, nil
 }
 
+// normalizeRegistry rewrites the aliases of Docker Hub, "docker.io" and
+// "registry-1.docker.io", to "index.docker.io".
+// See: https://github.com/google/go-containerregistry/issues/68
+func normalizeRegistry(name string) string {
+	if name == defaultRegistryAlias || name == defaultRegistryAPIHost {
+		return DefaultRegistry
+	}
+	return name
+}
+
 // NewInsecureRegistry returns an Insecure Registry based on the given name.
 //
 // Deprecated: Use the Insecure Option with NewRegistry instead.
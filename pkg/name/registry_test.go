@@ -108,6 +108,52 @@ func TestDefaultRegistryNames(t *testing.T) {
 	}
 }
 
+func TestDockerHubAliases(t *testing.T) {
+	t.Parallel()
+	aliases := []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+	want, err := NewRegistry(DefaultRegistry, StrictValidation)
+	if err != nil {
+		t.Fatalf("NewRegistry(%q) = %v", DefaultRegistry, err)
+	}
+	for _, alias := range aliases {
+		registry, err := NewRegistry(alias, StrictValidation)
+		if err != nil {
+			t.Fatalf("`%s` should be a valid Registry name, got error: %v", alias, err)
+		}
+		if registry != want {
+			t.Errorf("NewRegistry(%q) = %#v, want %#v", alias, registry, want)
+		}
+		if got := registry.String(); got != DefaultRegistry {
+			t.Errorf("String() was incorrect for %q. Wanted: `%s` Got: `%s`", alias, DefaultRegistry, got)
+		}
+		if got, want := registry.APIHost(), "registry-1.docker.io"; got != want {
+			t.Errorf("APIHost() was incorrect for %q. Wanted: `%s` Got: `%s`", alias, want, got)
+		}
+
+		// Repositories and references normalize the same way.
+		ref, err := ParseReference(alias + "/library/ubuntu:latest")
+		if err != nil {
+			t.Fatalf("ParseReference(%q) = %v", alias, err)
+		}
+		if got, want := ref.Name(), "index.docker.io/library/ubuntu:latest"; got != want {
+			t.Errorf("ParseReference(%q).Name() = %q, want %q", alias, got, want)
+		}
+		if got, want := ref.Context().String(), "index.docker.io/library/ubuntu"; got != want {
+			t.Errorf("ParseReference(%q).Context().String() = %q, want %q", alias, got, want)
+		}
+	}
+
+	// Other registries connect to the registry itself.
+	registry, err := NewRegistry("gcr.io:8443", StrictValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := registry.APIHost(), "gcr.io:8443"; got != want {
+		t.Errorf("APIHost() = %q, want %q", got, want)
+	}
+}
+
 func TestOverrideDefaultRegistryNames(t *testing.T) {
 	testRegistries := []string{"docker.io", ""}
 	expectedRegistries := []string{"index.docker.io", "gcr.io"}
@@ -29,6 +29,9 @@ const (
 type Repository struct {
 	Registry
 	repository string
+	// noDefaultNamespace disables the implicit "library/" namespace, see
+	// WithoutDefaultNamespace.
+	noDefaultNamespace bool
 }
 
 // See https://docs.docker.com/docker-hub/official_repos
@@ -38,7 +41,7 @@ func hasImplicitNamespace(repo string, reg Registry) bool {
 
 // RepositoryStr returns the repository component of the Repository.
 func (r Repository) RepositoryStr() string {
-	if hasImplicitNamespace(r.repository, r.Registry) {
+	if !r.noDefaultNamespace && hasImplicitNamespace(r.repository, r.Registry) {
 		return fmt.Sprintf("%s/%s", defaultNamespace, r.repository)
 	}
 	return r.repository
@@ -94,10 +97,10 @@ func NewRepository(name string, opts ...Option) (Repository, error) {
 	if err != nil {
 		return Repository{}, err
 	}
-	if hasImplicitNamespace(repo, reg) && opt.strict {
+	if hasImplicitNamespace(repo, reg) && opt.strict && !opt.noDefaultNamespace {
 		return Repository{}, newErrBadName("strict validation requires the full repository path (missing 'library')")
 	}
-	return Repository{reg, repo}, nil
+	return Repository{Registry: reg, repository: repo, noDefaultNamespace: opt.noDefaultNamespace}, nil
 }
 
 // Tag returns a Tag in this Repository.
@@ -119,3 +122,33 @@ func (r Repository) Digest(identifier string) Digest {
 	d.original = d.Name()
 	return d
 }
+
+// Tags returns a Tag in this Repository for each of the given tags, which
+// inherit the registry options (e.g. Insecure) the Repository was parsed with.
+// Unlike Tag, the tags are validated; an error is returned for the first
+// invalid one.
+func (r Repository) Tags(tags []string) ([]Tag, error) {
+	ts := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		if err := checkTag(tag); err != nil {
+			return nil, err
+		}
+		ts = append(ts, r.Tag(tag))
+	}
+	return ts, nil
+}
+
+// Digests returns a Digest in this Repository for each of the given digests,
+// which inherit the registry options (e.g. Insecure) the Repository was parsed
+// with. Unlike Digest, the digests are validated; an error is returned for the
+// first invalid one.
+func (r Repository) Digests(digests []string) ([]Digest, error) {
+	ds := make([]Digest, 0, len(digests))
+	for _, digest := range digests {
+		if err := checkDigest(digest); err != nil {
+			return nil, err
+		}
+		ds = append(ds, r.Digest(digest))
+	}
+	return ds, nil
+}
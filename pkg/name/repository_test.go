@@ -143,3 +143,113 @@ func TestRepositoryChildren(t *testing.T) {
 		t.Errorf("digest.String(): got %s want %s", got, want)
 	}
 }
+
+func TestRepositoryTagsAndDigests(t *testing.T) {
+	repo, err := NewRepository("example.com/repo", Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := repo.Tags([]string{"v1", "latest"})
+	if err != nil {
+		t.Fatalf("Tags: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("len(Tags()) = %d, want 2", len(tags))
+	}
+	for i, want := range []string{"example.com/repo:v1", "example.com/repo:latest"} {
+		if got := tags[i].String(); got != want {
+			t.Errorf("tags[%d].String(): got %s want %s", i, got, want)
+		}
+		if got, want := tags[i].Scheme(), "http"; got != want {
+			t.Errorf("tags[%d].Scheme(): got %s want %s", i, got, want)
+		}
+	}
+
+	var berr *ErrBadName
+	if _, err := repo.Tags([]string{"v1", "not:valid"}); !errors.As(err, &berr) {
+		t.Errorf("Tags(invalid) = %v, want ErrBadName", err)
+	}
+
+	d := "sha256:deadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33fdeadb33f"
+	digests, err := repo.Digests([]string{d})
+	if err != nil {
+		t.Fatalf("Digests: %v", err)
+	}
+	if got, want := digests[0].String(), "example.com/repo@"+d; got != want {
+		t.Errorf("digests[0].String(): got %s want %s", got, want)
+	}
+	if got, want := digests[0].Scheme(), "http"; got != want {
+		t.Errorf("digests[0].Scheme(): got %s want %s", got, want)
+	}
+	if _, err := repo.Digests([]string{"badf00d"}); !errors.As(err, &berr) {
+		t.Errorf("Digests(invalid) = %v, want ErrBadName", err)
+	}
+}
+
+func TestRepositoryWithoutDefaultNamespace(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		wantStr string
+		wantRef string
+	}{{
+		name:    "ubuntu",
+		wantStr: "library/ubuntu",
+		wantRef: "index.docker.io/library/ubuntu:latest",
+	}, {
+		name:    "docker.io/ubuntu",
+		wantStr: "library/ubuntu",
+		wantRef: "index.docker.io/library/ubuntu:latest",
+	}, {
+		name:    "ubuntu",
+		opts:    []Option{WithoutDefaultNamespace()},
+		wantStr: "ubuntu",
+		wantRef: "index.docker.io/ubuntu:latest",
+	}, {
+		name:    "docker.io/ubuntu",
+		opts:    []Option{WithoutDefaultNamespace()},
+		wantStr: "ubuntu",
+		wantRef: "index.docker.io/ubuntu:latest",
+	}, {
+		name:    "docker.io/foo/bar",
+		opts:    []Option{WithoutDefaultNamespace()},
+		wantStr: "foo/bar",
+		wantRef: "index.docker.io/foo/bar:latest",
+	}, {
+		name:    "gcr.io/ubuntu",
+		wantStr: "ubuntu",
+		wantRef: "gcr.io/ubuntu:latest",
+	}, {
+		name:    "gcr.io/ubuntu",
+		opts:    []Option{WithoutDefaultNamespace()},
+		wantStr: "ubuntu",
+		wantRef: "gcr.io/ubuntu:latest",
+	}} {
+		repo, err := NewRepository(tc.name, tc.opts...)
+		if err != nil {
+			t.Fatalf("NewRepository(%q): %v", tc.name, err)
+		}
+		if got := repo.RepositoryStr(); got != tc.wantStr {
+			t.Errorf("NewRepository(%q).RepositoryStr() = %q, want %q", tc.name, got, tc.wantStr)
+		}
+		// The option should carry over to references in the repository.
+		if got := repo.Tag("latest").String(); got != tc.wantRef {
+			t.Errorf("NewRepository(%q).Tag(latest) = %q, want %q", tc.name, got, tc.wantRef)
+		}
+		ref, err := ParseReference(tc.name, tc.opts...)
+		if err != nil {
+			t.Fatalf("ParseReference(%q): %v", tc.name, err)
+		}
+		if got := ref.Name(); got != tc.wantRef {
+			t.Errorf("ParseReference(%q).Name() = %q, want %q", tc.name, got, tc.wantRef)
+		}
+	}
+
+	// Without the implicit namespace, there's nothing for strict validation to
+	// complain about.
+	if _, err := NewRepository("docker.io/ubuntu", WithoutDefaultNamespace(), StrictValidation); err != nil {
+		t.Errorf("NewRepository(docker.io/ubuntu, strict): %v", err)
+	}
+}
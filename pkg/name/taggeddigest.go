@@ -0,0 +1,97 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"strings"
+)
+
+// TaggedDigest stores a name with both a tag and a digest, e.g.
+// "ubuntu:20.04@sha256:...", in a structured form. As with Docker, the
+// digest is authoritative and the tag is only informational, so a
+// TaggedDigest identifies the same thing as its Digest.
+type TaggedDigest struct {
+	digest   Digest
+	tag      Tag
+	original string
+}
+
+// Ensure TaggedDigest implements Reference
+var _ Reference = (*TaggedDigest)(nil)
+
+// Context implements Reference.
+func (t TaggedDigest) Context() Repository {
+	return t.digest.Repository
+}
+
+// Identifier implements Reference.
+func (t TaggedDigest) Identifier() string {
+	return t.digest.DigestStr()
+}
+
+// Name returns the fully-qualified name, including both the tag and the
+// digest.
+func (t TaggedDigest) Name() string {
+	return t.tag.Name() + digestDelim + t.digest.DigestStr()
+}
+
+// String returns the original input string.
+func (t TaggedDigest) String() string {
+	return t.original
+}
+
+// Scope returns the scope required to perform the given action on the
+// reference.
+func (t TaggedDigest) Scope(action string) string {
+	return t.digest.Scope(action)
+}
+
+// Tag returns the informational tag of the reference.
+func (t TaggedDigest) Tag() Tag {
+	return t.tag
+}
+
+// Digest returns the authoritative digest of the reference, which is what
+// should be used to pull it.
+func (t TaggedDigest) Digest() Digest {
+	return t.digest
+}
+
+// NewTaggedDigest returns a new TaggedDigest representing the given name,
+// which must have both a tag and a digest.
+//
+// ParseReference returns a TaggedDigest for such names too. NewDigest also
+// accepts them, but returns a Digest that only keeps the tag in its String().
+func NewTaggedDigest(name string, opts ...Option) (TaggedDigest, error) {
+	d, err := NewDigest(name, opts...)
+	if err != nil {
+		return TaggedDigest{}, err
+	}
+
+	base := strings.SplitN(name, digestDelim, 2)[0]
+	parts := strings.Split(base, tagDelim)
+	if tag := parts[len(parts)-1]; len(parts) < 2 || tag == "" || strings.Contains(tag, regRepoDelimiter) {
+		return TaggedDigest{}, newErrBadName("a tagged digest must contain a tag (e.g. registry/repository:tag@digest) saw: %s", name)
+	}
+	tag, err := NewTag(base, opts...)
+	if err != nil {
+		return TaggedDigest{}, err
+	}
+	return TaggedDigest{
+		digest:   d,
+		tag:      tag,
+		original: name,
+	}, nil
+}
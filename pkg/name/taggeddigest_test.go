@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewTaggedDigest(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		opts     []Option
+		wantTag  string
+		wantRepo string
+		wantName string
+	}{{
+		name:     "example.text/foo/bar:latest@" + validDigest,
+		opts:     []Option{StrictValidation},
+		wantTag:  "example.text/foo/bar:latest",
+		wantRepo: "example.text/foo/bar",
+		wantName: "example.text/foo/bar:latest@" + validDigest,
+	}, {
+		name:     "example.text:8443/foo/bar:v1.0.0-alpine@" + validDigest,
+		opts:     []Option{StrictValidation},
+		wantTag:  "example.text:8443/foo/bar:v1.0.0-alpine",
+		wantRepo: "example.text:8443/foo/bar",
+		wantName: "example.text:8443/foo/bar:v1.0.0-alpine@" + validDigest,
+	}, {
+		name:     "nginx:latest@" + validDigest,
+		wantTag:  "index.docker.io/library/nginx:latest",
+		wantRepo: "index.docker.io/library/nginx",
+		wantName: "index.docker.io/library/nginx:latest@" + validDigest,
+	}, {
+		name:     "example.text/foo/bar:latest@" + validSHA512Digest,
+		wantTag:  "example.text/foo/bar:latest",
+		wantRepo: "example.text/foo/bar",
+		wantName: "example.text/foo/bar:latest@" + validSHA512Digest,
+	}} {
+		td, err := NewTaggedDigest(tc.name, tc.opts...)
+		if err != nil {
+			t.Errorf("NewTaggedDigest(%q) = %v", tc.name, err)
+			continue
+		}
+
+		// String() must round-trip the original input.
+		if got := td.String(); got != tc.name {
+			t.Errorf("String() = %q, want %q", got, tc.name)
+		}
+		again, err := NewTaggedDigest(td.String(), tc.opts...)
+		if err != nil {
+			t.Errorf("NewTaggedDigest(%q) = %v", td.String(), err)
+		} else if again != td {
+			t.Errorf("round trip of %q = %#v, want %#v", tc.name, again, td)
+		}
+
+		if got := td.Name(); got != tc.wantName {
+			t.Errorf("Name() = %q, want %q", got, tc.wantName)
+		}
+		if got := td.Tag().Name(); got != tc.wantTag {
+			t.Errorf("Tag() = %q, want %q", got, tc.wantTag)
+		}
+		if got := td.Context().Name(); got != tc.wantRepo {
+			t.Errorf("Context() = %q, want %q", got, tc.wantRepo)
+		}
+
+		// The digest is authoritative.
+		d, err := NewDigest(tc.name, tc.opts...)
+		if err != nil {
+			t.Fatalf("NewDigest(%q) = %v", tc.name, err)
+		}
+		if got, want := td.Identifier(), d.DigestStr(); got != want {
+			t.Errorf("Identifier() = %q, want %q", got, want)
+		}
+		if got, want := td.Digest().Name(), d.Name(); got != want {
+			t.Errorf("Digest() = %q, want %q", got, want)
+		}
+		if got, want := td.Scope("pull"), d.Scope("pull"); got != want {
+			t.Errorf("Scope() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestNewTaggedDigestBad(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range append([]string{
+		// No tag.
+		"example.text/foo/bar@" + validDigest,
+		"example.text:8443/foo/bar@" + validDigest,
+		// No digest.
+		"example.text/foo/bar:latest",
+		// Bad tag.
+		"example.text/foo/bar:@" + validDigest,
+		"example.text/foo/bar:" + strings.Repeat("a", 129) + "@" + validDigest,
+	}, badDigestNames...) {
+		if td, err := NewTaggedDigest(name); err == nil {
+			t.Errorf("NewTaggedDigest(%q) = %v, want error", name, td)
+		}
+	}
+}
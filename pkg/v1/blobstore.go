@@ -0,0 +1,39 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"io"
+)
+
+// BlobStore defines the minimal interface for a content-addressable store of
+// blobs and manifests, e.g. a registry (see remote.BlobStore), an OCI image
+// layout (see layout.Path), or a bucket in object storage (see
+// objectstore.NewBlobStore). Use crane.CopyBlobStore to copy between them.
+type BlobStore interface {
+	// GetBlob returns the contents of the blob with the given digest.
+	GetBlob(Hash) (io.ReadCloser, error)
+
+	// PutBlob writes the contents of the blob with the given digest.
+	PutBlob(Hash, io.ReadCloser) error
+
+	// GetManifest returns the serialized bytes and Descriptor of the manifest
+	// with the given digest.
+	GetManifest(Hash) ([]byte, *Descriptor, error)
+
+	// PutManifest writes the serialized bytes of the manifest described by
+	// the given Descriptor.
+	PutManifest(Descriptor, []byte) error
+}
@@ -18,9 +18,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -28,11 +31,42 @@ import (
 
 type fscache struct {
 	path string
+
+	// writing holds the entries that are being written in this process,
+	// see startWriting.
+	mu      sync.Mutex
+	writing map[v1.Hash]bool
 }
 
 // NewFilesystemCache returns a Cache implementation backed by files.
+//
+// The returned Cache is safe for concurrent use. Only one reader writes each
+// entry at a time; other readers of the same entry read through to the
+// underlying layer until it has been written, rather than waiting for the
+// writer to finish, and Get doesn't return entries that are still being
+// written.
 func NewFilesystemCache(path string) Cache {
-	return &fscache{path}
+	return &fscache{
+		path:    path,
+		writing: map[v1.Hash]bool{},
+	}
+}
+
+// startWriting marks the entry h as being written by us, returning false if
+// someone else in this process is already writing it. Call done once the
+// entry has been written or discarded.
+func (fs *fscache) startWriting(h v1.Hash) (done func(), ok bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.writing[h] {
+		return nil, false
+	}
+	fs.writing[h] = true
+	return func() {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		delete(fs.writing, h)
+	}, true
 }
 
 func (fs *fscache) Put(l v1.Layer) (v1.Layer, error) {
@@ -46,7 +80,7 @@ func (fs *fscache) Put(l v1.Layer) (v1.Layer, error) {
 	}
 	return &layer{
 		Layer:  l,
-		path:   fs.path,
+		fs:     fs,
 		digest: digest,
 		diffID: diffID,
 	}, nil
@@ -54,67 +88,203 @@ func (fs *fscache) Put(l v1.Layer) (v1.Layer, error) {
 
 type layer struct {
 	v1.Layer
-	path           string
+	fs             *fscache
 	digest, diffID v1.Hash
 }
 
-func (l *layer) create(h v1.Hash) (io.WriteCloser, error) {
-	if err := os.MkdirAll(l.path, 0700); err != nil {
-		return nil, err
+// open returns the contents of h, from the cache if it's there, or as
+// returned by inner otherwise, writing them to the cache as they are read.
+// Only one reader writes h at a time. Others just read inner, since the
+// writer may not finish for as long as its caller holds on to it.
+func (l *layer) open(h v1.Hash, inner func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if f, err := os.Open(cachepath(l.fs.path, h)); err == nil {
+		return f, nil
 	}
-	return os.Create(cachepath(l.path, h))
-}
-
-func (l *layer) Compressed() (io.ReadCloser, error) {
-	f, err := l.create(l.digest)
+	unlock, ok := l.fs.startWriting(h)
+	if !ok {
+		return inner()
+	}
+	// It may have been written since we looked.
+	if f, err := os.Open(cachepath(l.fs.path, h)); err == nil {
+		unlock()
+		return f, nil
+	}
+	p, err := l.create(h, unlock)
 	if err != nil {
 		return nil, err
 	}
-	rc, err := l.Layer.Compressed()
+	rc, err := inner()
 	if err != nil {
+		p.finish(false)
 		return nil, err
 	}
-	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
-	}, nil
+	return newReadCloser(rc, p), nil
 }
 
-func (l *layer) Uncompressed() (io.ReadCloser, error) {
-	f, err := l.create(l.diffID)
+// create returns a file to write the contents of h to, which is moved into
+// the cache once the contents have been read completely, see pending. It
+// returns a nil pending if another process is already caching h, in which
+// case we just don't cache it. The in-process lock is released by unlock,
+// either right away or once the pending entry is finished.
+func (l *layer) create(h v1.Hash, unlock func()) (*pending, error) {
+	if err := os.MkdirAll(l.fs.path, 0700); err != nil {
+		unlock()
+		return nil, err
+	}
+	path := cachepath(l.fs.path, h)
+	unlockFile, err := lock(path)
 	if err != nil {
+		unlock()
+		if errors.Is(err, errLocked) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	rc, err := l.Layer.Uncompressed()
+	f, err := ioutil.TempFile(l.fs.path, filepath.Base(path)+".tmp-*")
 	if err != nil {
+		unlockFile()
+		unlock()
 		return nil, err
 	}
-	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
-	}, nil
+	return &pending{f: f, path: path, unlock: func() {
+		unlockFile()
+		unlock()
+	}}, nil
+}
+
+func (l *layer) Compressed() (io.ReadCloser, error) {
+	return l.open(l.digest, l.Layer.Compressed)
+}
+
+func (l *layer) Uncompressed() (io.ReadCloser, error) {
+	return l.open(l.diffID, l.Layer.Uncompressed)
+}
+
+// pending is a cache entry that is being written. The contents are written to
+// a temporary file that is renamed into place by finish, so that concurrent
+// readers never see partially written entries.
+type pending struct {
+	f      *os.File
+	path   string
+	unlock func()
+}
+
+// finish moves the entry into the cache if complete, and discards it
+// otherwise. It's a no-op on a nil pending.
+func (p *pending) finish(complete bool) error {
+	if p == nil {
+		return nil
+	}
+	defer p.unlock()
+	err := p.f.Close()
+	if err == nil && complete {
+		return os.Rename(p.f.Name(), p.path)
+	}
+	os.Remove(p.f.Name())
+	return err
+}
+
+// newReadCloser returns an io.ReadCloser that reads from rc, writing what it
+// reads to p, if any.
+func newReadCloser(rc io.ReadCloser, p *pending) *readcloser {
+	if p == nil {
+		return &readcloser{t: rc, rc: rc}
+	}
+	return &readcloser{t: io.TeeReader(rc, p.f), rc: rc, p: p}
 }
 
 type readcloser struct {
-	t      io.Reader
-	closes []func() error
+	t  io.Reader
+	rc io.ReadCloser
+
+	// p is finished as soon as we reach EOF or fail, rather than when we're
+	// closed, so that the entry lands and other readers can use it even if
+	// we're never closed.
+	p         *pending
+	once      sync.Once
+	finishErr error
 }
 
 func (rc *readcloser) Read(b []byte) (int, error) {
-	return rc.t.Read(b)
+	n, err := rc.t.Read(b)
+	if err != nil {
+		rc.finish(err == io.EOF)
+	}
+	return n, err
+}
+
+func (rc *readcloser) finish(complete bool) {
+	rc.once.Do(func() {
+		rc.finishErr = rc.p.finish(complete)
+	})
 }
 
 func (rc *readcloser) Close() error {
-	// Call all Close methods, even if any returned an error. Return the
-	// first returned error.
-	var err error
-	for _, c := range rc.closes {
-		lastErr := c()
+	err := rc.rc.Close()
+	rc.finish(false)
+	if err == nil {
+		err = rc.finishErr
+	}
+	return err
+}
+
+// staleLock is how long a lock file has to go without being refreshed for us
+// to assume that whoever created it has died without cleaning it up.
+const staleLock = 5 * time.Minute
+
+// lockRefresh is how often the holder of a lock refreshes it, however long
+// the entry takes to write.
+var lockRefresh = time.Minute
+
+var errLocked = errors.New("cache entry is locked")
+
+// lock takes an exclusive lock on the cache entry at path, so that concurrent
+// processes sharing the cache don't all write the same entry. It returns
+// errLocked if someone else holds the lock.
+func lock(path string) (unlock func(), err error) {
+	lockpath := path + ".lock"
+	for i := 0; i < 2; i++ {
+		var f *os.File
+		f, err = os.OpenFile(lockpath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
 		if err == nil {
-			err = lastErr
+			f.Close()
+			stop := make(chan struct{})
+			go refreshLock(lockpath, lockRefresh, stop)
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					close(stop)
+					os.Remove(lockpath)
+				})
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		fi, serr := os.Stat(lockpath)
+		if serr != nil || time.Since(fi.ModTime()) < staleLock {
+			return nil, errLocked
+		}
+		// Break the stale lock and try again.
+		os.Remove(lockpath)
+	}
+	return nil, errLocked
+}
+
+// refreshLock bumps the modification time of the lock file at lockpath every
+// interval until stop is closed, so that nobody breaks it while we're still
+// writing.
+func refreshLock(lockpath string, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			os.Chtimes(lockpath, now, now)
 		}
 	}
-	return err
 }
 
 func (fs *fscache) Get(h v1.Hash) (v1.Layer, error) {
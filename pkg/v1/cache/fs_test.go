@@ -16,15 +16,20 @@ package cache
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestFilesystemCache(t *testing.T) {
@@ -212,3 +217,325 @@ func TestErrUnexpectedEOF(t *testing.T) {
 		t.Errorf("os.Stat(%q): %v", p, err)
 	}
 }
+
+func TestLockedEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := random.Layer(10, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	h, err := l.Digest()
+	if err != nil {
+		t.Fatalf("layer.Digest(): %v", err)
+	}
+	c := NewFilesystemCache(dir)
+	lockpath := cachepath(dir, h) + ".lock"
+
+	consume := func() {
+		t.Helper()
+		cl, err := c.Put(l)
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		rc, err := cl.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Fatalf("Error reading contents: %v", err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	// Someone else is writing this entry, so we shouldn't.
+	if err := ioutil.WriteFile(lockpath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	consume()
+	if _, err := c.Get(h); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(%q) with held lock: %v", h, err)
+	}
+
+	// A stale lock is broken.
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(lockpath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	consume()
+	if _, err := c.Get(h); err != nil {
+		t.Errorf("Get(%q) after stale lock: %v", h, err)
+	}
+	if _, err := os.Stat(lockpath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists: %v", err)
+	}
+}
+
+func TestPartialRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := random.Layer(1000, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	h, err := l.Digest()
+	if err != nil {
+		t.Fatalf("layer.Digest(): %v", err)
+	}
+	c := NewFilesystemCache(dir)
+	cl, err := c.Put(l)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := rc.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	rc.Close()
+
+	// Nothing should have been cached, not even a partial entry.
+	if _, err := c.Get(h); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(%q) after partial read: %v", h, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("got %d files in cache, want 0", len(files))
+	}
+}
+
+// countingLayer counts how often its contents are fetched.
+type countingLayer struct {
+	v1.Layer
+	compressed, uncompressed int32
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	atomic.AddInt32(&l.compressed, 1)
+	return l.Layer.Compressed()
+}
+
+func (l *countingLayer) Uncompressed() (io.ReadCloser, error) {
+	atomic.AddInt32(&l.uncompressed, 1)
+	return l.Layer.Uncompressed()
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+
+	rl, err := random.Layer(100000, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	l := &countingLayer{Layer: rl}
+	digest, err := l.Digest()
+	if err != nil {
+		t.Fatalf("layer.Digest(): %v", err)
+	}
+	diffID, err := l.DiffID()
+	if err != nil {
+		t.Fatalf("layer.DiffID(): %v", err)
+	}
+	c := NewFilesystemCache(dir)
+
+	// check reads all of rc, closes it, and verifies that it hashes to want.
+	check := func(rc io.ReadCloser, want v1.Hash) error {
+		defer rc.Close()
+		got, _, err := v1.SHA256(rc)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("got contents with digest %v, want %v", got, want)
+		}
+		return rc.Close()
+	}
+
+	const n = 50
+	var g errgroup.Group
+	for i := 0; i < n; i++ {
+		i := i
+		g.Go(func() error {
+			switch i % 3 {
+			case 0:
+				cl, err := c.Put(l)
+				if err != nil {
+					return err
+				}
+				rc, err := cl.Compressed()
+				if err != nil {
+					return err
+				}
+				return check(rc, digest)
+			case 1:
+				cl, err := c.Put(l)
+				if err != nil {
+					return err
+				}
+				rc, err := cl.Uncompressed()
+				if err != nil {
+					return err
+				}
+				return check(rc, diffID)
+			default:
+				// Gets either see nothing or a complete entry.
+				cl, err := c.Get(digest)
+				if errors.Is(err, ErrNotFound) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				rc, err := cl.Compressed()
+				if err != nil {
+					return err
+				}
+				return check(rc, digest)
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers that raced with the writer read through to the layer, but
+	// once the entry has landed it's used instead.
+	compressed, uncompressed := atomic.LoadInt32(&l.compressed), atomic.LoadInt32(&l.uncompressed)
+	for _, h := range []v1.Hash{digest, diffID} {
+		if _, err := c.Get(h); err != nil {
+			t.Errorf("Get(%v): %v", h, err)
+		}
+	}
+	cl, err := c.Put(l)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if rc, err := cl.Compressed(); err != nil {
+		t.Errorf("Compressed: %v", err)
+	} else if err := check(rc, digest); err != nil {
+		t.Error(err)
+	}
+	if rc, err := cl.Uncompressed(); err != nil {
+		t.Errorf("Uncompressed: %v", err)
+	} else if err := check(rc, diffID); err != nil {
+		t.Error(err)
+	}
+	if got := atomic.LoadInt32(&l.compressed); got != compressed {
+		t.Errorf("fetched cached compressed contents again: %d times, want %d", got, compressed)
+	}
+	if got := atomic.LoadInt32(&l.uncompressed); got != uncompressed {
+		t.Errorf("fetched cached uncompressed contents again: %d times, want %d", got, uncompressed)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files in cache, want 2", len(files))
+	}
+}
+
+func TestUnclosedReader(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := random.Layer(1000, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	h, err := l.Digest()
+	if err != nil {
+		t.Fatalf("layer.Digest(): %v", err)
+	}
+	c := NewFilesystemCache(dir)
+	cl, err := c.Put(l)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Opening the entry again while it's being written doesn't wait for the
+	// first reader, which will never finish.
+	first, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	second, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, second); err != nil {
+		t.Fatalf("Error reading contents: %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c.Get(h); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(%q) while writing: %v", h, err)
+	}
+
+	// The entry lands once the first reader reaches EOF, without waiting for
+	// it to be closed.
+	if _, err := io.Copy(ioutil.Discard, first); err != nil {
+		t.Fatalf("Error reading contents: %v", err)
+	}
+	if _, err := c.Get(h); err != nil {
+		t.Errorf("Get(%q) after EOF: %v", h, err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestLockRefresh(t *testing.T) {
+	defer func(d time.Duration) { lockRefresh = d }(lockRefresh)
+	lockRefresh = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "entry")
+	lockpath := path + ".lock"
+	unlock, err := lock(path)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	// A long write keeps its lock fresh, so nobody else breaks it.
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(lockpath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fi, err := os.Stat(lockpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(fi.ModTime()) < staleLock {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lock wasn't refreshed: modified %v", fi.ModTime())
+		}
+		time.Sleep(lockRefresh)
+	}
+	if _, err := lock(path); !errors.Is(err, errLocked) {
+		t.Errorf("lock while held: got %v, want %v", err, errLocked)
+	}
+
+	unlock()
+	unlock()
+	if _, err := os.Stat(lockpath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists: %v", err)
+	}
+}
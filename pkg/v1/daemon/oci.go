@@ -0,0 +1,158 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// infoClient is implemented by docker clients that can describe the daemon.
+// It's not part of Client so that existing implementations keep working.
+type infoClient interface {
+	Info(context.Context) (types.Info, error)
+}
+
+// supportsOCI returns true if the daemon stores images in containerd, in which
+// case it can load OCI image layouts as-is. Any failure to tell is treated as
+// no support, so that we fall back to the docker format.
+func supportsOCI(o *options) bool {
+	ic, ok := o.client.(infoClient)
+	if !ok {
+		return false
+	}
+	info, err := ic.Info(o.ctx)
+	if err != nil {
+		return false
+	}
+	for _, kv := range info.DriverStatus {
+		if kv[0] == "driver-type" && kv[1] == "io.containerd.snapshotter.v1" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOCIArchive writes img to w as a tarball of an OCI image layout, with
+// the manifest annotated so that the daemon tags it as tag on load.
+func writeOCIArchive(tag name.Tag, img v1.Image, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	writeFile := func(name string, size int64, r io.Reader) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Size:     size,
+			Mode:     0644,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+	writeBytes := func(name string, b []byte) error {
+		return writeFile(name, int64(len(b)), bytes.NewReader(b))
+	}
+	blobPath := func(h v1.Hash) string {
+		return path.Join("blobs", h.Algorithm, h.Hex)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return err
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return err
+		}
+		err = writeFile(blobPath(d), size, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("writing layer %s: %w", d, err)
+		}
+	}
+
+	cfgName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := writeBytes(blobPath(cfgName), cfg); err != nil {
+		return err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	if err := writeBytes(blobPath(digest), raw); err != nil {
+		return err
+	}
+
+	index, err := json.Marshal(v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     ggcrtypes.OCIImageIndex,
+		Manifests: []v1.Descriptor{{
+			MediaType: mt,
+			Size:      int64(len(raw)),
+			Digest:    digest,
+			Annotations: map[string]string{
+				"io.containerd.image.name": tag.Name(),
+				specsv1.AnnotationRefName:  tag.TagStr(),
+			},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeBytes("index.json", index); err != nil {
+		return err
+	}
+	if err := writeBytes(specsv1.ImageLayoutFile, []byte(fmt.Sprintf(`{"imageLayoutVersion":%q}`, specsv1.ImageLayoutVersion))); err != nil {
+		return err
+	}
+	return tw.Close()
+}
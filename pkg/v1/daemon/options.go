@@ -33,6 +33,8 @@ type options struct {
 	ctx      context.Context
 	client   Client
 	buffered bool
+
+	preserveMediaTypes bool
 }
 
 var defaultClient = func() (Client, error) {
@@ -74,6 +76,16 @@ func WithUnbufferedOpener() Option {
 	}
 }
 
+// WithPreserveMediaTypes makes Write load images as OCI image layouts, which
+// keeps their media types and manifest annotations intact, if the daemon
+// stores images in containerd. Otherwise, Write falls back to converting the
+// image to the `docker save` format as usual.
+func WithPreserveMediaTypes() Option {
+	return func(o *options) {
+		o.preserveMediaTypes = true
+	}
+}
+
 // WithClient is a functional option to allow injecting a docker client.
 //
 // By default, github.com/docker/docker/client.FromEnv is used.
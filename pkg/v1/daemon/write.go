@@ -41,12 +41,18 @@ func Write(tag name.Tag, img v1.Image, options ...Option) (string, error) {
 		return "", err
 	}
 
+	oci := o.preserveMediaTypes && supportsOCI(o)
+
 	pr, pw := io.Pipe()
 	go func() {
-		pw.CloseWithError(tarball.Write(tag, img, pw))
+		if oci {
+			pw.CloseWithError(writeOCIArchive(tag, img, pw))
+		} else {
+			pw.CloseWithError(tarball.Write(tag, img, pw))
+		}
 	}()
 
-	// write the image in docker save format first, then load it
+	// write the image in docker save (or OCI layout) format first, then load it
 	resp, err := o.client.ImageLoad(o.ctx, pr, false)
 	if err != nil {
 		return "", fmt.Errorf("error loading image: %w", err)
@@ -15,19 +15,26 @@
 package daemon
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path"
 	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 type errReader struct {
@@ -158,3 +165,124 @@ func TestWriteDefaultClient(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// infoMockClient is a MockClient that can describe the daemon and records what
+// was loaded.
+type infoMockClient struct {
+	*MockClient
+	info   types.Info
+	loaded map[string][]byte
+}
+
+func (m *infoMockClient) Info(context.Context) (types.Info, error) {
+	return m.info, nil
+}
+
+func (m *infoMockClient) ImageLoad(ctx context.Context, r io.Reader, _ bool) (types.ImageLoadResponse, error) {
+	m.loaded = map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return types.ImageLoadResponse{}, err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return types.ImageLoadResponse{}, err
+		}
+		m.loaded[hdr.Name] = b
+	}
+	return types.ImageLoadResponse{Body: ioutil.NopCloser(strings.NewReader("Loaded"))}, nil
+}
+
+func TestWritePreserveMediaTypes(t *testing.T) {
+	img, err := random.Image(256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.Annotations(mutate.MediaType(img, ggcrtypes.OCIManifestSchema1), map[string]string{"foo": "bar"}).(v1.Image)
+	raw, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag("test:preserve", name.WeakValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containerd := types.Info{DriverStatus: [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}}
+	for _, tc := range []struct {
+		name    string
+		info    types.Info
+		opts    []Option
+		wantOCI bool
+	}{{
+		name:    "containerd",
+		info:    containerd,
+		opts:    []Option{WithPreserveMediaTypes()},
+		wantOCI: true,
+	}, {
+		name: "not requested",
+		info: containerd,
+	}, {
+		name: "unsupported",
+		info: types.Info{DriverStatus: [][2]string{{"Backing Filesystem", "extfs"}}},
+		opts: []Option{WithPreserveMediaTypes()},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &infoMockClient{MockClient: &MockClient{}, info: tc.info}
+			if _, err := Write(tag, img, append(tc.opts, WithClient(client))...); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			_, isOCI := client.loaded["index.json"]
+			if isOCI != tc.wantOCI {
+				t.Fatalf("loaded OCI layout = %t, want %t (files: %d)", isOCI, tc.wantOCI, len(client.loaded))
+			}
+			if !tc.wantOCI {
+				if _, ok := client.loaded["manifest.json"]; !ok {
+					t.Error("docker format tarball missing manifest.json")
+				}
+				return
+			}
+
+			// The manifest must be loaded byte for byte.
+			if got := client.loaded[path.Join("blobs", digest.Algorithm, digest.Hex)]; !bytes.Equal(got, raw) {
+				t.Errorf("loaded manifest = %s, want %s", got, raw)
+			}
+			idx, err := v1.ParseIndexManifest(bytes.NewReader(client.loaded["index.json"]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.Manifests) != 1 {
+				t.Fatalf("index has %d manifests, want 1", len(idx.Manifests))
+			}
+			desc := idx.Manifests[0]
+			if desc.Digest != digest || desc.MediaType != ggcrtypes.OCIManifestSchema1 {
+				t.Errorf("index descriptor = %+v, want digest %s and OCI media type", desc, digest)
+			}
+			if got, want := desc.Annotations["io.containerd.image.name"], tag.Name(); got != want {
+				t.Errorf("image name annotation = %q, want %q", got, want)
+			}
+			layers, err := img.Layers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range layers {
+				d, err := l.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := client.loaded[path.Join("blobs", d.Algorithm, d.Hex)]; !ok {
+					t.Errorf("layer %s not loaded", d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package empty
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// JSON is the content of the empty JSON blob, which OCI artifacts without a
+// meaningful config use as their config, see:
+// https://github.com/opencontainers/image-spec/blob/main/manifest.md#guidance-for-an-empty-descriptor
+const JSON = "{}"
+
+// JSONDigest is the digest of JSON.
+const JSONDigest = "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+
+// JSONHash is JSONDigest as a v1.Hash.
+var JSONHash = v1.Hash{
+	Algorithm: "sha256",
+	Hex:       "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+}
+
+// JSONDescriptor returns the descriptor of the empty JSON blob, with its
+// content inlined.
+func JSONDescriptor() v1.Descriptor {
+	return v1.Descriptor{
+		MediaType: types.OCIEmptyJSON,
+		Size:      int64(len(JSON)),
+		Digest:    JSONHash,
+		Data:      []byte(JSON),
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package empty
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestJSON(t *testing.T) {
+	h, size, err := v1.SHA256(strings.NewReader(JSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.String() != JSONDigest || h != JSONHash {
+		t.Errorf("digest of %q = %s, want %s and %s", JSON, h, JSONDigest, JSONHash)
+	}
+
+	desc := JSONDescriptor()
+	if desc.MediaType != types.OCIEmptyJSON || desc.Size != size || desc.Digest != h || string(desc.Data) != JSON {
+		t.Errorf("JSONDescriptor() = %+v", desc)
+	}
+}
@@ -90,7 +90,7 @@ func newLister(repo name.Repository, options ...Option) (*lister, error) {
 func (l *lister) list(repo name.Repository) (*Tags, error) {
 	uri := &url.URL{
 		Scheme: repo.Registry.Scheme(),
-		Host:   repo.Registry.RegistryStr(),
+		Host:   repo.Registry.APIHost(),
 		Path:   fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
 		// ECR returns an error if n > 1000:
 		// https://github.com/google/go-containerregistry/issues/681
@@ -16,6 +16,7 @@ package v1
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -79,6 +80,8 @@ func Hasher(name string) (hash.Hash, error) {
 	switch name {
 	case "sha256":
 		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
 	default:
 		return nil, fmt.Errorf("unsupported hash: %q", name)
 	}
@@ -121,3 +124,20 @@ func SHA256(r io.Reader) (Hash, int64, error) {
 		Hex:       hex.EncodeToString(hasher.Sum(make([]byte, 0, hasher.Size()))),
 	}, n, nil
 }
+
+// ComputeHash computes the Hash of the provided io.Reader's content with the
+// named algorithm (e.g. "sha512"), see Hasher.
+func ComputeHash(algorithm string, r io.Reader) (Hash, int64, error) {
+	hasher, err := Hasher(algorithm)
+	if err != nil {
+		return Hash{}, 0, err
+	}
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return Hash{}, 0, err
+	}
+	return Hash{
+		Algorithm: algorithm,
+		Hex:       hex.EncodeToString(hasher.Sum(make([]byte, 0, hasher.Size()))),
+	}, n, nil
+}
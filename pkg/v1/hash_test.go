@@ -25,6 +25,7 @@ func TestGoodHashes(t *testing.T) {
 	good := []string{
 		"sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
 		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"sha512:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 	}
 
 	for _, s := range good {
@@ -49,6 +50,7 @@ func TestBadHashes(t *testing.T) {
 	bad := []string{
 		// Too short
 		"sha256:deadbeef",
+		"sha512:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 		// Bad character
 		"sha256:o123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 		// Unknown algorithm
@@ -84,6 +86,27 @@ func TestSHA256(t *testing.T) {
 	}
 }
 
+func TestComputeHash(t *testing.T) {
+	input := "asdf"
+	h, n, err := ComputeHash("sha512", strings.NewReader(input))
+	if err != nil {
+		t.Error("ComputeHash(sha512, asdf) =", err)
+	}
+	if got, want := h.Algorithm, "sha512"; got != want {
+		t.Errorf("Algorithm; got %v, want %v", got, want)
+	}
+	if got, want := h.Hex, "401b09eab3c013d4ca54922bb802bec8fd5318192b0a75f201d8b3727429080fb337591abd3e44453b954555b7a0812e1081c39b740293f765eae731f5a65ed1"; got != want {
+		t.Errorf("Hex; got %v, want %v", got, want)
+	}
+	if got, want := n, int64(len(input)); got != want {
+		t.Errorf("n; got %v, want %v", got, want)
+	}
+
+	if _, _, err := ComputeHash("md5", strings.NewReader(input)); err == nil {
+		t.Error("ComputeHash(md5) = nil, wanted error")
+	}
+}
+
 // This tests that you can use Hash as a key in a map (needs to implement both
 // MarshalText and UnmarshalText).
 func TestTextMarshalling(t *testing.T) {
@@ -0,0 +1,68 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+var _ v1.BlobStore = Path("")
+
+// GetBlob implements v1.BlobStore.
+func (l Path) GetBlob(h v1.Hash) (io.ReadCloser, error) {
+	return l.Blob(h)
+}
+
+// PutBlob implements v1.BlobStore.
+func (l Path) PutBlob(h v1.Hash, rc io.ReadCloser) error {
+	defer rc.Close()
+	return l.WriteBlob(h, rc)
+}
+
+// GetManifest implements v1.BlobStore.
+//
+// Manifests are stored as blobs, so the MediaType of the returned Descriptor
+// is taken from the "mediaType" field of the manifest itself.
+func (l Path) GetManifest(h v1.Hash) ([]byte, *v1.Descriptor, error) {
+	b, err := l.Bytes(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mf struct {
+		MediaType types.MediaType `json:"mediaType"`
+	}
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return nil, nil, err
+	}
+	return b, &v1.Descriptor{
+		MediaType: mf.MediaType,
+		Size:      int64(len(b)),
+		Digest:    h,
+	}, nil
+}
+
+// PutManifest implements v1.BlobStore.
+//
+// This writes the manifest to the blobs directory only. To make it
+// discoverable via the index.json, call AppendDescriptor.
+func (l Path) PutManifest(desc v1.Descriptor, raw []byte) error {
+	return l.WriteBlob(desc.Digest, ioutil.NopCloser(bytes.NewReader(raw)))
+}
@@ -23,6 +23,7 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type layoutImage struct {
@@ -44,6 +45,35 @@ func (l Path) Image(h v1.Hash) (v1.Image, error) {
 	return ii.Image(h)
 }
 
+// ImageByRefName reads the v1.Image whose descriptor in the Path's index.json
+// has the given "org.opencontainers.image.ref.name" annotation, see
+// WithRefName. It returns an error if no image, or more than one entry, has
+// that ref name.
+func (l Path) ImageByRefName(name string) (v1.Image, error) {
+	descs, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	var found []v1.Descriptor
+	for _, desc := range descs {
+		if ref, ok := desc.Annotations[specsv1.AnnotationRefName]; ok && ref == name {
+			found = append(found, desc)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no image with ref name %q in layout %s", name, l)
+	case 1:
+	default:
+		digests := make([]string, 0, len(found))
+		for _, desc := range found {
+			digests = append(digests, desc.Digest.String())
+		}
+		return nil, fmt.Errorf("multiple entries with ref name %q in layout %s: %v", name, l, digests)
+	}
+	return l.Image(found[0].Digest)
+}
+
 func (li *layoutImage) MediaType() (types.MediaType, error) {
 	return li.desc.MediaType, nil
 }
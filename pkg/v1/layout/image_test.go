@@ -16,12 +16,16 @@ package layout
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var (
@@ -179,3 +183,83 @@ func TestImageCustomMediaType(t *testing.T) {
 		t.Fatalf("MediaType(); want: %q got: %q", want, got)
 	}
 }
+
+func TestImageByRefName(t *testing.T) {
+	tmp := t.TempDir()
+	lp, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgs := map[string]v1.Image{}
+	for _, ref := range []string{"v1", "v2"} {
+		img, err := random.Image(5, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lp.AppendImage(img, WithRefName(ref)); err != nil {
+			t.Fatal(err)
+		}
+		imgs[ref] = img
+	}
+	// An image without a ref name shouldn't match anything.
+	unnamed, err := random.Image(5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendImage(unnamed); err != nil {
+		t.Fatal(err)
+	}
+
+	descs, err := lp.List()
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if got, want := len(descs), 3; got != want {
+		t.Fatalf("len(List()) = %d, want %d", got, want)
+	}
+	for i, ref := range []string{"v1", "v2", ""} {
+		if got := descs[i].Annotations[specsv1.AnnotationRefName]; got != ref {
+			t.Errorf("List()[%d] ref name = %q, want %q", i, got, ref)
+		}
+	}
+
+	for ref, want := range imgs {
+		img, err := lp.ImageByRefName(ref)
+		if err != nil {
+			t.Fatalf("ImageByRefName(%q) = %v", ref, err)
+		}
+		got, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantDigest, err := want.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != wantDigest {
+			t.Errorf("ImageByRefName(%q) digest = %v, want %v", ref, got, wantDigest)
+		}
+		if err := validate.Image(img); err != nil {
+			t.Errorf("validate.Image() = %v", err)
+		}
+	}
+
+	for _, ref := range []string{"", "v3"} {
+		if _, err := lp.ImageByRefName(ref); err == nil {
+			t.Errorf("ImageByRefName(%q) = nil, expected err", ref)
+		}
+	}
+
+	// Entries sharing a ref name are ambiguous.
+	dup, err := random.Image(5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendImage(dup, WithRefName("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lp.ImageByRefName("v1"); err == nil || !strings.Contains(err.Error(), "multiple entries") {
+		t.Errorf("ImageByRefName(%q) with duplicates = %v, expected err", "v1", err)
+	}
+}
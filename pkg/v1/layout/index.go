@@ -59,6 +59,21 @@ func (l Path) ImageIndex() (v1.ImageIndex, error) {
 	return idx, nil
 }
 
+// List returns the descriptors of the images and indexes in the Path's
+// index.json, including their annotations, e.g. the
+// "org.opencontainers.image.ref.name" annotation used by ImageByRefName.
+func (l Path) List() ([]v1.Descriptor, error) {
+	ii, err := l.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	return im.Manifests, nil
+}
+
 func (i *layoutIndex) MediaType() (types.MediaType, error) {
 	return i.mediaType, nil
 }
@@ -1,6 +1,9 @@
 package layout
 
-import v1 "github.com/google/go-containerregistry/pkg/v1"
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
 
 // Option is a functional option for Layout.
 type Option func(*options)
@@ -35,6 +38,15 @@ func WithAnnotations(annotations map[string]string) Option {
 	}
 }
 
+// WithRefName sets the "org.opencontainers.image.ref.name" annotation of the
+// artifact descriptor, e.g. to the tag of the image, so that tools that
+// select images from a layout by name can find it.
+func WithRefName(ref string) Option {
+	return WithAnnotations(map[string]string{
+		specsv1.AnnotationRefName: ref,
+	})
+}
+
 // WithURLs adds urls to the artifact descriptor.
 func WithURLs(urls []string) Option {
 	return func(o *options) {
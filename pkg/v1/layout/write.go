@@ -16,6 +16,7 @@ package layout
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/logs"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -111,13 +113,11 @@ func (l Path) AppendIndex(ii v1.ImageIndex, options ...Option) error {
 }
 
 // AppendDescriptor adds a descriptor to the index.json of the Path.
+//
+// If the Path doesn't have an index.json yet, e.g. because it is a fresh
+// directory, a new image layout is initialized.
 func (l Path) AppendDescriptor(desc v1.Descriptor) error {
-	ii, err := l.ImageIndex()
-	if err != nil {
-		return err
-	}
-
-	index, err := ii.IndexManifest()
+	index, err := l.indexManifestOrEmpty()
 	if err != nil {
 		return err
 	}
@@ -132,6 +132,25 @@ func (l Path) AppendDescriptor(desc v1.Descriptor) error {
 	return l.WriteFile("index.json", rawIndex, os.ModePerm)
 }
 
+// indexManifestOrEmpty returns the parsed index.json of the Path, or an empty
+// index after writing the oci-layout file if there is no index.json.
+func (l Path) indexManifestOrEmpty() (*v1.IndexManifest, error) {
+	ii, err := l.ImageIndex()
+	if errors.Is(err, os.ErrNotExist) {
+		if err := l.WriteFile("oci-layout", []byte(layoutFile), os.ModePerm); err != nil {
+			return nil, err
+		}
+		return &v1.IndexManifest{
+			SchemaVersion: 2,
+			MediaType:     types.OCIImageIndex,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ii.IndexManifest()
+}
+
 // ReplaceImage writes a v1.Image to the Path and updates
 // the index.json to reference it, replacing any existing one that matches matcher, if found.
 func (l Path) ReplaceImage(img v1.Image, matcher match.Matcher, options ...Option) error {
@@ -224,11 +243,50 @@ func (l Path) WriteFile(name string, data []byte, perm os.FileMode) error {
 
 // WriteBlob copies a file to the blobs/ directory in the Path from the given ReadCloser at
 // blobs/{hash.Algorithm}/{hash.Hex}.
+//
+// The contents are streamed to a temporary file in the same directory while
+// being hashed, and only renamed into place once they're verified to match
+// hash, so a partially-written blob is never visible, even with concurrent
+// writers of the same blob.
 func (l Path) WriteBlob(hash v1.Hash, r io.ReadCloser) error {
-	return l.writeBlob(hash, -1, r, nil)
+	return l.writeBlob(hash, -1, func() (io.ReadCloser, error) { return r, nil }, nil)
+}
+
+// blobWrites tracks the blobs being written by this process, so that
+// concurrent writers of images that share layers only write each blob once.
+var blobWrites = &inflight{writes: map[string]chan struct{}{}}
+
+type inflight struct {
+	sync.Mutex
+	writes map[string]chan struct{}
+}
+
+// acquire blocks until no other goroutine is writing file, then marks it as
+// being written. The returned func must be called once the write is done.
+func (f *inflight) acquire(file string) func() {
+	for {
+		f.Lock()
+		done, ok := f.writes[file]
+		if !ok {
+			done = make(chan struct{})
+			f.writes[file] = done
+			f.Unlock()
+			return func() {
+				f.Lock()
+				delete(f.writes, file)
+				f.Unlock()
+				close(done)
+			}
+		}
+		f.Unlock()
+		<-done
+	}
 }
 
-func (l Path) writeBlob(hash v1.Hash, size int64, rc io.ReadCloser, renamer func() (v1.Hash, error)) error {
+// writeBlob writes the blob returned by open, unless it already exists. open
+// is only called once we know the blob needs writing, which avoids e.g.
+// compressing a layer that's already in the layout.
+func (l Path) writeBlob(hash v1.Hash, size int64, open func() (io.ReadCloser, error), renamer func() (v1.Hash, error)) error {
 	if hash.Hex == "" && renamer == nil {
 		panic("writeBlob called an invalid hash and no renamer")
 	}
@@ -238,33 +296,42 @@ func (l Path) writeBlob(hash v1.Hash, size int64, rc io.ReadCloser, renamer func
 		return err
 	}
 
-	// Check if blob already exists and is the correct size
+	// Check if blob already exists and is the correct size. If someone else
+	// is writing it, wait for them to finish first.
 	file := filepath.Join(dir, hash.Hex)
+	if hash.Hex != "" {
+		defer blobWrites.acquire(file)()
+	}
 	if s, err := os.Stat(file); err == nil && !s.IsDir() && (s.Size() == size || size == -1) {
 		return nil
 	}
 
-	// If a renamer func was provided write to a temporary file
-	open := func() (*os.File, error) { return os.Create(file) }
-	if renamer != nil {
-		open = func() (*os.File, error) { return ioutil.TempFile(dir, hash.Hex) }
-	}
-	w, err := open()
+	rc, err := open()
 	if err != nil {
 		return err
 	}
-	if renamer != nil {
-		// Delete temp file if an error is encountered before renaming
-		defer func() {
-			if err := os.Remove(w.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
-				logs.Warn.Printf("error removing temporary file after encountering an error while writing blob: %v", err)
-			}
-		}()
+
+	// Write to a temporary file, so that nothing ever sees a partial blob.
+	w, err := ioutil.TempFile(dir, hash.Hex)
+	if err != nil {
+		return err
 	}
+	// Delete temp file if an error is encountered before renaming
+	defer func() {
+		if err := os.Remove(w.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logs.Warn.Printf("error removing temporary file after encountering an error while writing blob: %v", err)
+		}
+	}()
 	defer w.Close()
 
-	// Write to file and exit if not renaming
-	if n, err := io.Copy(w, rc); err != nil || renamer == nil {
+	// Hash the contents as we write them, if we know how.
+	var out io.Writer = w
+	hasher, herr := v1.Hasher(hash.Algorithm)
+	if herr == nil {
+		out = io.MultiWriter(w, hasher)
+	}
+
+	if n, err := io.Copy(out, rc); err != nil {
 		return err
 	} else if size != -1 && n != size {
 		return fmt.Errorf("expected blob size %d, but only wrote %d", size, n)
@@ -285,13 +352,37 @@ func (l Path) writeBlob(hash v1.Hash, size int64, rc io.ReadCloser, renamer func
 	}
 
 	// Rename file based on the final hash
-	finalHash, err := renamer()
-	if err != nil {
-		return fmt.Errorf("error getting final digest of layer: %w", err)
+	finalHash := hash
+	if renamer != nil {
+		finalHash, err = renamer()
+		if err != nil {
+			return fmt.Errorf("error getting final digest of layer: %w", err)
+		}
+		if hash.Hex != "" && finalHash != hash {
+			return fmt.Errorf("layer digest changed while writing: was %s, now %s", hash, finalHash)
+		}
+	}
+	if herr == nil && finalHash.Algorithm == hash.Algorithm {
+		got := v1.Hash{
+			Algorithm: hash.Algorithm,
+			Hex:       hex.EncodeToString(hasher.Sum(nil)),
+		}
+		if got != finalHash {
+			return fmt.Errorf("error verifying blob: expected digest %s, got %s", finalHash, got)
+		}
 	}
 
 	renamePath := l.path("blobs", finalHash.Algorithm, finalHash.Hex)
-	return os.Rename(w.Name(), renamePath)
+	if err := os.Rename(w.Name(), renamePath); err != nil {
+		// On some platforms, rename fails if the destination exists, e.g.
+		// because a concurrent writer of the same blob beat us to it. Since
+		// blobs are content-addressed, that's just as good.
+		if _, serr := os.Stat(renamePath); serr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
 // writeLayer writes the compressed layer to a blob. Unlike WriteBlob it will
@@ -326,12 +417,7 @@ func (l Path) writeLayer(layer v1.Layer) error {
 		return err
 	}
 
-	r, err := layer.Compressed()
-	if err != nil {
-		return err
-	}
-
-	if err := l.writeBlob(d, s, r, layer.Digest); err != nil {
+	if err := l.writeBlob(d, s, layer.Compressed, layer.Digest); err != nil {
 		return fmt.Errorf("error writing layer: %w", err)
 	}
 	return nil
@@ -352,7 +438,9 @@ func (l Path) RemoveBlob(hash v1.Hash) error {
 
 // WriteImage writes an image, including its manifest, config and all of its
 // layers, to the blobs directory. If any blob already exists, as determined by
-// the hash filename, does not write it.
+// the hash filename, does not write it, so appending images that share layers
+// to the same layout only writes the shared layers once. This is also true
+// when images are written concurrently.
 // This function does *not* update the `index.json` file. If you want to write the
 // image and also update the `index.json`, call AppendImage(), which wraps this
 // and also updates the `index.json`.
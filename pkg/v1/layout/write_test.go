@@ -22,6 +22,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -29,10 +30,13 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestWrite(t *testing.T) {
@@ -203,6 +207,39 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestWithRefName(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-index-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	img, err := random.Image(5, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Append to a fresh layout, without an existing index.json.
+	if err := Path(tmp).AppendImage(img, WithRefName("v1"), WithAnnotations(map[string]string{"foo": "bar"})); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := Path(tmp).ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexManifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := indexManifest.Manifests[0]
+	if got, want := desc.Annotations[specsv1.AnnotationRefName], "v1"; got != want {
+		t.Errorf("wrong ref.name; got: %v, want: %v", got, want)
+	}
+	if got, want := desc.Annotations["foo"], "bar"; got != want {
+		t.Errorf("wrong annotation; got: %v, want: %v", got, want)
+	}
+}
+
 func TestDeduplicatedWrites(t *testing.T) {
 	lp, err := FromPath(testPath)
 	if err != nil {
@@ -482,6 +519,62 @@ func TestRemoveBlob(t *testing.T) {
 	}
 }
 
+func TestWriteBlobVerifies(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-blob-verify-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := []byte("abcdefghijklmnop")
+	hash, _, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing the wrong content should fail and leave nothing behind.
+	if err := l.WriteBlob(hash, ioutil.NopCloser(strings.NewReader("wrong"))); err == nil {
+		t.Fatal("WriteBlob() with mismatched digest = nil, wanted error")
+	}
+	entries, err := ioutil.ReadDir(l.path("blobs", hash.Algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("WriteBlob() left %d files behind after failing", len(entries))
+	}
+
+	// Concurrent writes of the same blob should all succeed.
+	var g errgroup.Group
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			return l.WriteBlob(hash, ioutil.NopCloser(bytes.NewReader(b)))
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.Bytes(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, got) {
+		t.Fatal("mismatched bytes")
+	}
+	entries, err = ioutil.ReadDir(l.path("blobs", hash.Algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in blobs dir, wanted 1", len(entries))
+	}
+}
+
 func TestStreamingWriteLayer(t *testing.T) {
 	// need to set up a basic path
 	tmp, err := ioutil.TempDir("", "streaming-write-layer-test")
@@ -724,3 +817,90 @@ func TestOverwriteWithReplaceImage(t *testing.T) {
 		t.Fatalf("validating image after attempting repair of truncated layer with ReplaceImage; validate.Image() = %v", err)
 	}
 }
+
+// countingLayer counts how often its compressed contents are read.
+type countingLayer struct {
+	v1.Layer
+	reads *int32
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	atomic.AddInt32(l.reads, 1)
+	return l.Layer.Compressed()
+}
+
+func TestWriteImageSharedLayers(t *testing.T) {
+	shared, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reads int32
+	base, err := mutate.AppendLayers(empty.Image, &countingLayer{Layer: shared, reads: &reads})
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := make([]v1.Image, 4)
+	for i := range images {
+		layer, err := random.Layer(1024, types.OCILayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[i], err = mutate.AppendLayers(base, layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("sequential", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		l, err := Write(t.TempDir(), empty.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, img := range images[:2] {
+			if err := l.AppendImage(img); err != nil {
+				t.Fatalf("AppendImage() = %v", err)
+			}
+		}
+		if got := atomic.LoadInt32(&reads); got != 1 {
+			t.Errorf("shared layer was written %d times, wanted 1", got)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		l, err := Write(t.TempDir(), empty.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g errgroup.Group
+		for _, img := range images {
+			img := img
+			g.Go(func() error {
+				return l.WriteImage(img)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatalf("WriteImage() = %v", err)
+		}
+		if got := atomic.LoadInt32(&reads); got != 1 {
+			t.Errorf("shared layer was written %d times, wanted 1", got)
+		}
+		for _, img := range images {
+			desc, err := partial.Descriptor(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.AppendDescriptor(*desc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := l.Image(desc.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validate.Image(got); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+		}
+	})
+}
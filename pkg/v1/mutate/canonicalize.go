@@ -0,0 +1,136 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// canonicalTime is the modification time of every entry written by
+// Canonicalize. The epoch, unlike the zero time.Time, fits in a ustar header.
+var canonicalTime = time.Unix(0, 0).UTC()
+
+// ExtractOption is a functional option for Extract.
+type ExtractOption func(*extractOptions)
+
+type extractOptions struct {
+	canonicalize bool
+}
+
+// Canonicalize makes Extract write the flattened filesystem in a reproducible
+// form, so that a layer squashed from it has the same digest across runs and
+// machines for the same filesystem contents:
+//
+//   - Entries are sorted by name, except that hardlinks come after everything
+//     else, so that their targets are always written first.
+//   - Modification, access and change times are set to the Unix epoch.
+//   - User and group names are dropped, keeping the numeric IDs.
+//   - PAX records other than extended attributes are dropped.
+//
+// Since entries can only be written once all of the layers have been read,
+// file contents are buffered in a temporary file in the meantime.
+func Canonicalize() ExtractOption {
+	return func(o *extractOptions) {
+		o.canonicalize = true
+	}
+}
+
+// extractCanonical writes the flattened filesystem of img to w as described
+// by Canonicalize.
+func extractCanonical(img v1.Image, w io.Writer) error {
+	tmp, err := ioutil.TempFile("", "extract-canonical")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Stash the contents of each entry in tmp, remembering where they went.
+	type entry struct {
+		header *tar.Header
+		offset int64
+	}
+	var (
+		entries []entry
+		offset  int64
+	)
+	if err := flatten(img, func(header *tar.Header, r io.Reader) error {
+		entries = append(entries, entry{header: canonicalHeader(header), offset: offset})
+		if header.Size > 0 {
+			n, err := io.CopyN(tmp, r, header.Size)
+			offset += n
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		li, lj := entries[i].header.Typeflag == tar.TypeLink, entries[j].header.Typeflag == tar.TypeLink
+		if li != lj {
+			return lj
+		}
+		return entries[i].header.Name < entries[j].header.Name
+	})
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		if err := tw.WriteHeader(e.header); err != nil {
+			return err
+		}
+		if e.header.Size > 0 {
+			if _, err := io.Copy(tw, io.NewSectionReader(tmp, e.offset, e.header.Size)); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// canonicalHeader returns a copy of h with only the fields that describe the
+// file itself, with times set to canonicalTime.
+func canonicalHeader(h *tar.Header) *tar.Header {
+	var pax map[string]string
+	for k, v := range h.PAXRecords {
+		if strings.HasPrefix(k, "SCHILY.xattr.") {
+			if pax == nil {
+				pax = map[string]string{}
+			}
+			pax[k] = v
+		}
+	}
+	return &tar.Header{
+		Typeflag:   h.Typeflag,
+		Name:       h.Name,
+		Linkname:   h.Linkname,
+		Size:       h.Size,
+		Mode:       h.Mode,
+		Uid:        h.Uid,
+		Gid:        h.Gid,
+		ModTime:    canonicalTime,
+		Devmajor:   h.Devmajor,
+		Devminor:   h.Devminor,
+		PAXRecords: pax,
+	}
+}
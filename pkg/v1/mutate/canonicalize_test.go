@@ -0,0 +1,165 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// headerLayer returns a layer with the given headers, where the contents of
+// regular files are their names.
+func headerLayer(t *testing.T, headers ...*tar.Header) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(h.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// squash returns a single layer with the flattened filesystem of img.
+func squash(t *testing.T, img v1.Image, opts ...mutate.ExtractOption) v1.Layer {
+	t.Helper()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return mutate.Extract(img, opts...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestCanonicalize(t *testing.T) {
+	// Build the same filesystem twice, with entries in a different order and
+	// with different metadata that doesn't affect the files themselves.
+	build := func(when time.Time, owner string, reverse bool) v1.Image {
+		dir := func(name string) *tar.Header {
+			return &tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755, ModTime: when, Uname: owner}
+		}
+		file := func(name string) *tar.Header {
+			return &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, ModTime: when, Uname: owner, Gname: owner,
+				PAXRecords: map[string]string{"atime": strconv.FormatInt(when.Unix(), 10), "SCHILY.xattr.user.test": "x"}}
+		}
+		base := []*tar.Header{dir("etc"), file("etc/b"), file("etc/a"), file("etc/gone")}
+		top := []*tar.Header{
+			file("bin/sh"),
+			{Typeflag: tar.TypeLink, Name: "bin/a", Linkname: "etc/a", ModTime: when},
+			dir("bin"),
+			{Typeflag: tar.TypeReg, Name: "etc/.wh.gone", ModTime: when},
+		}
+		if reverse {
+			for _, headers := range [][]*tar.Header{base, top} {
+				for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+					headers[i], headers[j] = headers[j], headers[i]
+				}
+			}
+		}
+		img, err := mutate.AppendLayers(empty.Image, headerLayer(t, base...), headerLayer(t, top...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	a := build(time.Unix(1600000000, 0), "alice", false)
+	b := build(time.Unix(1700000000, 0), "bob", true)
+
+	digest := func(l v1.Layer) v1.Hash {
+		t.Helper()
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	// Without Canonicalize, the order and metadata leak into the digest.
+	if digest(squash(t, a)) == digest(squash(t, b)) {
+		t.Fatal("squashed layers of differently built images are the same without Canonicalize")
+	}
+
+	want := digest(squash(t, a, mutate.Canonicalize()))
+	if got := digest(squash(t, a, mutate.Canonicalize())); got != want {
+		t.Errorf("squashing the same image twice: got %s, want %s", got, want)
+	}
+	if got := digest(squash(t, b, mutate.Canonicalize())); got != want {
+		t.Errorf("squashing an equivalent image: got %s, want %s", got, want)
+	}
+
+	// Check what the canonical form looks like.
+	rc := mutate.Extract(b, mutate.Canonicalize())
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		if !h.ModTime.Equal(time.Unix(0, 0)) {
+			t.Errorf("%s: ModTime = %v, want the epoch", h.Name, h.ModTime)
+		}
+		if h.Uname != "" || h.Gname != "" {
+			t.Errorf("%s: Uname, Gname = %q, %q, want none", h.Name, h.Uname, h.Gname)
+		}
+		if _, ok := h.PAXRecords["atime"]; ok {
+			t.Errorf("%s: got atime PAX record", h.Name)
+		}
+		if h.Typeflag == tar.TypeReg && h.PAXRecords["SCHILY.xattr.user.test"] != "x" {
+			t.Errorf("%s: PAXRecords = %v, want xattr kept", h.Name, h.PAXRecords)
+		}
+	}
+	// Hardlinks come last, so that their targets exist.
+	if diff := cmp.Diff([]string{"bin", "bin/sh", "etc", "etc/a", "etc/b", "bin/a"}, names); diff != "" {
+		t.Errorf("entries (-want +got): %s", diff)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+// ExtractFiles returns the contents of the given paths in the image's
+// flattened filesystem, keyed by the paths as they were passed in.
+//
+// Layers are read from the top down, taking whiteouts into account, and
+// reading stops as soon as every path has been resolved, so lower layers
+// (which may be lazily fetched from a registry) are never read if they aren't
+// needed. Paths that don't exist in the final filesystem, or that aren't
+// regular files, are omitted from the result. Symlinks are not followed.
+func ExtractFiles(img v1.Image, paths []string) (map[string][]byte, error) {
+	// Map tar entry names to the requested paths.
+	pending := map[string][]string{}
+	for _, p := range paths {
+		name := cleanEntryName(p)
+		pending[name] = append(pending[name], p)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %w", err)
+	}
+
+	files := map[string][]byte{}
+	for i := len(layers) - 1; i >= 0 && len(pending) != 0; i-- {
+		if err := extractFiles(layers[i], pending, files); err != nil {
+			return nil, fmt.Errorf("reading layer %d: %w", i, err)
+		}
+	}
+	return files, nil
+}
+
+// extractFiles resolves any pending paths found in layer, removing them from
+// pending and adding the contents of regular files to files.
+func extractFiles(layer v1.Layer, pending map[string][]string, files map[string][]byte) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// An opaque whiteout hides the contents of a directory in lower layers,
+	// but not in this one, so these are applied after reading the layer.
+	opaque := []string{}
+
+	tr := tar.NewReader(rc)
+	for len(pending) != 0 {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+
+		name := cleanEntryName(header.Name)
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" {
+			dir = "."
+		}
+
+		if base == opaqueWhiteout {
+			opaque = append(opaque, dir)
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			// Deletes the entry and anything beneath it.
+			resolveUnder(pending, path.Join(dir, base[len(whiteoutPrefix):]), true)
+			continue
+		}
+
+		if requested, ok := pending[name]; ok {
+			delete(pending, name)
+			if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+				b, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return err
+				}
+				for _, p := range requested {
+					files[p] = b
+				}
+			}
+		}
+		if header.Typeflag != tar.TypeDir {
+			// A non-directory replaces anything that used to be beneath it.
+			resolveUnder(pending, name, false)
+		}
+	}
+
+	for _, dir := range opaque {
+		resolveUnder(pending, dir, false)
+	}
+	return nil
+}
+
+// resolveUnder removes any pending entries beneath name, and name itself if
+// inclusive is set.
+func resolveUnder(pending map[string][]string, name string, inclusive bool) {
+	for p := range pending {
+		if (inclusive && p == name) || name == "." || strings.HasPrefix(p, name+"/") {
+			delete(pending, p)
+		}
+	}
+}
+
+// cleanEntryName normalizes a path or tar entry name so that e.g.
+// "/etc/os-release" and "./etc/os-release" compare equal.
+func cleanEntryName(name string) string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// FileInfo describes an entry in the flattened filesystem of an image.
+type FileInfo struct {
+	// Path is the cleaned path of the entry, relative to the root.
+	Path string
+	// Size is the size of the contents, in bytes.
+	Size int64
+	// Mode holds the permission and type bits of the entry.
+	Mode os.FileMode
+	// Type is the tar type flag of the entry, e.g. tar.TypeSymlink.
+	Type byte
+	UID  int
+	GID  int
+	// Linkname is the target of a symlink or hard link.
+	Linkname string
+}
+
+// ListFiles returns the entries of the flattened filesystem of img, i.e. what
+// Extract would produce, sorted by path. Whiteouts are resolved across layers
+// as they are by Extract, but unlike Extract, the contents of files aren't
+// returned.
+func ListFiles(img v1.Image) ([]FileInfo, error) {
+	files := []FileInfo{}
+	if err := flatten(img, func(header *tar.Header, _ io.Reader) error {
+		files = append(files, FileInfo{
+			Path:     header.Name,
+			Size:     header.Size,
+			Mode:     header.FileInfo().Mode(),
+			Type:     header.Typeflag,
+			UID:      header.Uid,
+			GID:      header.Gid,
+			Linkname: header.Linkname,
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
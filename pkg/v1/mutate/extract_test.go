@@ -0,0 +1,254 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+type entry struct {
+	name     string
+	contents string
+	typeflag byte
+	linkname string
+}
+
+func tarLayer(t *testing.T, entries ...entry) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: typeflag,
+			Linkname: e.linkname,
+			Size:     int64(len(e.contents)),
+			Mode:     0644,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// unreadableLayer fails if anyone tries to read its contents.
+type unreadableLayer struct {
+	v1.Layer
+}
+
+func (l *unreadableLayer) Uncompressed() (io.ReadCloser, error) {
+	return nil, errors.New("should not be read")
+}
+
+func TestExtractFiles(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t,
+			entry{name: "etc/os-release", contents: "base"},
+			entry{name: "etc/hostname", contents: "base"},
+			entry{name: "var/lib/dpkg/status", contents: "base"},
+			entry{name: "opt/app/config", contents: "base"},
+		),
+		tarLayer(t,
+			entry{name: "./etc/os-release", contents: "upper"},
+			entry{name: "etc/.wh.hostname"},
+			entry{name: "opt/app/.wh..wh..opq"},
+			entry{name: "opt/app/other", contents: "upper"},
+			entry{name: "etc/motd", typeflag: tar.TypeSymlink},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mutate.ExtractFiles(img, []string{
+		"/etc/os-release",
+		"/etc/hostname",
+		"/var/lib/dpkg/status",
+		"/opt/app/config",
+		"/opt/app/other",
+		"/etc/motd",
+		"/does/not/exist",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"/etc/os-release":      []byte("upper"),
+		"/var/lib/dpkg/status": []byte("base"),
+		"/opt/app/other":       []byte("upper"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ExtractFiles (-want +got) = %s", diff)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t,
+			entry{name: "etc/", typeflag: tar.TypeDir},
+			entry{name: "etc/os-release", contents: "base"},
+			entry{name: "etc/hostname", contents: "base"},
+			entry{name: "opt/app/config", contents: "base"},
+			entry{name: "tmp/", typeflag: tar.TypeDir},
+			entry{name: "tmp/cache", contents: "base"},
+		),
+		tarLayer(t,
+			entry{name: "./etc/os-release", contents: "upper!"},
+			entry{name: "etc/.wh.hostname"},
+			entry{name: "opt/app/.wh..wh..opq"},
+			entry{name: "opt/app/other", contents: "upper"},
+			entry{name: "etc/motd", typeflag: tar.TypeSymlink, linkname: "os-release"},
+			entry{name: ".wh.tmp"},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := mutate.ListFiles(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]mutate.FileInfo{}
+	names := []string{}
+	for _, f := range files {
+		got[f.Path] = f
+		names = append(names, f.Path)
+	}
+	// etc/hostname and tmp were whited out, and opt/app/config was hidden by
+	// the opaque whiteout.
+	want := []string{"etc", "etc/motd", "etc/os-release", "opt/app/other"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("ListFiles paths (-want +got) = %s", diff)
+	}
+
+	if f := got["etc/os-release"]; f.Size != int64(len("upper!")) || f.Type != tar.TypeReg || f.Mode != 0644 {
+		t.Errorf("etc/os-release = %+v, want the upper regular file", f)
+	}
+	if f := got["etc/motd"]; f.Type != tar.TypeSymlink || f.Linkname != "os-release" {
+		t.Errorf("etc/motd = %+v, want a symlink to os-release", f)
+	}
+	if f := got["etc"]; !f.Mode.IsDir() {
+		t.Errorf("etc = %+v, want a directory", f)
+	}
+}
+
+func TestExtractFiles_StopsEarly(t *testing.T) {
+	base := &unreadableLayer{tarLayer(t, entry{name: "etc/os-release", contents: "base"})}
+	img, err := mutate.AppendLayers(empty.Image,
+		base,
+		tarLayer(t, entry{name: "etc/os-release", contents: "upper"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mutate.ExtractFiles(img, []string{"etc/os-release"})
+	if err != nil {
+		t.Fatalf("ExtractFiles: %v", err)
+	}
+	if want := "upper"; string(got["etc/os-release"]) != want {
+		t.Errorf("ExtractFiles: got %q, want %q", got["etc/os-release"], want)
+	}
+
+	if _, err := mutate.ExtractFiles(img, []string{"etc/passwd"}); err == nil {
+		t.Error("ExtractFiles(etc/passwd): expected error reading base layer")
+	}
+}
+
+func TestDeletePaths(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t,
+			entry{name: "etc/", typeflag: tar.TypeDir},
+			entry{name: "etc/passwd", contents: "root"},
+			entry{name: "etc/shadow", contents: "secret"},
+			entry{name: "var/cache/", typeflag: tar.TypeDir},
+			entry{name: "var/cache/a", contents: "a"},
+			entry{name: "tmp/", typeflag: tar.TypeDir},
+			entry{name: "tmp/b", contents: "b"},
+		),
+		tarLayer(t,
+			entry{name: "var/cache/c", contents: "c"},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := mutate.DeletePaths(img, []string{"/etc/shadow", "tmp", "/var/cache/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := deleted.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(layers), 3; got != want {
+		t.Fatalf("len(Layers()) = %d, want %d", got, want)
+	}
+
+	rc := mutate.Extract(deleted)
+	defer rc.Close()
+	got := []string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, hdr.Name)
+	}
+	sort.Strings(got)
+	want := []string{"etc", "etc/passwd", "var/cache"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Extract() (-want +got) = %s", diff)
+	}
+
+	if _, err := mutate.DeletePaths(img, []string{"/"}); err == nil {
+		t.Error("DeletePaths(/) = nil, wanted error")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/google/go-containerregistry/internal/inline"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
@@ -35,6 +36,7 @@ type image struct {
 	annotations     map[string]string
 	mediaType       *types.MediaType
 	configMediaType *types.MediaType
+	inlineThreshold int64
 	diffIDMap       map[v1.Hash]v1.Layer
 	digestMap       map[v1.Hash]v1.Layer
 }
@@ -131,10 +133,28 @@ func (i *image) compute() error {
 	manifest.Config.Size = sz
 
 	// If Data was set in the base image, we need to update it in the mutated image.
-	if m.Config.Data != nil {
+	if m.Config.Data != nil || (i.inlineThreshold > 0 && sz <= i.inlineThreshold) {
 		manifest.Config.Data = rcfg
 	}
 
+	if i.inlineThreshold > 0 {
+		for j, desc := range manifest.Layers {
+			if !inline.Eligible(desc, i.inlineThreshold) {
+				continue
+			}
+			layer, ok := digestMap[desc.Digest]
+			if !ok {
+				layer, err = i.base.LayerByDigest(desc.Digest)
+				if err != nil {
+					return err
+				}
+			}
+			if manifest.Layers[j].Data, err = inline.Layer(layer, desc); err != nil {
+				return err
+			}
+		}
+	}
+
 	// If the user wants to mutate the media type of the config
 	if i.configMediaType != nil {
 		manifest.Config.MediaType = *i.configMediaType
@@ -145,13 +165,7 @@ func (i *image) compute() error {
 	}
 
 	if i.annotations != nil {
-		if manifest.Annotations == nil {
-			manifest.Annotations = map[string]string{}
-		}
-
-		for k, v := range i.annotations {
-			manifest.Annotations[k] = v
-		}
+		manifest.Annotations = mergeAnnotations(manifest.Annotations, i.annotations)
 	}
 
 	i.configFile = configFile
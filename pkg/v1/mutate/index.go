@@ -135,12 +135,7 @@ func (i *index) compute() error {
 	}
 
 	if i.annotations != nil {
-		if manifest.Annotations == nil {
-			manifest.Annotations = map[string]string{}
-		}
-		for k, v := range i.annotations {
-			manifest.Annotations[k] = v
-		}
+		manifest.Annotations = mergeAnnotations(manifest.Annotations, i.annotations)
 	}
 
 	i.manifest = manifest
@@ -27,12 +27,14 @@ import (
 	"time"
 
 	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/pkg/logs"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 const whiteoutPrefix = ".wh."
@@ -48,6 +50,10 @@ type Addendum struct {
 }
 
 // AppendLayers applies layers to a base image.
+//
+// Layers are always appended, even if the image already contains a layer
+// with the same diff ID, for callers that want repeated layers. Use
+// AppendLayersWithOptions and WithDedup to skip them instead.
 func AppendLayers(base v1.Image, layers ...v1.Layer) (v1.Image, error) {
 	additions := make([]Addendum, 0, len(layers))
 	for _, layer := range layers {
@@ -57,6 +63,69 @@ func AppendLayers(base v1.Image, layers ...v1.Layer) (v1.Image, error) {
 	return Append(base, additions...)
 }
 
+// AppendOption is a functional option for AppendLayersWithOptions.
+type AppendOption func(*appendOptions)
+
+type appendOptions struct {
+	dedup bool
+}
+
+// WithDedup skips appending layers whose diff ID matches that of a layer
+// already in the image, or of an earlier layer being appended, so that e.g.
+// re-running a build step doesn't add an identical layer again.
+//
+// The diff ID of every appended layer has to be known up front, so this
+// doesn't work with streaming layers.
+func WithDedup() AppendOption {
+	return func(o *appendOptions) {
+		o.dedup = true
+	}
+}
+
+// AppendLayersWithOptions applies layers to a base image, like AppendLayers,
+// with the given options.
+func AppendLayersWithOptions(base v1.Image, layers []v1.Layer, opts ...AppendOption) (v1.Image, error) {
+	o := &appendOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.dedup {
+		var err error
+		if layers, err = dedupLayers(base, layers); err != nil {
+			return nil, err
+		}
+	}
+	return AppendLayers(base, layers...)
+}
+
+// dedupLayers returns the layers whose diff IDs aren't in base, or earlier in
+// layers.
+func dedupLayers(base v1.Image, layers []v1.Layer) ([]v1.Layer, error) {
+	cf, err := base.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[v1.Hash]bool{}
+	for _, diffID := range cf.RootFS.DiffIDs {
+		seen[diffID] = true
+	}
+
+	deduped := make([]v1.Layer, 0, len(layers))
+	for _, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return nil, fmt.Errorf("getting diff ID to dedup layer: %w", err)
+		}
+		if seen[diffID] {
+			continue
+		}
+		seen[diffID] = true
+		deduped = append(deduped, layer)
+	}
+	return deduped, nil
+}
+
 // Append will apply the list of addendums to the base image
 func Append(base v1.Image, adds ...Addendum) (v1.Image, error) {
 	if len(adds) == 0 {
@@ -104,6 +173,60 @@ func RemoveManifests(base v1.ImageIndex, matcher match.Matcher) v1.ImageIndex {
 	}
 }
 
+// ErrManifestNotFound is returned by RemoveManifestByPlatform and
+// RemoveManifestByDigest with WithErrorIfMissing when no child matches.
+var ErrManifestNotFound = errors.New("no matching manifest in index")
+
+// RemoveOption is a functional option for RemoveManifestByPlatform and
+// RemoveManifestByDigest.
+type RemoveOption func(*removeOptions)
+
+type removeOptions struct {
+	errIfMissing bool
+}
+
+// WithErrorIfMissing makes RemoveManifestByPlatform and RemoveManifestByDigest
+// return an error wrapping ErrManifestNotFound when there's nothing to remove,
+// rather than the index as is.
+func WithErrorIfMissing() RemoveOption {
+	return func(o *removeOptions) {
+		o.errIfMissing = true
+	}
+}
+
+// RemoveManifestByPlatform returns base without the children whose platform is
+// exactly p, e.g. to trim unwanted platforms from a multi-platform image.
+// Children without a platform are kept. See WithErrorIfMissing.
+func RemoveManifestByPlatform(base v1.ImageIndex, p v1.Platform, opts ...RemoveOption) (v1.ImageIndex, error) {
+	return removeManifest(base, match.Platforms(p), "platform "+p.String(), opts)
+}
+
+// RemoveManifestByDigest returns base without the child with digest h. See
+// WithErrorIfMissing.
+func RemoveManifestByDigest(base v1.ImageIndex, h v1.Hash, opts ...RemoveOption) (v1.ImageIndex, error) {
+	return removeManifest(base, match.Digests(h), "digest "+h.String(), opts)
+}
+
+func removeManifest(base v1.ImageIndex, matcher match.Matcher, what string, opts []RemoveOption) (v1.ImageIndex, error) {
+	o := &removeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	m, err := base.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range m.Manifests {
+		if matcher(desc) {
+			return RemoveManifests(base, matcher), nil
+		}
+	}
+	if o.errIfMissing {
+		return nil, fmt.Errorf("removing manifest with %s: %w", what, ErrManifestNotFound)
+	}
+	return base, nil
+}
+
 // Config mutates the provided v1.Image to have the provided v1.Config
 func Config(base v1.Image, cfg v1.Config) (v1.Image, error) {
 	cf, err := base.ConfigFile()
@@ -123,6 +246,10 @@ type Annotatable interface {
 
 // Annotations mutates the annotations on an annotatable image or index manifest.
 //
+// The given annotations are merged into any existing ones. An empty value
+// removes that annotation, the same way empty labels are treated by docker.
+// Use partial.Annotations to read the current annotations.
+//
 // The annotatable input is expected to be a v1.Image or v1.ImageIndex, and
 // returns the same type. You can type-assert the result like so:
 //
@@ -168,20 +295,48 @@ func (a arbitraryRawManifest) RawManifest() ([]byte, error) {
 	if err := json.Unmarshal(b, &m); err != nil {
 		return nil, err
 	}
+	existing := map[string]string{}
 	if ann, ok := m["annotations"]; ok {
-		if annm, ok := ann.(map[string]string); ok {
-			for k, v := range a.anns {
-				annm[k] = v
-			}
-		} else {
+		annm, ok := ann.(map[string]interface{})
+		if !ok {
 			return nil, fmt.Errorf(".annotations is not a map: %T", ann)
 		}
+		for k, v := range annm {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf(".annotations[%q] is not a string: %T", k, v)
+			}
+			existing[k] = s
+		}
+	}
+	if merged := mergeAnnotations(existing, a.anns); merged != nil {
+		m["annotations"] = merged
 	} else {
-		m["annotations"] = a.anns
+		delete(m, "annotations")
 	}
 	return json.Marshal(m)
 }
 
+// mergeAnnotations sets anns on base, which may be nil, deleting any keys
+// with empty values. It returns nil if no annotations are left, so that the
+// field is omitted from the manifest.
+func mergeAnnotations(base, anns map[string]string) map[string]string {
+	if base == nil {
+		base = map[string]string{}
+	}
+	for k, v := range anns {
+		if v == "" {
+			delete(base, k)
+		} else {
+			base[k] = v
+		}
+	}
+	if len(base) == 0 {
+		return nil
+	}
+	return base
+}
+
 // ConfigFile mutates the provided v1.Image to have the provided v1.ConfigFile
 func ConfigFile(base v1.Image, cfg *v1.ConfigFile) (v1.Image, error) {
 	m, err := base.Manifest()
@@ -198,6 +353,73 @@ func ConfigFile(base v1.Image, cfg *v1.ConfigFile) (v1.Image, error) {
 	return image, nil
 }
 
+// ConfigOption is a functional option for ConfigFileFull.
+type ConfigOption func(*configOptions)
+
+type configOptions struct {
+	fixRootFS bool
+}
+
+// WithRootFSFromLayers makes ConfigFileFull replace the RootFS of the given
+// config with the diff IDs of the image's layers, rather than erroring when
+// they disagree.
+func WithRootFSFromLayers() ConfigOption {
+	return func(o *configOptions) {
+		o.fixRootFS = true
+	}
+}
+
+// ConfigFileFull replaces the entire config file of the provided v1.Image with
+// cf, recomputing the config blob and manifest.
+//
+// The diff IDs in cf.RootFS have to match the image's layers. If cf has no
+// diff IDs, the ones of the layers are used; if they disagree, an error is
+// returned unless WithRootFSFromLayers is given.
+func ConfigFileFull(base v1.Image, cf v1.ConfigFile, opts ...ConfigOption) (v1.Image, error) {
+	o := &configOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	layers, err := base.Layers()
+	if err != nil {
+		return nil, err
+	}
+	diffIDs := make([]v1.Hash, 0, len(layers))
+	for _, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return nil, err
+		}
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	cfg := cf.DeepCopy()
+	switch {
+	case len(cfg.RootFS.DiffIDs) == 0 || o.fixRootFS:
+		cfg.RootFS.DiffIDs = diffIDs
+	case !equalHashes(cfg.RootFS.DiffIDs, diffIDs):
+		return nil, fmt.Errorf("config has diff IDs %v, but the image's layers have %v", cfg.RootFS.DiffIDs, diffIDs)
+	}
+	if cfg.RootFS.Type == "" {
+		cfg.RootFS.Type = "layers"
+	}
+
+	return ConfigFile(base, cfg)
+}
+
+func equalHashes(a, b []v1.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // CreatedAt mutates the provided v1.Image to have the provided v1.Time
 func CreatedAt(base v1.Image, created v1.Time) (v1.Image, error) {
 	cf, err := base.ConfigFile()
@@ -211,6 +433,53 @@ func CreatedAt(base v1.Image, created v1.Time) (v1.Image, error) {
 	return ConfigFile(base, cfg)
 }
 
+// HistoryOption is a functional option for ClearHistory.
+type HistoryOption func(*historyOptions)
+
+type historyOptions struct {
+	minimal bool
+}
+
+// WithMinimalHistory makes ClearHistory replace the history with one minimal
+// entry per layer, created at the same time as the image, rather than none at
+// all. This keeps the history consistent with the layers for tools that check
+// that the number of non-empty-layer entries matches the number of diff IDs.
+func WithMinimalHistory() HistoryOption {
+	return func(o *historyOptions) {
+		o.minimal = true
+	}
+}
+
+// ClearHistory removes all of the history entries from the config of the
+// provided v1.Image, e.g. because they're malformed, recomputing the config
+// blob and manifest. See WithMinimalHistory.
+func ClearHistory(base v1.Image, opts ...HistoryOption) (v1.Image, error) {
+	o := &historyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cf, err := base.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfg := cf.DeepCopy()
+	cfg.History = nil
+
+	if o.minimal {
+		layers, err := base.Layers()
+		if err != nil {
+			return nil, err
+		}
+		cfg.History = make([]v1.History, 0, len(layers))
+		for range layers {
+			cfg.History = append(cfg.History, v1.History{Created: cfg.Created})
+		}
+	}
+
+	return ConfigFile(base, cfg)
+}
+
 // Extract takes an image and returns an io.ReadCloser containing the image's
 // flattened filesystem.
 //
@@ -219,7 +488,15 @@ func CreatedAt(base v1.Image, created v1.Time) (v1.Image, error) {
 //
 // If a caller doesn't read the full contents, they should Close it to free up
 // resources used during extraction.
-func Extract(img v1.Image) io.ReadCloser {
+//
+// By default, entries are written in the order they're found in the layers,
+// with their headers as is. See Canonicalize for a reproducible alternative.
+func Extract(img v1.Image, opts ...ExtractOption) io.ReadCloser {
+	o := &extractOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	pr, pw := io.Pipe()
 
 	go func() {
@@ -227,7 +504,11 @@ func Extract(img v1.Image) io.ReadCloser {
 		// extraction. These errors will be returned by the reader end
 		// on subsequent reads. If err == nil, the reader will return
 		// EOF.
-		pw.CloseWithError(extract(img, pw))
+		if o.canonicalize {
+			pw.CloseWithError(extractCanonical(img, pw))
+		} else {
+			pw.CloseWithError(extract(img, pw))
+		}
 	}()
 
 	return pr
@@ -238,6 +519,21 @@ func extract(img v1.Image, w io.Writer) error {
 	tarWriter := tar.NewWriter(w)
 	defer tarWriter.Close()
 
+	return flatten(img, func(header *tar.Header, r io.Reader) error {
+		tarWriter.WriteHeader(header)
+		if header.Size > 0 {
+			if _, err := io.CopyN(tarWriter, r, header.Size); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// flatten calls fn with the header and contents of each entry in the
+// flattened filesystem of img, after resolving whiteouts. Layers are read one
+// at a time, from the top down; fn doesn't have to consume the contents.
+func flatten(img v1.Image, fn func(*tar.Header, io.Reader) error) error {
 	fileMap := map[string]bool{}
 
 	layers, err := img.Layers()
@@ -254,6 +550,9 @@ func extract(img v1.Image, w io.Writer) error {
 			return fmt.Errorf("reading layer contents: %w", err)
 		}
 		defer layerReader.Close()
+		// An opaque whiteout hides the contents of a directory in lower layers,
+		// but not in this one, so these are applied after reading the layer.
+		opaque := []string{}
 		tarReader := tar.NewReader(layerReader)
 		for {
 			header, err := tarReader.Next()
@@ -270,6 +569,10 @@ func extract(img v1.Image, w io.Writer) error {
 
 			basename := filepath.Base(header.Name)
 			dirname := filepath.Dir(header.Name)
+			if basename == opaqueWhiteout {
+				opaque = append(opaque, dirname)
+				continue
+			}
 			tombstone := strings.HasPrefix(basename, whiteoutPrefix)
 			if tombstone {
 				basename = basename[len(whiteoutPrefix):]
@@ -297,14 +600,14 @@ func extract(img v1.Image, w io.Writer) error {
 			// any entries with a matching (or child) name
 			fileMap[name] = tombstone || !(header.Typeflag == tar.TypeDir)
 			if !tombstone {
-				tarWriter.WriteHeader(header)
-				if header.Size > 0 {
-					if _, err := io.CopyN(tarWriter, tarReader, header.Size); err != nil {
-						return err
-					}
+				if err := fn(header, tarReader); err != nil {
+					return err
 				}
 			}
 		}
+		for _, dir := range opaque {
+			fileMap[dir] = true
+		}
 	}
 	return nil
 }
@@ -383,6 +686,75 @@ func Time(img v1.Image, t time.Time) (v1.Image, error) {
 	return ConfigFile(newImage, cfg)
 }
 
+// IndexTime is like Time for every image in idx, recursing into nested
+// indexes, so that the whole tree is reproducible. The children keep their
+// platforms and annotations, and the resulting index is annotated with t as
+// its "org.opencontainers.image.created" time. Children that are neither
+// images nor indexes, e.g. artifacts, are carried over untouched if idx can
+// return them as a layer, and dropped otherwise.
+func IndexTime(idx v1.ImageIndex, t time.Time) (v1.ImageIndex, error) {
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("getting index manifest: %w", err)
+	}
+	mt, err := idx.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("getting index media type: %w", err)
+	}
+
+	adds := make([]IndexAddendum, 0, len(m.Manifests))
+	for _, desc := range m.Manifests {
+		var add Appendable
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = IndexTime(child, t); err != nil {
+				return nil, fmt.Errorf("setting times of index %s: %w", desc.Digest, err)
+			}
+		case desc.MediaType.IsImage():
+			child, err := idx.Image(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if add, err = Time(child, t); err != nil {
+				return nil, fmt.Errorf("setting times of image %s: %w", desc.Digest, err)
+			}
+		default:
+			wl, ok := idx.(withLayer)
+			if !ok {
+				logs.Warn.Printf("IndexTime: dropping %s with unsupported media type %q", desc.Digest, desc.MediaType)
+				continue
+			}
+			layer, err := wl.Layer(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			adds = append(adds, IndexAddendum{Add: layer, Descriptor: desc})
+			continue
+		}
+		adds = append(adds, IndexAddendum{
+			Add: add,
+			Descriptor: v1.Descriptor{
+				Platform:    desc.Platform,
+				URLs:        desc.URLs,
+				Annotations: desc.Annotations,
+			},
+		})
+	}
+
+	anns := make(map[string]string, len(m.Annotations)+1)
+	for k, v := range m.Annotations {
+		anns[k] = v
+	}
+	anns[specsv1.AnnotationCreated] = t.UTC().Format(time.RFC3339)
+
+	newIndex := AppendManifests(IndexMediaType(empty.Index, mt), adds...)
+	return Annotations(newIndex, anns).(v1.ImageIndex), nil
+}
+
 func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
 	layerReader, err := layer.Uncompressed()
 	if err != nil {
@@ -435,6 +807,13 @@ func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
 
 // Canonical is a helper function to combine Time and configFile
 // to remove any randomness during a docker build.
+//
+// All timestamps (config, history, and layer contents) are zeroed, and
+// host-dependent fields like container, docker_version, Hostname, Domainname
+// and MacAddress are cleared. Fields that ConfigFile doesn't model, such as
+// container_config, are dropped when the config is re-serialized, so the
+// digest of the result depends only on the image's contents and runtime
+// config.
 func Canonical(img v1.Image) (v1.Image, error) {
 	// Set all timestamps to 0
 	created := time.Time{}
@@ -453,6 +832,8 @@ func Canonical(img v1.Image) (v1.Image, error) {
 
 	cfg.Container = ""
 	cfg.Config.Hostname = ""
+	cfg.Config.Domainname = ""
+	cfg.Config.MacAddress = ""
 	cfg.DockerVersion = ""
 
 	return ConfigFile(img, cfg)
@@ -474,6 +855,19 @@ func ConfigMediaType(img v1.Image, mt types.MediaType) v1.Image {
 	}
 }
 
+// InlineData embeds the content of the config and of any distributable layer
+// of img no bigger than threshold bytes in the data field of its descriptor, so
+// that clients can read it straight from the manifest. See:
+// https://github.com/opencontainers/image-spec/blob/main/descriptor.md#embedded-content
+//
+// Since this changes the manifest, the result has a different digest than img.
+func InlineData(img v1.Image, threshold int64) v1.Image {
+	return &image{
+		base:            img,
+		inlineThreshold: threshold,
+	}
+}
+
 // IndexMediaType modifies the MediaType() of the given index.
 func IndexMediaType(idx v1.ImageIndex, mt types.MediaType) v1.ImageIndex {
 	return &index{
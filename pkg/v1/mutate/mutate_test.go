@@ -17,6 +17,7 @@ package mutate_test
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -32,6 +33,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -227,6 +229,174 @@ func TestAppendLayers(t *testing.T) {
 	}
 }
 
+func TestConfigFileFull(t *testing.T) {
+	source := sourceImage(t)
+	cf, err := source.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := v1.ConfigFile{
+		Architecture: "arm64",
+		OS:           "linux",
+		Config: v1.Config{
+			Env: []string{"FOO=bar"},
+		},
+	}
+
+	// Without diff IDs, they come from the image's layers.
+	result, err := mutate.ConfigFileFull(source, want)
+	if err != nil {
+		t.Fatalf("ConfigFileFull() = %v", err)
+	}
+	got, err := result.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Architecture != want.Architecture || !reflect.DeepEqual(got.Config, want.Config) {
+		t.Errorf("ConfigFileFull() didn't replace the config: got %+v", got)
+	}
+	if diff := cmp.Diff(cf.RootFS, got.RootFS); diff != "" {
+		t.Errorf("ConfigFileFull() wrong RootFS (-want +got) = %s", diff)
+	}
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	// Mismatched diff IDs are an error...
+	bogus := want
+	bogus.RootFS = v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}}}
+	if _, err := mutate.ConfigFileFull(source, bogus); err == nil {
+		t.Error("ConfigFileFull() with mismatched diff IDs, want error")
+	}
+
+	// ... unless they're fixed up.
+	result, err = mutate.ConfigFileFull(source, bogus, mutate.WithRootFSFromLayers())
+	if err != nil {
+		t.Fatalf("ConfigFileFull() = %v", err)
+	}
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
+func TestClearHistory(t *testing.T) {
+	base, err := random.Image(100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.Created = v1.Time{Time: time.Unix(1234, 0).UTC()}
+	// More entries than layers, which is malformed.
+	cf.History = []v1.History{{CreatedBy: "a"}, {CreatedBy: "b"}, {CreatedBy: "c"}, {CreatedBy: "d"}, {CreatedBy: "e", EmptyLayer: true}}
+	source, err := mutate.ConfigFile(base, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []mutate.HistoryOption
+		want []v1.History
+	}{{
+		name: "clear",
+	}, {
+		name: "minimal",
+		opts: []mutate.HistoryOption{mutate.WithMinimalHistory()},
+		want: []v1.History{{Created: cf.Created}, {Created: cf.Created}, {Created: cf.Created}},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := mutate.ClearHistory(source, tc.opts...)
+			if err != nil {
+				t.Fatalf("ClearHistory() = %v", err)
+			}
+			got, err := result.ConfigFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got.History); diff != "" {
+				t.Errorf("ClearHistory() wrong history (-want +got) = %s", diff)
+			}
+			if diff := cmp.Diff(cf.RootFS, got.RootFS); diff != "" {
+				t.Errorf("ClearHistory() changed RootFS (-want +got) = %s", diff)
+			}
+			if got.Created != cf.Created {
+				t.Errorf("ClearHistory() changed Created to %v", got.Created)
+			}
+
+			// The config blob and manifest are recomputed.
+			if err := validate.Image(result); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+			before, err := source.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := result.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before == after {
+				t.Error("ClearHistory() didn't change the digest")
+			}
+		})
+	}
+}
+
+func TestAppendLayersWithDedup(t *testing.T) {
+	source := sourceImage(t)
+	sourceLayers := getLayers(t, source)
+	layer, err := random.Layer(100, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without dedup, duplicates are preserved.
+	result, err := mutate.AppendLayersWithOptions(source, []v1.Layer{sourceLayers[0], layer, layer})
+	if err != nil {
+		t.Fatalf("failed to append layers: %v", err)
+	}
+	if got, want := len(getLayers(t, result)), 4; got != want {
+		t.Errorf("got %d layers without dedup, want %d", got, want)
+	}
+
+	// With dedup, the layer already in source and the repeated layer are
+	// skipped.
+	result, err = mutate.AppendLayersWithOptions(source, []v1.Layer{sourceLayers[0], layer, layer}, mutate.WithDedup())
+	if err != nil {
+		t.Fatalf("failed to append layers: %v", err)
+	}
+	layers := getLayers(t, result)
+	if got, want := len(layers), 2; got != want {
+		t.Fatalf("got %d layers with dedup, want %d", got, want)
+	}
+	if layers[1] != layer {
+		t.Errorf("correct layer was not appended: got %v; want %v", layers[1], layer)
+	}
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	// Appending only duplicates is a no-op.
+	result, err = mutate.AppendLayersWithOptions(source, sourceLayers, mutate.WithDedup())
+	if err != nil {
+		t.Fatalf("failed to append layers: %v", err)
+	}
+	if !manifestsAreEqual(t, source, result) {
+		t.Error("appending only duplicate layers mutated the manifest")
+	}
+
+	// Streaming layers can't be deduped before they're consumed.
+	sl := stream.NewLayer(ioutil.NopCloser(strings.NewReader("hello")))
+	if _, err := mutate.AppendLayersWithOptions(source, []v1.Layer{sl}, mutate.WithDedup()); err == nil {
+		t.Error("AppendLayersWithOptions(stream.Layer, WithDedup()) = nil, expected err")
+	}
+}
+
 func TestMutateConfig(t *testing.T) {
 	source := sourceImage(t)
 	cfg, err := source.ConfigFile()
@@ -306,6 +476,111 @@ func TestAnnotations(t *testing.T) {
 	}
 }
 
+func TestAnnotationsDelete(t *testing.T) {
+	base := mutate.Annotations(empty.Image, map[string]string{
+		"foo": "bar",
+		"baz": "quux",
+	}).(v1.Image)
+
+	for _, c := range []struct {
+		desc string
+		in   mutate.Annotatable
+		anns map[string]string
+		want string
+	}{{
+		desc: "image",
+		in:   base,
+		anns: map[string]string{"foo": ""},
+		want: `{"baz":"quux"}`,
+	}, {
+		desc: "image, all removed",
+		in:   base,
+		anns: map[string]string{"foo": "", "baz": ""},
+		want: `{}`,
+	}, {
+		desc: "index",
+		in:   mutate.Annotations(empty.Index, map[string]string{"foo": "bar"}),
+		anns: map[string]string{"foo": "", "new": "value"},
+		want: `{"new":"value"}`,
+	}, {
+		desc: "arbitrary",
+		in:   mutate.Annotations(arbitrary{}, map[string]string{"foo": "bar"}),
+		anns: map[string]string{"foo": ""},
+		want: `{}`,
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			got, err := partial.Annotations(mutate.Annotations(c.in, c.anns))
+			if err != nil {
+				t.Fatalf("Annotations: %v", err)
+			}
+			b, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(c.want, string(b)); d != "" {
+				t.Errorf("Diff(-want,+got): %s", d)
+			}
+		})
+	}
+
+	raw, err := mutate.Annotations(base, map[string]string{"foo": "", "baz": ""}).RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "annotations") {
+		t.Errorf("removing all annotations should omit the field, got %s", raw)
+	}
+}
+
+func TestInlineData(t *testing.T) {
+	small, err := random.Layer(100, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, err := random.Layer(10000, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := mutate.AppendLayers(empty.Image, small, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallSize, err := small.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := mutate.InlineData(base, smallSize)
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Config.Size <= smallSize && m.Config.Data == nil {
+		t.Errorf("config of %d bytes not inlined", m.Config.Size)
+	}
+	if m.Layers[0].Data == nil {
+		t.Error("small layer not inlined")
+	}
+	if m.Layers[1].Data != nil {
+		t.Error("big layer inlined")
+	}
+	for _, desc := range append(m.Layers, m.Config) {
+		if desc.Data == nil {
+			continue
+		}
+		h, sz, err := v1.SHA256(bytes.NewReader(desc.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != desc.Digest || sz != desc.Size {
+			t.Errorf("inlined data for %s doesn't match: got %s (%d bytes)", desc.Digest, h, sz)
+		}
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
 func TestMutateCreatedAt(t *testing.T) {
 	source := sourceImage(t)
 	want := time.Now().Add(-2 * time.Minute)
@@ -543,6 +818,51 @@ func TestCanonical(t *testing.T) {
 	}
 }
 
+func TestCanonicalDigest(t *testing.T) {
+	source := sourceImage(t)
+	cf, err := source.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the same build on a different machine.
+	cfg := cf.DeepCopy()
+	cfg.Created = v1.Time{Time: time.Unix(1234567890, 0)}
+	cfg.Container = "some-other-container"
+	cfg.DockerVersion = "20.10.0"
+	cfg.Config.Hostname = "some-other-host"
+	cfg.Config.Domainname = "example.com"
+	cfg.Config.MacAddress = "02:42:ac:11:00:02"
+	for i := range cfg.History {
+		cfg.History[i].Created = cfg.Created
+	}
+	other, err := mutate.ConfigFile(source, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := mutate.Canonical(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := mutate.Canonical(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDigest, err := want.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotDigest, err := got.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantDigest != gotDigest {
+		t.Errorf("Canonical digests differ: %s != %s", wantDigest, gotDigest)
+	}
+}
+
 func TestRemoveManifests(t *testing.T) {
 	// Load up the registry.
 	count := 3
@@ -576,6 +896,101 @@ func TestRemoveManifests(t *testing.T) {
 	}
 }
 
+func TestRemoveManifestByKey(t *testing.T) {
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "windows", Architecture: "amd64"},
+	}
+	var adds []mutate.IndexAddendum
+	for i := range platforms {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adds = append(adds, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platforms[i]},
+		})
+	}
+	ii := mutate.AppendManifests(empty.Index, adds...)
+	before, err := ii.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, got v1.ImageIndex, removed v1.Hash) {
+		t.Helper()
+		gm, err := got.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gm.Manifests) != len(m.Manifests)-1 {
+			t.Fatalf("got %d manifests, want %d", len(gm.Manifests), len(m.Manifests)-1)
+		}
+		for _, desc := range gm.Manifests {
+			if desc.Digest == removed {
+				t.Errorf("found removed manifest %s", removed)
+			}
+		}
+		after, err := got.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after == before {
+			t.Error("index digest didn't change")
+		}
+		if err := validate.Index(got); err != nil {
+			t.Errorf("validate.Index() = %v", err)
+		}
+	}
+
+	t.Run("platform", func(t *testing.T) {
+		got, err := mutate.RemoveManifestByPlatform(ii, platforms[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got, m.Manifests[1].Digest)
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		got, err := mutate.RemoveManifestByDigest(ii, m.Manifests[2].Digest, mutate.WithErrorIfMissing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got, m.Manifests[2].Digest)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		missing := v1.Platform{OS: "linux", Architecture: "arm64"}
+		got, err := mutate.RemoveManifestByPlatform(ii, missing)
+		if err != nil {
+			t.Fatalf("RemoveManifestByPlatform() = %v", err)
+		}
+		if got != ii {
+			t.Error("removing a missing platform changed the index")
+		}
+		if _, err := mutate.RemoveManifestByPlatform(ii, missing, mutate.WithErrorIfMissing()); !errors.Is(err, mutate.ErrManifestNotFound) {
+			t.Errorf("RemoveManifestByPlatform(WithErrorIfMissing) = %v, want ErrManifestNotFound", err)
+		}
+
+		h, err := v1.NewHash("sha256:" + strings.Repeat("0", 64))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := mutate.RemoveManifestByDigest(ii, h); err != nil || got != ii {
+			t.Errorf("RemoveManifestByDigest(missing) = %v, %v, want the index unchanged", got, err)
+		}
+		if _, err := mutate.RemoveManifestByDigest(ii, h, mutate.WithErrorIfMissing()); !errors.Is(err, mutate.ErrManifestNotFound) {
+			t.Errorf("RemoveManifestByDigest(WithErrorIfMissing) = %v, want ErrManifestNotFound", err)
+		}
+	})
+}
+
 func TestImageImmutability(t *testing.T) {
 	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
 
@@ -736,3 +1151,116 @@ func (m mockLayer) Compressed() (io.ReadCloser, error) {
 func (m mockLayer) Uncompressed() (io.ReadCloser, error) {
 	return ioutil.NopCloser(strings.NewReader("uncompressed")), nil
 }
+
+func TestMutateIndexTime(t *testing.T) {
+	img1, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img2, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := random.Layer(1024, "application/vnd.example.artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := &v1.Platform{OS: "linux", Architecture: "arm64"}
+
+	// Build two trees that only differ in their timestamps.
+	tree := func(created time.Time) v1.ImageIndex {
+		i1, err := mutate.CreatedAt(img1, v1.Time{Time: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i2, err := mutate.CreatedAt(img2, v1.Time{Time: created.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nested := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: i2})
+		return mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+			Add:        i1,
+			Descriptor: v1.Descriptor{Platform: platform},
+		}, mutate.IndexAddendum{
+			Add: nested,
+		}, mutate.IndexAddendum{
+			Add: artifact,
+		})
+	}
+	a, b := tree(time.Now()), tree(time.Now().Add(-24*time.Hour))
+
+	want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ra, err := mutate.IndexTime(a, want)
+	if err != nil {
+		t.Fatalf("IndexTime: %v", err)
+	}
+	rb, err := mutate.IndexTime(b, want)
+	if err != nil {
+		t.Fatalf("IndexTime: %v", err)
+	}
+	if err := validate.Index(ra); err != nil {
+		t.Errorf("validate.Index: %v", err)
+	}
+
+	da, err := ra.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := rb.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if da != db {
+		t.Errorf("IndexTime digests differ: %s != %s", da, db)
+	}
+
+	m, err := ra.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Annotations["org.opencontainers.image.created"], "2020-01-01T00:00:00Z"; got != want {
+		t.Errorf("created annotation: got %q, want %q", got, want)
+	}
+	if len(m.Manifests) != 3 {
+		t.Fatalf("got %d manifests, want 3", len(m.Manifests))
+	}
+	// Artifacts are carried over as they are.
+	if got, err := partial.Descriptor(artifact); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff(*got, m.Manifests[2]); diff != "" {
+		t.Errorf("artifact descriptor (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff(platform, m.Manifests[0].Platform); diff != "" {
+		t.Errorf("Platform (-want +got) = %s", diff)
+	}
+
+	// Every image in the tree has the new time.
+	child, err := ra.Image(m.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getConfigFile(t, child).Created.Time; !got.Equal(want) {
+		t.Errorf("child created: got %v, want %v", got, want)
+	}
+	nested, err := ra.ImageIndex(m.Manifests[1].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm, err := nested.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grandchild, err := nested.Image(nm.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf := getConfigFile(t, grandchild)
+	if got := cf.Created.Time; !got.Equal(want) {
+		t.Errorf("nested child created: got %v, want %v", got, want)
+	}
+	for i, h := range cf.History {
+		if !h.Created.Time.Equal(want) {
+			t.Errorf("nested child history[%d] created: got %v, want %v", i, h.Created.Time, want)
+		}
+	}
+}
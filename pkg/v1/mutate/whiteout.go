@@ -0,0 +1,108 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/internal/gzip"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// DeletePaths returns a copy of img with a layer appended that deletes the
+// given paths from its filesystem, without having to rewrite the layers that
+// contain them.
+//
+// Each path is removed, along with anything beneath it, by a ".wh.<name>"
+// whiteout entry. A path with a trailing slash (e.g. "/var/cache/") instead
+// keeps the directory itself but removes everything beneath it, using an
+// opaque ".wh..wh..opq" whiteout.
+func DeletePaths(img v1.Image, paths []string) (v1.Image, error) {
+	layer, err := whiteoutLayer(paths)
+	if err != nil {
+		return nil, err
+	}
+	return Append(img, Addendum{
+		Layer: layer,
+		History: v1.History{
+			CreatedBy: "mutate.DeletePaths " + strings.Join(paths, " "),
+		},
+	})
+}
+
+// whiteoutLayer returns a layer containing the whiteout entries that delete
+// paths, see DeletePaths.
+func whiteoutLayer(paths []string) (v1.Layer, error) {
+	whiteouts := map[string]bool{}
+	opaque := map[string]bool{}
+	for _, p := range paths {
+		name := cleanEntryName(p)
+		if name == "." {
+			return nil, fmt.Errorf("cannot delete root directory %q", p)
+		}
+		if strings.HasSuffix(p, "/") {
+			opaque[name] = true
+		} else {
+			dir, base := path.Split(name)
+			whiteouts[path.Join(dir, whiteoutPrefix+base)] = true
+		}
+	}
+
+	headers := []*tar.Header{}
+	for dir := range opaque {
+		headers = append(headers, &tar.Header{
+			Name:     dir + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+		}, &tar.Header{
+			Name:     path.Join(dir, opaqueWhiteout),
+			Typeflag: tar.TypeReg,
+		})
+	}
+	for name := range whiteouts {
+		headers = append(headers, &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+		})
+	}
+	// Sort the entries so that the layer is reproducible.
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("writing tar header: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	contents := b.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return gzip.ReadCloser(ioutil.NopCloser(bytes.NewReader(contents))), nil
+	})
+}
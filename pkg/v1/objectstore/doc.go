@@ -0,0 +1,19 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package objectstore provides a v1.BlobStore for blobs and manifests kept in
+// object storage, e.g. a GCS or S3 bucket, using the OCI image layout:
+//
+// https://github.com/opencontainers/image-spec/blob/master/image-layout.md
+package objectstore
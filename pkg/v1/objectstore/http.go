@@ -0,0 +1,90 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/google/go-containerregistry/internal/redact"
+)
+
+// httpBucket implements Bucket with plain GET and PUT requests.
+type httpBucket struct {
+	base   url.URL
+	client *http.Client
+}
+
+// NewHTTPBucket returns a Bucket that GETs and PUTs objects under base, e.g.
+// "https://storage.googleapis.com/<bucket>" for GCS or
+// "https://<bucket>.s3.amazonaws.com" for S3.
+//
+// The given transport must add whatever authentication the service needs,
+// e.g. an oauth2.Transport for GCS, or one that signs each request for S3.
+// Objects are uploaded with chunked transfer encoding, as the size of a blob
+// isn't known ahead of time.
+func NewHTTPBucket(base *url.URL, t http.RoundTripper) Bucket {
+	return &httpBucket{
+		base:   *base,
+		client: &http.Client{Transport: t},
+	}
+}
+
+func (b *httpBucket) url(key string) string {
+	u := b.base
+	u.Path = path.Join("/", u.Path, key)
+	return u.String()
+}
+
+// Get implements Bucket.
+func (b *httpBucket) Get(key string) (io.ReadCloser, error) {
+	resp, err := b.client.Get(b.url(key))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put implements Bucket.
+func (b *httpBucket) Put(key string, r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, b.url(key), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp, http.StatusOK, http.StatusCreated)
+}
+
+// checkStatus returns an error unless resp has one of the given status codes.
+func checkStatus(resp *http.Response, codes ...int) error {
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s: unexpected status code %d %s", resp.Request.Method, redact.URL(resp.Request.URL), resp.StatusCode, http.StatusText(resp.StatusCode))
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/google/go-containerregistry/internal/verify"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Bucket is the minimal interface to a bucket in object storage that a
+// BlobStore needs. Adapting a GCS or S3 client to it takes a few lines; see
+// also NewHTTPBucket.
+type Bucket interface {
+	// Get returns the contents of the object with the given key.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put writes the contents of the object with the given key.
+	Put(key string, r io.Reader) error
+}
+
+// blobStore implements v1.BlobStore for an OCI image layout in a Bucket.
+type blobStore struct {
+	bucket Bucket
+	prefix string
+}
+
+var _ v1.BlobStore = (*blobStore)(nil)
+
+// NewBlobStore returns a v1.BlobStore that reads from and writes to the OCI
+// image layout under prefix in bucket, storing each blob and manifest at
+// "<prefix>/blobs/<algorithm>/<hex>".
+//
+// Like layout.Path, PutManifest only writes the manifest to the blobs
+// directory, and doesn't add it to the index.json.
+func NewBlobStore(bucket Bucket, prefix string) v1.BlobStore {
+	return &blobStore{bucket: bucket, prefix: prefix}
+}
+
+func (b *blobStore) key(h v1.Hash) string {
+	return path.Join(b.prefix, "blobs", h.Algorithm, h.Hex)
+}
+
+// GetBlob implements v1.BlobStore.
+//
+// The contents are verified against h as they are read.
+func (b *blobStore) GetBlob(h v1.Hash) (io.ReadCloser, error) {
+	rc, err := b.bucket.Get(b.key(h))
+	if err != nil {
+		return nil, err
+	}
+	return verify.ReadCloser(rc, verify.SizeUnknown, h)
+}
+
+// PutBlob implements v1.BlobStore.
+func (b *blobStore) PutBlob(h v1.Hash, rc io.ReadCloser) error {
+	defer rc.Close()
+	return b.bucket.Put(b.key(h), rc)
+}
+
+// GetManifest implements v1.BlobStore.
+//
+// Manifests are stored as blobs, so the MediaType of the returned Descriptor
+// is taken from the "mediaType" field of the manifest itself. As that field
+// is optional for OCI manifests, a manifest without one is assumed to be an
+// OCI index if it has "manifests", or an OCI image manifest otherwise.
+func (b *blobStore) GetManifest(h v1.Hash) ([]byte, *v1.Descriptor, error) {
+	rc, err := b.GetBlob(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	raw, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mf struct {
+		MediaType types.MediaType `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &mf); err != nil {
+		return nil, nil, err
+	}
+	if mf.MediaType == "" {
+		mf.MediaType = types.OCIManifestSchema1
+		if mf.Manifests != nil {
+			mf.MediaType = types.OCIImageIndex
+		}
+	}
+	return raw, &v1.Descriptor{
+		MediaType: mf.MediaType,
+		Size:      int64(len(raw)),
+		Digest:    h,
+	}, nil
+}
+
+// PutManifest implements v1.BlobStore.
+func (b *blobStore) PutManifest(desc v1.Descriptor, raw []byte) error {
+	return b.bucket.Put(b.key(desc.Digest), bytes.NewReader(raw))
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// fakeBucket serves objects from memory, like a bucket's XML API.
+type fakeBucket struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = b
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	f := &fakeBucket{objects: map[string][]byte{}}
+	s := httptest.NewServer(f)
+	defer s.Close()
+	u, err := url.Parse(s.URL + "/my-bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := NewBlobStore(NewHTTPBucket(u, http.DefaultTransport), "oci")
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ls[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.PutBlob(h, rc); err != nil {
+		t.Fatalf("PutBlob() = %v", err)
+	}
+	if _, ok := f.objects["/my-bucket/oci/blobs/sha256/"+h.Hex]; !ok {
+		t.Errorf("blob not stored in the image layout, got %v", f.objects)
+	}
+	rc, err = bs.GetBlob(h)
+	if err != nil {
+		t.Fatalf("GetBlob() = %v", err)
+	}
+	if _, err := ioutil.ReadAll(rc); err != nil {
+		t.Errorf("reading blob: %v", err)
+	}
+	rc.Close()
+
+	desc, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.PutManifest(*desc, raw); err != nil {
+		t.Fatalf("PutManifest() = %v", err)
+	}
+	got, gotDesc, err := bs.GetManifest(desc.Digest)
+	if err != nil {
+		t.Fatalf("GetManifest() = %v", err)
+	}
+	if string(got) != string(raw) {
+		t.Errorf("GetManifest() = %s, want %s", got, raw)
+	}
+	if gotDesc.MediaType != desc.MediaType || gotDesc.Size != desc.Size {
+		t.Errorf("GetManifest() descriptor = %+v, want %+v", gotDesc, desc)
+	}
+
+	// Corrupt objects are caught as they're read.
+	f.objects["/my-bucket/oci/blobs/sha256/"+h.Hex] = []byte("corrupt")
+	rc, err = bs.GetBlob(h)
+	if err != nil {
+		t.Fatalf("GetBlob() = %v", err)
+	}
+	if _, err := ioutil.ReadAll(rc); err == nil {
+		t.Error("reading corrupt blob: got nil error")
+	}
+
+	missing := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}
+	if _, err := bs.GetBlob(missing); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("GetBlob(missing) = %v, want 404 error", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial
+
+import (
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// memoizedImage caches the results of calls to the wrapped v1.Image.
+type memoizedImage struct {
+	v1.Image
+
+	// mu guards all of the cached values below, which are only set once the
+	// underlying call succeeds, so errors are never cached.
+	mu          sync.Mutex
+	mediaType   *types.MediaType
+	size        *int64
+	digest      *v1.Hash
+	rawManifest []byte
+	manifest    *v1.Manifest
+	configName  *v1.Hash
+	rawConfig   []byte
+	config      *v1.ConfigFile
+	layers      []v1.Layer
+	byDigest    map[v1.Hash]v1.Layer
+	byDiffID    map[v1.Hash]v1.Layer
+}
+
+// Memoize returns a v1.Image that caches the results of the metadata methods
+// of img (e.g. Digest, Manifest and ConfigFile) and of its layer lookups, so
+// that calling them repeatedly, e.g. after chaining several mutate
+// operations, doesn't recompute anything.
+//
+// Layer contents aren't cached, so they are still only read when needed.
+// Failed calls aren't cached either, so they can be retried.
+func Memoize(img v1.Image) v1.Image {
+	if _, ok := img.(*memoizedImage); ok {
+		return img
+	}
+	return &memoizedImage{
+		Image:    img,
+		byDigest: map[v1.Hash]v1.Layer{},
+		byDiffID: map[v1.Hash]v1.Layer{},
+	}
+}
+
+// MediaType implements v1.Image.
+func (i *memoizedImage) MediaType() (types.MediaType, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.mediaType == nil {
+		mt, err := i.Image.MediaType()
+		if err != nil {
+			return "", err
+		}
+		i.mediaType = &mt
+	}
+	return *i.mediaType, nil
+}
+
+// Size implements v1.Image.
+func (i *memoizedImage) Size() (int64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.size == nil {
+		size, err := i.Image.Size()
+		if err != nil {
+			return -1, err
+		}
+		i.size = &size
+	}
+	return *i.size, nil
+}
+
+// Digest implements v1.Image.
+func (i *memoizedImage) Digest() (v1.Hash, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.digest == nil {
+		h, err := i.Image.Digest()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		i.digest = &h
+	}
+	return *i.digest, nil
+}
+
+// RawManifest implements v1.Image.
+func (i *memoizedImage) RawManifest() ([]byte, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.rawManifest == nil {
+		b, err := i.Image.RawManifest()
+		if err != nil {
+			return nil, err
+		}
+		i.rawManifest = b
+	}
+	return i.rawManifest, nil
+}
+
+// Manifest implements v1.Image. Each call returns a copy, so callers are free
+// to modify it.
+func (i *memoizedImage) Manifest() (*v1.Manifest, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.manifest == nil {
+		m, err := i.Image.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		i.manifest = m.DeepCopy()
+	}
+	return i.manifest.DeepCopy(), nil
+}
+
+// ConfigName implements v1.Image.
+func (i *memoizedImage) ConfigName() (v1.Hash, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.configName == nil {
+		h, err := i.Image.ConfigName()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		i.configName = &h
+	}
+	return *i.configName, nil
+}
+
+// RawConfigFile implements v1.Image.
+func (i *memoizedImage) RawConfigFile() ([]byte, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.rawConfig == nil {
+		b, err := i.Image.RawConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		i.rawConfig = b
+	}
+	return i.rawConfig, nil
+}
+
+// ConfigFile implements v1.Image. Each call returns a copy, so callers are
+// free to modify it.
+func (i *memoizedImage) ConfigFile() (*v1.ConfigFile, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.config == nil {
+		cfg, err := i.Image.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		i.config = cfg.DeepCopy()
+	}
+	return i.config.DeepCopy(), nil
+}
+
+// Layers implements v1.Image.
+func (i *memoizedImage) Layers() ([]v1.Layer, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.layers == nil {
+		ls, err := i.Image.Layers()
+		if err != nil {
+			return nil, err
+		}
+		i.layers = ls
+	}
+	return append([]v1.Layer{}, i.layers...), nil
+}
+
+// LayerByDigest implements v1.Image.
+func (i *memoizedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if l, ok := i.byDigest[h]; ok {
+		return l, nil
+	}
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	i.byDigest[h] = l
+	return l, nil
+}
+
+// LayerByDiffID implements v1.Image.
+func (i *memoizedImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if l, ok := i.byDiffID[h]; ok {
+		return l, nil
+	}
+	l, err := i.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	i.byDiffID[h] = l
+	return l, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial_test
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// countingImage counts calls to the methods of the wrapped image, and fails
+// the first call to Digest.
+type countingImage struct {
+	v1.Image
+	calls       map[string]int
+	failedFirst bool
+}
+
+func (c *countingImage) Digest() (v1.Hash, error) {
+	c.calls["Digest"]++
+	if !c.failedFirst {
+		c.failedFirst = true
+		return v1.Hash{}, errors.New("transient")
+	}
+	return c.Image.Digest()
+}
+
+func (c *countingImage) Manifest() (*v1.Manifest, error) {
+	c.calls["Manifest"]++
+	return c.Image.Manifest()
+}
+
+func (c *countingImage) ConfigFile() (*v1.ConfigFile, error) {
+	c.calls["ConfigFile"]++
+	return c.Image.ConfigFile()
+}
+
+func (c *countingImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	c.calls["LayerByDigest"]++
+	return c.Image.LayerByDigest(h)
+}
+
+func TestMemoize(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci := &countingImage{Image: img, calls: map[string]int{}}
+	mi := partial.Memoize(ci)
+	if partial.Memoize(mi) != mi {
+		t.Error("Memoize() re-wrapped a memoized image")
+	}
+
+	if _, err := mi.Digest(); err == nil {
+		t.Fatal("Digest() = nil, wanted error")
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mi.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 3; n++ {
+		got, err := mi.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Digest() = %s, want %s", got, want)
+		}
+		if _, err := mi.Manifest(); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := mi.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Callers can modify what they get back without affecting the cache.
+		cfg.Config.Labels = map[string]string{"foo": "bar"}
+		if _, err := mi.LayerByDigest(m.Layers[0].Digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for method, want := range map[string]int{
+		"Digest":        2,
+		"Manifest":      1,
+		"ConfigFile":    1,
+		"LayerByDigest": 1,
+	} {
+		if got := ci.calls[method]; got != want {
+			t.Errorf("%s called %d times, want %d", method, got, want)
+		}
+	}
+
+	cfg, err := mi.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Config.Labels != nil {
+		t.Errorf("ConfigFile() was modified through a returned copy: %v", cfg.Config.Labels)
+	}
+	if err := validate.Image(mi); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
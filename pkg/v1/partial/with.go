@@ -21,8 +21,10 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // WithRawConfigFile defines the subset of v1.Image used by these helper methods
@@ -136,12 +138,26 @@ type WithRawManifest interface {
 }
 
 // Digest is a helper for implementing v1.Image
+//
+// If i has a Descriptor, e.g. because it was fetched by a digest that isn't
+// sha256, the digest is computed with the same algorithm; otherwise sha256 is
+// used.
 func Digest(i WithRawManifest) (v1.Hash, error) {
 	mb, err := i.RawManifest()
 	if err != nil {
 		return v1.Hash{}, err
 	}
-	digest, _, err := v1.SHA256(bytes.NewReader(mb))
+	algorithm := "sha256"
+	if wd, ok := unwrap(i).(withDescriptor); ok {
+		desc, err := wd.Descriptor()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		if desc.Digest.Algorithm != "" {
+			algorithm = desc.Digest.Algorithm
+		}
+	}
+	digest, _, err := v1.ComputeHash(algorithm, bytes.NewReader(mb))
 	return digest, err
 }
 
@@ -169,6 +185,26 @@ func RawManifest(i WithManifest) ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// Annotations returns the annotations of an image or index manifest, or an
+// empty map if it has none. The returned map can be modified freely, e.g. to
+// pass back to mutate.Annotations.
+func Annotations(i WithRawManifest) (map[string]string, error) {
+	b, err := i.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	var m struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest annotations: %w", err)
+	}
+	if m.Annotations == nil {
+		return map[string]string{}, nil
+	}
+	return m.Annotations, nil
+}
+
 // Size is a helper for implementing v1.Image
 func Size(i WithRawManifest) (int64, error) {
 	b, err := i.RawManifest()
@@ -345,6 +381,22 @@ func UncompressedSize(l v1.Layer) (int64, error) {
 	return io.Copy(ioutil.Discard, rc)
 }
 
+type withStoredSize interface {
+	StoredSize() (int64, error)
+}
+
+// StoredSize returns the size of the compressed contents of l according to
+// wherever they're stored, e.g. the size a registry reports for the blob,
+// without reading them. It returns false if l can't tell, e.g. because its
+// contents aren't stored anywhere else.
+func StoredSize(l v1.Layer) (int64, bool, error) {
+	if ws, ok := unwrap(l).(withStoredSize); ok {
+		size, err := ws.StoredSize()
+		return size, true, err
+	}
+	return -1, false, nil
+}
+
 type withExists interface {
 	Exists() (bool, error)
 }
@@ -370,6 +422,71 @@ func Exists(l v1.Layer) (bool, error) {
 	return true, nil
 }
 
+// BaseImage returns the base image that img was built on, as recorded by the
+// "org.opencontainers.image.base.name" and "org.opencontainers.image.base.digest"
+// annotations in its manifest, falling back to labels with the same keys in
+// its config file.
+//
+// If the base name is missing or isn't a valid reference, BaseImage returns
+// false. If only the digest is missing or invalid, the returned v1.Hash is the
+// zero value.
+func BaseImage(img v1.Image) (name.Reference, v1.Hash, bool) {
+	var base, digest string
+	if m, err := img.Manifest(); err == nil && m != nil {
+		base = m.Annotations[specsv1.AnnotationBaseImageName]
+		digest = m.Annotations[specsv1.AnnotationBaseImageDigest]
+	}
+	if base == "" {
+		if cf, err := img.ConfigFile(); err == nil && cf != nil {
+			base = cf.Config.Labels[specsv1.AnnotationBaseImageName]
+			digest = cf.Config.Labels[specsv1.AnnotationBaseImageDigest]
+		}
+	}
+	if base == "" {
+		return nil, v1.Hash{}, false
+	}
+	ref, err := name.ParseReference(base)
+	if err != nil {
+		return nil, v1.Hash{}, false
+	}
+	h, err := v1.NewHash(digest)
+	if err != nil {
+		return ref, v1.Hash{}, true
+	}
+	return ref, h, true
+}
+
+// Subject returns the descriptor in the "subject" field of img's manifest,
+// i.e. the manifest that img refers to, e.g. the image that a signature or
+// SBOM describes.
+//
+// If img has no subject, or its manifest can't be read, Subject returns false.
+func Subject(img v1.Image) (*v1.Descriptor, bool) {
+	m, err := img.Manifest()
+	if err != nil || m == nil || m.Subject == nil {
+		return nil, false
+	}
+	return m.Subject, true
+}
+
+type withReaderAt interface {
+	ReaderAt() (io.ReaderAt, bool)
+}
+
+// Seekable returns an io.ReaderAt over the compressed contents of the layer, if
+// the underlying implementation supports random access, e.g. a remote layer in
+// a registry that honors Range requests. Each ReadAt may result in a separate
+// request, so callers should read in reasonably sized chunks.
+//
+// If the layer doesn't support random access, Seekable returns false and
+// callers should fall back to reading the whole layer via Compressed.
+func Seekable(l v1.Layer) (io.ReaderAt, bool) {
+	if wr, ok := unwrap(l).(withReaderAt); ok {
+		return wr.ReaderAt()
+	}
+	return nil, false
+}
+
 // Recursively unwrap our wrappers so that we can check for the original implementation.
 // We might want to expose this?
 func unwrap(i interface{}) interface{} {
@@ -385,5 +502,8 @@ func unwrap(i interface{}) interface{} {
 	if cie, ok := i.(*compressedImageExtender); ok {
 		return unwrap(cie.CompressedImageCore)
 	}
+	if mi, ok := i.(*memoizedImage); ok {
+		return unwrap(mi.Image)
+	}
 	return i
 }
@@ -19,9 +19,11 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func TestRawConfigFile(t *testing.T) {
@@ -244,3 +246,126 @@ func TestExists(t *testing.T) {
 		t.Errorf("Exists() = %t != %t", got, want)
 	}
 }
+
+func TestBaseImage(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := partial.BaseImage(img); ok {
+		t.Errorf("BaseImage() = true without annotations")
+	}
+
+	digest := "sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	annotated := mutate.Annotations(img, map[string]string{
+		specsv1.AnnotationBaseImageName:   "example.com/base:latest",
+		specsv1.AnnotationBaseImageDigest: digest,
+	}).(v1.Image)
+	ref, h, ok := partial.BaseImage(annotated)
+	if !ok {
+		t.Fatal("BaseImage() = false with annotations")
+	}
+	if got, want := ref.String(), "example.com/base:latest"; got != want {
+		t.Errorf("ref: got %s, want %s", got, want)
+	}
+	if got := h.String(); got != digest {
+		t.Errorf("digest: got %s, want %s", got, digest)
+	}
+
+	// Fall back to labels.
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.Config.Labels = map[string]string{
+		specsv1.AnnotationBaseImageName: "example.com/labeled",
+	}
+	labeled, err := mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, h, ok = partial.BaseImage(labeled)
+	if !ok {
+		t.Fatal("BaseImage() = false with labels")
+	}
+	if got, want := ref.Name(), "example.com/labeled:latest"; got != want {
+		t.Errorf("ref: got %s, want %s", got, want)
+	}
+	if h != (v1.Hash{}) {
+		t.Errorf("digest: got %s, want zero value", h)
+	}
+
+	invalid := mutate.Annotations(img, map[string]string{
+		specsv1.AnnotationBaseImageName: "not a reference!",
+	}).(v1.Image)
+	if _, _, ok := partial.BaseImage(invalid); ok {
+		t.Errorf("BaseImage() = true with invalid base name")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := partial.Annotations(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Annotations() = %v, want none", got)
+	}
+
+	want := map[string]string{"foo": "bar"}
+	got, err = partial.Annotations(mutate.Annotations(img, want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("Annotations() Diff(-want,+got): %s", d)
+	}
+}
+
+// subjectImage is an image whose manifest has a subject.
+type subjectImage struct {
+	v1.Image
+	subject v1.Descriptor
+}
+
+func (i *subjectImage) Manifest() (*v1.Manifest, error) {
+	m, err := i.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+	m.Subject = &i.subject
+	return m, nil
+}
+
+func TestSubject(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := partial.Subject(img); ok {
+		t.Error("Subject() = true without a subject")
+	}
+
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := partial.Subject(&subjectImage{Image: sig, subject: *subject})
+	if !ok {
+		t.Fatal("Subject() = false with a subject")
+	}
+	if diff := cmp.Diff(subject, got); diff != "" {
+		t.Errorf("Subject() (-want +got) = %s", diff)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+
+	"github.com/google/go-containerregistry/internal/redact"
+	"github.com/google/go-containerregistry/internal/verify"
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// blobStore implements v1.BlobStore for a repository in a remote registry.
+type blobStore struct {
+	fetcher
+	w writer
+}
+
+var _ v1.BlobStore = (*blobStore)(nil)
+
+// BlobStore returns a v1.BlobStore that reads from and writes to the given
+// repository. Manifests are read and written by digest.
+func BlobStore(repo name.Repository, options ...Option) (v1.BlobStore, error) {
+	o, err := makeOptions(repo, options...)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []string{repo.Scope(transport.PushScope)}
+	tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, scopes)
+	if err != nil {
+		return nil, err
+	}
+	client := o.newClient(tr)
+	return &blobStore{
+		fetcher: fetcher{
+			// The identifier is replaced for each request, see ref.
+			Ref:     repo.Tag("latest"),
+			Client:  client,
+			context: o.context,
+		},
+		w: writer{
+			repo:      repo,
+			client:    client,
+			context:   o.context,
+			backoff:   o.retryBackoff,
+			predicate: o.retryPredicate,
+		},
+	}, nil
+}
+
+func (b *blobStore) ref(h v1.Hash) name.Digest {
+	return b.Ref.Context().Digest(h.String())
+}
+
+// GetBlob implements v1.BlobStore.
+func (b *blobStore) GetBlob(h v1.Hash) (io.ReadCloser, error) {
+	// We don't want to log binary blobs -- this can break terminals.
+	ctx := redact.NewContext(b.context, "omitting binary blobs from logs")
+	return b.fetchBlob(ctx, verify.SizeUnknown, h)
+}
+
+// PutBlob implements v1.BlobStore.
+//
+// Since rc can only be consumed once, failed uploads are not retried.
+func (b *blobStore) PutBlob(h v1.Hash, rc io.ReadCloser) error {
+	defer rc.Close()
+
+	existing, err := b.w.checkExistingBlob(h)
+	if err != nil {
+		return err
+	}
+	if existing {
+		logs.Progress.Printf("existing blob: %v", h)
+		return nil
+	}
+
+	location, mounted, err := b.w.initiateUpload("", h.String())
+	if err != nil {
+		return err
+	} else if mounted {
+		logs.Progress.Printf("mounted blob: %v", h)
+		return nil
+	}
+
+	ctx := redact.NewContext(b.context, "omitting binary blobs from logs")
+	location, err = b.w.streamBlob(ctx, rc, location)
+	if err != nil {
+		return err
+	}
+	if err := b.w.commitBlob(location, h.String()); err != nil {
+		return err
+	}
+	logs.Progress.Printf("pushed blob: %v", h)
+	return nil
+}
+
+// GetManifest implements v1.BlobStore.
+func (b *blobStore) GetManifest(h v1.Hash) ([]byte, *v1.Descriptor, error) {
+	acceptable := []types.MediaType{}
+	acceptable = append(acceptable, acceptableImageMediaTypes...)
+	acceptable = append(acceptable, acceptableIndexMediaTypes...)
+	return b.fetchManifest(b.ref(h), acceptable)
+}
+
+// PutManifest implements v1.BlobStore.
+func (b *blobStore) PutManifest(desc v1.Descriptor, raw []byte) error {
+	return b.w.commitManifest(b.context, &Descriptor{
+		Descriptor: desc,
+		Manifest:   raw,
+	}, b.ref(desc.Digest))
+}
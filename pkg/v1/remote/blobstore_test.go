@@ -0,0 +1,126 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// copyImage copies the image with the given manifest digest between stores.
+func copyImage(t *testing.T, src, dst v1.BlobStore, h v1.Hash) v1.Descriptor {
+	t.Helper()
+	raw, desc, err := src.GetManifest(h)
+	if err != nil {
+		t.Fatalf("GetManifest: %v", err)
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range append([]v1.Descriptor{m.Config}, m.Layers...) {
+		rc, err := src.GetBlob(blob.Digest)
+		if err != nil {
+			t.Fatalf("GetBlob(%s): %v", blob.Digest, err)
+		}
+		if err := dst.PutBlob(blob.Digest, rc); err != nil {
+			t.Fatalf("PutBlob(%s): %v", blob.Digest, err)
+		}
+	}
+	if err := dst.PutManifest(*desc, raw); err != nil {
+		t.Fatalf("PutManifest: %v", err)
+	}
+	return *desc
+}
+
+func TestBlobStore(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := mustNewTag(t, u.Host+"/src:latest")
+	if err := Write(src, img); err != nil {
+		t.Fatal(err)
+	}
+
+	srcStore, err := BlobStore(src.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registry -> layout.
+	tmp, err := ioutil.TempDir("", "blobstore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	lp, err := layout.Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := copyImage(t, srcStore, lp, mustDigest(t, img))
+	if err := lp.AppendDescriptor(desc); err != nil {
+		t.Fatal(err)
+	}
+	limg, err := lp.Image(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(limg); err != nil {
+		t.Errorf("validate.Image(layout): %v", err)
+	}
+
+	// Layout -> registry.
+	dst, err := name.NewRepository(u.Host + "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstStore, err := BlobStore(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyImage(t, lp, dstStore, desc.Digest)
+
+	rimg, err := Image(dst.Digest(desc.Digest.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(rimg); err != nil {
+		t.Errorf("validate.Image(remote): %v", err)
+	}
+
+	// Copying again should be a no-op.
+	copyImage(t, lp, dstStore, desc.Digest)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+)
+
+// cache is a bounded map for state that's shared between operations for the
+// lifetime of the process, in the same way as transport's ping cache: entries
+// expire after ttl, and once it holds max entries, adding another drops the
+// expired entries or, if none have expired, the one that expires soonest.
+//
+// Values that hold connections, i.e. *http.Transport, have their idle
+// connections closed when they're dropped.
+type cache struct {
+	sync.Mutex
+	ttl time.Duration
+	max int
+	// touch, if set, extends an entry's expiry each time it's used, so that
+	// only unused entries expire.
+	touch bool
+	m     map[interface{}]cacheEntry
+	clock clock.Clock
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newCache(ttl time.Duration, max int) *cache {
+	return &cache{ttl: ttl, max: max, m: map[interface{}]cacheEntry{}}
+}
+
+// get returns the unexpired value for key, if any.
+func (c *cache) get(key interface{}) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	return c.lookup(clock.OrReal(c.clock).Now(), key)
+}
+
+// put stores value for key, making room for it if necessary.
+func (c *cache) put(key, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.store(clock.OrReal(c.clock).Now(), key, value)
+}
+
+// load returns the unexpired value for key, or stores and returns the result
+// of create if there isn't one.
+func (c *cache) load(key interface{}, create func() interface{}) interface{} {
+	c.Lock()
+	defer c.Unlock()
+	now := clock.OrReal(c.clock).Now()
+	if v, ok := c.lookup(now, key); ok {
+		return v
+	}
+	v := create()
+	c.store(now, key, v)
+	return v
+}
+
+// lookup implements get. It must be called with c held.
+func (c *cache) lookup(now time.Time, key interface{}) (interface{}, bool) {
+	e, ok := c.m[key]
+	if !ok || !now.Before(e.expires) {
+		return nil, false
+	}
+	if c.touch {
+		e.expires = now.Add(c.ttl)
+		c.m[key] = e
+	}
+	return e.value, true
+}
+
+// store implements put. It must be called with c held.
+func (c *cache) store(now time.Time, key, value interface{}) {
+	if _, ok := c.m[key]; ok {
+		c.drop(key)
+	} else if len(c.m) >= c.max {
+		c.evict(now)
+	}
+	c.m[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// drop removes key. It must be called with c held.
+func (c *cache) drop(key interface{}) {
+	if t, ok := c.m[key].value.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+	delete(c.m, key)
+}
+
+// evict makes room for a new entry. It must be called with c held.
+func (c *cache) evict(now time.Time) {
+	var (
+		oldest    interface{}
+		oldestExp time.Time
+	)
+	for k, e := range c.m {
+		if !now.Before(e.expires) {
+			c.drop(k)
+			continue
+		}
+		if oldestExp.IsZero() || e.expires.Before(oldestExp) {
+			oldest, oldestExp = k, e.expires
+		}
+	}
+	if len(c.m) >= c.max {
+		c.drop(oldest)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	c := newCache(time.Minute, 10)
+	c.clock = fake
+
+	c.put("key", 1)
+	fake.Advance(time.Minute - time.Second)
+	if v, ok := c.get("key"); !ok || v != 1 {
+		t.Errorf("get() = %v, %t; want 1, true", v, ok)
+	}
+	fake.Advance(time.Second)
+	if v, ok := c.get("key"); ok {
+		t.Errorf("get() = %v, %t; want expired", v, ok)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	c := newCache(10*time.Minute, 10)
+	c.clock = fake
+	for i := 0; i < 10; i++ {
+		c.put(i, i)
+		fake.Advance(time.Minute)
+	}
+
+	// With nothing expired, the entry that expires soonest goes.
+	c.put("new", 10)
+	if got, want := len(c.m), 10; got != want {
+		t.Errorf("len: got %d, want %d", got, want)
+	}
+	if _, ok := c.get(0); ok {
+		t.Error("0: still cached, want evicted")
+	}
+
+	// Otherwise, everything that has expired goes.
+	fake.Advance(5 * time.Minute)
+	c.put("newer", 11)
+	if got, want := len(c.m), 6; got != want {
+		t.Errorf("len: got %d, want %d", got, want)
+	}
+	for _, k := range []interface{}{"new", "newer", 9} {
+		if _, ok := c.get(k); !ok {
+			t.Errorf("%v: evicted, want cached", k)
+		}
+	}
+}
+
+type idleCloser struct{ closed bool }
+
+func (c *idleCloser) CloseIdleConnections() { c.closed = true }
+
+func TestCacheLoad(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	c := newCache(time.Minute, 1)
+	c.touch = true
+	c.clock = fake
+
+	var created int
+	load := func(key string) *idleCloser {
+		return c.load(key, func() interface{} {
+			created++
+			return &idleCloser{}
+		}).(*idleCloser)
+	}
+
+	// Using an entry keeps it from expiring.
+	a := load("a")
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Minute - time.Second)
+		if got := load("a"); got != a {
+			t.Errorf("load(a) = %p, want %p", got, a)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created %d values, want 1", created)
+	}
+
+	// Dropped values have their idle connections closed.
+	load("b")
+	if !a.closed {
+		t.Error("evicted value: idle connections not closed")
+	}
+	if created != 2 {
+		t.Errorf("created %d values, want 2", created)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// probeRepository is the repository Capabilities probes for per-repository
+// APIs. It's not expected to exist; registries answer for unknown
+// repositories the same way they answer for real ones.
+const probeRepository = "ggcr-capabilities-probe"
+
+// probeDigest is a digest that no real content hashes to.
+const probeDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+// RegistryCapabilities describes the optional parts of the distribution API
+// that a registry supports, as detected by Capabilities.
+//
+// Chunked uploads and cross-repository mounts can't be detected without
+// writing to the registry, so they aren't probed: every registry that accepts
+// pushes supports chunked uploads, and Write already falls back to a regular
+// upload when a mount isn't possible.
+type RegistryCapabilities struct {
+	// APIVersion is the Docker-Distribution-Api-Version header returned from
+	// /v2/, e.g. "registry/2.0", or empty if the registry didn't send one.
+	APIVersion string
+
+	// Catalog is true if the registry serves /v2/_catalog to us.
+	Catalog bool
+
+	// Referrers is true if the registry implements the OCI referrers API.
+	// When it's false, referrers can only be found via the fallback tag
+	// schema.
+	Referrers bool
+
+	// Delete is true if the registry accepts manifest deletes, i.e. it
+	// doesn't reject them as an unsupported method. It's still possible for
+	// a particular delete to be forbidden.
+	Delete bool
+}
+
+// capabilitiesKey identifies cached capabilities. Registries can expose
+// different APIs to different users, so results are only shared between
+// callers that use the same credentials.
+type capabilitiesKey struct {
+	registry string
+	scheme   string
+	// The authenticator, or its keychainKey if it resolves from a keychain.
+	auth interface{}
+}
+
+const (
+	// capabilitiesTTL is how long probed capabilities are used for, so that
+	// long-running processes notice when a registry is upgraded.
+	capabilitiesTTL = 10 * time.Minute
+
+	// maxCapabilities bounds the size of the cache, since every distinct
+	// authenticator adds an entry.
+	maxCapabilities = 1024
+)
+
+// capabilitiesCache holds a *RegistryCapabilities for each capabilitiesKey.
+var capabilitiesCache = newCache(capabilitiesTTL, maxCapabilities)
+
+// Capabilities probes the registry to find out which optional APIs it
+// supports, so that callers can choose the best way to talk to it. None of the
+// probes modify the registry.
+//
+// Results are cached per registry and authenticator for ten minutes; callers
+// that need fresh results sooner should use a distinct authenticator.
+func Capabilities(registry name.Registry, options ...Option) (*RegistryCapabilities, error) {
+	o, err := makeOptions(registry, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	key := capabilitiesKey{registry: registry.Name(), scheme: registry.Scheme()}
+	cacheable := o.auth == nil || reflect.TypeOf(o.auth).Comparable()
+	key.auth = o.auth
+	if ka, ok := o.auth.(*keychainAuth); ok {
+		key.auth, cacheable = ka.key()
+	}
+	if cacheable {
+		if c, ok := capabilitiesCache.get(key); ok {
+			copied := *c.(*RegistryCapabilities)
+			return &copied, nil
+		}
+	}
+
+	c, err := probeCapabilities(registry, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable {
+		copied := *c
+		capabilitiesCache.put(key, &copied)
+	}
+	return c, nil
+}
+
+func probeCapabilities(registry name.Registry, o *options) (*RegistryCapabilities, error) {
+	repo, err := name.NewRepository(fmt.Sprintf("%s/%s", registry.Name(), probeRepository))
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []string{registry.Scope(transport.PullScope), repo.Scope(transport.PullScope)}
+	tr, err := transport.NewWithContext(o.context, registry, o.auth, o.transport, scopes)
+	if err != nil {
+		return nil, err
+	}
+	client := o.newClient(tr)
+
+	probe := func(method, path, query string) (*http.Response, error) {
+		u := url.URL{
+			Scheme:   registry.Scheme(),
+			Host:     registry.APIHost(),
+			Path:     path,
+			RawQuery: query,
+		}
+		req, err := http.NewRequest(method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req.WithContext(o.context))
+		if err != nil {
+			return nil, err
+		}
+		// We only care about the status and headers.
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return resp, nil
+	}
+
+	c := &RegistryCapabilities{}
+
+	resp, err := probe(http.MethodGet, "/v2/", "")
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	c.APIVersion = resp.Header.Get("Docker-Distribution-Api-Version")
+
+	resp, err = probe(http.MethodGet, "/v2/_catalog", "n=1")
+	if err != nil {
+		return nil, err
+	}
+	c.Catalog = resp.StatusCode == http.StatusOK
+
+	// Registries that implement the referrers API return an empty index for
+	// unknown subjects, rather than a 404.
+	resp, err = probe(http.MethodGet, fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), probeDigest), "")
+	if err != nil {
+		return nil, err
+	}
+	c.Referrers = resp.StatusCode == http.StatusOK
+
+	// Deleting needs a token with more than pull access, which we might not be
+	// able to get; that just means we can't delete.
+	dtr, err := transport.NewWithContext(o.context, registry, o.auth, o.transport, []string{repo.Scope(transport.DeleteScope)})
+	if err != nil {
+		return c, nil
+	}
+	client = o.newClient(dtr)
+	resp, err = probe(http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/%s", repo.RepositoryStr(), probeDigest), "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusNotFound:
+		// The registry would have deleted the manifest if it existed.
+		c.Delete = true
+	}
+
+	return c, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		referrers  int
+		catalog    int
+		delete     int
+		apiVersion string
+		want       RegistryCapabilities
+	}{{
+		name:       "everything",
+		referrers:  http.StatusOK,
+		catalog:    http.StatusOK,
+		delete:     http.StatusNotFound,
+		apiVersion: "registry/2.0",
+		want:       RegistryCapabilities{APIVersion: "registry/2.0", Catalog: true, Referrers: true, Delete: true},
+	}, {
+		name:      "nothing",
+		referrers: http.StatusNotFound,
+		catalog:   http.StatusUnauthorized,
+		delete:    http.StatusMethodNotAllowed,
+		want:      RegistryCapabilities{},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			probes := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v2/":
+					probes++
+					if tc.apiVersion != "" {
+						w.Header().Set("Docker-Distribution-Api-Version", tc.apiVersion)
+					}
+				case r.URL.Path == "/v2/_catalog" && r.Method == http.MethodGet:
+					w.WriteHeader(tc.catalog)
+				case strings.Contains(r.URL.Path, "/referrers/") && r.Method == http.MethodGet:
+					w.WriteHeader(tc.referrers)
+				case strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodDelete:
+					w.WriteHeader(tc.delete)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reg, err := name.NewRegistry(u.Host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Capabilities(reg)
+			if err != nil {
+				t.Fatalf("Capabilities() = %v", err)
+			}
+			if *got != tc.want {
+				t.Errorf("Capabilities() = %+v, want %+v", *got, tc.want)
+			}
+
+			// The second call should be served from the cache.
+			before := probes
+			got, err = Capabilities(reg)
+			if err != nil {
+				t.Fatalf("Capabilities() = %v", err)
+			}
+			if *got != tc.want {
+				t.Errorf("cached Capabilities() = %+v, want %+v", *got, tc.want)
+			}
+			if probes != before {
+				t.Errorf("Capabilities() probed /v2/ %d more times, wanted cached result", probes-before)
+			}
+		})
+	}
+}
@@ -36,7 +36,9 @@ func CatalogPage(target name.Registry, last string, n int, options ...Option) ([
 		return nil, err
 	}
 
-	scopes := []string{target.Scope(transport.PullScope)}
+	// Registries that use token auth (e.g. Harbor) require the
+	// "registry:catalog:*" scope to list repositories.
+	scopes := []string{target.Scope(transport.CatalogScope)}
 	tr, err := transport.NewWithContext(o.context, target, o.auth, o.transport, scopes)
 	if err != nil {
 		return nil, err
@@ -46,12 +48,12 @@ func CatalogPage(target name.Registry, last string, n int, options ...Option) ([
 
 	uri := url.URL{
 		Scheme:   target.Scheme(),
-		Host:     target.RegistryStr(),
+		Host:     target.APIHost(),
 		Path:     "/v2/_catalog",
 		RawQuery: query,
 	}
 
-	client := http.Client{Transport: tr}
+	client := o.newClient(tr)
 	req, err := http.NewRequest(http.MethodGet, uri.String(), nil)
 	if err != nil {
 		return nil, err
@@ -81,7 +83,7 @@ func Catalog(ctx context.Context, target name.Registry, options ...Option) ([]st
 		return nil, err
 	}
 
-	scopes := []string{target.Scope(transport.PullScope)}
+	scopes := []string{target.Scope(transport.CatalogScope)}
 	tr, err := transport.NewWithContext(o.context, target, o.auth, o.transport, scopes)
 	if err != nil {
 		return nil, err
@@ -89,7 +91,7 @@ func Catalog(ctx context.Context, target name.Registry, options ...Option) ([]st
 
 	uri := &url.URL{
 		Scheme: target.Scheme(),
-		Host:   target.RegistryStr(),
+		Host:   target.APIHost(),
 		Path:   "/v2/_catalog",
 	}
 
@@ -97,7 +99,7 @@ func Catalog(ctx context.Context, target name.Registry, options ...Option) ([]st
 		uri.RawQuery = fmt.Sprintf("n=%d", o.pageSize)
 	}
 
-	client := http.Client{Transport: tr}
+	client := o.newClient(tr)
 
 	// WithContext overrides the ctx passed directly.
 	if o.context != context.Background() {
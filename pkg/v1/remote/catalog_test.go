@@ -181,3 +181,64 @@ func TestCancelledCatalog(t *testing.T) {
 		t.Errorf("wanted %v got %v", want, got)
 	}
 }
+
+func TestCatalogScope(t *testing.T) {
+	const (
+		token = "catalog-token"
+		scope = "registry:catalog:*"
+	)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenge := fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL)
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			// Like Harbor, only issue a token that can list the catalog if
+			// the catalog scope was requested.
+			if got := r.URL.Query().Get("scope"); got != scope {
+				t.Errorf("token requested with scope %q, want %q", got, scope)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"token":%q}`, token)
+		case "/v2/_catalog":
+			if got, want := r.Header.Get("Authorization"), "Bearer "+token; got != want {
+				w.Header().Set("WWW-Authenticate", challenge+`,scope="`+scope+`"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"repositories":["foo","bar"]}`))
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	reg, err := name.NewRegistry(u.Host)
+	if err != nil {
+		t.Fatalf("name.NewRegistry(%v) = %v", u.Host, err)
+	}
+
+	want := []string{"foo", "bar"}
+	repos, err := Catalog(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Catalog() = %v", err)
+	}
+	if diff := cmp.Diff(want, repos); diff != "" {
+		t.Errorf("Catalog() wrong repos (-want +got) = %s", diff)
+	}
+
+	repos, err = CatalogPage(reg, "", 100)
+	if err != nil {
+		t.Fatalf("CatalogPage() = %v", err)
+	}
+	if diff := cmp.Diff(want, repos); diff != "" {
+		t.Errorf("CatalogPage() wrong repos (-want +got) = %s", diff)
+	}
+}
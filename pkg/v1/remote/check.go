@@ -36,7 +36,7 @@ func CheckPushPermission(ref name.Reference, kc authn.Keychain, t http.RoundTrip
 	// to avoid a roundtrip for spec-compliant registries.
 	w := writer{
 		repo:    ref.Context(),
-		client:  &http.Client{Transport: tr},
+		client:  &http.Client{Transport: tr, CheckRedirect: checkRedirect(defaultMaxRedirects)},
 		context: context.Background(),
 	}
 	loc, _, err := w.initiateUpload("", "")
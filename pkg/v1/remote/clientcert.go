@@ -0,0 +1,97 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// clientCertTransport sends requests for hosts that have a client certificate
+// configured through a copy of the inner transport that presents it, and
+// everything else (e.g. token servers) through the inner transport as-is.
+type clientCertTransport struct {
+	inner http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+var _ http.RoundTripper = (*clientCertTransport)(nil)
+
+type clientCertKey struct {
+	base *http.Transport
+	// chain is the certificate's DER-encoded chain, concatenated.
+	chain string
+}
+
+const (
+	// clientCertTTL is how long a copy made by newClientCertTransport is kept
+	// once it's no longer used.
+	clientCertTTL = 10 * time.Minute
+
+	// maxClientCertTransports bounds how many copies are kept, since each
+	// holds its own connections.
+	maxClientCertTransports = 64
+)
+
+// clientCertTransports holds the copies made by newClientCertTransport for
+// each clientCertKey, so that repeated operations with the same options share
+// connections (and ping responses).
+var clientCertTransports = &cache{
+	ttl:   clientCertTTL,
+	max:   maxClientCertTransports,
+	touch: true,
+	m:     map[interface{}]cacheEntry{},
+}
+
+func newClientCertTransport(inner http.RoundTripper, certs map[string]tls.Certificate) (http.RoundTripper, error) {
+	base, ok := inner.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("WithClientCert requires an *http.Transport, got %T", inner)
+	}
+	hosts := make(map[string]http.RoundTripper, len(certs))
+	for host, cert := range certs {
+		cert := cert
+		key := clientCertKey{base: base, chain: string(bytes.Join(cert.Certificate, nil))}
+		hosts[host] = clientCertTransports.load(key, func() interface{} {
+			t := base.Clone()
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+			return t
+		}).(*http.Transport)
+	}
+	return &clientCertTransport{inner: inner, hosts: hosts}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *clientCertTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	if ct, ok := t.hosts[in.URL.Host]; ok {
+		return ct.RoundTrip(in)
+	}
+	if ct, ok := t.hosts[in.URL.Hostname()]; ok {
+		return ct.RoundTrip(in)
+	}
+	return t.inner.RoundTrip(in)
+}
+
+// Unwrap returns the wrapped transport, so that ping responses are cached
+// against the transport that actually talks to the registry.
+func (t *clientCertTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
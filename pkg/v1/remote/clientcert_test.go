@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func newClientCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, leaf
+}
+
+func TestWithClientCert(t *testing.T) {
+	cert, leaf := newClientCert(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	s := httptest.NewUnstartedServer(registry.New())
+	s.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	s.StartTLS()
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trust the server's certificate.
+	tr := s.Client().Transport.(*http.Transport)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+
+	if err := Write(tag, img, WithTransport(tr)); err == nil {
+		t.Error("Write without client cert: got nil want err")
+	}
+	if err := Write(tag, img, WithTransport(tr), WithClientCert("example.com", cert)); err == nil {
+		t.Error("Write with client cert for another host: got nil want err")
+	}
+	if err := Write(tag, img, WithTransport(tr), WithClientCert(u.Host, cert)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := Image(tag, WithTransport(tr), WithClientCert(u.Hostname(), cert)); err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+
+	if _, err := Image(tag, WithTransport(http.NewFileTransport(http.Dir("."))), WithClientCert(u.Host, cert)); err == nil {
+		t.Error("WithClientCert with a non-*http.Transport: got nil want err")
+	}
+}
+
+func TestClientCertTransportReused(t *testing.T) {
+	cert, _ := newClientCert(t)
+	other, _ := newClientCert(t)
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	newTransport := func(certs map[string]tls.Certificate) *clientCertTransport {
+		t.Helper()
+		rt, err := newClientCertTransport(base, certs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rt.(*clientCertTransport)
+	}
+	a := newTransport(map[string]tls.Certificate{"a.example.com": cert})
+	b := newTransport(map[string]tls.Certificate{"b.example.com": cert, "c.example.com": other})
+
+	if a.hosts["a.example.com"] != b.hosts["b.example.com"] {
+		t.Error("same certificate: got different transports, want the same")
+	}
+	if b.hosts["b.example.com"] == b.hosts["c.example.com"] {
+		t.Error("different certificates: got the same transport, want different")
+	}
+	if a.Unwrap() != base {
+		t.Errorf("Unwrap: got %v, want %v", a.Unwrap(), base)
+	}
+}
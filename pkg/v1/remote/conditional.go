@@ -0,0 +1,94 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// ConflictError is returned when pushing with WithExpectedDigest and the tag
+// being pushed no longer points at the expected digest.
+type ConflictError struct {
+	Ref      name.Reference
+	Expected v1.Hash
+
+	// Actual is the digest the tag pointed at, if known. It is the zero
+	// value if the tag doesn't exist or the registry rejected the push with
+	// 412 Precondition Failed.
+	Actual v1.Hash
+}
+
+// Error implements error.
+func (e *ConflictError) Error() string {
+	if e.Actual == (v1.Hash{}) {
+		return fmt.Sprintf("%v no longer points at expected digest %v", e.Ref, e.Expected)
+	}
+	return fmt.Sprintf("%v points at %v, expected %v", e.Ref, e.Actual, e.Expected)
+}
+
+// conditional returns true if pushing to ref should be conditional on
+// w.expectedDigest. Only tags are checked, since pushes by digest can't
+// clobber anything, e.g. the children of an index.
+func (w *writer) conditional(ref name.Reference) bool {
+	_, ok := ref.(name.Tag)
+	return ok && w.expectedDigest != nil
+}
+
+// checkExpectedDigest checks that tag currently points at w.expectedDigest.
+//
+// This is a fallback for registries that ignore If-Match, so there is a window
+// between this check and the subsequent PUT in which another push can still
+// clobber the tag.
+func (w *writer) checkExpectedDigest(ctx context.Context, tag name.Reference) error {
+	u := w.url(fmt.Sprintf("/v2/%s/manifests/%s", w.repo.RepositoryStr(), tag.Identifier()))
+	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	accept := []string{}
+	for _, mt := range append(acceptableImageMediaTypes, acceptableIndexMediaTypes...) {
+		accept = append(accept, string(mt))
+	}
+	req.Header.Set("Accept", strings.Join(accept, ","))
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &ConflictError{Ref: tag, Expected: *w.expectedDigest}
+	}
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	actual, err := v1.NewHash(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		return fmt.Errorf("reading digest of %v: %w", tag, err)
+	}
+	if actual != *w.expectedDigest {
+		return &ConflictError{Ref: tag, Expected: *w.expectedDigest, Actual: actual}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestWithExpectedDigest(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+
+	first, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(tag, first); err != nil {
+		t.Fatal(err)
+	}
+	firstDigest, err := first.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(tag, second, WithExpectedDigest(firstDigest)); err != nil {
+		t.Fatalf("Write(expected digest matches): %v", err)
+	}
+	secondDigest, err := second.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag now points at second, so a push expecting first must fail,
+	// even though this registry ignores If-Match.
+	third, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Write(tag, third, WithExpectedDigest(firstDigest))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Write(stale expected digest): got %v, want *ConflictError", err)
+	}
+	if conflict.Expected != firstDigest || conflict.Actual != secondDigest {
+		t.Errorf("ConflictError: got expected=%v actual=%v, want expected=%v actual=%v", conflict.Expected, conflict.Actual, firstDigest, secondDigest)
+	}
+
+	desc, err := Head(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != secondDigest {
+		t.Errorf("tag was clobbered: got %v, want %v", desc.Digest, secondDigest)
+	}
+}
+
+func TestWithExpectedDigest_PreconditionFailed(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+
+	reg := registry.New()
+	var ifMatch string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/manifests/latest") {
+			switch r.Method {
+			case http.MethodHead:
+				// Pretend the tag matched when we read it.
+				w.Header().Set("Docker-Content-Digest", expected.String())
+				w.WriteHeader(http.StatusOK)
+				return
+			case http.MethodPut:
+				// Simulate another push winning the race.
+				ifMatch = r.Header.Get("If-Match")
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+
+	err = Write(tag, img, WithExpectedDigest(expected))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Write: got %v, want *ConflictError", err)
+	}
+	if conflict.Expected != expected {
+		t.Errorf("ConflictError.Expected: got %v, want %v", conflict.Expected, expected)
+	}
+	if want := fmt.Sprintf("%q", expected.String()); ifMatch != want {
+		t.Errorf("If-Match: got %s, want %s", ifMatch, want)
+	}
+}
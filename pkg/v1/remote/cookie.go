@@ -0,0 +1,57 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+)
+
+// cookieTransport wraps a RoundTripper and sends and stores cookies using an
+// http.CookieJar, the same way http.Client does when its Jar is set.
+//
+// We do this at the transport level because the http.Clients used for token
+// exchange and registry requests are created in many places.
+type cookieTransport struct {
+	inner http.RoundTripper
+	jar   http.CookieJar
+}
+
+var _ http.RoundTripper = (*cookieTransport)(nil)
+
+// RoundTrip implements http.RoundTripper
+func (t *cookieTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	if cookies := t.jar.Cookies(in.URL); len(cookies) != 0 {
+		// RoundTrippers must not modify the request.
+		out := in.Clone(in.Context())
+		for _, c := range cookies {
+			out.AddCookie(c)
+		}
+		in = out
+	}
+	resp, err := t.inner.RoundTrip(in)
+	if err != nil {
+		return resp, err
+	}
+	if cookies := resp.Cookies(); len(cookies) != 0 {
+		t.jar.SetCookies(in.URL, cookies)
+	}
+	return resp, nil
+}
+
+// Unwrap returns the wrapped transport, so that ping responses are cached
+// against the transport that actually talks to the registry.
+func (t *cookieTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
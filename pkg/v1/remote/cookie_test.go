@@ -0,0 +1,76 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestWithCookieJar(t *testing.T) {
+	reg := registry.New()
+	pings := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			pings++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "hunter2", Path: "/"})
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(tag, img, WithCookieJar(jar)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The ping response is shared, but the cookie isn't.
+	if err := Write(tag, img); err == nil {
+		t.Error("Write without cookie jar: got nil want err")
+	}
+	if _, err := Image(tag, WithCookieJar(jar)); err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	if pings != 1 {
+		t.Errorf("pings: got %d, want 1", pings)
+	}
+	if got := jar.Cookies(&url.URL{Scheme: "http", Host: "example.com"}); len(got) != 0 {
+		t.Errorf("cookies for another host: got %v, want none", got)
+	}
+}
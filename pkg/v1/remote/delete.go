@@ -15,30 +15,81 @@
 package remote
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // Delete removes the specified image reference from the remote registry.
+//
+// With WithCascadeReferrers, any referrers of the image (e.g. signatures or
+// SBOMs) are deleted first. With WithDryRun, nothing is deleted and the
+// digests of the manifests that would be deleted are returned instead.
 func Delete(ref name.Reference, options ...Option) error {
 	o, err := makeOptions(ref.Context(), options...)
 	if err != nil {
 		return err
 	}
+	dryRun := o.dryRun != nil
 	scopes := []string{ref.Scope(transport.DeleteScope)}
+	if o.cascadeReferrers || dryRun {
+		scopes = append(scopes, ref.Scope(transport.PullScope))
+	}
 	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
 	if err != nil {
 		return err
 	}
-	c := &http.Client{Transport: tr}
+	c := o.newClient(tr)
+
+	var plan []name.Digest
+	if o.cascadeReferrers || dryRun {
+		f := &fetcher{
+			Ref:     ref,
+			Client:  c,
+			context: o.context,
+		}
+		h, err := f.subjectDigest(ref)
+		if err != nil {
+			return err
+		}
+		if o.cascadeReferrers {
+			plan, err = f.referrersToDelete(ref.Context(), h, map[v1.Hash]bool{h: true})
+			if err != nil {
+				return fmt.Errorf("listing referrers of %s: %w", ref, err)
+			}
+		}
+		if dryRun {
+			*o.dryRun = append(plan, ref.Context().Digest(h.String()))
+			for _, d := range *o.dryRun {
+				logs.Progress.Printf("would delete: %s", d)
+			}
+			return nil
+		}
+	}
 
+	for _, r := range plan {
+		if err := deleteManifest(c, r, o); err != nil {
+			// Bail before deleting the subject, so that we don't leave any
+			// referrers orphaned.
+			return fmt.Errorf("deleting referrer %s of %s: %w", r, ref, err)
+		}
+	}
+	return deleteManifest(c, ref, o)
+}
+
+func deleteManifest(c *http.Client, ref name.Reference, o *options) error {
 	u := url.URL{
 		Scheme: ref.Context().Registry.Scheme(),
-		Host:   ref.Context().RegistryStr(),
+		Host:   ref.Context().Registry.APIHost(),
 		Path:   fmt.Sprintf("/v2/%s/manifests/%s", ref.Context().RepositoryStr(), ref.Identifier()),
 	}
 
@@ -55,3 +106,126 @@ func Delete(ref name.Reference, options ...Option) error {
 
 	return transport.CheckError(resp, http.StatusOK, http.StatusAccepted)
 }
+
+// subjectDigest resolves ref to the digest of the manifest it points to.
+func (f *fetcher) subjectDigest(ref name.Reference) (v1.Hash, error) {
+	if d, ok := asDigest(ref); ok {
+		return v1.NewHash(d.DigestStr())
+	}
+	acceptable := []types.MediaType{}
+	acceptable = append(acceptable, acceptableImageMediaTypes...)
+	acceptable = append(acceptable, acceptableIndexMediaTypes...)
+	desc, err := f.headManifest(ref, acceptable)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return desc.Digest, nil
+}
+
+// referrersToDelete returns the referrers of h, recursively, in the order they
+// should be deleted, i.e. each referrer comes after its own referrers. If the
+// registry doesn't support the referrers API and we found the referrers via
+// the tag schema, the index behind the fallback tag is included as well.
+func (f *fetcher) referrersToDelete(repo name.Repository, h v1.Hash, seen map[v1.Hash]bool) ([]name.Digest, error) {
+	descs, fallback, err := f.fetchReferrers(repo, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []name.Digest
+	for _, desc := range descs {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		children, err := f.referrersToDelete(repo, desc.Digest, seen)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, children...)
+		out = append(out, repo.Digest(desc.Digest.String()))
+	}
+	if fallback != nil && !seen[*fallback] {
+		seen[*fallback] = true
+		out = append(out, repo.Digest(fallback.String()))
+	}
+	return out, nil
+}
+
+// fetchReferrers lists the referrers of h using the referrers API, following
+// any Link headers to later pages. It falls back to the "<alg>-<hex>" tag
+// schema for registries that don't support the API, which depending on the
+// registry respond with a 404, 400 or 405. If the fallback tag was used, its
+// digest is returned as well.
+func (f *fetcher) fetchReferrers(repo name.Repository, h v1.Hash) ([]v1.Descriptor, *v1.Hash, error) {
+	first := f.url("referrers", h.String())
+	var descs []v1.Descriptor
+	for u := &first; u != nil; {
+		index, next, err := f.referrersPage(u, u == &first)
+		if err != nil {
+			return nil, nil, err
+		}
+		if index == nil {
+			return f.fallbackReferrers(repo, h)
+		}
+		descs = append(descs, index.Manifests...)
+		u = next
+	}
+	return descs, nil, nil
+}
+
+// referrersPage fetches one page of the referrers API, returning the URL of
+// the next page if there is one. If first is set and the registry doesn't
+// support the API, it returns a nil index.
+func (f *fetcher) referrersPage(u *url.URL, first bool) (*v1.IndexManifest, *url.URL, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := f.Client.Do(req.WithContext(f.context))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	codes := []int{http.StatusOK}
+	if first {
+		codes = append(codes, http.StatusNotFound, http.StatusBadRequest, http.StatusMethodNotAllowed)
+	}
+	if err := transport.CheckError(resp, codes...); err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil
+	}
+	index, err := v1.ParseIndexManifest(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := getNextPageURL(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return index, next, nil
+}
+
+// fallbackReferrers lists the referrers of h from the index behind its
+// "<alg>-<hex>" tag, returning the digest of that index as well.
+func (f *fetcher) fallbackReferrers(repo name.Repository, h v1.Hash) ([]v1.Descriptor, *v1.Hash, error) {
+	tag := repo.Tag(strings.Replace(h.String(), ":", "-", 1))
+	b, desc, err := f.fetchManifest(tag, acceptableIndexMediaTypes)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	index, err := v1.ParseIndexManifest(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	return index.Manifests, &desc.Digest, nil
+}
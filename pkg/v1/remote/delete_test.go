@@ -15,13 +15,24 @@
 package remote
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 func TestDelete(t *testing.T) {
@@ -87,3 +98,178 @@ func TestDeleteBadStatus(t *testing.T) {
 		t.Error("Delete() = nil; wanted error")
 	}
 }
+
+func TestDeleteCascadeReferrers(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		deletes   []string
+		reject    string
+		referrers int
+		// pages, if set, are served by the referrers API for pagesFor,
+		// linked together with Link headers.
+		pages    [][]v1.Descriptor
+		pagesFor string
+	)
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if referrers != 0 && strings.Contains(r.URL.Path, "/referrers/") {
+			http.Error(w, "referrers API unsupported", referrers)
+			return
+		}
+		if pages != nil && strings.Contains(r.URL.Path, "/referrers/") {
+			var page int
+			if strings.HasSuffix(r.URL.Path, pagesFor) {
+				fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+			} else {
+				page = len(pages)
+			}
+			index := v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex}
+			if page < len(pages) {
+				index.Manifests = pages[page]
+			}
+			if page+1 < len(pages) {
+				w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+			}
+			if err := json.NewEncoder(w).Encode(index); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deletes = append(deletes, path.Base(r.URL.Path))
+			mu.Unlock()
+			if reject != "" && strings.HasSuffix(r.URL.Path, reject) {
+				http.Error(w, "nope", http.StatusMethodNotAllowed)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(ref string, tg withDigest) v1.Hash {
+		t.Helper()
+		r, err := name.ParseReference(u.Host + "/repo" + ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tt := tg.(type) {
+		case v1.Image:
+			err = Write(r, tt)
+		case v1.ImageIndex:
+			err = WriteIndex(r, tt)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mustDigest(t, tg)
+	}
+	fallback := func(subject v1.Hash, referrer v1.Image) v1.Hash {
+		t.Helper()
+		idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex), mutate.IndexAddendum{Add: referrer})
+		return push(":"+strings.Replace(subject.String(), ":", "-", 1), idx)
+	}
+
+	subject, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigsig, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjectDigest := push(":latest", subject)
+	sigDigest := push("@"+mustDigest(t, sig).String(), sig)
+	sigsigDigest := push("@"+mustDigest(t, sigsig).String(), sigsig)
+	subjectFallback := fallback(subjectDigest, sig)
+	sigFallback := fallback(sigDigest, sigsig)
+
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+
+	// A dry run deletes nothing, but returns everything it would delete,
+	// however the registry says it doesn't support the referrers API.
+	var wantPlan []name.Digest
+	for _, h := range []v1.Hash{sigsigDigest, sigFallback, sigDigest, subjectFallback, subjectDigest} {
+		wantPlan = append(wantPlan, tag.Context().Digest(h.String()))
+	}
+	for _, status := range []int{0, http.StatusBadRequest, http.StatusMethodNotAllowed} {
+		referrers = status
+		var plan []name.Digest
+		if err := Delete(tag, WithCascadeReferrers(), WithDryRun(&plan)); err != nil {
+			t.Fatalf("Delete(dry run, referrers %d): %v", status, err)
+		}
+		if diff := cmp.Diff(wantPlan, plan, cmp.Comparer(func(a, b name.Digest) bool { return a.String() == b.String() })); diff != "" {
+			t.Errorf("dry run plan, referrers %d (-want +got) = %s", status, diff)
+		}
+	}
+
+	// An auth failure isn't a sign that the referrers API is unsupported.
+	referrers = http.StatusUnauthorized
+	if err := Delete(tag, WithCascadeReferrers(), WithDryRun(&[]name.Digest{})); err == nil {
+		t.Error("Delete(dry run, referrers 401): got nil want err")
+	}
+
+	// Referrers are collected from every page of the referrers API.
+	referrers = 0
+	pages = [][]v1.Descriptor{
+		{{MediaType: types.OCIManifestSchema1, Digest: sigDigest}},
+		{{MediaType: types.OCIManifestSchema1, Digest: sigsigDigest}},
+	}
+	pagesFor = subjectDigest.String()
+	var paged []name.Digest
+	if err := Delete(tag, WithCascadeReferrers(), WithDryRun(&paged)); err != nil {
+		t.Fatalf("Delete(dry run, paged referrers): %v", err)
+	}
+	var wantPaged []name.Digest
+	for _, h := range []v1.Hash{sigDigest, sigsigDigest, subjectDigest} {
+		wantPaged = append(wantPaged, tag.Context().Digest(h.String()))
+	}
+	if diff := cmp.Diff(wantPaged, paged, cmp.Comparer(func(a, b name.Digest) bool { return a.String() == b.String() })); diff != "" {
+		t.Errorf("dry run plan, paged referrers (-want +got) = %s", diff)
+	}
+	pages = nil
+
+	if len(deletes) != 0 {
+		t.Errorf("dry run sent deletes: %v", deletes)
+	}
+	var plan []name.Digest
+	if err := Delete(tag, WithDryRun(&plan)); err != nil {
+		t.Fatalf("Delete(dry run): %v", err)
+	}
+	if want := tag.Context().Digest(subjectDigest.String()); len(plan) != 1 || plan[0].String() != want.String() {
+		t.Errorf("dry run plan without referrers = %v, want [%v]", plan, want)
+	}
+
+	// If the registry rejects deleting a referrer, we don't delete the subject.
+	reject = sigsigDigest.String()
+	if err := Delete(tag, WithCascadeReferrers()); err == nil {
+		t.Error("Delete: got nil want err")
+	}
+	if diff := cmp.Diff([]string{sigsigDigest.String()}, deletes); diff != "" {
+		t.Errorf("deletes (-want +got) = %s", diff)
+	}
+
+	reject, deletes = "", nil
+	if err := Delete(tag, WithCascadeReferrers()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	want := []string{
+		sigsigDigest.String(),
+		sigFallback.String(),
+		sigDigest.String(),
+		subjectFallback.String(),
+		"latest",
+	}
+	if diff := cmp.Diff(want, deletes); diff != "" {
+		t.Errorf("deletes (-want +got) = %s", diff)
+	}
+}
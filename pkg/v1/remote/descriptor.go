@@ -59,6 +59,10 @@ type Descriptor struct {
 	v1.Descriptor
 	Manifest []byte
 
+	// ResponseHeaders holds the headers of the registry's response to the
+	// manifest request. It is only populated if WithCaptureHeaders is set.
+	ResponseHeaders http.Header
+
 	// So we can share this implementation with Image..
 	platform v1.Platform
 }
@@ -118,20 +122,29 @@ func get(ref name.Reference, acceptable []types.MediaType, options ...Option) (*
 	if err != nil {
 		return nil, err
 	}
+	return getWithOptions(ref, acceptable, o)
+}
+
+// getWithOptions is like get, for callers that need the options themselves.
+func getWithOptions(ref name.Reference, acceptable []types.MediaType, o *options) (*Descriptor, error) {
 	f, err := makeFetcher(ref, o)
 	if err != nil {
 		return nil, err
 	}
-	b, desc, err := f.fetchManifest(ref, acceptable)
+	b, desc, header, err := f.fetchManifestWithHeaders(ref, acceptable)
 	if err != nil {
 		return nil, err
 	}
-	return &Descriptor{
+	d := &Descriptor{
 		fetcher:    *f,
 		Manifest:   b,
 		Descriptor: *desc,
 		platform:   o.platform,
-	}, nil
+	}
+	if o.captureHeaders {
+		d.ResponseHeaders = header
+	}
+	return d, nil
 }
 
 // Image converts the Descriptor into a v1.Image.
@@ -209,11 +222,31 @@ func (d *Descriptor) remoteIndex() *remoteIndex {
 	}
 }
 
+// asDigest returns the digest that ref refers to, if any. The digest of a
+// name.TaggedDigest is authoritative, so it's treated like a name.Digest.
+func asDigest(ref name.Reference) (name.Digest, bool) {
+	switch r := ref.(type) {
+	case name.Digest:
+		return r, true
+	case name.TaggedDigest:
+		return r.Digest(), true
+	}
+	return name.Digest{}, false
+}
+
 // fetcher implements methods for reading from a registry.
 type fetcher struct {
 	Ref     name.Reference
 	Client  *http.Client
 	context context.Context
+
+	// digestAlgorithm is used to compute the digest of manifests fetched by
+	// tag; "sha256" if empty.
+	digestAlgorithm string
+
+	// manifests holds the child manifests of an index that were prefetched by
+	// Index, if any.
+	manifests *manifestCache
 }
 
 func makeFetcher(ref name.Reference, o *options) (*fetcher, error) {
@@ -222,9 +255,10 @@ func makeFetcher(ref name.Reference, o *options) (*fetcher, error) {
 		return nil, err
 	}
 	return &fetcher{
-		Ref:     ref,
-		Client:  &http.Client{Transport: tr},
-		context: o.context,
+		Ref:             ref,
+		Client:          o.newClient(tr),
+		context:         o.context,
+		digestAlgorithm: o.digestAlgorithm,
 	}, nil
 }
 
@@ -232,16 +266,23 @@ func makeFetcher(ref name.Reference, o *options) (*fetcher, error) {
 func (f *fetcher) url(resource, identifier string) url.URL {
 	return url.URL{
 		Scheme: f.Ref.Context().Registry.Scheme(),
-		Host:   f.Ref.Context().RegistryStr(),
+		Host:   f.Ref.Context().Registry.APIHost(),
 		Path:   fmt.Sprintf("/v2/%s/%s/%s", f.Ref.Context().RepositoryStr(), resource, identifier),
 	}
 }
 
 func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType) ([]byte, *v1.Descriptor, error) {
+	b, desc, _, err := f.fetchManifestWithHeaders(ref, acceptable)
+	return b, desc, err
+}
+
+// fetchManifestWithHeaders is like fetchManifest, but also returns the headers
+// of the response.
+func (f *fetcher) fetchManifestWithHeaders(ref name.Reference, acceptable []types.MediaType) ([]byte, *v1.Descriptor, http.Header, error) {
 	u := f.url("manifests", ref.Identifier())
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	accept := []string{}
 	for _, mt := range acceptable {
@@ -251,22 +292,33 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 
 	resp, err := f.Client.Do(req.WithContext(f.context))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	if err := transport.CheckError(resp, http.StatusOK); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	manifest, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	digest, size, err := v1.SHA256(bytes.NewReader(manifest))
+	// Compute the digest with the same algorithm as the one we asked for, if
+	// pulling by digest.
+	algorithm := f.digestAlgorithm
+	if dgst, ok := asDigest(ref); ok {
+		if h, err := v1.NewHash(dgst.DigestStr()); err == nil {
+			algorithm = h.Algorithm
+		}
+	}
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	digest, size, err := v1.ComputeHash(algorithm, bytes.NewReader(manifest))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	mediaType := types.MediaType(resp.Header.Get("Content-Type"))
@@ -278,9 +330,9 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 	}
 
 	// Validate the digest matches what we asked for, if pulling by digest.
-	if dgst, ok := ref.(name.Digest); ok {
+	if dgst, ok := asDigest(ref); ok {
 		if digest.String() != dgst.DigestStr() {
-			return nil, nil, fmt.Errorf("manifest digest: %q does not match requested digest: %q for %q", digest, dgst.DigestStr(), f.Ref)
+			return nil, nil, nil, fmt.Errorf("manifest digest: %q does not match requested digest: %q for %q", digest, dgst.DigestStr(), f.Ref)
 		}
 	}
 	// Do nothing for tags; I give up.
@@ -298,7 +350,7 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 		MediaType: mediaType,
 	}
 
-	return manifest, &desc, nil
+	return manifest, &desc, resp.Header, nil
 }
 
 func (f *fetcher) headManifest(ref name.Reference, acceptable []types.MediaType) (*v1.Descriptor, error) {
@@ -344,7 +396,7 @@ func (f *fetcher) headManifest(ref name.Reference, acceptable []types.MediaType)
 	}
 
 	// Validate the digest matches what we asked for, if pulling by digest.
-	if dgst, ok := ref.(name.Digest); ok {
+	if dgst, ok := asDigest(ref); ok {
 		if digest.String() != dgst.DigestStr() {
 			return nil, fmt.Errorf("manifest digest: %q does not match requested digest: %q for %q", digest, dgst.DigestStr(), f.Ref)
 		}
@@ -409,6 +461,19 @@ func (f *fetcher) headBlob(h v1.Hash) (*http.Response, error) {
 	return resp, nil
 }
 
+// blobSize returns the size of the blob h as reported by the registry.
+func (f *fetcher) blobSize(h v1.Hash) (int64, error) {
+	resp, err := f.headBlob(h)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return -1, fmt.Errorf("HEAD %s: registry didn't report the size of %s", resp.Request.URL, h)
+	}
+	return resp.ContentLength, nil
+}
+
 func (f *fetcher) blobExists(h v1.Hash) (bool, error) {
 	u := f.url("blobs", h.String())
 	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
@@ -15,6 +15,7 @@
 package remote
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
@@ -25,6 +26,8 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -128,6 +131,51 @@ func TestGetImageAsIndex(t *testing.T) {
 	}
 }
 
+func TestGetCaptureHeaders(t *testing.T) {
+	expectedRepo := "foo/bar"
+	manifestPath := fmt.Sprintf("/v2/%s/manifests/latest", expectedRepo)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case manifestPath:
+			w.Header().Set("Content-Type", string(types.DockerManifestSchema2))
+			w.Header().Set("RateLimit-Remaining", "99;w=21600")
+			w.Header().Set("X-Custom", "hello")
+			w.Write([]byte("doesn't matter"))
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	tag := mustNewTag(t, fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo))
+
+	desc, err := Get(tag)
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", tag, err)
+	}
+	if desc.ResponseHeaders != nil {
+		t.Errorf("ResponseHeaders = %v, expected nil by default", desc.ResponseHeaders)
+	}
+
+	desc, err = Get(tag, WithCaptureHeaders())
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", tag, err)
+	}
+	if got, want := desc.ResponseHeaders.Get("RateLimit-Remaining"), "99;w=21600"; got != want {
+		t.Errorf("RateLimit-Remaining = %q, want %q", got, want)
+	}
+	if got, want := desc.ResponseHeaders.Get("X-Custom"), "hello"; got != want {
+		t.Errorf("X-Custom = %q, want %q", got, want)
+	}
+}
+
 func TestHeadSchema1(t *testing.T) {
 	expectedRepo := "foo/bar"
 	mediaType := types.DockerManifestSchema1Signed
@@ -216,3 +264,52 @@ func TestHead_MissingHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestGetTaggedDigest(t *testing.T) {
+	expectedRepo := "foo/bar"
+	manifest := []byte("doesn't matter")
+	digest, _, err := v1.SHA256(bytes.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDigest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case fmt.Sprintf("/v2/%s/manifests/%s", expectedRepo, digest), fmt.Sprintf("/v2/%s/manifests/%s", expectedRepo, otherDigest):
+			w.Header().Set("Content-Type", string(types.DockerManifestSchema2))
+			w.Write(manifest)
+		default:
+			// In particular, we should never fetch by tag.
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	ref, err := name.NewTaggedDigest(fmt.Sprintf("%s/%s:latest@%s", u.Host, expectedRepo, digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := Get(ref)
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", ref, err)
+	}
+	if desc.Digest != digest {
+		t.Errorf("Digest = %v, want %v", desc.Digest, digest)
+	}
+
+	// The digest is authoritative, so a mismatch must fail.
+	ref, err = name.NewTaggedDigest(fmt.Sprintf("%s/%s:latest@%s", u.Host, expectedRepo, otherDigest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(ref); err == nil {
+		t.Errorf("Get(%s) = nil, want digest mismatch error", ref)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestWithDigestAlgorithm(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/sha512")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := []byte("hello, sha512")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Reading a manifest that references sha512 blobs verifies them with sha512.
+	got, err := Image(ref)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	layers, err := got.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want 1", len(layers))
+	}
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := digest.Algorithm, "sha512"; got != want {
+		t.Errorf("layer digest algorithm: got %q, want %q", got, want)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		t.Errorf("reading sha512 layer: %v", err)
+	}
+
+	// Manifests fetched by tag are digested with the requested algorithm.
+	desc, err := Get(ref, WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	want, _, err := v1.ComputeHash("sha512", bytes.NewReader(desc.Manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != want {
+		t.Errorf("Get digest: got %v, want %v", desc.Digest, want)
+	}
+
+	if _, err := Get(ref, WithDigestAlgorithm("md5")); err == nil {
+		t.Error("Get(md5) = nil, wanted error")
+	}
+}
+
+func TestDigestAlgorithmRoundTrip(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := name.NewRepository(u.Host + "/test/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := name.NewRepository(u.Host + "/test/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := v1.ComputeHash("sha512", bytes.NewReader(mustRawManifest(t, img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(src.Digest(h.String()), img); err != nil {
+		t.Fatal(err)
+	}
+
+	// An image fetched by a sha512 digest keeps that digest when it's
+	// written elsewhere, and its push is verified by that digest.
+	got, err := Image(src.Digest(h.String()))
+	if err != nil {
+		t.Fatalf("Image(%s): %v", h, err)
+	}
+	if d := mustDigest(t, got); d != h {
+		t.Errorf("Image(%s).Digest() = %v", h, d)
+	}
+	if err := Write(dst.Digest(h.String()), got, WithVerifyAfterPush()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Overriding the media type of an index fetched with sha512 gives a
+	// sha512 digest too.
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+	if err := WriteIndex(src.Tag("index"), idx); err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := Index(src.Tag("index"), WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oi, err := newOverriddenIndex(fetched, types.DockerManifestList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := v1.ComputeHash("sha512", bytes.NewReader(mustRawManifest(t, oi)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := mustDigest(t, oi); d != want {
+		t.Errorf("overridden index digest: got %v, want %v", d, want)
+	}
+	if err := WriteIndex(dst.Tag("index"), fetched, WithManifestMediaTypeOverride(types.DockerManifestList)); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	desc, err := Get(dst.Tag("index"), WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.MediaType != types.DockerManifestList || desc.Digest != want {
+		t.Errorf("Get(index) = %s %v, want %s %v", desc.MediaType, desc.Digest, types.DockerManifestList, want)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+)
+
+// hostHeaderTransport wraps a RoundTripper and overrides the Host header of
+// requests to the registry, while still connecting to the registry's address.
+// Requests to other hosts, e.g. token servers or redirects to a CDN, are left
+// alone.
+//
+// This wraps the transport that dials the registry, so the auth transports
+// above it still match requests against the registry rather than host.
+type hostHeaderTransport struct {
+	inner  http.RoundTripper
+	target string
+	host   string
+}
+
+var _ http.RoundTripper = (*hostHeaderTransport)(nil)
+
+// RoundTrip implements http.RoundTripper
+func (t *hostHeaderTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	if in.URL.Host == t.target && in.Host != t.host {
+		// RoundTrippers must not modify the request.
+		out := in.Clone(in.Context())
+		out.Host = t.host
+		in = out
+	}
+	return t.inner.RoundTrip(in)
+}
+
+// Unwrap returns the wrapped transport, so that ping responses are cached
+// against the transport that actually talks to the registry.
+func (t *hostHeaderTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
+
+// HostHeader returns the Host header that requests to the registry are sent
+// with, so that ping responses for different hosts are cached separately.
+func (t *hostHeaderTransport) HostHeader() string {
+	return t.host
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestWithHostHeader(t *testing.T) {
+	const vhost = "registry.example.com"
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Route based on the Host header, like a load balancer would.
+		if r.Host != vhost {
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+	auth := WithAuth(&authn.Basic{Username: "foo", Password: "bar"})
+
+	if err := Write(tag, img, auth); err == nil {
+		t.Error("Write without host header: got nil want err")
+	}
+	if _, err := Image(tag, auth, WithHostHeader(vhost)); err == nil {
+		t.Error("Image before Write: got nil want err")
+	}
+
+	if err := Write(tag, img, auth, WithHostHeader(vhost)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := Image(tag, auth, WithHostHeader(vhost)); err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+
+	if _, err := makeOptions(tag, WithHostHeader("")); err == nil {
+		t.Error("WithHostHeader(\"\"): got nil want err")
+	}
+}
+
+func TestWithHostHeaderPingCache(t *testing.T) {
+	// Two virtual hosts on one server, only one of which needs auth.
+	const public, private = "public.example.com", "private.example.com"
+	var mu sync.Mutex
+	pings := map[string]int{}
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			mu.Lock()
+			pings[r.Host]++
+			mu.Unlock()
+		}
+		if r.Host == private {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+	auth := WithAuth(&authn.Basic{Username: "foo", Password: "bar"})
+
+	// Both share the underlying transport, but the anonymous ping response
+	// from the public host mustn't be used for the private one.
+	if err := Write(tag, img, auth, WithHostHeader(public)); err != nil {
+		t.Fatalf("Write(%s): %v", public, err)
+	}
+	if err := Write(tag, img, auth, WithHostHeader(private)); err != nil {
+		t.Fatalf("Write(%s): %v", private, err)
+	}
+	if _, err := Image(tag, auth, WithHostHeader(private)); err != nil {
+		t.Fatalf("Image(%s): %v", private, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, host := range []string{public, private} {
+		if got, want := pings[host], 1; got != want {
+			t.Errorf("pings to %s: got %d, want %d", host, got, want)
+		}
+	}
+}
@@ -239,6 +239,11 @@ func (rl *remoteImageLayer) Exists() (bool, error) {
 	return rl.ri.blobExists(rl.digest)
 }
 
+// See partial.StoredSize.
+func (rl *remoteImageLayer) StoredSize() (int64, error) {
+	return rl.ri.blobSize(rl.digest)
+}
+
 // LayerByDigest implements partial.CompressedLayer
 func (r *remoteImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
 	return &remoteImageLayer{
@@ -34,6 +34,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
@@ -43,10 +44,6 @@ import (
 
 const bogusDigest = "sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
 
-type withDigest interface {
-	Digest() (v1.Hash, error)
-}
-
 func mustDigest(t *testing.T, img withDigest) v1.Hash {
 	h, err := img.Digest()
 	if err != nil {
@@ -520,6 +517,69 @@ func TestPullingManifestListNoMatch(t *testing.T) {
 	tag := mustNewTag(t, fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo))
 	if _, err := Image(tag, WithPlatform(platform)); err == nil {
 		t.Errorf("Image succeeded, wanted err")
+	} else if !strings.Contains(err.Error(), "available platforms: [linux/amd64") {
+		t.Errorf("Image() = %v, wanted error listing available platforms", err)
+	}
+}
+
+func TestPullingManifestListPlatformResolve(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/foo/bar:latest")
+
+	host := hostPlatform()
+	other := v1.Platform{OS: "not-real-os", Architecture: "not-real-arch"}
+	var adds []mutate.IndexAddendum
+	digests := map[string]v1.Hash{}
+	for _, p := range []v1.Platform{defaultPlatform, host, other} {
+		if _, ok := digests[p.String()]; ok {
+			continue
+		}
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := p
+		adds = append(adds, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &p},
+		})
+		digests[p.String()] = mustDigest(t, img)
+	}
+	idx := mutate.AppendManifests(empty.Index, adds...)
+	if err := WriteIndex(tag, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want v1.Platform
+	}{{
+		name: "default",
+		want: defaultPlatform,
+	}, {
+		name: "host",
+		opts: []Option{WithPlatformResolve()},
+		want: host,
+	}, {
+		name: "override",
+		opts: []Option{WithPlatform(other), WithPlatformResolve()},
+		want: other,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Image(tag, tc.opts...)
+			if err != nil {
+				t.Fatalf("Image() = %v", err)
+			}
+			if got, want := mustDigest(t, img), digests[tc.want.String()]; got != want {
+				t.Errorf("Digest() = %v, want %v (%s)", got, want, tc.want)
+			}
+		})
 	}
 }
 
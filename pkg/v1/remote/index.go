@@ -17,6 +17,7 @@ package remote
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/google/go-containerregistry/internal/verify"
@@ -24,6 +25,7 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
 )
 
 var acceptableIndexMediaTypes = []types.MediaType{
@@ -41,15 +43,113 @@ type remoteIndex struct {
 }
 
 // Index provides access to a remote index reference.
+//
+// If WithJobs is given, the manifests of all the children of the index are
+// fetched up front, recursively and concurrently. Layers are still fetched
+// lazily.
 func Index(ref name.Reference, options ...Option) (v1.ImageIndex, error) {
-	desc, err := get(ref, acceptableIndexMediaTypes, options...)
+	o, err := makeOptions(ref.Context(), options...)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := getWithOptions(ref, acceptableIndexMediaTypes, o)
 	if err != nil {
 		return nil, err
 	}
+	if o.jobsSet {
+		if err := desc.prefetch(o.jobs); err != nil {
+			return nil, err
+		}
+	}
 
 	return desc.ImageIndex()
 }
 
+// manifestCache holds manifests by digest.
+type manifestCache struct {
+	sync.Mutex
+	manifests map[v1.Hash][]byte
+}
+
+func (c *manifestCache) get(h v1.Hash) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	b, ok := c.manifests[h]
+	return b, ok
+}
+
+// prefetch fetches the manifests of every image and index under the index d,
+// with at most jobs requests in flight, and caches them on d's fetcher so that
+// they're shared with every remoteIndex derived from d.
+func (d *Descriptor) prefetch(jobs int) error {
+	cache := &manifestCache{manifests: map[v1.Hash][]byte{}}
+	seen := map[v1.Hash]bool{}
+	var seenLock sync.Mutex
+	sem := make(chan struct{}, jobs)
+	var g errgroup.Group
+
+	var visit func(raw []byte)
+	visit = func(raw []byte) {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			g.Go(func() error { return err })
+			return
+		}
+		for _, child := range index.Manifests {
+			child := child
+			if !child.MediaType.IsImage() && !child.MediaType.IsIndex() {
+				continue
+			}
+			seenLock.Lock()
+			dup := seen[child.Digest]
+			seen[child.Digest] = true
+			seenLock.Unlock()
+			if dup {
+				continue
+			}
+
+			g.Go(func() error {
+				manifest := child.Data
+				if manifest != nil {
+					if err := verify.Descriptor(child); err != nil {
+						return err
+					}
+				} else {
+					sem <- struct{}{}
+					ref := d.Ref.Context().Digest(child.Digest.String())
+					b, _, err := d.fetchManifest(ref, []types.MediaType{child.MediaType})
+					<-sem
+					if err != nil {
+						return err
+					}
+					manifest = b
+				}
+
+				cache.Lock()
+				cache.manifests[child.Digest] = manifest
+				cache.Unlock()
+
+				// Only the fetch itself holds a slot, so that nested indexes
+				// can't starve each other.
+				if child.MediaType.IsIndex() {
+					visit(manifest)
+				}
+				return nil
+			})
+		}
+	}
+	visit(d.Manifest)
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	d.manifests = cache
+	return nil
+}
+
 func (r *remoteIndex) MediaType() (types.MediaType, error) {
 	if string(r.mediaType) != "" {
 		return r.mediaType, nil
@@ -203,6 +303,7 @@ func (r *remoteIndex) childByPlatform(platform v1.Platform) (*Descriptor, error)
 	if err != nil {
 		return nil, err
 	}
+	available := make([]string, 0, len(index.Manifests))
 	for _, childDesc := range index.Manifests {
 		// If platform is missing from child descriptor, assume it's amd64/linux.
 		p := defaultPlatform
@@ -213,8 +314,9 @@ func (r *remoteIndex) childByPlatform(platform v1.Platform) (*Descriptor, error)
 		if matchesPlatform(p, platform) {
 			return r.childDescriptor(childDesc, platform)
 		}
+		available = append(available, p.String())
 	}
-	return nil, fmt.Errorf("no child with platform %+v in index %s", platform, r.Ref)
+	return nil, fmt.Errorf("no child with platform %s in index %s; available platforms: [%s]", platform, r.Ref, strings.Join(available, ", "))
 }
 
 func (r *remoteIndex) childByHash(h v1.Hash) (*Descriptor, error) {
@@ -242,6 +344,8 @@ func (r *remoteIndex) childDescriptor(child v1.Descriptor, platform v1.Platform)
 			return nil, err
 		}
 		manifest = child.Data
+	} else if b, ok := r.manifests.get(child.Digest); ok {
+		manifest = b
 	} else {
 		manifest, _, err = r.fetchManifest(ref, []types.MediaType{child.MediaType})
 		if err != nil {
@@ -250,9 +354,10 @@ func (r *remoteIndex) childDescriptor(child v1.Descriptor, platform v1.Platform)
 	}
 	return &Descriptor{
 		fetcher: fetcher{
-			Ref:     ref,
-			Client:  r.Client,
-			context: r.context,
+			Ref:       ref,
+			Client:    r.Client,
+			context:   r.context,
+			manifests: r.manifests,
 		},
 		Manifest:   manifest,
 		Descriptor: child,
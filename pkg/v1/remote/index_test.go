@@ -21,12 +21,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
 
 func randomIndex(t *testing.T) v1.ImageIndex {
@@ -502,3 +510,149 @@ func TestMatchesPlatform(t *testing.T) {
 		}
 	}
 }
+
+func TestIndexPrefetch(t *testing.T) {
+	// Build a 3-level index: top -> 2 indexes -> 2 indexes each -> 2 images each.
+	nest := func(children ...mutate.Appendable) v1.ImageIndex {
+		adds := []mutate.IndexAddendum{}
+		for _, c := range children {
+			adds = append(adds, mutate.IndexAddendum{Add: c})
+		}
+		return mutate.AppendManifests(empty.Index, adds...)
+	}
+	leaf := func() v1.ImageIndex {
+		imgs := []mutate.Appendable{}
+		for i := 0; i < 2; i++ {
+			img, err := random.Image(64, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imgs = append(imgs, img)
+		}
+		return nest(imgs...)
+	}
+	top := nest(nest(leaf(), leaf()), nest(leaf(), leaf()))
+	// 1 top + 2 middle + 4 leaf indexes + 8 images.
+	const manifests = 15
+
+	var (
+		mu                   sync.Mutex
+		gets, inflight, peak int
+		blobs                int
+	)
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+			mu.Lock()
+			gets++
+			inflight++
+			if inflight > peak {
+				peak = inflight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			defer func() {
+				mu.Lock()
+				inflight--
+				mu.Unlock()
+			}()
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			mu.Lock()
+			blobs++
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/nested:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(ref, top); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	gets, blobs = 0, 0
+	mu.Unlock()
+
+	const jobs = 2
+	idx, err := Index(ref, WithJobs(jobs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if gets != manifests {
+		t.Errorf("Index() fetched %d manifests, want %d", gets, manifests)
+	}
+	if peak > jobs {
+		t.Errorf("Index() had %d manifest requests in flight, want at most %d", peak, jobs)
+	}
+	if peak < jobs {
+		t.Errorf("Index() had %d manifest requests in flight, want %d", peak, jobs)
+	}
+	if blobs != 0 {
+		t.Errorf("Index() fetched %d blobs, want 0", blobs)
+	}
+	gets = 0
+	mu.Unlock()
+
+	// Walking the tree is served from the prefetched manifests, and preserves
+	// the structure of the original index.
+	var walk func(got, want v1.ImageIndex)
+	walk = func(got, want v1.ImageIndex) {
+		gm, err := got.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wm, err := want.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gm.Manifests) != len(wm.Manifests) {
+			t.Fatalf("got %d children, want %d", len(gm.Manifests), len(wm.Manifests))
+		}
+		for i, desc := range gm.Manifests {
+			if desc.Digest != wm.Manifests[i].Digest {
+				t.Errorf("child %d: got %s, want %s", i, desc.Digest, wm.Manifests[i].Digest)
+			}
+			if desc.MediaType.IsIndex() {
+				gc, err := got.ImageIndex(desc.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wc, err := want.ImageIndex(desc.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				walk(gc, wc)
+				continue
+			}
+			img, err := got.Image(desc.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := img.Manifest(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	walk(idx, top)
+
+	mu.Lock()
+	if gets != 0 {
+		t.Errorf("walking the index fetched %d manifests, want 0", gets)
+	}
+	mu.Unlock()
+
+	// Layers are still fetched lazily, and the whole thing is valid.
+	if err := validate.Index(idx); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/internal/inline"
+	"github.com/google/go-containerregistry/internal/verify"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// newInlinedImage wraps img to present its manifest with the content of any
+// blob of at most threshold bytes embedded in its descriptor.
+func newInlinedImage(img v1.Image, threshold int64) (v1.Image, error) {
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+
+	if inline.Eligible(m.Config, threshold) {
+		rcfg, err := img.RawConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		m.Config.Data = rcfg
+		if err := verify.Descriptor(m.Config); err != nil {
+			return nil, fmt.Errorf("inlining config: %w", err)
+		}
+	}
+	for i, desc := range m.Layers {
+		if !inline.Eligible(desc, threshold) {
+			continue
+		}
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if m.Layers[i].Data, err = inline.Layer(l, desc); err != nil {
+			return nil, err
+		}
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &overriddenImage{Image: img, raw: raw, mt: mt}, nil
+}
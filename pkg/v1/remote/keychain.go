@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// keychainAuth is an authn.Authenticator that resolves its credentials from a
+// keychain the first time they're needed, rather than up front, and resolves
+// them again if the registry rejects them, so that rotated credentials are
+// picked up by long-lived clients.
+type keychainAuth struct {
+	keys   authn.Keychain
+	target authn.Resource
+
+	mu sync.Mutex
+	// The authenticator resolved from keys, or nil if we haven't resolved
+	// it yet.
+	auth authn.Authenticator
+}
+
+var _ authn.Fallback = (*keychainAuth)(nil)
+
+// keychainKey identifies a keychainAuth, for caches.
+type keychainKey struct {
+	keys   authn.Keychain
+	target authn.Resource
+}
+
+// resolve returns the authenticator of the keychain for the target, resolving
+// it if we haven't already.
+func (k *keychainAuth) resolve() (authn.Authenticator, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.auth != nil {
+		return k.auth, nil
+	}
+	auth, err := k.keys.Resolve(k.target)
+	if err != nil {
+		return nil, err
+	}
+	k.auth = auth
+	return auth, nil
+}
+
+// Authorization implements authn.Authenticator.
+func (k *keychainAuth) Authorization() (*authn.AuthConfig, error) {
+	auth, err := k.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return auth.Authorization()
+}
+
+// Fallback implements authn.Fallback, using the fallback of the resolved
+// authenticator, if any.
+func (k *keychainAuth) Fallback() authn.Authenticator {
+	auth, err := k.resolve()
+	if err != nil {
+		return nil
+	}
+	if fb, ok := auth.(authn.Fallback); ok {
+		return fb.Fallback()
+	}
+	return nil
+}
+
+// Refresh resolves the credentials again after the registry has rejected
+// them. It reports whether they changed, i.e. whether it's worth retrying.
+// If the keychain fails, the error is returned by the next Authorization.
+func (k *keychainAuth) Refresh() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	old := k.auth
+	k.auth = nil
+	auth, err := k.keys.Resolve(k.target)
+	if err != nil {
+		return true
+	}
+	k.auth = auth
+	return old == nil || !sameCredentials(old, auth)
+}
+
+// sameCredentials returns whether a and b authorize the same way.
+func sameCredentials(a, b authn.Authenticator) bool {
+	ac, err := a.Authorization()
+	if err != nil {
+		return false
+	}
+	bc, err := b.Authorization()
+	if err != nil {
+		return false
+	}
+	return *ac == *bc
+}
+
+// key returns the key of k for caches, and whether it can be used as one.
+func (k *keychainAuth) key() (keychainKey, bool) {
+	if !reflect.TypeOf(k.keys).Comparable() || !reflect.TypeOf(k.target).Comparable() {
+		return keychainKey{}, false
+	}
+	return keychainKey{keys: k.keys, target: k.target}, true
+}
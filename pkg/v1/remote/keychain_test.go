@@ -0,0 +1,133 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// rotatingKeychain hands out the current password, recording the targets it
+// was asked about.
+type rotatingKeychain struct {
+	sync.Mutex
+	password string
+	err      error
+	targets  []string
+}
+
+func (k *rotatingKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	k.Lock()
+	defer k.Unlock()
+	k.targets = append(k.targets, target.String())
+	if k.err != nil {
+		return nil, k.err
+	}
+	return &authn.Basic{Username: "user", Password: k.password}, nil
+}
+
+func (k *rotatingKeychain) set(password string, err error) {
+	k.Lock()
+	defer k.Unlock()
+	k.password, k.err = password, err
+}
+
+func TestWithAuthFromKeychainLazy(t *testing.T) {
+	var mu sync.Mutex
+	password := "first"
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		want := password
+		mu.Unlock()
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != want {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/test/keychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kc := &rotatingKeychain{password: "first"}
+	up, err := NewUploader(WithAuthFromKeychain(kc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kc.targets) != 0 {
+		t.Errorf("keychain resolved eagerly for %v", kc.targets)
+	}
+
+	upload := func() error {
+		t.Helper()
+		l, err := random.Layer(1024, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return up.UploadBlob(repo, l)
+	}
+	if err := upload(); err != nil {
+		t.Fatalf("UploadBlob() = %v", err)
+	}
+	if err := upload(); err != nil {
+		t.Fatalf("UploadBlob() = %v", err)
+	}
+	// The credentials are only resolved once, until the registry rejects them.
+	if len(kc.targets) != 1 {
+		t.Fatalf("resolved keychain for %v, want once", kc.targets)
+	}
+	for _, target := range kc.targets {
+		if target != repo.String() {
+			t.Errorf("resolved keychain for %q, want %q", target, repo)
+		}
+	}
+
+	// Rotate the credentials; the same client should pick up the new ones.
+	mu.Lock()
+	password = "second"
+	mu.Unlock()
+	kc.set("second", nil)
+	if err := upload(); err != nil {
+		t.Fatalf("UploadBlob() after rotation = %v", err)
+	}
+
+	// Errors from the keychain are returned when authenticating.
+	mu.Lock()
+	password = "third"
+	mu.Unlock()
+	wantErr := errors.New("keychain is broken")
+	kc.set("", wantErr)
+	if err := upload(); !errors.Is(err, wantErr) {
+		t.Errorf("UploadBlob() with broken keychain = %v, want %v", err, wantErr)
+	}
+}
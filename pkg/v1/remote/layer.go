@@ -25,6 +25,10 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
+// SizeError is returned when reading a blob yields more or fewer bytes than
+// its descriptor says it has.
+type SizeError = verify.SizeError
+
 // remoteImagelayer implements partial.CompressedLayer
 type remoteLayer struct {
 	fetcher
@@ -63,6 +67,11 @@ func (rl *remoteLayer) Exists() (bool, error) {
 	return rl.blobExists(rl.digest)
 }
 
+// See partial.StoredSize.
+func (rl *remoteLayer) StoredSize() (int64, error) {
+	return rl.blobSize(rl.digest)
+}
+
 // Layer reads the given blob reference from a registry as a Layer. A blob
 // reference here is just a punned name.Digest where the digest portion is the
 // digest of the blob to be read and the repository portion is the repo where
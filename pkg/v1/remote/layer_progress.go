@@ -0,0 +1,190 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerProgressFunc returns the channel that should receive progress updates
+// for uploading the layer with the given digest, or nil to skip reporting
+// progress for that layer. See WithPerLayerProgress.
+type LayerProgressFunc func(h v1.Hash) chan<- v1.Update
+
+// chainLayerProgress returns a LayerProgressFunc that sends every update to
+// the channels returned by both a and b, closing them once its own is closed.
+func chainLayerProgress(a, b LayerProgressFunc) LayerProgressFunc {
+	return func(h v1.Hash) chan<- v1.Update {
+		ca, cb := a(h), b(h)
+		switch {
+		case ca == nil:
+			return cb
+		case cb == nil:
+			return ca
+		}
+		updates := make(chan v1.Update)
+		go func() {
+			defer close(cb)
+			defer close(ca)
+			for u := range updates {
+				ca <- u
+				cb <- u
+			}
+		}()
+		return updates
+	}
+}
+
+// layerProgress keeps track of the per-layer channels handed out by a
+// LayerProgressFunc during a single operation, so that we can make sure all
+// of them get closed.
+type layerProgress struct {
+	sync.Mutex
+	newChan LayerProgressFunc
+	chans   map[v1.Hash]chan<- v1.Update
+	done    map[v1.Hash]bool
+}
+
+func newLayerProgress(f LayerProgressFunc) *layerProgress {
+	if f == nil {
+		return nil
+	}
+	return &layerProgress{
+		newChan: f,
+		chans:   map[v1.Hash]chan<- v1.Update{},
+		done:    map[v1.Hash]bool{},
+	}
+}
+
+// start returns the updates for uploading layer h of the given size, or nil if
+// we're not reporting per-layer progress for it. Each layer is only reported
+// on once, even if it is uploaded as part of multiple images.
+func (p *layerProgress) start(h v1.Hash, size int64) *layerUpdates {
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.done[h] {
+		return nil
+	}
+	if _, ok := p.chans[h]; ok {
+		// Some other goroutine is already uploading and reporting on h.
+		return nil
+	}
+	ch := p.newChan(h)
+	if ch == nil {
+		p.done[h] = true
+		return nil
+	}
+	p.chans[h] = ch
+	return &layerUpdates{p: p, digest: h, ch: ch, total: size}
+}
+
+// finish sends err, if any, and closes the channel for h.
+func (p *layerProgress) finish(h v1.Hash, err error) {
+	p.Lock()
+	ch, ok := p.chans[h]
+	delete(p.chans, h)
+	p.done[h] = true
+	p.Unlock()
+	if !ok {
+		return
+	}
+	_ = sendError(ch, err)
+	close(ch)
+}
+
+// closeAll sends err, if any, to and closes any channels that are still open,
+// e.g. because the operation was aborted.
+func (p *layerProgress) closeAll(err error) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	hs := make([]v1.Hash, 0, len(p.chans))
+	for h := range p.chans {
+		hs = append(hs, h)
+	}
+	p.Unlock()
+	for _, h := range hs {
+		p.finish(h, err)
+	}
+}
+
+// layerUpdates reports the progress of uploading a single layer.
+type layerUpdates struct {
+	p        *layerProgress
+	digest   v1.Hash
+	ch       chan<- v1.Update
+	total    int64
+	complete int64
+}
+
+func (u *layerUpdates) send(complete int64) {
+	u.ch <- v1.Update{
+		Total:    u.total,
+		Complete: complete,
+	}
+}
+
+// skip reports the whole layer as complete, e.g. because it already exists or
+// was mounted.
+func (u *layerUpdates) skip() {
+	if u == nil {
+		return
+	}
+	atomic.StoreInt64(&u.complete, u.total)
+	u.send(u.total)
+}
+
+// finish closes the channel for the layer, after sending err if non-nil.
+func (u *layerUpdates) finish(err error) {
+	if u == nil {
+		return
+	}
+	u.p.finish(u.digest, err)
+}
+
+// wrap returns a reader that reports on the bytes read from rc. Each call to
+// wrap starts over from zero, since it happens once per upload attempt.
+func (u *layerUpdates) wrap(rc io.ReadCloser) io.ReadCloser {
+	if u == nil {
+		return rc
+	}
+	if atomic.SwapInt64(&u.complete, 0) != 0 {
+		u.send(0)
+	}
+	return &layerProgressReader{rc: rc, u: u}
+}
+
+type layerProgressReader struct {
+	rc io.ReadCloser
+	u  *layerUpdates
+}
+
+func (r *layerProgressReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b)
+	if n > 0 {
+		r.u.send(atomic.AddInt64(&r.u.complete, int64(n)))
+	}
+	return n, err
+}
+
+func (r *layerProgressReader) Close() error { return r.rc.Close() }
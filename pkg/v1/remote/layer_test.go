@@ -15,9 +15,13 @@
 package remote
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/google/go-containerregistry/internal/compare"
@@ -146,3 +150,72 @@ func TestRemoteLayerDescriptor(t *testing.T) {
 		t.Errorf("Exists() = %t != %t", got, want)
 	}
 }
+
+func TestRemoteLayerSizeError(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := layers[0].Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Serve a truncated layer blob.
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/blobs/"+digest.String()) {
+			rc, err := layers[0].Compressed()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer rc.Close()
+			io.CopyN(w, rc, size/2)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/repo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	pulled, err := Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulledLayers, err := pulled.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := pulledLayers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	_, err = io.ReadAll(rc)
+	var serr SizeError
+	if !errors.As(err, &serr) {
+		t.Fatalf("ReadAll() = %v; want SizeError", err)
+	}
+	if serr.Got != size/2 || serr.Want != size {
+		t.Errorf("SizeError = %+v, want Got %d and Want %d", serr, size/2, size)
+	}
+}
@@ -53,7 +53,7 @@ func List(repo name.Repository, options ...Option) ([]string, error) {
 
 	uri := &url.URL{
 		Scheme: repo.Registry.Scheme(),
-		Host:   repo.Registry.RegistryStr(),
+		Host:   repo.Registry.APIHost(),
 		Path:   fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
 	}
 
@@ -61,7 +61,7 @@ func List(repo name.Repository, options ...Option) ([]string, error) {
 		uri.RawQuery = fmt.Sprintf("n=%d", o.pageSize)
 	}
 
-	client := http.Client{Transport: tr}
+	client := o.newClient(tr)
 	tagList := []string{}
 	parsed := tags{}
 
@@ -0,0 +1,219 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// overrideMediaType rewrites the "mediaType" field of the raw manifest to mt,
+// after checking that mt is appropriate for the content of the manifest, i.e.
+// that we don't try to push an image manifest as an index or vice versa, and
+// that the descriptors in it are of the same family (Docker or OCI) as mt.
+func overrideMediaType(raw []byte, mt types.MediaType) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest to override media type: %w", err)
+	}
+	var content struct {
+		Config    *v1.Descriptor  `json:"config"`
+		Layers    []v1.Descriptor `json:"layers"`
+		Manifests []v1.Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, fmt.Errorf("parsing manifest to override media type: %w", err)
+	}
+	_, hasLayers := m["layers"]
+	_, hasManifests := m["manifests"]
+	var descs []v1.Descriptor
+	switch {
+	case mt.IsImage():
+		if content.Config == nil || !hasLayers {
+			return nil, fmt.Errorf("cannot override media type to %s: content is not an image manifest", mt)
+		}
+		descs = append([]v1.Descriptor{*content.Config}, content.Layers...)
+	case mt.IsIndex():
+		if !hasManifests {
+			return nil, fmt.Errorf("cannot override media type to %s: content is not an index", mt)
+		}
+		descs = content.Manifests
+	default:
+		return nil, fmt.Errorf("cannot override media type to %s: unsupported manifest media type", mt)
+	}
+	docker := isDockerMediaType(mt)
+	for _, desc := range descs {
+		if isDockerMediaType(desc.MediaType) != docker {
+			return nil, fmt.Errorf("cannot override media type to %s: manifest references %s %s", mt, desc.MediaType, desc.Digest)
+		}
+	}
+
+	var current types.MediaType
+	if b, ok := m["mediaType"]; ok {
+		if err := json.Unmarshal(b, &current); err != nil {
+			return nil, err
+		}
+	}
+	if current == mt {
+		return raw, nil
+	}
+
+	b, err := json.Marshal(mt)
+	if err != nil {
+		return nil, err
+	}
+	m["mediaType"] = b
+	return json.Marshal(m)
+}
+
+// checkOverrideRef returns an error if ref is a digest, as overriding the
+// media type can change the digest of the manifest.
+func checkOverrideRef(ref name.Reference) error {
+	if _, ok := asDigest(ref); ok {
+		return fmt.Errorf("cannot override the manifest media type when writing to digest reference %s", ref)
+	}
+	return nil
+}
+
+// isDockerMediaType returns true for the Docker media types, which can't be
+// mixed with OCI ones in the same manifest.
+func isDockerMediaType(mt types.MediaType) bool {
+	return strings.Contains(string(mt), types.DockerVendorPrefix)
+}
+
+// overriddenImage wraps a v1.Image to present its manifest with a different
+// media type.
+type overriddenImage struct {
+	v1.Image
+	raw []byte
+	mt  types.MediaType
+}
+
+func newOverriddenImage(img v1.Image, mt types.MediaType) (v1.Image, error) {
+	raw, err := img.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	raw, err = overrideMediaType(raw, mt)
+	if err != nil {
+		return nil, err
+	}
+	return &overriddenImage{Image: img, raw: raw, mt: mt}, nil
+}
+
+func (i *overriddenImage) MediaType() (types.MediaType, error) { return i.mt, nil }
+func (i *overriddenImage) RawManifest() ([]byte, error)        { return i.raw, nil }
+func (i *overriddenImage) Size() (int64, error)                { return int64(len(i.raw)), nil }
+
+func (i *overriddenImage) Manifest() (*v1.Manifest, error) {
+	return v1.ParseManifest(bytes.NewReader(i.raw))
+}
+
+// Digest uses the same algorithm as the digest of the wrapped image.
+func (i *overriddenImage) Digest() (v1.Hash, error) {
+	orig, err := i.Image.Digest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.ComputeHash(orig.Algorithm, bytes.NewReader(i.raw))
+	return h, err
+}
+
+// overriddenIndex wraps a v1.ImageIndex to present its manifest with a
+// different media type.
+type overriddenIndex struct {
+	base v1.ImageIndex
+	raw  []byte
+	mt   types.MediaType
+}
+
+func newOverriddenIndex(idx v1.ImageIndex, mt types.MediaType) (v1.ImageIndex, error) {
+	raw, err := idx.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	raw, err = overrideMediaType(raw, mt)
+	if err != nil {
+		return nil, err
+	}
+	oi := &overriddenIndex{base: idx, raw: raw, mt: mt}
+	if wl, ok := idx.(withLayer); ok {
+		return &overriddenLayerIndex{overriddenIndex: oi, withLayer: wl}, nil
+	}
+	return oi, nil
+}
+
+func (i *overriddenIndex) MediaType() (types.MediaType, error) { return i.mt, nil }
+func (i *overriddenIndex) RawManifest() ([]byte, error)        { return i.raw, nil }
+func (i *overriddenIndex) Size() (int64, error)                { return int64(len(i.raw)), nil }
+
+func (i *overriddenIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return v1.ParseIndexManifest(bytes.NewReader(i.raw))
+}
+
+// Digest uses the same algorithm as the digest of the wrapped index.
+func (i *overriddenIndex) Digest() (v1.Hash, error) {
+	orig, err := i.base.Digest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.ComputeHash(orig.Algorithm, bytes.NewReader(i.raw))
+	return h, err
+}
+
+func (i *overriddenIndex) Image(h v1.Hash) (v1.Image, error) {
+	return i.base.Image(h)
+}
+
+func (i *overriddenIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	return i.base.ImageIndex(h)
+}
+
+// overriddenLayerIndex preserves the withLayer workaround for #819.
+type overriddenLayerIndex struct {
+	*overriddenIndex
+	withLayer
+}
+
+// overriddenTaggable returns a Descriptor for the given Taggable's manifest
+// with a different media type.
+func overriddenTaggable(t Taggable, mt types.MediaType) (Taggable, error) {
+	raw, desc, err := unpackTaggable(t)
+	if err != nil {
+		return nil, err
+	}
+	raw, err = overrideMediaType(raw, mt)
+	if err != nil {
+		return nil, err
+	}
+	h, sz, err := v1.ComputeHash(desc.Digest.Algorithm, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return &Descriptor{
+		Manifest: raw,
+		Descriptor: v1.Descriptor{
+			MediaType: mt,
+			Size:      sz,
+			Digest:    h,
+		},
+	}, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestWithManifestMediaTypeOverride(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An image with OCI content, but a Docker manifest media type.
+	l, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oci, err := mutate.AppendLayers(mutate.ConfigMediaType(empty.Image, types.OCIConfigJSON), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("image", func(t *testing.T) {
+		ref := mustNewTag(t, u.Host+"/repo:image")
+		if err := Write(ref, oci, WithManifestMediaTypeOverride(types.OCIManifestSchema1)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		desc, err := Get(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.MediaType != types.OCIManifestSchema1 {
+			t.Errorf("Content-Type: got %s, want %s", desc.MediaType, types.OCIManifestSchema1)
+		}
+		got, err := desc.Image()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := got.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.MediaType != types.OCIManifestSchema1 {
+			t.Errorf("mediaType: got %s, want %s", m.MediaType, types.OCIManifestSchema1)
+		}
+		if err := validate.Image(got); err != nil {
+			t.Errorf("validate.Image: %v", err)
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		ref := mustNewTag(t, u.Host+"/repo:index")
+		if err := WriteIndex(ref, idx, WithManifestMediaTypeOverride(types.DockerManifestList)); err != nil {
+			t.Fatalf("WriteIndex: %v", err)
+		}
+		desc, err := Get(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.MediaType != types.DockerManifestList {
+			t.Errorf("Content-Type: got %s, want %s", desc.MediaType, types.DockerManifestList)
+		}
+		got, err := desc.ImageIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Index(got); err != nil {
+			t.Errorf("validate.Index: %v", err)
+		}
+	})
+
+	t.Run("put", func(t *testing.T) {
+		ref := mustNewTag(t, u.Host+"/repo:put")
+		if err := Put(ref, oci, WithManifestMediaTypeOverride(types.OCIManifestSchema1)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		desc, err := Head(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.MediaType != types.OCIManifestSchema1 {
+			t.Errorf("Content-Type: got %s, want %s", desc.MediaType, types.OCIManifestSchema1)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		ref := mustNewTag(t, u.Host+"/repo:mismatch")
+		if err := Write(ref, img, WithManifestMediaTypeOverride(types.OCIImageIndex)); err == nil {
+			t.Error("Write: expected error pushing an image as an index")
+		}
+		if err := WriteIndex(ref, idx, WithManifestMediaTypeOverride(types.DockerManifestSchema2)); err == nil {
+			t.Error("WriteIndex: expected error pushing an index as an image")
+		}
+		if err := Write(ref, img, WithManifestMediaTypeOverride(types.DockerLayer)); err == nil {
+			t.Error("Write: expected error overriding to a layer media type")
+		}
+		if err := Write(ref, img, WithManifestMediaTypeOverride(types.OCIManifestSchema1)); err == nil {
+			t.Error("Write: expected error pushing Docker layers in an OCI manifest")
+		}
+		if err := Write(ref, oci, WithManifestMediaTypeOverride(types.DockerManifestSchema2)); err == nil {
+			t.Error("Write: expected error pushing OCI layers in a Docker manifest")
+		}
+		if err := WriteIndex(ref, idx, WithManifestMediaTypeOverride(types.OCIImageIndex)); err == nil {
+			t.Error("WriteIndex: expected error pushing Docker manifests in an OCI index")
+		}
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		ref := mustNewTag(t, u.Host+"/repo:digest").Context().Digest(mustDigest(t, oci).String())
+		if err := Write(ref, oci, WithManifestMediaTypeOverride(types.OCIManifestSchema1)); err == nil {
+			t.Error("Write: expected error writing to a digest")
+		}
+		if err := WriteIndex(ref, idx, WithManifestMediaTypeOverride(types.DockerManifestList)); err == nil {
+			t.Error("WriteIndex: expected error writing to a digest")
+		}
+		if err := Put(ref, oci, WithManifestMediaTypeOverride(types.OCIManifestSchema1)); err == nil {
+			t.Error("Put: expected error writing to a digest")
+		}
+	})
+}
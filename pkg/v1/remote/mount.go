@@ -15,9 +15,13 @@
 package remote
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
 // MountableLayer wraps a v1.Layer in a shim that enables the layer to be
@@ -39,6 +43,20 @@ func (ml *MountableLayer) Exists() (bool, error) {
 	return partial.Exists(ml.Layer)
 }
 
+// StoredSize implements partial.StoredSize.
+func (ml *MountableLayer) StoredSize() (int64, error) {
+	size, ok, err := partial.StoredSize(ml.Layer)
+	if !ok {
+		return -1, fmt.Errorf("%T doesn't report a stored size", ml.Layer)
+	}
+	return size, err
+}
+
+// ReaderAt implements random access for partial.Seekable.
+func (ml *MountableLayer) ReaderAt() (io.ReaderAt, bool) {
+	return partial.Seekable(ml.Layer)
+}
+
 // mountableImage wraps the v1.Layer references returned by the embedded v1.Image
 // in MountableLayer's so that remote.Write might attempt to mount them from their
 // source repository.
@@ -93,3 +111,42 @@ func (mi *mountableImage) LayerByDiffID(d v1.Hash) (v1.Layer, error) {
 func (mi *mountableImage) Descriptor() (*v1.Descriptor, error) {
 	return partial.Descriptor(mi.Image)
 }
+
+// MountBlob asks the registry to mount the blob with digest h from the src
+// repository into the dst repository, without uploading its contents.
+//
+// It returns true if the registry mounted the blob (201 Created). If the
+// registry instead started a regular upload (202 Accepted), e.g. because it
+// doesn't support cross-repository mounts or the caller can't read src,
+// the upload is cancelled and MountBlob returns false, in which case the
+// caller has to upload the blob itself.
+func MountBlob(dst, src name.Repository, h v1.Hash, options ...Option) (bool, error) {
+	if dst.Registry.String() != src.Registry.String() {
+		return false, fmt.Errorf("cannot mount %s from %s: blobs can only be mounted within a registry", dst, src)
+	}
+	o, err := makeOptions(dst, options...)
+	if err != nil {
+		return false, err
+	}
+	// Push scope should be the first element because a few registries just look at the first scope to determine access.
+	scopes := []string{dst.Scope(transport.PushScope), src.Scope(transport.PullScope)}
+	tr, err := transport.NewWithContext(o.context, dst.Registry, o.auth, o.transport, scopes)
+	if err != nil {
+		return false, err
+	}
+	w := writer{
+		repo:    dst,
+		client:  o.newClient(tr),
+		context: o.context,
+	}
+
+	loc, mounted, err := w.initiateUpload(src.RepositoryStr(), h.String())
+	if err != nil {
+		return false, err
+	}
+	if !mounted && loc != "" {
+		// We don't care if this fails.
+		w.cancelUpload(loc)
+	}
+	return mounted, nil
+}
@@ -15,9 +15,14 @@
 package remote
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -53,3 +58,73 @@ func TestMountableImage(t *testing.T) {
 		}
 	}
 }
+
+func TestMountBlob(t *testing.T) {
+	mountable := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	cancelled := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/dst/blobs/uploads/":
+			q := r.URL.Query()
+			if q.Get("from") != "src" {
+				t.Errorf("from: got %q, want %q", q.Get("from"), "src")
+			}
+			if q.Get("mount") == mountable.String() {
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			w.Header().Set("Location", "/v2/dst/blobs/uploads/session")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/dst/blobs/uploads/session":
+			cancelled = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := name.NewRepository(u.Host + "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := name.NewRepository(u.Host + "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounted, err := MountBlob(dst, src, mountable)
+	if err != nil {
+		t.Fatalf("MountBlob: %v", err)
+	}
+	if !mounted {
+		t.Error("MountBlob: got false, want true")
+	}
+
+	other := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}
+	mounted, err = MountBlob(dst, src, other)
+	if err != nil {
+		t.Fatalf("MountBlob: %v", err)
+	}
+	if mounted {
+		t.Error("MountBlob: got true, want false")
+	}
+	if !cancelled {
+		t.Error("MountBlob: expected the upload to be cancelled")
+	}
+
+	elsewhere, err := name.NewRepository("gcr.io/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MountBlob(dst, elsewhere, mountable); err == nil {
+		t.Error("MountBlob(different registry): got nil want err")
+	}
+}
@@ -17,8 +17,9 @@ package remote
 import (
 	"context"
 	"fmt"
-	"net/http"
 
+	"github.com/google/go-containerregistry/internal/retry"
+	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
@@ -31,9 +32,17 @@ import (
 // efficiently as possible, by deduping shared layer blobs and uploading layers
 // in parallel, then uploading all manifests in parallel.
 //
+// Non-distributable (foreign) layers, like Windows base layers, are neither
+// uploaded nor mounted unless WithNondistributable is given. Index manifests
+// are pushed as-is, so platform fields like os.version are preserved.
+//
 // Current limitations:
 // - All refs must share the same repository.
 // - Images cannot consist of stream.Layers.
+//
+// Child manifests of indexes that already exist in the repository, e.g. from
+// a previous push that failed partway, are skipped along with their blobs,
+// unless WithForce is given.
 func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 	// Determine the repository being pushed to; if asked to push to
 	// multiple repositories, give up.
@@ -51,6 +60,33 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 		return err
 	}
 
+	// Check for existing children of indexes, so that we don't re-push them.
+	var exists func(v1.Descriptor) (bool, error)
+	hasIndex := false
+	for _, i := range m {
+		if _, ok := i.(v1.ImageIndex); ok {
+			hasIndex = true
+		}
+	}
+	if hasIndex && !o.force {
+		tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, []string{repo.Scope(transport.PushScope)})
+		if err != nil {
+			return err
+		}
+		cw := writer{
+			repo:    repo,
+			client:  o.newClient(tr),
+			context: o.context,
+		}
+		exists = func(desc v1.Descriptor) (ok bool, err error) {
+			err = retry.RetryWithClock(func() error {
+				ok, err = cw.checkExistingManifest(desc.Digest, desc.MediaType)
+				return err
+			}, o.retryPredicate, o.retryBackoff, o.clock)
+			return ok, err
+		}
+	}
+
 	// Collect unique blobs (layers and config blobs).
 	blobs := map[v1.Hash]v1.Layer{}
 	newManifests := []map[name.Reference]Taggable{}
@@ -66,7 +102,7 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 		}
 		if idx, ok := i.(v1.ImageIndex); ok {
 			indexes[ref] = i
-			newManifests, err = addIndexBlobs(idx, blobs, repo, newManifests, 0, o.allowNondistributableArtifacts)
+			newManifests, err = addIndexBlobs(idx, blobs, repo, newManifests, 0, o.allowNondistributableArtifacts, exists)
 			if err != nil {
 				return err
 			}
@@ -88,19 +124,27 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 	}
 	w := writer{
 		repo:       repo,
-		client:     &http.Client{Transport: tr},
+		client:     o.newClient(tr),
 		context:    o.context,
 		updates:    o.updates,
 		lastUpdate: &v1.Update{},
 		backoff:    o.retryBackoff,
 		predicate:  o.retryPredicate,
+		present:    o.presentBlobs(),
+		clock:      o.clock,
 	}
 
+	w.layerProgress = newLayerProgress(o.layerProgress)
+	defer func() { w.layerProgress.closeAll(rerr) }()
+
 	// Collect the total size of blobs and manifests we're about to write.
 	if o.updates != nil {
 		defer close(o.updates)
 		defer func() { _ = sendError(o.updates, rerr) }()
-		for _, b := range blobs {
+		for h, b := range blobs {
+			if w.present[h] {
+				continue
+			}
 			size, err := b.Size()
 			if err != nil {
 				return err
@@ -211,7 +255,8 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 
 // addIndexBlobs adds blobs to the set of blobs we intend to upload, and
 // returns the latest copy of the ordered collection of manifests to upload.
-func addIndexBlobs(idx v1.ImageIndex, blobs map[v1.Hash]v1.Layer, repo name.Repository, newManifests []map[name.Reference]Taggable, lvl int, allowNondistributableArtifacts bool) ([]map[name.Reference]Taggable, error) {
+// Child manifests for which exists, if non-nil, returns true are skipped.
+func addIndexBlobs(idx v1.ImageIndex, blobs map[v1.Hash]v1.Layer, repo name.Repository, newManifests []map[name.Reference]Taggable, lvl int, allowNondistributableArtifacts bool, exists func(v1.Descriptor) (bool, error)) ([]map[name.Reference]Taggable, error) {
 	if lvl > len(newManifests)-1 {
 		newManifests = append(newManifests, map[name.Reference]Taggable{})
 	}
@@ -221,13 +266,24 @@ func addIndexBlobs(idx v1.ImageIndex, blobs map[v1.Hash]v1.Layer, repo name.Repo
 		return nil, err
 	}
 	for _, desc := range im.Manifests {
+		if exists != nil && (desc.MediaType.IsIndex() || desc.MediaType.IsImage()) {
+			ok, err := exists(desc)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				logs.Progress.Print("existing manifest: ", desc.Digest)
+				continue
+			}
+		}
+
 		switch desc.MediaType {
 		case types.OCIImageIndex, types.DockerManifestList:
 			idx, err := idx.ImageIndex(desc.Digest)
 			if err != nil {
 				return nil, err
 			}
-			newManifests, err = addIndexBlobs(idx, blobs, repo, newManifests, lvl+1, allowNondistributableArtifacts)
+			newManifests, err = addIndexBlobs(idx, blobs, repo, newManifests, lvl+1, allowNondistributableArtifacts, exists)
 			if err != nil {
 				return nil, err
 			}
@@ -23,11 +23,13 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
@@ -155,6 +157,140 @@ func TestMultiWriteWithNondistributableLayer(t *testing.T) {
 	}
 }
 
+// windowsIndex returns a multi-arch Windows index, whose images are each based
+// on a foreign layer for a different OS version, along with the digests of
+// those foreign layers.
+func windowsIndex(t *testing.T) (v1.ImageIndex, map[string]bool) {
+	t.Helper()
+	foreign := map[string]bool{}
+	var adds []mutate.IndexAddendum
+	for _, osVersion := range []string{"10.0.17763.2686", "10.0.20348.587"} {
+		base, err := random.Layer(1024, types.DockerForeignLayer)
+		if err != nil {
+			t.Fatal("random.Layer:", err)
+		}
+		d, err := base.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		foreign[d.String()] = true
+
+		app, err := random.Layer(1024, types.DockerLayer)
+		if err != nil {
+			t.Fatal("random.Layer:", err)
+		}
+		img, err := mutate.AppendLayers(empty.Image, base, app)
+		if err != nil {
+			t.Fatal("mutate.AppendLayers:", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf = cf.DeepCopy()
+		cf.OS, cf.Architecture, cf.OSVersion = "windows", "amd64", osVersion
+		img, err = mutate.ConfigFile(img, cf)
+		if err != nil {
+			t.Fatal("mutate.ConfigFile:", err)
+		}
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{
+					OS:           "windows",
+					Architecture: "amd64",
+					OSVersion:    osVersion,
+				},
+			},
+		})
+	}
+	idx := mutate.IndexMediaType(mutate.AppendManifests(empty.Index, adds...), types.DockerManifestList)
+	return idx, foreign
+}
+
+func TestMultiWriteWindowsIndex(t *testing.T) {
+	idx, foreign := windowsIndex(t)
+
+	// Set up a fake registry that fails any request for a foreign layer.
+	handler := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for d := range foreign {
+			if strings.Contains(r.URL.Path, d) || strings.Contains(r.URL.RawQuery, d) {
+				t.Errorf("unexpected request for foreign layer: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		write func(name.Reference) error
+	}{{
+		name: "MultiWrite",
+		write: func(ref name.Reference) error {
+			return MultiWrite(map[name.Reference]Taggable{ref: idx})
+		},
+	}, {
+		name: "WriteIndex",
+		write: func(ref name.Reference) error {
+			return WriteIndex(ref, idx)
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			tag := mustNewTag(t, u.Host+"/windows:"+strings.ToLower(tc.name))
+			if err := tc.write(tag); err != nil {
+				t.Fatal("write:", err)
+			}
+
+			got, err := Index(tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := idx.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := got.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Manifests) != len(want.Manifests) {
+				t.Fatalf("got %d manifests, want %d", len(m.Manifests), len(want.Manifests))
+			}
+			for i, desc := range m.Manifests {
+				if got, want := desc.Platform.OSVersion, want.Manifests[i].Platform.OSVersion; got != want {
+					t.Errorf("manifests[%d] os.version = %q, want %q", i, got, want)
+				}
+				// The child image is there, even though its base layer isn't.
+				img, err := got.Image(desc.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := img.Manifest(); err != nil {
+					t.Errorf("manifests[%d]: %v", i, err)
+				}
+			}
+
+			// Copying the pushed index elsewhere must skip the foreign layers
+			// too, even though they're now remote layers.
+			dst := mustNewTag(t, u.Host+"/windows-copy:"+strings.ToLower(tc.name))
+			if err := MultiWrite(map[name.Reference]Taggable{dst: got}); err != nil {
+				t.Fatal("MultiWrite(copy):", err)
+			}
+			if err := WriteIndex(dst, got); err != nil {
+				t.Fatal("WriteIndex(copy):", err)
+			}
+		})
+	}
+}
+
 func TestMultiWrite_Retry(t *testing.T) {
 	// Create a random image.
 	img1, err := random.Image(1024, 2)
@@ -335,6 +471,85 @@ func TestMultiWrite_Deep(t *testing.T) {
 	}
 }
 
+func TestMultiWrite_ExistingChildren(t *testing.T) {
+	idx, err := random.Index(1024, 2, 3)
+	if err != nil {
+		t.Fatal("random.Index:", err)
+	}
+
+	// Count the uploads that the registry sees.
+	var mu sync.Mutex
+	var posts, puts int
+	nopLog := log.New(ioutil.Discard, "", 0)
+	reg := registry.New(registry.Logger(nopLog))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		switch {
+		case r.Method == http.MethodPost:
+			posts++
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+			puts++
+		}
+		mu.Unlock()
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		posts, puts = 0, 0
+	}
+
+	// Simulate a push that failed partway, after pushing one child.
+	tag := mustNewTag(t, u.Host+"/repo:tag")
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := idx.Image(im.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(tag.Context().Digest(im.Manifests[0].Digest.String()), child); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the remaining children and their blobs should be pushed.
+	reset()
+	if err := MultiWrite(map[name.Reference]Taggable{tag: idx}); err != nil {
+		t.Fatal("MultiWrite:", err)
+	}
+	// Each of the other 2 children has 2 layers and a config.
+	if got, want := posts, 2*3; got != want {
+		t.Errorf("got %d blob uploads, want %d", got, want)
+	}
+	// The 2 other children, and the index itself.
+	if got, want := puts, 3; got != want {
+		t.Errorf("got %d manifest uploads, want %d", got, want)
+	}
+	got, err := Index(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(got); err != nil {
+		t.Error("Validate() =", err)
+	}
+
+	// With WithForce, every child is pushed again. The blobs exist, so they
+	// aren't uploaded.
+	reset()
+	if err := MultiWrite(map[name.Reference]Taggable{tag: idx}, WithForce()); err != nil {
+		t.Fatal("MultiWrite:", err)
+	}
+	if got, want := puts, 4; got != want {
+		t.Errorf("got %d manifest uploads with WithForce, want %d", got, want)
+	}
+}
+
 type countTransport struct {
 	count int
 	inner http.RoundTripper
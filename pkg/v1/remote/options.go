@@ -16,18 +16,24 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"runtime"
 	"syscall"
 	"time"
 
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/internal/retry"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // Option is a functional option for remote operations.
@@ -38,14 +44,43 @@ type options struct {
 	keychain                       authn.Keychain
 	transport                      http.RoundTripper
 	platform                       v1.Platform
+	platformSet                    bool
+	platformResolve                bool
 	context                        context.Context
 	jobs                           int
+	jobsSet                        bool
 	userAgent                      string
 	allowNondistributableArtifacts bool
 	updates                        chan<- v1.Update
 	pageSize                       int
 	retryBackoff                   Backoff
 	retryPredicate                 retry.Predicate
+	warningHandler                 WarningHandler
+	manifestMediaType              types.MediaType
+	cookieJar                      http.CookieJar
+	expectedDigest                 *v1.Hash
+	captureHeaders                 bool
+	clientCerts                    map[string]tls.Certificate
+	layerProgress                  LayerProgressFunc
+	cascadeReferrers               bool
+	dryRun                         *[]name.Digest
+	timeouts                       timeouts
+	existingBlobs                  []v1.Hash
+	strictPing                     bool
+	maxRedirects                   int
+	inlineThreshold                int64
+	digestAlgorithm                string
+	chunkSize                      int64
+	rateLimiter                    *rateLimiter
+	hostHeader                     string
+	force                          bool
+	verifyAfterPush                bool
+	remoteBlobCheck                bool
+	tracer                         *tracer
+
+	// clock is used to wait between retries and for rate limiting, so that
+	// tests can use a fake one. See withClock.
+	clock clock.Clock
 }
 
 var defaultPlatform = v1.Platform{
@@ -110,6 +145,7 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 		pageSize:       defaultPageSize,
 		retryPredicate: defaultRetryPredicate,
 		retryBackoff:   defaultRetryBackoff,
+		maxRedirects:   defaultMaxRedirects,
 	}
 
 	for _, option := range opts {
@@ -118,17 +154,70 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 		}
 	}
 
-	if o.keychain != nil {
-		auth, err := o.keychain.Resolve(target)
-		if err != nil {
-			return nil, err
-		}
-		o.auth = auth
+	if o.platformResolve && !o.platformSet {
+		o.platform = hostPlatform()
+	}
+
+	if o.strictPing {
+		o.context = transport.WithStrictPing(o.context)
+	}
+
+	// The retry transport only sees requests, so it finds the clock there.
+	if o.clock != nil {
+		o.context = clock.NewContext(o.context, o.clock)
+	}
+
+	// Without a target, e.g. for an Uploader, the keychain is resolved for
+	// each repository instead.
+	if o.keychain != nil && target != nil {
+		o.auth = &keychainAuth{keys: o.keychain, target: target}
+	}
+	if o.hostHeader != "" && target == nil {
+		return nil, errors.New("WithHostHeader requires a single registry to send the Host header to")
 	}
 
 	// transport.Wrapper is a signal that consumers are opt-ing into providing their own transport without any additional wrapping.
 	// This is to allow consumers full control over the transports logic, such as providing retry logic.
 	if _, ok := o.transport.(*transport.Wrapper); !ok {
+		// Apply any timeouts to a copy of the transport that dials the registry.
+		if o.timeouts.isSet() {
+			t, err := withTimeouts(o.transport, o.timeouts)
+			if err != nil {
+				return nil, err
+			}
+			o.transport = t
+		}
+
+		// Present client certificates to the hosts that want them. This has to
+		// wrap the transport that actually dials the registry.
+		if len(o.clientCerts) != 0 {
+			t, err := newClientCertTransport(o.transport, o.clientCerts)
+			if err != nil {
+				return nil, err
+			}
+			o.transport = t
+		}
+
+		// Send the overridden Host header to the registry.
+		if o.hostHeader != "" {
+			o.transport = &hostHeaderTransport{inner: o.transport, target: apiHost(target), host: o.hostHeader}
+		}
+
+		// Limit the rate at which we send and receive bodies.
+		if o.rateLimiter != nil {
+			o.transport = &rateLimitTransport{inner: o.transport, l: o.rateLimiter, clock: o.clock}
+		}
+
+		// Wrap the transport in something that sends and stores cookies.
+		if o.cookieJar != nil {
+			o.transport = &cookieTransport{inner: o.transport, jar: o.cookieJar}
+		}
+
+		// Record each request and response, including retried ones.
+		if o.tracer != nil {
+			o.transport = &traceTransport{inner: o.transport, tracer: o.tracer, clock: o.clock}
+		}
+
 		// Wrap the transport in something that logs requests and responses.
 		// It's expensive to generate the dumps, so skip it if we're writing
 		// to nothing.
@@ -139,6 +228,11 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 		// Wrap the transport in something that can retry network flakes.
 		o.transport = transport.NewRetry(o.transport)
 
+		// Wrap the transport in something that surfaces Warning headers.
+		if o.warningHandler != nil {
+			o.transport = &warningTransport{inner: o.transport, handler: o.warningHandler}
+		}
+
 		// Wrap this last to prevent transport.New from double-wrapping.
 		if o.userAgent != "" {
 			o.transport = transport.NewUserAgent(o.transport, o.userAgent)
@@ -176,6 +270,13 @@ func WithAuth(auth authn.Authenticator) Option {
 // authenticator for remote operations, using an authn.Keychain to find
 // credentials.
 //
+// Credentials are resolved lazily for the target of each operation, when the
+// transport first needs to authenticate, and resolved again if the registry
+// rejects them with a 401, so that rotated credentials are picked up and a
+// single set of options can be used against many registries. This means that
+// errors from the keychain are returned by the operation when it first
+// authenticates, rather than before it sends any requests.
+//
 // The default authenticator is authn.Anonymous.
 func WithAuthFromKeychain(keys authn.Keychain) Option {
 	return func(o *options) error {
@@ -187,14 +288,34 @@ func WithAuthFromKeychain(keys authn.Keychain) Option {
 // WithPlatform is a functional option for overriding the default platform
 // that Image and Descriptor.Image use for resolving an index to an image.
 //
-// The default platform is amd64/linux.
+// The default platform is amd64/linux, see also WithPlatformResolve.
 func WithPlatform(p v1.Platform) Option {
 	return func(o *options) error {
 		o.platform = p
+		o.platformSet = true
+		return nil
+	}
+}
+
+// WithPlatformResolve makes Image and Descriptor.Image resolve an index to the
+// child image for the host platform (runtime.GOOS/runtime.GOARCH), like
+// `docker pull` does, rather than the amd64/linux default. A platform given
+// with WithPlatform takes precedence.
+func WithPlatformResolve() Option {
+	return func(o *options) error {
+		o.platformResolve = true
 		return nil
 	}
 }
 
+// hostPlatform returns the platform this binary is running on.
+func hostPlatform() v1.Platform {
+	return v1.Platform{
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+	}
+}
+
 // WithContext is a functional option for setting the context in http requests
 // performed by a given function. Note that this context is used for _all_
 // http requests, not just the initial volley. E.g., for remote.Image, the
@@ -213,6 +334,9 @@ func WithContext(ctx context.Context) Option {
 // operations performed by a given function. Note that not all remote
 // operations support parallelism.
 //
+// For Index, setting this also fetches the manifests of all the children of
+// the index, recursively, with at most jobs requests in flight at once.
+//
 // The default value is 4.
 func WithJobs(jobs int) Option {
 	return func(o *options) error {
@@ -220,6 +344,7 @@ func WithJobs(jobs int) Option {
 			return errors.New("jobs must be greater than zero")
 		}
 		o.jobs = jobs
+		o.jobsSet = true
 		return nil
 	}
 }
@@ -256,6 +381,80 @@ func WithProgress(updates chan<- v1.Update) Option {
 	}
 }
 
+// WithPerLayerProgress reports the progress of uploading each layer
+// separately, e.g. to render a progress bar per layer. For each blob being
+// written, including the config blob of images, f is called with the blob's
+// digest and returns the channel that should receive updates for it, or nil
+// to skip it. Blobs that already exist or get mounted are reported as complete
+// right away.
+//
+// Each channel is closed once its layer has been uploaded, or when the
+// operation fails, after receiving an Update with the Error set. As with
+// WithProgress, sending to an unbuffered channel will block writes. Layers
+// whose digest isn't known ahead of time (e.g. stream.Layer) aren't reported.
+//
+// This can be used along with WithProgress, which reports the aggregate
+// progress of the whole operation. If it's given more than once, every f
+// receives the updates for each blob.
+func WithPerLayerProgress(f LayerProgressFunc) Option {
+	return func(o *options) error {
+		if o.layerProgress != nil {
+			o.layerProgress = chainLayerProgress(o.layerProgress, f)
+		} else {
+			o.layerProgress = f
+		}
+		return nil
+	}
+}
+
+// WithExistingBlobs tells Write, WriteIndex and MultiWrite that the given
+// blobs are already known to exist in the destination repository, so they are
+// skipped without checking, e.g. when resuming an interrupted copy.
+func WithExistingBlobs(hs ...v1.Hash) Option {
+	return func(o *options) error {
+		o.existingBlobs = append(o.existingBlobs, hs...)
+		return nil
+	}
+}
+
+// WithStrictPing makes remote operations fail with transport.ErrNotRegistry
+// if the registry's /v2/ endpoint responds successfully but doesn't look like
+// a registry, e.g. because the host is actually serving a web page. Responses
+// need to either set the "Docker-Distribution-Api-Version: registry/2.0"
+// header or have a JSON body. This is opt-in because some registries omit the
+// header.
+func WithStrictPing() Option {
+	return func(o *options) error {
+		o.strictPing = true
+		return nil
+	}
+}
+
+// WithMaxRedirects sets the maximum number of redirects to follow for each
+// request, e.g. when a registry redirects blob downloads to a CDN. Use 0 to
+// fail on any redirect. The default is 10.
+//
+// Regardless of this setting, the Authorization header is never forwarded
+// when a redirect leads to a different host.
+func WithMaxRedirects(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("WithMaxRedirects: negative redirect limit %d", n)
+		}
+		o.maxRedirects = n
+		return nil
+	}
+}
+
+// presentBlobs returns the set of blobs given to WithExistingBlobs.
+func (o *options) presentBlobs() map[v1.Hash]bool {
+	present := make(map[v1.Hash]bool, len(o.existingBlobs))
+	for _, h := range o.existingBlobs {
+		present[h] = true
+	}
+	return present
+}
+
 // WithPageSize sets the given size as the value of parameter 'n' in the request.
 //
 // To omit the `n` parameter entirely, use WithPageSize(0).
@@ -282,3 +481,306 @@ func WithRetryPredicate(predicate retry.Predicate) Option {
 		return nil
 	}
 }
+
+// WithWarningHandler sets a callback that is invoked with any Warning headers
+// (e.g. deprecation notices) that the registry returns in response to
+// manifest or blob requests. Warnings never cause a request to fail.
+//
+// The handler is not installed if WithTransport is given a transport.Wrapper.
+func WithWarningHandler(handler WarningHandler) Option {
+	return func(o *options) error {
+		o.warningHandler = handler
+		return nil
+	}
+}
+
+// WithCookieJar sets an http.CookieJar that is used to store cookies set by
+// the registry (or its token server) and send them on subsequent requests,
+// e.g. for registries that rely on a session cookie after authenticating.
+//
+// Cookies are scoped according to the semantics of the jar, so an
+// implementation like net/http/cookiejar will only send them to the hosts
+// that set them.
+//
+// The jar is not used if WithTransport is given a transport.Wrapper.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) error {
+		o.cookieJar = jar
+		return nil
+	}
+}
+
+// WithExpectedDigest makes pushing a tag with Write, WriteIndex, Put or Tag
+// conditional on the tag currently pointing at the manifest with the given
+// digest, e.g. the one that was read before mutating it. If it doesn't, the
+// push fails with a *ConflictError.
+//
+// The manifest PUT is sent with an If-Match header, so registries that
+// support conditional requests reject a conflicting push atomically with
+// 412 Precondition Failed. For registries that don't, the tag is also checked
+// with a HEAD request before pushing, but another push can still clobber the
+// tag between that check and our PUT.
+func WithExpectedDigest(h v1.Hash) Option {
+	return func(o *options) error {
+		o.expectedDigest = &h
+		return nil
+	}
+}
+
+// WithCaptureHeaders causes Get to populate Descriptor.ResponseHeaders with
+// the headers of the registry's response to the manifest request, e.g. to
+// inspect rate-limit or other custom headers.
+func WithCaptureHeaders() Option {
+	return func(o *options) error {
+		o.captureHeaders = true
+		return nil
+	}
+}
+
+// WithManifestMediaTypeOverride pushes the manifest at the target reference
+// with the given media type, regardless of the media type of the image or
+// index being pushed. Both the Content-Type header and the "mediaType" field
+// of the manifest are rewritten, so the digest of the pushed manifest may
+// differ from the original.
+//
+// The media type must be appropriate for the content, i.e. an image manifest
+// can't be pushed as an index or vice versa, and a Docker media type can only
+// be used if the config and layers (or child manifests) have Docker media
+// types too, and an OCI one only if none of them do. Child manifests are not
+// affected.
+//
+// This applies to Write, WriteIndex, Put and Tag. As the digest may change,
+// it can't be used to push to a digest reference.
+func WithManifestMediaTypeOverride(mt types.MediaType) Option {
+	return func(o *options) error {
+		if !mt.IsImage() && !mt.IsIndex() {
+			return fmt.Errorf("unsupported manifest media type override: %s", mt)
+		}
+		o.manifestMediaType = mt
+		return nil
+	}
+}
+
+// WithInlineDataThreshold embeds the content of the config and layers that are
+// at most n bytes in the image manifest, see mutate.InlineData. The blobs are
+// still uploaded, since registries require them. A threshold of 0 disables
+// inlining.
+//
+// This changes the digest of the pushed manifest, so it can't be combined with
+// writing to a digest reference. For the same reason it only applies to Write:
+// WriteIndex and MultiWrite push child manifests by the digests their index
+// already refers to, so they ignore it.
+func WithInlineDataThreshold(n int64) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid inline data threshold %d", n)
+		}
+		o.inlineThreshold = n
+		return nil
+	}
+}
+
+// WithChunkSize makes blob uploads send the blob contents in a series of
+// requests of at most size bytes each, rather than in a single request. This
+// is useful for registries, or proxies in front of them, that limit the size
+// of request bodies.
+func WithChunkSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("chunk size must be positive, got %d", size)
+		}
+		o.chunkSize = size
+		return nil
+	}
+}
+
+// WithRateLimit limits the bandwidth used to transfer blobs and manifests to
+// and from registries to bytesPerSecond. The limit applies to all transfers
+// made with the returned option, across concurrent layers and operations,
+// e.g. to keep background copies from saturating a shared link.
+func WithRateLimit(bytesPerSecond int64) Option {
+	l := newRateLimiter(bytesPerSecond)
+	return func(o *options) error {
+		if bytesPerSecond <= 0 {
+			return fmt.Errorf("rate limit must be positive, got %d", bytesPerSecond)
+		}
+		o.rateLimiter = l
+		return nil
+	}
+}
+
+// withClock sets the clock used to wait between retries and for rate
+// limiting, for tests.
+func withClock(c clock.Clock) Option {
+	return func(o *options) error {
+		o.clock = c
+		return nil
+	}
+}
+
+// WithHostHeader sends host as the Host header of all requests to the
+// registry, while still connecting to the registry's address, e.g. for load
+// balancers that route requests based on their Host header. Credentials are
+// still matched against the registry itself.
+//
+// This has no effect if WithTransport is given a transport.Wrapper.
+func WithHostHeader(host string) Option {
+	return func(o *options) error {
+		if host == "" {
+			return errors.New("host header must not be empty")
+		}
+		o.hostHeader = host
+		return nil
+	}
+}
+
+// apiHost returns the host we connect to for target, see name.Registry.APIHost.
+func apiHost(target authn.Resource) string {
+	if r, ok := target.(interface{ APIHost() string }); ok {
+		return r.APIHost()
+	}
+	return target.RegistryStr()
+}
+
+// WithDigestAlgorithm sets the algorithm (e.g. "sha512") used to compute the
+// digests of manifests fetched by tag, as reported by Get, Head and friends.
+// Manifests fetched by digest are always verified with the algorithm of that
+// digest, and blobs with the algorithm of their descriptor. The default is
+// "sha256".
+func WithDigestAlgorithm(algorithm string) Option {
+	return func(o *options) error {
+		if _, err := v1.Hasher(algorithm); err != nil {
+			return err
+		}
+		o.digestAlgorithm = algorithm
+		return nil
+	}
+}
+
+// WithClientCert presents cert during the TLS handshake with host, e.g. for
+// registries that require mutual TLS. The host is matched against the host of
+// each request, with or without the port, so requests to other hosts (such as
+// a separate token server) don't present the certificate.
+//
+// This requires the transport (see WithTransport) to be an *http.Transport,
+// which is copied for each host with a certificate. The certificate is not
+// used if WithTransport is given a transport.Wrapper.
+func WithClientCert(host string, cert tls.Certificate) Option {
+	return func(o *options) error {
+		if o.clientCerts == nil {
+			o.clientCerts = map[string]tls.Certificate{}
+		}
+		o.clientCerts[host] = cert
+		return nil
+	}
+}
+
+// WithCascadeReferrers causes Delete to also delete the referrers of the
+// image (e.g. signatures or SBOMs attached to it), recursively, before
+// deleting the image itself. Referrers are listed with the referrers API,
+// falling back to the "<alg>-<hex>" tag schema for registries that don't
+// support it, in which case the fallback tag is deleted too.
+//
+// If the registry rejects deleting any of the referrers, Delete returns an
+// error without deleting the image, so nothing is left orphaned.
+func WithCascadeReferrers() Option {
+	return func(o *options) error {
+		o.cascadeReferrers = true
+		return nil
+	}
+}
+
+// WithForce causes WriteIndex and MultiWrite to push every child of an index,
+// along with its blobs, even if a manifest with the same digest already
+// exists in the repository. By default, existing children are skipped, which
+// makes it cheap to retry a push that failed partway.
+func WithForce() Option {
+	return func(o *options) error {
+		o.force = true
+		return nil
+	}
+}
+
+// WithDryRun causes Delete to set plan to the digests of the manifests it
+// would delete, in the order it would delete them, without deleting anything.
+// They're also logged to logs.Progress.
+func WithDryRun(plan *[]name.Digest) Option {
+	return func(o *options) error {
+		if plan == nil {
+			return errors.New("WithDryRun requires a non-nil plan")
+		}
+		o.dryRun = plan
+		return nil
+	}
+}
+
+// WithDialTimeout limits how long establishing a connection to the registry
+// (or any other host involved, e.g. a token server or blob storage) may take.
+//
+// The timeouts set by WithDialTimeout, WithResponseHeaderTimeout and
+// WithIdleConnTimeout apply to individual connections and responses, rather
+// than putting a wall-clock cap on whole requests, so that large blobs can
+// take as long as they need to download while dead connections still fail
+// fast. A deadline on the context passed to WithContext still applies to the
+// whole operation, on top of these.
+//
+// These require the transport (see WithTransport) to be an *http.Transport,
+// which is copied rather than modified. WithDialTimeout replaces its
+// DialContext. They are not used if WithTransport is given a
+// transport.Wrapper.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if err := validateTimeout("WithDialTimeout", d); err != nil {
+			return err
+		}
+		o.timeouts.dial = d
+		return nil
+	}
+}
+
+// WithResponseHeaderTimeout limits how long to wait for the response headers
+// after writing a request, without limiting how long reading the body may
+// take. See WithDialTimeout.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if err := validateTimeout("WithResponseHeaderTimeout", d); err != nil {
+			return err
+		}
+		o.timeouts.responseHeader = d
+		return nil
+	}
+}
+
+// WithIdleConnTimeout limits how long idle connections are kept around for
+// reuse. See WithDialTimeout.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if err := validateTimeout("WithIdleConnTimeout", d); err != nil {
+			return err
+		}
+		o.timeouts.idleConn = d
+		return nil
+	}
+}
+
+// WithTrace records every HTTP request made to the registry and its token
+// server to w, as one JSON object per line. Each entry has the method, URL,
+// status (or error), headers, the sizes of the request and response bodies,
+// and how long the response took, and is written once the response body has
+// been read or closed.
+//
+// Credentials are redacted from URLs and headers. Bodies are only included
+// when they are small, printable and not otherwise redacted from logs, e.g.
+// the responses of token exchanges are never included.
+//
+// Entries are written one at a time, so w can be shared by concurrent
+// operations using the same Option.
+//
+// The trace is not recorded if WithTransport is given a transport.Wrapper.
+func WithTrace(w io.Writer) Option {
+	t := newTracer(w)
+	return func(o *options) error {
+		o.tracer = t
+		return nil
+	}
+}
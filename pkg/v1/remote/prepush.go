@@ -0,0 +1,106 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
+)
+
+// ErrMissingBlob is returned by Write when the manifest of an image references
+// a blob that isn't one of the image's layers or its config, which usually
+// means that a layer was never added to it.
+var ErrMissingBlob = errors.New("manifest references blobs that are not part of the image")
+
+// WithRemoteBlobCheck allows Write to push an image whose manifest references
+// blobs that aren't part of the image itself, as long as they already exist
+// in the repository. Each such blob is checked for with a HEAD request before
+// anything is uploaded.
+//
+// Without it, Write fails with ErrMissingBlob for such images before making
+// any changes to the repository.
+func WithRemoteBlobCheck() Option {
+	return func(o *options) error {
+		o.remoteBlobCheck = true
+		return nil
+	}
+}
+
+// checkManifestBlobs checks that every blob referenced by the manifest of img
+// is about to be uploaded, i.e. is its config or one of its layers, or, if
+// remote is set, already exists in w.repo.
+//
+// The digests of streaming layers aren't known until they've been uploaded,
+// so there's nothing to check for images that have them.
+func (w *writer) checkManifestBlobs(img v1.Image, remote bool) error {
+	cfg, err := img.ConfigName()
+	if errors.Is(err, stream.ErrNotComputed) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	uploading := map[v1.Hash]bool{cfg: true}
+	ls, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, l := range ls {
+		h, err := l.Digest()
+		if errors.Is(err, stream.ErrNotComputed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		uploading[h] = true
+	}
+
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	check := func(what string, h v1.Hash) error {
+		if uploading[h] {
+			return nil
+		}
+		if remote {
+			exists, err := w.checkExistingBlob(h)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return nil
+			}
+		}
+		missing = append(missing, fmt.Sprintf("%s %s", what, h))
+		return nil
+	}
+	if err := check("config", m.Config.Digest); err != nil {
+		return err
+	}
+	for i, desc := range m.Layers {
+		if err := check(fmt.Sprintf("layer %d", i), desc.Digest); err != nil {
+			return err
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: %s", ErrMissingBlob, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// forgottenLayerImage is an image whose manifest references a layer that it
+// doesn't return from Layers.
+type forgottenLayerImage struct {
+	v1.Image
+}
+
+func (i *forgottenLayerImage) Layers() ([]v1.Layer, error) {
+	ls, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	return ls[:len(ls)-1], nil
+}
+
+// brokenConfigNameImage is an image whose config name can't be computed.
+type brokenConfigNameImage struct {
+	v1.Image
+}
+
+var errBrokenConfigName = errors.New("broken config name")
+
+func (i *brokenConfigNameImage) ConfigName() (v1.Hash, error) {
+	return v1.Hash{}, errBrokenConfigName
+}
+
+func TestWriteMissingBlob(t *testing.T) {
+	var writes int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			atomic.AddInt32(&writes, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := full.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgotten, err := ls[len(ls)-1].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := &forgottenLayerImage{full}
+
+	// The missing layer is caught before writing anything, without or with
+	// the remote check.
+	for _, opts := range [][]Option{nil, {WithRemoteBlobCheck()}} {
+		ref := mustNewTag(t, u.Host+"/test/missing:latest")
+		err := Write(ref, img, opts...)
+		if !errors.Is(err, ErrMissingBlob) {
+			t.Fatalf("Write() = %v, want ErrMissingBlob", err)
+		}
+		if !strings.Contains(err.Error(), "layer 2 "+forgotten.String()) {
+			t.Errorf("Write() = %v, want it to name layer 2 %s", err, forgotten)
+		}
+		if n := atomic.LoadInt32(&writes); n != 0 {
+			t.Errorf("Write() made %d write requests, want 0", n)
+		}
+	}
+
+	// Once the layer exists in the repository, the remote check allows it.
+	if err := Write(mustNewTag(t, u.Host+"/test/missing:full"), full); err != nil {
+		t.Fatal(err)
+	}
+	ref := mustNewTag(t, u.Host+"/test/missing:latest")
+	if err := Write(ref, img); !errors.Is(err, ErrMissingBlob) {
+		t.Errorf("Write() without WithRemoteBlobCheck = %v, want ErrMissingBlob", err)
+	}
+	if err := Write(ref, img, WithRemoteBlobCheck()); err != nil {
+		t.Errorf("Write() with WithRemoteBlobCheck = %v", err)
+	}
+}
+
+func TestWriteCheckBlobsError(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Errors other than those from streaming layers aren't skipped over.
+	ref := mustNewTag(t, u.Host+"/test/broken:latest")
+	if err := Write(ref, &brokenConfigNameImage{img}); !errors.Is(err, errBrokenConfigName) {
+		t.Errorf("Write() = %v, want %v", err, errBrokenConfigName)
+	}
+}
@@ -165,6 +165,73 @@ func TestWrite_Progress_DedupeLayers(t *testing.T) {
 	}
 }
 
+// TestWrite_Progress_Exists tests that blobs which already exist in the
+// registry are excluded from the total, which should still be reached.
+func TestWrite_Progress_Exists(t *testing.T) {
+	base, err := random.Image(1000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := random.Layer(1000, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(base, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/test/progress/upload", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push the base image, so only the new layer, config and manifest remain.
+	if err := Write(ref, base); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	c := make(chan v1.Update, 200)
+	if err := Write(ref, img, WithProgress(c)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var last v1.Update
+	for update := range c {
+		if update.Error != nil {
+			t.Fatal(update.Error)
+		}
+		last = update
+	}
+
+	size, err := l.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := size + int64(len(cfg)) + int64(len(mf))
+	if last.Total != want {
+		t.Errorf("Total: got %d, want %d", last.Total, want)
+	}
+	if last.Complete != last.Total {
+		t.Errorf("Complete: got %d, want %d", last.Complete, last.Total)
+	}
+}
+
 func TestWriteIndex_Progress(t *testing.T) {
 	idx, err := random.Index(100000, 3, 10)
 	if err != nil {
@@ -194,6 +261,49 @@ func TestWriteIndex_Progress(t *testing.T) {
 	}
 }
 
+// TestWriteIndex_Progress_Exists tests that children of an index which
+// already exist in the registry are excluded from the total.
+func TestWriteIndex_Progress_Exists(t *testing.T) {
+	idx, err := random.Index(1000, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/test/progress/upload", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push one of the children ahead of time.
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := idx.Image(m.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref.Context().Digest(m.Manifests[0].Digest.String()), child); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	c := make(chan v1.Update, 200)
+	if err := WriteIndex(ref, idx, WithProgress(c)); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+
+	if err := checkUpdates(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestMultiWrite_Progress(t *testing.T) {
 	idx, err := random.Index(100000, 10, 10)
 	if err != nil {
@@ -430,6 +540,175 @@ func TestWrite_Progress_WithNonDistributableLayer_AndIncludeNonDistributableLaye
 
 // checkUpdates checks that updates show steady progress toward a total, and
 // don't describe errors.
+func TestWrite_PerLayerProgress(t *testing.T) {
+	img, err := random.Image(100000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/progress/upload", u.Host)
+	ref, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	chans := map[v1.Hash]chan v1.Update{}
+	perLayer := func(h v1.Hash) chan<- v1.Update {
+		mu.Lock()
+		defer mu.Unlock()
+		c := make(chan v1.Update, 200)
+		chans[h] = c
+		return c
+	}
+	c := make(chan v1.Update, 200)
+
+	if err := Write(ref, img, WithProgress(c), WithPerLayerProgress(perLayer)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := checkUpdates(c); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each layer, plus the config blob.
+	if got, want := len(chans), len(layers)+1; got != want {
+		t.Errorf("got %d per-layer channels, want %d", got, want)
+	}
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := l.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lc, ok := chans[h]
+		if !ok {
+			t.Errorf("no updates for layer %s", h)
+			continue
+		}
+		var last v1.Update
+		for u := range lc {
+			last = u
+		}
+		if want := (v1.Update{Total: size, Complete: size}); last != want {
+			t.Errorf("layer %s: last update %+v, want %+v", h, last, want)
+		}
+	}
+
+	// Writing the same image again reports each existing layer as complete.
+	chans = map[v1.Hash]chan v1.Update{}
+	if err := Write(ref, img, WithPerLayerProgress(perLayer)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for h, lc := range chans {
+		if err := checkUpdates(lc); err != nil {
+			t.Errorf("layer %s: %v", h, err)
+		}
+	}
+}
+
+func TestWrite_PerLayerProgress_Chained(t *testing.T) {
+	img, err := random.Image(100000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/test/progress/chained", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of the funcs gets its own channel for every blob.
+	var mu sync.Mutex
+	chans := [2][]chan v1.Update{}
+	perLayer := func(i int) LayerProgressFunc {
+		return func(h v1.Hash) chan<- v1.Update {
+			mu.Lock()
+			defer mu.Unlock()
+			c := make(chan v1.Update, 200)
+			chans[i] = append(chans[i], c)
+			return c
+		}
+	}
+	if err := Write(ref, img, WithPerLayerProgress(perLayer(0)), WithPerLayerProgress(perLayer(1))); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for i, cs := range chans {
+		// Each layer, plus the config blob.
+		if got, want := len(cs), 3; got != want {
+			t.Errorf("func %d: got %d per-layer channels, want %d", i, got, want)
+		}
+		for _, c := range cs {
+			if err := checkUpdates(c); err != nil {
+				t.Errorf("func %d: %v", i, err)
+			}
+		}
+	}
+}
+
+func TestWriteLayer_PerLayerProgress_Error(t *testing.T) {
+	l, err := random.Layer(100000, types.OCIUncompressedLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := make(chan v1.Update, 200)
+
+	// Set up a fake registry.
+	handler := registry.New()
+	registryThatAlwaysFails := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodPatch && strings.Contains(request.URL.Path, "blobs/uploads") {
+			responseWriter.WriteHeader(403)
+		}
+		handler.ServeHTTP(responseWriter, request)
+	})
+
+	s := httptest.NewServer(registryThatAlwaysFails)
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/progress/upload", u.Host)
+	ref, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteLayer(ref.Context(), l, WithPerLayerProgress(func(v1.Hash) chan<- v1.Update { return c })); err == nil {
+		t.Errorf("WriteLayer: wanted error, got nil")
+	}
+
+	everyUpdate := []v1.Update{}
+	for update := range c {
+		everyUpdate = append(everyUpdate, update)
+	}
+	if len(everyUpdate) == 0 {
+		t.Fatal("no updates")
+	}
+	if everyUpdate[len(everyUpdate)-1].Error == nil {
+		t.Errorf("Last update had nil error")
+	}
+}
+
 func checkUpdates(updates <-chan v1.Update) error {
 	var high, total int64
 	for u := range updates {
@@ -0,0 +1,151 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+)
+
+// rateLimiter is a token bucket that limits the aggregate rate at which
+// bytes are transferred by everyone sharing it.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	// Allow bursts of up to a second's worth of bytes, but don't let a slow
+	// start hand out more than that.
+	return &rateLimiter{
+		rate:  float64(bytesPerSecond),
+		burst: float64(bytesPerSecond),
+	}
+}
+
+// chunk is the most we transfer between calls to wait, so that concurrent
+// transfers interleave instead of one large read hogging the budget.
+func (l *rateLimiter) chunk() int {
+	c := int(l.burst / 10)
+	if c < 1 {
+		c = 1
+	}
+	return c
+}
+
+// wait takes n tokens from the bucket, blocking until the transfer of n bytes
+// fits within the rate limit. Tokens are taken immediately, so callers that
+// have to wait put the bucket into debt, which later callers wait out. Time
+// is measured with c, or the real clock if c is nil.
+func (l *rateLimiter) wait(ctx context.Context, n int, c clock.Clock) error {
+	c = clock.OrReal(c)
+	l.mu.Lock()
+	now := c.Now()
+	if l.last.IsZero() {
+		l.tokens = l.burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := c.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedReader reads from rc no faster than its limiter allows.
+type rateLimitedReader struct {
+	rc    io.ReadCloser
+	l     *rateLimiter
+	ctx   context.Context
+	clock clock.Clock
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if c := r.l.chunk(); len(p) > c {
+		p = p[:c]
+	}
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(r.ctx, n, r.clock); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (r *rateLimitedReader) Close() error {
+	return r.rc.Close()
+}
+
+// rateLimitTransport limits the rate at which request and response bodies
+// are sent and received.
+type rateLimitTransport struct {
+	inner http.RoundTripper
+	l     *rateLimiter
+	clock clock.Clock
+}
+
+var _ http.RoundTripper = (*rateLimitTransport)(nil)
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	ctx := in.Context()
+	if in.Body != nil && in.Body != http.NoBody {
+		// RoundTrippers must not modify the request.
+		out := in.Clone(ctx)
+		out.Body = &rateLimitedReader{rc: in.Body, l: t.l, ctx: ctx, clock: t.clock}
+		in = out
+	}
+	resp, err := t.inner.RoundTrip(in)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &rateLimitedReader{rc: resp.Body, l: t.l, ctx: ctx, clock: t.clock}
+	}
+	return resp, nil
+}
+
+// Unwrap returns the underlying RoundTripper, so that we can still share
+// cached ping responses with other transports.
+func (t *rateLimitTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
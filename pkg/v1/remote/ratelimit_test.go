@@ -0,0 +1,161 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+func TestWithRateLimit(t *testing.T) {
+	if _, err := makeOptions(name.MustParseReference("example.com/foo").Context(), WithRateLimit(0)); err == nil {
+		t.Error("WithRateLimit(0) = nil, expected err")
+	}
+
+	var received int64
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = &countingReader{ReadCloser: r.Body, n: &received}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		rate   = 256 * 1024
+		layers = 4
+	)
+	img, err := random.Image(128*1024, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push all the layers concurrently; the limit applies to all of them.
+	opt := WithRateLimit(rate)
+	start := time.Now()
+	if err := Write(ref, img, opt, WithJobs(layers)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// The first second's worth of bytes can be sent in a burst, the rest
+	// no faster than the rate.
+	n := atomic.LoadInt64(&received)
+	if n < 2*rate {
+		t.Fatalf("only pushed %d bytes, test needs more than %d", n, 2*rate)
+	}
+	if want := time.Duration(float64(n-rate) / rate * float64(time.Second)); elapsed < want*9/10 {
+		t.Errorf("pushed %d bytes in %v at %d bytes/s, want at least %v", n, elapsed, rate, want)
+	}
+
+	// Pulling shares the limit, which was just used up by the push.
+	start = time.Now()
+	pulled, err := Image(ref, opt)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	ls, err := pulled.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read int64
+	for _, l := range ls {
+		read += drain(t, l)
+	}
+	elapsed = time.Since(start)
+	if want := time.Duration(float64(read) / rate * float64(time.Second)); elapsed < want*9/10 {
+		t.Errorf("pulled %d bytes in %v at %d bytes/s, want at least %v", read, elapsed, rate, want)
+	}
+}
+
+func drain(t *testing.T, l v1.Layer) int64 {
+	t.Helper()
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	n, err := io.Copy(ioutil.Discard, rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRateLimiterClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	l := newRateLimiter(100)
+	ctx := context.Background()
+
+	// The first second's worth is free.
+	if err := l.wait(ctx, 100, c); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.wait(ctx, 50, c)
+	}()
+
+	// The next 50 bytes have to wait half a second, and no less.
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(499 * time.Millisecond)
+	if got := c.Timers(); got != 1 {
+		t.Fatalf("wait() stopped waiting after 499ms")
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("wait() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait() still waiting after 500ms")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRedirects matches the limit of http.Client's default policy.
+const defaultMaxRedirects = 10
+
+// newClient returns an http.Client that sends requests through tr and follows
+// redirects according to o, see WithMaxRedirects.
+func (o *options) newClient(tr http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport:     tr,
+		CheckRedirect: checkRedirect(o.maxRedirects),
+	}
+}
+
+// checkRedirect returns an http.Client CheckRedirect policy that follows at
+// most max redirects.
+//
+// Registries commonly redirect blob downloads to a CDN or a pre-signed S3 URL,
+// which must not receive our credentials. Our auth transports only attach the
+// Authorization header to requests for the registry itself, and http.Client
+// only forwards it from the original request to the same domain or its
+// subdomains, but we don't want to rely on either: any change of host drops
+// it.
+func checkRedirect(max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+		if req.URL.Host != via[0].URL.Host {
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestRedirectStripsAuthorization(t *testing.T) {
+	content := "hello"
+	h, _, err := v1.SHA256(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for a CDN or S3 pre-signed URL. This is on the same hostname
+	// as the registry, just a different port, which http.Client alone would
+	// happily forward credentials to.
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hdr := r.Header.Get("Authorization"); hdr != "" {
+			t.Errorf("CDN got Authorization header %q", hdr)
+		}
+		w.Write([]byte(content))
+	}))
+	defer cdn.Close()
+
+	var redirects int
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if _, _, ok := r.BasicAuth(); !ok {
+			t.Errorf("registry request %s missing credentials", r.URL.Path)
+		}
+		// Bounce through the registry a couple of times before the CDN.
+		if redirects < 2 {
+			redirects++
+			http.Redirect(w, r, r.URL.Path, http.StatusTemporaryRedirect)
+			return
+		}
+		http.Redirect(w, r, cdn.URL+"/blob", http.StatusTemporaryRedirect)
+	}))
+	defer reg.Close()
+
+	u, err := url.Parse(reg.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s/foo@%s", u.Host, h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := WithAuth(&authn.Basic{Username: "foo", Password: "bar"})
+
+	l, err := Layer(ref, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != content {
+		t.Errorf("got %q, want %q", got, content)
+	}
+
+	// Three redirects is too many.
+	redirects = 0
+	l, err = Layer(ref, auth, WithMaxRedirects(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Compressed(); err == nil {
+		t.Error("Compressed() with too many redirects = nil, wanted error")
+	}
+
+	if _, err := Layer(ref, WithMaxRedirects(-1)); err == nil {
+		t.Error("WithMaxRedirects(-1) = nil, wanted error")
+	}
+}
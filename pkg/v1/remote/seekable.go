@@ -0,0 +1,156 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/internal/redact"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// blobReaderAt implements io.ReaderAt for a blob by issuing a Range request
+// for each call to ReadAt.
+type blobReaderAt struct {
+	f      *fetcher
+	ctx    context.Context
+	digest v1.Hash
+	size   int64
+}
+
+var _ io.ReaderAt = (*blobReaderAt)(nil)
+
+// ReadAt implements io.ReaderAt
+func (b *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	want := int64(len(p))
+	var eof error
+	if off+want > b.size {
+		want = b.size - off
+		eof = io.EOF
+	}
+
+	resp, err := b.f.fetchBlobRange(b.ctx, b.digest, off, off+want-1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("GET %s: registry ignored Range request", resp.Request.URL.Redacted())
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:want])
+	if err != nil {
+		return n, err
+	}
+	return n, eof
+}
+
+// fetchBlobRange requests the bytes [start, end] (inclusive) of the blob.
+func (f *fetcher) fetchBlobRange(ctx context.Context, h v1.Hash, start, end int64) (*http.Response, error) {
+	u := f.url("blobs", h.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := f.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusPartialContent); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// blobReaderAt probes the registry with a single-byte Range request and
+// returns a blobReaderAt if the registry supports Range requests for h.
+func (f *fetcher) blobReaderAt(h v1.Hash) (io.ReaderAt, bool) {
+	// We don't want to log binary blobs -- this can break terminals.
+	ctx := redact.NewContext(f.context, "omitting binary blobs from logs")
+	resp, err := f.fetchBlobRange(ctx, h, 0, 0)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, false
+	}
+	size, ok := contentRangeSize(resp.Header.Get("Content-Range"))
+	if !ok {
+		return nil, false
+	}
+	return &blobReaderAt{
+		f:      f,
+		ctx:    ctx,
+		digest: h,
+		size:   size,
+	}, true
+}
+
+// contentRangeSize parses the complete length out of a Content-Range header
+// of the form "bytes <start>-<end>/<size>".
+func contentRangeSize(cr string) (int64, bool) {
+	if !strings.HasPrefix(cr, "bytes ") {
+		return 0, false
+	}
+	i := strings.LastIndex(cr, "/")
+	if i == -1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// ReaderAt implements random access for partial.Seekable.
+func (rl *remoteLayer) ReaderAt() (io.ReaderAt, bool) {
+	return rl.blobReaderAt(rl.digest)
+}
+
+// ReaderAt implements random access for partial.Seekable.
+func (rl *remoteImageLayer) ReaderAt() (io.ReaderAt, bool) {
+	d, err := partial.BlobDescriptor(rl, rl.digest)
+	if err != nil {
+		return nil, false
+	}
+	if d.Data != nil {
+		return bytes.NewReader(d.Data), true
+	}
+	return rl.ri.blobReaderAt(rl.digest)
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestSeekable(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ranges := range []bool{true, false} {
+		reg := registry.New()
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ranges && r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/blobs/"+h.String()) {
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(want))
+				return
+			}
+			reg.ServeHTTP(w, r)
+		}))
+		defer s.Close()
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tag := mustNewTag(t, u.Host+"/repo:latest")
+		if err := Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+
+		rimg, err := Image(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rl, err := rimg.LayerByDigest(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bl, err := Layer(tag.Context().Digest(h.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, l := range []struct {
+			desc string
+			ra   func() (io.ReaderAt, bool)
+		}{{
+			desc: "image layer",
+			ra:   func() (io.ReaderAt, bool) { return partial.Seekable(rl) },
+		}, {
+			desc: "blob",
+			ra:   func() (io.ReaderAt, bool) { return partial.Seekable(bl) },
+		}} {
+			ra, ok := l.ra()
+			if ok != ranges {
+				t.Fatalf("%s: Seekable() = %t, want %t", l.desc, ok, ranges)
+			}
+			if !ok {
+				continue
+			}
+
+			buf := make([]byte, 16)
+			if n, err := ra.ReadAt(buf, 10); err != nil || n != len(buf) {
+				t.Fatalf("%s: ReadAt(10) = %d, %v", l.desc, n, err)
+			}
+			if !bytes.Equal(buf, want[10:26]) {
+				t.Errorf("%s: ReadAt(10) = %x, want %x", l.desc, buf, want[10:26])
+			}
+
+			// Reading past the end returns what's left and io.EOF.
+			off := int64(len(want) - 4)
+			n, err := ra.ReadAt(buf, off)
+			if err != io.EOF || n != 4 {
+				t.Fatalf("%s: ReadAt(%d) = %d, %v; want 4, io.EOF", l.desc, off, n, err)
+			}
+			if !bytes.Equal(buf[:n], want[off:]) {
+				t.Errorf("%s: ReadAt(%d) = %x, want %x", l.desc, off, buf[:n], want[off:])
+			}
+		}
+	}
+}
+
+func TestSeekableUnsupported(t *testing.T) {
+	l, err := random.Layer(1024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := partial.Seekable(l); ok {
+		t.Errorf("Seekable(random.Layer) = true, want false")
+	}
+	ml := &MountableLayer{Layer: l, Reference: name.MustParseReference("example.com/repo:tag")}
+	if _, ok := partial.Seekable(ml); ok {
+		t.Errorf("Seekable(MountableLayer) = true, want false")
+	}
+}
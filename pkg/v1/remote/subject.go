@@ -0,0 +1,51 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ErrNoSubject is returned by Subject for manifests without a subject.
+var ErrNoSubject = errors.New("manifest has no subject")
+
+// Subject fetches the manifest that ref refers to with the "subject" field of
+// its manifest, e.g. the image that a signature or SBOM describes, from the
+// same repository. The returned Descriptor can be turned into an image or
+// index, as with Get.
+//
+// If the manifest of ref has no subject, Subject returns an error wrapping
+// ErrNoSubject.
+func Subject(ref name.Reference, options ...Option) (*Descriptor, error) {
+	desc, err := Get(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+	var m struct {
+		Subject *v1.Descriptor `json:"subject"`
+	}
+	if err := json.Unmarshal(desc.Manifest, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest of %s: %w", ref, err)
+	}
+	if m.Subject == nil {
+		return nil, fmt.Errorf("%s: %w", ref, ErrNoSubject)
+	}
+	return Get(ref.Context().Digest(m.Subject.Digest.String()), options...)
+}
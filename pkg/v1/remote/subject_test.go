@@ -0,0 +1,111 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestSubject(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgRef := mustNewTag(t, u.Host+"/repo:image")
+	if err := Write(imgRef, img); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An artifact, e.g. a signature, that refers back to img.
+	layer, err := random.Layer(64, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := partial.Descriptor(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := empty.JSONDescriptor()
+	cd.Data = nil
+	raw, err := json.Marshal(v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		Config:        cd,
+		Layers:        []v1.Descriptor{*ld},
+		Subject:       subject,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := partial.CompressedToImage(&emptyConfigArtifact{layer: layer, manifest: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigRef := mustNewTag(t, u.Host+"/repo:sig")
+	if err := Write(sigRef, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := Subject(sigRef)
+	if err != nil {
+		t.Fatalf("Subject() = %v", err)
+	}
+	if desc.Digest != subject.Digest {
+		t.Errorf("Subject() = %s, want %s", desc.Digest, subject.Digest)
+	}
+	if _, err := desc.Image(); err != nil {
+		t.Errorf("Image() = %v", err)
+	}
+
+	// The subject survives the round trip through the registry.
+	pulled, err := Image(sigRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := partial.Subject(pulled)
+	if !ok {
+		t.Fatal("partial.Subject() = false")
+	}
+	if diff := cmp.Diff(subject, got); diff != "" {
+		t.Errorf("partial.Subject() (-want +got) = %s", diff)
+	}
+
+	if _, err := Subject(imgRef); !errors.Is(err, ErrNoSubject) {
+		t.Errorf("Subject() = %v, want %v", err, ErrNoSubject)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// timeouts holds the transport-level timeouts set via WithDialTimeout,
+// WithResponseHeaderTimeout and WithIdleConnTimeout.
+type timeouts struct {
+	dial           time.Duration
+	responseHeader time.Duration
+	idleConn       time.Duration
+}
+
+func (t timeouts) isSet() bool {
+	return t.dial != 0 || t.responseHeader != 0 || t.idleConn != 0
+}
+
+type timeoutsKey struct {
+	base *http.Transport
+	timeouts
+}
+
+const (
+	// timeoutsTTL is how long a copy made by withTimeouts is kept once it's
+	// no longer used.
+	timeoutsTTL = 10 * time.Minute
+
+	// maxTimeoutTransports bounds how many copies are kept, since each holds
+	// its own connections.
+	maxTimeoutTransports = 64
+)
+
+// timeoutTransports holds the copies made by withTimeouts for each
+// timeoutsKey, so that repeated operations with the same options share
+// connections (and ping responses).
+var timeoutTransports = &cache{
+	ttl:   timeoutsTTL,
+	max:   maxTimeoutTransports,
+	touch: true,
+	m:     map[interface{}]cacheEntry{},
+}
+
+// withTimeouts returns a copy of inner with the given timeouts applied. We
+// copy the transport so that we don't modify e.g. DefaultTransport for
+// everyone else.
+func withTimeouts(inner http.RoundTripper, to timeouts) (http.RoundTripper, error) {
+	base, ok := inner.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("timeouts require an *http.Transport, got %T", inner)
+	}
+
+	key := timeoutsKey{base: base, timeouts: to}
+	return timeoutTransports.load(key, func() interface{} {
+		t := base.Clone()
+		if to.dial != 0 {
+			t.DialContext = (&net.Dialer{
+				Timeout:   to.dial,
+				KeepAlive: 30 * time.Second,
+			}).DialContext
+		}
+		if to.responseHeader != 0 {
+			t.ResponseHeaderTimeout = to.responseHeader
+		}
+		if to.idleConn != 0 {
+			t.IdleConnTimeout = to.idleConn
+		}
+		return t
+	}).(*http.Transport), nil
+}
+
+func validateTimeout(opt string, d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s: negative timeout %v", opt, d)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestTimeouts(t *testing.T) {
+	tr, err := withTimeouts(DefaultTransport, timeouts{
+		responseHeader: time.Second,
+		idleConn:       time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht := tr.(*http.Transport)
+	if ht == DefaultTransport {
+		t.Fatal("withTimeouts modified DefaultTransport")
+	}
+	if got, want := ht.ResponseHeaderTimeout, time.Second; got != want {
+		t.Errorf("ResponseHeaderTimeout: got %v, want %v", got, want)
+	}
+	if got, want := ht.IdleConnTimeout, time.Minute; got != want {
+		t.Errorf("IdleConnTimeout: got %v, want %v", got, want)
+	}
+	if DefaultTransport.ResponseHeaderTimeout != 0 {
+		t.Errorf("DefaultTransport.ResponseHeaderTimeout was modified")
+	}
+
+	// The same options share a transport.
+	again, err := withTimeouts(DefaultTransport, timeouts{
+		responseHeader: time.Second,
+		idleConn:       time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != tr {
+		t.Error("withTimeouts didn't reuse the transport for the same options")
+	}
+
+	if _, err := withTimeouts(http.NewFileTransport(http.Dir(".")), timeouts{dial: time.Second}); err == nil {
+		t.Error("withTimeouts with a non-*http.Transport: got nil want err")
+	}
+	if _, err := makeOptions(nil, WithDialTimeout(-time.Second)); err == nil {
+		t.Error("WithDialTimeout(-1s): got nil want err")
+	}
+}
+
+func TestWithResponseHeaderTimeout(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Respond to blob requests with headers right away, but take longer than
+	// the response header timeout to send the body.
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/blobs/"+h.String()) && r.Method == http.MethodGet {
+			rec := httptest.NewRecorder()
+			reg.ServeHTTP(rec, r)
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			w.Write(rec.Body.Bytes())
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+	if err := Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := Layer(tag.Context().Digest(h.String()), WithResponseHeaderTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := rl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		t.Errorf("reading slow body: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-containerregistry/internal/clock"
+	"github.com/google/go-containerregistry/internal/redact"
+)
+
+// traceBodyLimit is the largest body that we include in a trace. Anything
+// larger is only summarized by its size.
+const traceBodyLimit = 1024
+
+// traceEntry is the JSON line written to the trace for each HTTP request.
+type traceEntry struct {
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Status          int         `json:"status,omitempty"`
+	Error           string      `json:"error,omitempty"`
+	RequestHeaders  http.Header `json:"requestHeaders,omitempty"`
+	ResponseHeaders http.Header `json:"responseHeaders,omitempty"`
+	RequestSize     int64       `json:"requestSize"`
+	ResponseSize    int64       `json:"responseSize"`
+	RequestBody     string      `json:"requestBody,omitempty"`
+	ResponseBody    string      `json:"responseBody,omitempty"`
+	Redacted        string      `json:"redacted,omitempty"`
+	// WaitMillis is the time until the response headers arrived, and
+	// TotalMillis also includes reading the response body.
+	WaitMillis  float64 `json:"waitMillis"`
+	TotalMillis float64 `json:"totalMillis"`
+}
+
+// tracer writes traceEntries to w as JSON lines, one at a time.
+type tracer struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+func newTracer(w io.Writer) *tracer {
+	return &tracer{enc: json.NewEncoder(w)}
+}
+
+func (t *tracer) write(e *traceEntry) {
+	t.Lock()
+	defer t.Unlock()
+	// Tracing must not affect the request, so there's nothing useful to do
+	// with an error here.
+	_ = t.enc.Encode(e)
+}
+
+// traceTransport wraps a RoundTripper and records each request and response
+// to a tracer. Entries are written once the response body has been read or
+// closed, so that they include its size.
+type traceTransport struct {
+	inner  http.RoundTripper
+	tracer *tracer
+	clock  clock.Clock
+}
+
+var _ http.RoundTripper = (*traceTransport)(nil)
+
+// Unwrap returns the inner RoundTripper, so that the transport package can
+// cache ping responses for it.
+func (t *traceTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *traceTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	c := clock.OrReal(t.clock)
+	omitBody, reason := redact.FromContext(in.Context())
+	e := &traceEntry{
+		Time:           c.Now(),
+		Method:         in.Method,
+		URL:            redact.URL(in.URL).String(),
+		RequestHeaders: redact.Header(in.Header),
+	}
+	if omitBody {
+		e.Redacted = reason
+	}
+
+	var reqBody *traceBody
+	if in.Body != nil && in.Body != http.NoBody {
+		// RoundTrippers must not modify the request.
+		out := in.Clone(in.Context())
+		reqBody = &traceBody{ReadCloser: in.Body}
+		out.Body = reqBody
+		in = out
+	}
+
+	resp, err := t.inner.RoundTrip(in)
+	e.WaitMillis = millis(c.Now().Sub(e.Time))
+	finish := func(respBody *traceBody) {
+		e.TotalMillis = millis(c.Now().Sub(e.Time))
+		if reqBody != nil {
+			e.RequestSize, e.RequestBody = reqBody.summary(omitBody)
+		}
+		if respBody != nil {
+			e.ResponseSize, e.ResponseBody = respBody.summary(omitBody)
+		}
+		t.tracer.write(e)
+	}
+	if err != nil {
+		e.Error = err.Error()
+		finish(nil)
+		return resp, err
+	}
+
+	e.Status = resp.StatusCode
+	e.ResponseHeaders = redact.Header(resp.Header)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		finish(nil)
+		return resp, nil
+	}
+	respBody := &traceBody{ReadCloser: resp.Body}
+	respBody.done = func() { finish(respBody) }
+	resp.Body = respBody
+	return resp, nil
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// traceBody counts the bytes read through it and keeps the first
+// traceBodyLimit of them. done, if set, is called once, when the body has
+// been read to the end or closed, whichever comes first.
+//
+// Request bodies are read by the http.Transport in another goroutine, hence
+// the mutex.
+type traceBody struct {
+	io.ReadCloser
+	mu   sync.Mutex
+	n    int64
+	head []byte
+	once sync.Once
+	done func()
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if keep := traceBodyLimit + 1 - len(b.head); keep > 0 {
+		if keep > n {
+			keep = n
+		}
+		b.head = append(b.head, p[:keep]...)
+	}
+	b.n += int64(n)
+	b.mu.Unlock()
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *traceBody) finish() {
+	if b.done != nil {
+		b.once.Do(b.done)
+	}
+}
+
+// summary returns the number of bytes read, and the body itself if it's
+// small, printable and not redacted.
+func (b *traceBody) summary(omit bool) (int64, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if omit || len(b.head) > traceBodyLimit || !utf8.Valid(b.head) {
+		return b.n, ""
+	}
+	return b.n, string(b.head)
+}
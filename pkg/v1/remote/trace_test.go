@@ -0,0 +1,127 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestTrace(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(traceBodyLimit*4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := authn.FromConfig(authn.AuthConfig{Username: "user", Password: "hunter2"})
+	var buf bytes.Buffer
+	if err := Write(ref, img, WithAuth(auth), WithTrace(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Image(ref, WithAuth(auth), WithTrace(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := got.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bytes.NewBuffer(nil).ReadFrom(rc); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("trace contains credentials:\n%s", buf.String())
+	}
+
+	var entries []traceEntry
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var e traceEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("parsing trace line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+
+	var manifestPut, manifestGet, blobGet *traceEntry
+	for i, e := range entries {
+		if e.Time.IsZero() || (e.Status == 0) == (e.Error == "") || e.TotalMillis < e.WaitMillis {
+			t.Errorf("incomplete entry: %+v", e)
+		}
+		if got := e.RequestHeaders.Get("Authorization"); got != "" && got != "<redacted>" {
+			t.Errorf("%s %s: Authorization = %q, want redacted", e.Method, e.URL, got)
+		}
+		switch {
+		case e.Method == http.MethodPut && strings.Contains(e.URL, "/manifests/"):
+			manifestPut = &entries[i]
+		case e.Method == http.MethodGet && strings.Contains(e.URL, "/manifests/"):
+			manifestGet = &entries[i]
+		case e.Method == http.MethodGet && strings.Contains(e.URL, "/blobs/") && e.ResponseSize > traceBodyLimit:
+			blobGet = &entries[i]
+		}
+	}
+
+	raw, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifestPut == nil {
+		t.Fatal("no manifest PUT in trace")
+	}
+	if manifestPut.RequestSize != int64(len(raw)) || manifestPut.RequestBody != string(raw) {
+		t.Errorf("manifest PUT: got size %d and body %q, want %d and %q", manifestPut.RequestSize, manifestPut.RequestBody, len(raw), raw)
+	}
+	if manifestGet == nil {
+		t.Fatal("no manifest GET in trace")
+	}
+	if manifestGet.ResponseSize != int64(len(raw)) || manifestGet.ResponseBody != string(raw) {
+		t.Errorf("manifest GET: got size %d and body %q, want %d and %q", manifestGet.ResponseSize, manifestGet.ResponseBody, len(raw), raw)
+	}
+
+	// Large bodies are only summarized.
+	if blobGet == nil {
+		t.Fatal("no layer GET in trace")
+	}
+	if blobGet.ResponseBody != "" {
+		t.Errorf("layer GET: got body of %d bytes, want none", len(blobGet.ResponseBody))
+	}
+}
@@ -18,22 +18,50 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"sync"
 
+	authchallenge "github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/google/go-containerregistry/pkg/authn"
 )
 
 type basicTransport struct {
-	inner  http.RoundTripper
+	inner http.RoundTripper
+	// Guards auth, which can change if it falls back to other credentials.
+	mu     sync.Mutex
 	auth   authn.Authenticator
 	target string
+	// Called if the registry responds with a bearer challenge, which means
+	// the cached ping response we were created from is stale.
+	invalidate func()
 }
 
 var _ http.RoundTripper = (*basicTransport)(nil)
 
 // RoundTrip implements http.RoundTripper
 func (bt *basicTransport) RoundTrip(in *http.Request) (*http.Response, error) {
-	if bt.auth != authn.Anonymous {
-		auth, err := bt.auth.Authorization()
+	bt.mu.Lock()
+	ba := bt.auth
+	bt.mu.Unlock()
+
+	for {
+		res, err := bt.roundTrip(in, ba)
+		if err != nil {
+			return nil, err
+		}
+		next, ok := fallback(ba, in, res)
+		if !ok {
+			return res, nil
+		}
+		ba = next
+		bt.mu.Lock()
+		bt.auth = next
+		bt.mu.Unlock()
+	}
+}
+
+func (bt *basicTransport) roundTrip(in *http.Request, ba authn.Authenticator) (*http.Response, error) {
+	if ba != authn.Anonymous {
+		auth, err := ba.Authorization()
 		if err != nil {
 			return nil, err
 		}
@@ -58,5 +86,17 @@ func (bt *basicTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 			}
 		}
 	}
-	return bt.inner.RoundTrip(in)
+	res, err := bt.inner.RoundTrip(in)
+	if err != nil {
+		return nil, err
+	}
+	if bt.invalidate != nil && res.StatusCode == http.StatusUnauthorized {
+		for _, wac := range authchallenge.ResponseChallenges(res) {
+			if challenge(wac.Scheme).Canonical() == bearer {
+				bt.invalidate()
+				break
+			}
+		}
+	}
+	return res, nil
 }
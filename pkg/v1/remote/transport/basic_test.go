@@ -136,3 +136,41 @@ func TestBasicTransportWithEmptyAuthnCred(t *testing.T) {
 		t.Errorf("Unexpected error during Get: %v", err)
 	}
 }
+
+func TestBasicTransportAnonymousFirst(t *testing.T) {
+	var anon, authed int
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); ok && user == "foo" && pass == "bar" {
+				authed++
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			anon++
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer server.Close()
+
+	inner := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+
+	auth := authn.AnonymousFirst(&authn.Basic{Username: "foo", Password: "bar"})
+	client := http.Client{Transport: &basicTransport{inner: inner, auth: auth, target: "gcr.io"}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post("http://gcr.io/v2/foo", "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("Unexpected error during Post: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Post StatusCode; got %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+	// Once we've fallen back, we should stick with the credentials.
+	if anon != 1 || authed != 2 {
+		t.Errorf("got %d anonymous and %d authenticated requests, want 1 and 2", anon, authed)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	authchallenge "github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/google/go-containerregistry/internal/redact"
@@ -35,6 +36,12 @@ import (
 type bearerTransport struct {
 	// Wrapped by bearerTransport.
 	inner http.RoundTripper
+	// Guards basic and bearer, which are replaced while other requests may
+	// be using the transport.
+	mu sync.Mutex
+	// Held while falling back to other credentials, so that concurrent
+	// requests that are rejected only fall back once.
+	fallbackMu sync.Mutex
 	// Basic credentials that we exchange for bearer tokens.
 	basic authn.Authenticator
 	// Holds the bearer response from the token service.
@@ -48,6 +55,9 @@ type bearerTransport struct {
 	scopes  []string
 	// Scheme we should use, determined by ping response.
 	scheme string
+	// Called if the registry responds with a different challenge than the
+	// one we were created from, which means the cached ping response is stale.
+	invalidate func()
 }
 
 var _ http.RoundTripper = (*bearerTransport)(nil)
@@ -65,16 +75,44 @@ func stringSet(ss []string) map[string]struct{} {
 	return set
 }
 
+func (bt *bearerTransport) getBasic() authn.Authenticator {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.basic
+}
+
+func (bt *bearerTransport) setBasic(basic authn.Authenticator) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	bt.basic = basic
+}
+
+func (bt *bearerTransport) token() string {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.bearer.RegistryToken
+}
+
+func (bt *bearerTransport) setToken(token string) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	bt.bearer.RegistryToken = token
+}
+
 // RoundTrip implements http.RoundTripper
 func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	// The token we last sent, to tell whether another request has refreshed
+	// it since.
+	var sent string
 	sendRequest := func() (*http.Response, error) {
+		sent = bt.token()
 		// http.Client handles redirects at a layer above the http.RoundTripper
 		// abstraction, so to avoid forwarding Authorization headers to places
 		// we are redirected, only set it when the authorization header matches
 		// the registry with which we are interacting.
 		// In case of redirect http.Client can use an empty Host, check URL too.
 		if matchesHost(bt.registry, in, bt.scheme) {
-			hdr := fmt.Sprintf("Bearer %s", bt.bearer.RegistryToken)
+			hdr := fmt.Sprintf("Bearer %s", sent)
 			in.Header.Set("Authorization", hdr)
 		}
 		return bt.inner.RoundTrip(in)
@@ -88,6 +126,9 @@ func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 	// If we hit a WWW-Authenticate challenge, it might be due to expired tokens or insufficient scope.
 	if challenges := authchallenge.ResponseChallenges(res); len(challenges) != 0 {
 		for _, wac := range challenges {
+			if bt.invalidate != nil && (challenge(wac.Scheme).Canonical() != bearer || wac.Parameters["realm"] != bt.realm) {
+				bt.invalidate()
+			}
 			// TODO(jonjohnsonjr): Should we also update "realm" or "service"?
 			if scope, ok := wac.Parameters["scope"]; ok {
 				// From https://tools.ietf.org/html/rfc6750#section-3
@@ -113,10 +154,47 @@ func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 		if err = bt.refresh(in.Context()); err != nil {
 			return nil, err
 		}
-		return sendRequest()
+		res, err = sendRequest()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return res, err
+	// If we're still rejected, e.g. because anonymous pulls are rate limited,
+	// try again with other credentials if we have any.
+	for {
+		if ok, err := bt.fallback(in, res, sent); err != nil {
+			return nil, err
+		} else if !ok {
+			return res, nil
+		}
+		res, err = sendRequest()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fallback switches to the credentials that replace ours if res shows that
+// the registry rejected them, and refreshes the token. If another request has
+// refreshed the token since we sent it, we just try again with the new one.
+// It returns false if the request shouldn't be sent again.
+func (bt *bearerTransport) fallback(in *http.Request, res *http.Response, sent string) (bool, error) {
+	bt.fallbackMu.Lock()
+	defer bt.fallbackMu.Unlock()
+
+	if bt.token() != sent {
+		return rejected(res) && rewind(in, res), nil
+	}
+	next, ok := fallback(bt.getBasic(), in, res)
+	if !ok {
+		return false, nil
+	}
+	bt.setBasic(next)
+	if err := bt.refresh(in.Context()); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // It's unclear which authentication flow to use based purely on the protocol,
@@ -124,13 +202,13 @@ func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 // The basic token exchange is attempted first, falling back to the oauth flow.
 // If the IdentityToken is set, this indicates that we should start with the oauth flow.
 func (bt *bearerTransport) refresh(ctx context.Context) error {
-	auth, err := bt.basic.Authorization()
+	auth, err := bt.getBasic().Authorization()
 	if err != nil {
 		return err
 	}
 
 	if auth.RegistryToken != "" {
-		bt.bearer.RegistryToken = auth.RegistryToken
+		bt.setToken(auth.RegistryToken)
 		return nil
 	}
 
@@ -167,23 +245,24 @@ func (bt *bearerTransport) refresh(ctx context.Context) error {
 		return err
 	}
 
-	// Some registries set access_token instead of token.
+	// Some registries set access_token instead of token, as in OAuth2. If both
+	// are set, they must be equivalent.
 	if response.AccessToken != "" {
 		response.Token = response.AccessToken
 	}
 
 	// Find a token to turn into a Bearer authenticator
 	if response.Token != "" {
-		bt.bearer.RegistryToken = response.Token
+		bt.setToken(response.Token)
 	} else {
-		return fmt.Errorf("no token in bearer response:\n%s", content)
+		return fmt.Errorf("no token in bearer response:\n%s", redact.JSON(content))
 	}
 
 	// If we obtained a refresh token from the oauth flow, use that for refresh() now.
 	if response.RefreshToken != "" {
-		bt.basic = authn.FromConfig(authn.AuthConfig{
+		bt.setBasic(authn.FromConfig(authn.AuthConfig{
 			IdentityToken: response.RefreshToken,
-		})
+		}))
 	}
 
 	return nil
@@ -192,7 +271,7 @@ func (bt *bearerTransport) refresh(ctx context.Context) error {
 func matchesHost(reg name.Registry, in *http.Request, scheme string) bool {
 	canonicalHeaderHost := canonicalAddress(in.Host, scheme)
 	canonicalURLHost := canonicalAddress(in.URL.Host, scheme)
-	canonicalRegistryHost := canonicalAddress(reg.RegistryStr(), scheme)
+	canonicalRegistryHost := canonicalAddress(reg.APIHost(), scheme)
 	return canonicalHeaderHost == canonicalRegistryHost || canonicalURLHost == canonicalRegistryHost
 }
 
@@ -223,7 +302,7 @@ func canonicalAddress(host, scheme string) (address string) {
 
 // https://docs.docker.com/registry/spec/auth/oauth/
 func (bt *bearerTransport) refreshOauth(ctx context.Context) ([]byte, error) {
-	auth, err := bt.basic.Authorization()
+	auth, err := bt.getBasic().Authorization()
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +359,7 @@ func (bt *bearerTransport) refreshBasic(ctx context.Context) ([]byte, error) {
 	}
 	b := &basicTransport{
 		inner:  bt.inner,
-		auth:   bt.basic,
+		auth:   bt.getBasic(),
 		target: u.Host,
 	}
 	client := http.Client{Transport: b}
@@ -21,6 +21,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -87,6 +88,83 @@ func TestBearerRefresh(t *testing.T) {
 	}
 }
 
+func TestBearerRefreshAccessToken(t *testing.T) {
+	accessToken := "access-token"
+	refreshToken := "refresh-token"
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("Method; got %v, want %v", r.Method, http.MethodGet)
+			}
+			// No "token" field, as returned by OAuth2-style token servers.
+			w.Write([]byte(fmt.Sprintf(`{"access_token": %q, "refresh_token": %q}`, accessToken, refreshToken)))
+		}))
+	defer server.Close()
+
+	registry, err := name.NewRegistry("my-service.io", name.WeakValidation)
+	if err != nil {
+		t.Errorf("Unexpected error during NewRegistry: %v", err)
+	}
+	bt := &bearerTransport{
+		inner:    http.DefaultTransport,
+		basic:    &authn.Basic{Username: "foo", Password: "bar"},
+		registry: registry,
+		realm:    server.URL,
+		service:  "my-service.io",
+		scheme:   "http",
+	}
+
+	if err := bt.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() = %v", err)
+	}
+	if got, want := bt.bearer.RegistryToken, accessToken; got != want {
+		t.Errorf("RegistryToken; got %v, want %v", got, want)
+	}
+
+	// The refresh token is kept for later refresh_token grants.
+	auth, err := bt.basic.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := auth.IdentityToken, refreshToken; got != want {
+		t.Errorf("IdentityToken; got %v, want %v", got, want)
+	}
+}
+
+func TestBearerRefreshErrorRedacted(t *testing.T) {
+	secret := "Sup3rDup3rS3cr3tz"
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// No usable token, but a refresh token that must not leak.
+			w.Write([]byte(fmt.Sprintf(`{"refresh_token": %q, "details": "no token for you"}`, secret)))
+		}))
+	defer server.Close()
+
+	registry, err := name.NewRegistry("my-service.io", name.WeakValidation)
+	if err != nil {
+		t.Errorf("Unexpected error during NewRegistry: %v", err)
+	}
+	bt := &bearerTransport{
+		inner:    http.DefaultTransport,
+		basic:    &authn.Basic{Username: "foo", Password: "bar"},
+		registry: registry,
+		realm:    server.URL,
+		service:  "my-service.io",
+		scheme:   "http",
+	}
+
+	err = bt.refresh(context.Background())
+	if err == nil {
+		t.Fatal("refresh() = nil, want error")
+	}
+	if strings.Contains(err.Error(), secret) {
+		t.Errorf("refresh() error leaks the refresh token: %v", err)
+	}
+	if !strings.Contains(err.Error(), "no token for you") {
+		t.Errorf("refresh() error should keep non-secret fields: %v", err)
+	}
+}
+
 func TestBearerTransport(t *testing.T) {
 	expectedToken := "sdkjhfskjdhfkjshdf"
 
@@ -559,3 +637,120 @@ func TestInsufficientScope(t *testing.T) {
 		t.Error("didn't refresh insufficient scope")
 	}
 }
+
+func TestBearerTransportAnonymousFirst(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				if user, pass, ok := r.BasicAuth(); ok && user == "foo" && pass == "bar" {
+					w.Write([]byte(`{"token": "authed"}`))
+					return
+				}
+				w.Write([]byte(`{"token": "anon"}`))
+				return
+			}
+			if r.Header.Get("Authorization") == "Bearer authed" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			// Rate limited, without a challenge.
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := name.NewRegistry(u.Host, name.WeakValidation)
+	if err != nil {
+		t.Fatalf("Unexpected error during NewRegistry: %v", err)
+	}
+
+	transport := &bearerTransport{
+		inner:    http.DefaultTransport,
+		basic:    authn.AnonymousFirst(&authn.Basic{Username: "foo", Password: "bar"}),
+		registry: registry,
+		realm:    server.URL + "/token",
+		scheme:   "http",
+	}
+	if err := transport.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() = %v", err)
+	}
+	if got, want := transport.bearer.RegistryToken, "anon"; got != want {
+		t.Errorf("initial token; got %v, want %v", got, want)
+	}
+
+	client := http.Client{Transport: transport}
+	res, err := client.Get(fmt.Sprintf("http://%s/v2/foo/bar/blobs/blah", u.Host))
+	if err != nil {
+		t.Fatalf("Unexpected error during client.Get: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("client.Get final StatusCode got %v, want: %v", res.StatusCode, http.StatusOK)
+	}
+	if got, want := transport.bearer.RegistryToken, "authed"; got != want {
+		t.Errorf("Expected Bearer token to be refreshed, got %v, want %v", got, want)
+	}
+}
+
+func TestBearerTransportConcurrentFallback(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				if user, pass, ok := r.BasicAuth(); ok && user == "foo" && pass == "bar" {
+					w.Write([]byte(`{"token": "authed"}`))
+					return
+				}
+				w.Write([]byte(`{"token": "anon"}`))
+				return
+			}
+			if r.Header.Get("Authorization") == "Bearer authed" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := name.NewRegistry(u.Host, name.WeakValidation)
+	if err != nil {
+		t.Fatalf("Unexpected error during NewRegistry: %v", err)
+	}
+
+	transport := &bearerTransport{
+		inner:    http.DefaultTransport,
+		basic:    authn.AnonymousFirst(&authn.Basic{Username: "foo", Password: "bar"}),
+		registry: registry,
+		realm:    server.URL + "/token",
+		scheme:   "http",
+	}
+	if err := transport.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() = %v", err)
+	}
+
+	// Requests that fall back at the same time mustn't race on the
+	// credentials they fall back to (run with -race).
+	client := http.Client{Transport: transport}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(fmt.Sprintf("http://%s/v2/foo/bar/blobs/blah", u.Host))
+			if err != nil {
+				t.Errorf("Unexpected error during client.Get: %v", err)
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("client.Get final StatusCode got %v, want: %v", res.StatusCode, http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+}
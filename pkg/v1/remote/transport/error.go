@@ -16,29 +16,14 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strings"
-)
 
-// The set of query string keys that we expect to send as part of the registry
-// protocol. Anything else is potentially dangerous to leak, as it's probably
-// from a redirect. These redirects often included tokens or signed URLs.
-var paramAllowlist = map[string]struct{}{
-	// Token exchange
-	"scope":   {},
-	"service": {},
-	// Cross-repo mounting
-	"mount": {},
-	"from":  {},
-	// Layer PUT
-	"digest": {},
-	// Listing tags and catalog
-	"n":    {},
-	"last": {},
-}
+	"github.com/google/go-containerregistry/internal/redact"
+)
 
 // Error implements error to support the following error specification:
 // https://github.com/docker/distribution/blob/master/docs/spec/api.md#errors
@@ -59,7 +44,7 @@ var _ error = (*Error)(nil)
 func (e *Error) Error() string {
 	prefix := ""
 	if e.Request != nil {
-		prefix = fmt.Sprintf("%s %s: ", e.Request.Method, redactURL(e.Request.URL))
+		prefix = fmt.Sprintf("%s %s: ", e.Request.Method, redact.URL(e.Request.URL))
 	}
 	return prefix + e.responseErr()
 }
@@ -100,22 +85,6 @@ func (e *Error) Temporary() bool {
 	return true
 }
 
-// TODO(jonjohnsonjr): Consider moving to internal/redact.
-func redactURL(original *url.URL) *url.URL {
-	qs := original.Query()
-	for k, v := range qs {
-		for i := range v {
-			if _, ok := paramAllowlist[k]; !ok {
-				// key is not in the Allowlist
-				v[i] = "REDACTED"
-			}
-		}
-	}
-	redacted := *original
-	redacted.RawQuery = qs.Encode()
-	return &redacted
-}
-
 // Diagnostic represents a single error returned by a Docker registry interaction.
 type Diagnostic struct {
 	Code    ErrorCode   `json:"code"`
@@ -177,6 +146,100 @@ var temporaryStatusCodes = map[int]struct{}{
 	http.StatusGatewayTimeout:      {},
 }
 
+// statusErrorCodes maps the HTTP status codes of responses without structured
+// errors to the error code that a registry would most likely have returned.
+// Not found responses depend on what was requested, see Error.Codes.
+var statusErrorCodes = map[int]ErrorCode{
+	http.StatusUnauthorized:       UnauthorizedErrorCode,
+	http.StatusForbidden:          DeniedErrorCode,
+	http.StatusMethodNotAllowed:   UnsupportedErrorCode,
+	http.StatusTooManyRequests:    TooManyRequestsErrorCode,
+	http.StatusServiceUnavailable: UnavailableErrorCode,
+}
+
+// Codes returns the error codes of the structured errors returned by the
+// registry. If the response had no structured errors, this is the code
+// implied by the HTTP status code, if any.
+func (e *Error) Codes() []ErrorCode {
+	if len(e.Errors) != 0 {
+		codes := make([]ErrorCode, 0, len(e.Errors))
+		for _, d := range e.Errors {
+			codes = append(codes, d.Code)
+		}
+		return codes
+	}
+	if e.StatusCode == http.StatusNotFound {
+		return []ErrorCode{notFoundCode(e.Request)}
+	}
+	if code, ok := statusErrorCodes[e.StatusCode]; ok {
+		return []ErrorCode{code}
+	}
+	return nil
+}
+
+// notFoundCode guesses which kind of thing wasn't found from the request path.
+func notFoundCode(req *http.Request) ErrorCode {
+	if req == nil || req.URL == nil {
+		return NameUnknownErrorCode
+	}
+	switch p := req.URL.Path; {
+	case strings.Contains(p, "/manifests/"):
+		return ManifestUnknownErrorCode
+	case strings.Contains(p, "/blobs/uploads/"):
+		return BlobUploadUnknownErrorCode
+	case strings.Contains(p, "/blobs/"):
+		return BlobUnknownErrorCode
+	default:
+		return NameUnknownErrorCode
+	}
+}
+
+// HasErrorCode returns true if err is (or wraps) an *Error with any of the
+// given codes, see Error.Codes.
+func HasErrorCode(err error, codes ...ErrorCode) bool {
+	var terr *Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	for _, got := range terr.Codes() {
+		for _, want := range codes {
+			if got == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsNotFound returns true if err means that the requested repository,
+// manifest, blob or upload doesn't exist.
+func IsNotFound(err error) bool {
+	return HasErrorCode(err, NameUnknownErrorCode, ManifestUnknownErrorCode, BlobUnknownErrorCode, BlobUploadUnknownErrorCode)
+}
+
+// IsDenied returns true if err means that access to the requested resource
+// was denied.
+func IsDenied(err error) bool {
+	return HasErrorCode(err, DeniedErrorCode)
+}
+
+// IsUnauthorized returns true if err means that authentication is required.
+func IsUnauthorized(err error) bool {
+	return HasErrorCode(err, UnauthorizedErrorCode)
+}
+
+// IsTooManyRequests returns true if err means that the registry is rate
+// limiting us.
+func IsTooManyRequests(err error) bool {
+	return HasErrorCode(err, TooManyRequestsErrorCode)
+}
+
+// IsUnsupported returns true if err means that the registry doesn't support
+// the requested operation.
+func IsUnsupported(err error) bool {
+	return HasErrorCode(err, UnsupportedErrorCode)
+}
+
 // CheckError returns a structured error if the response status is not in codes.
 func CheckError(resp *http.Response, codes ...int) error {
 	for _, code := range codes {
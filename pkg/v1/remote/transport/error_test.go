@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -254,3 +255,141 @@ func (e *errReadCloser) Read(p []byte) (int, error) {
 func (e *errReadCloser) Close() error {
 	return e.err
 }
+
+func TestErrorCodes(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		code   int
+		path   string
+		body   string
+		want   []ErrorCode
+		checks map[string]func(error) bool
+	}{{
+		name: "structured",
+		code: http.StatusNotFound,
+		path: "/v2/foo/manifests/latest",
+		body: `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"nope"}]}`,
+		want: []ErrorCode{ManifestUnknownErrorCode},
+		checks: map[string]func(error) bool{
+			"IsNotFound": IsNotFound,
+		},
+	}, {
+		name: "structured denied overrides status",
+		code: http.StatusUnauthorized,
+		path: "/v2/foo/manifests/latest",
+		body: `{"errors":[{"code":"DENIED"},{"code":"TOOMANYREQUESTS"}]}`,
+		want: []ErrorCode{DeniedErrorCode, TooManyRequestsErrorCode},
+		checks: map[string]func(error) bool{
+			"IsDenied":          IsDenied,
+			"IsTooManyRequests": IsTooManyRequests,
+		},
+	}, {
+		name: "manifest not found",
+		code: http.StatusNotFound,
+		path: "/v2/foo/manifests/latest",
+		want: []ErrorCode{ManifestUnknownErrorCode},
+		checks: map[string]func(error) bool{
+			"IsNotFound": IsNotFound,
+		},
+	}, {
+		name: "blob not found",
+		code: http.StatusNotFound,
+		path: "/v2/foo/blobs/sha256:deadbeef",
+		want: []ErrorCode{BlobUnknownErrorCode},
+		checks: map[string]func(error) bool{
+			"IsNotFound": IsNotFound,
+		},
+	}, {
+		name: "upload not found",
+		code: http.StatusNotFound,
+		path: "/v2/foo/blobs/uploads/1234",
+		body: "not json",
+		want: []ErrorCode{BlobUploadUnknownErrorCode},
+		checks: map[string]func(error) bool{
+			"IsNotFound": IsNotFound,
+		},
+	}, {
+		name: "repo not found",
+		code: http.StatusNotFound,
+		path: "/v2/foo/tags/list",
+		want: []ErrorCode{NameUnknownErrorCode},
+		checks: map[string]func(error) bool{
+			"IsNotFound": IsNotFound,
+		},
+	}, {
+		name: "unauthorized",
+		code: http.StatusUnauthorized,
+		path: "/v2/",
+		want: []ErrorCode{UnauthorizedErrorCode},
+		checks: map[string]func(error) bool{
+			"IsUnauthorized": IsUnauthorized,
+		},
+	}, {
+		name: "forbidden",
+		code: http.StatusForbidden,
+		path: "/v2/foo/manifests/latest",
+		want: []ErrorCode{DeniedErrorCode},
+		checks: map[string]func(error) bool{
+			"IsDenied": IsDenied,
+		},
+	}, {
+		name: "method not allowed",
+		code: http.StatusMethodNotAllowed,
+		path: "/v2/foo/manifests/latest",
+		want: []ErrorCode{UnsupportedErrorCode},
+		checks: map[string]func(error) bool{
+			"IsUnsupported": IsUnsupported,
+		},
+	}, {
+		name: "rate limited",
+		code: http.StatusTooManyRequests,
+		path: "/v2/foo/manifests/latest",
+		want: []ErrorCode{TooManyRequestsErrorCode},
+		checks: map[string]func(error) bool{
+			"IsTooManyRequests": IsTooManyRequests,
+		},
+	}, {
+		name: "teapot",
+		code: http.StatusTeapot,
+		path: "/v2/foo/manifests/latest",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: test.code,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(test.body)),
+				Request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Path: test.path}},
+			}
+			err := CheckError(resp, http.StatusOK)
+			if err == nil {
+				t.Fatal("CheckError() = nil")
+			}
+			var terr *Error
+			if !errors.As(err, &terr) {
+				t.Fatalf("CheckError() = %T, want *Error", err)
+			}
+			if diff := cmp.Diff(test.want, terr.Codes()); diff != "" {
+				t.Errorf("Codes() (-want +got) = %s", diff)
+			}
+
+			// Wrapping shouldn't matter.
+			wrapped := fmt.Errorf("wrapped: %w", err)
+			all := map[string]func(error) bool{
+				"IsNotFound":        IsNotFound,
+				"IsDenied":          IsDenied,
+				"IsUnauthorized":    IsUnauthorized,
+				"IsTooManyRequests": IsTooManyRequests,
+				"IsUnsupported":     IsUnsupported,
+			}
+			for name, check := range all {
+				_, want := test.checks[name]
+				if got := check(wrapped); got != want {
+					t.Errorf("%s() = %t, want %t", name, got, want)
+				}
+			}
+		})
+	}
+
+	if IsNotFound(errors.New("404 not found")) {
+		t.Error("IsNotFound(non-transport error) = true")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// refresher is implemented by Authenticators that hold on to credentials
+// that can go stale, so that we can refresh them if the registry rejects them.
+type refresher interface {
+	// Refresh reports whether the credentials changed.
+	Refresh() bool
+}
+
+// fallback returns the Authenticator that replaces auth if res shows that the
+// registry rejected our credentials (or lack thereof) and auth has others to
+// offer, see authn.Fallback, or auth itself if it has refreshed its
+// credentials after a 401. It also rewinds the body of in so that the request
+// can be sent again, and closes the body of res.
+func fallback(auth authn.Authenticator, in *http.Request, res *http.Response) (authn.Authenticator, bool) {
+	if !rejected(res) {
+		return nil, false
+	}
+	var next authn.Authenticator
+	if r, ok := auth.(refresher); ok && res.StatusCode == http.StatusUnauthorized && r.Refresh() {
+		next = auth
+	} else if fb, ok := auth.(authn.Fallback); ok {
+		next = fb.Fallback()
+	}
+	if next == nil {
+		return nil, false
+	}
+	if !rewind(in, res) {
+		return nil, false
+	}
+	return next, true
+}
+
+// rejected reports whether res shows that the registry rejected our
+// credentials, or lack thereof.
+func rejected(res *http.Response) bool {
+	return res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusTooManyRequests
+}
+
+// rewind rewinds the body of in so that the request can be sent again, and
+// closes the body of res. It returns false if the body can't be rewound.
+func rewind(in *http.Request, res *http.Response) bool {
+	if in.Body != nil && in.Body != http.NoBody {
+		if in.GetBody == nil {
+			return false
+		}
+		body, err := in.GetBody()
+		if err != nil {
+			return false
+		}
+		in.Body = body
+	}
+	res.Body.Close()
+	return true
+}
@@ -39,38 +39,37 @@ func (t *logTransport) RoundTrip(in *http.Request) (out *http.Response, err erro
 
 	// We redact token responses and binary blobs in response/request.
 	omitBody, reason := redact.FromContext(in.Context())
+	u := redact.URL(in.URL)
 	if omitBody {
-		logs.Debug.Printf("--> %s %s [body redacted: %s]", in.Method, in.URL, reason)
+		logs.Debug.Printf("--> %s %s [body redacted: %s]", in.Method, u, reason)
 	} else {
-		logs.Debug.Printf("--> %s %s", in.Method, in.URL)
+		logs.Debug.Printf("--> %s %s", in.Method, u)
 	}
 
-	// Save these headers so we can redact Authorization.
-	savedHeaders := in.Header.Clone()
-	if in.Header != nil && in.Header.Get("authorization") != "" {
-		in.Header.Set("authorization", "<redacted>")
-	}
+	// Save these so we can redact credentials from the dump.
+	savedURL, savedHeaders := in.URL, in.Header
+	in.URL, in.Header = u, redact.Header(in.Header)
 
 	b, err := httputil.DumpRequestOut(in, !omitBody)
 	if err == nil {
 		logs.Debug.Println(string(b))
 	} else {
-		logs.Debug.Printf("Failed to dump request %s %s: %v", in.Method, in.URL, err)
+		logs.Debug.Printf("Failed to dump request %s %s: %v", in.Method, u, err)
 	}
 
-	// Restore the non-redacted headers.
-	in.Header = savedHeaders
+	// Restore the non-redacted URL and headers.
+	in.URL, in.Header = savedURL, savedHeaders
 
 	start := time.Now()
 	out, err = t.inner.RoundTrip(in)
 	duration := time.Since(start)
 	if err != nil {
-		logs.Debug.Printf("<-- %v %s %s (%s)", err, in.Method, in.URL, duration)
+		logs.Debug.Printf("<-- %v %s %s (%s)", err, in.Method, u, duration)
 	}
 	if out != nil {
 		msg := fmt.Sprintf("<-- %d", out.StatusCode)
 		if out.Request != nil {
-			msg = fmt.Sprintf("%s %s", msg, out.Request.URL)
+			msg = fmt.Sprintf("%s %s", msg, redact.URL(out.Request.URL))
 		}
 		msg = fmt.Sprintf("%s (%s)", msg, duration)
 
@@ -80,11 +79,14 @@ func (t *logTransport) RoundTrip(in *http.Request) (out *http.Response, err erro
 
 		logs.Debug.Print(msg)
 
+		savedHeaders := out.Header
+		out.Header = redact.Header(out.Header)
 		b, err := httputil.DumpResponse(out, !omitBody)
+		out.Header = savedHeaders
 		if err == nil {
 			logs.Debug.Println(string(b))
 		} else {
-			logs.Debug.Printf("Failed to dump response %s %s: %v", in.Method, in.URL, err)
+			logs.Debug.Printf("Failed to dump response %s %s: %v", in.Method, u, err)
 		}
 	}
 	return
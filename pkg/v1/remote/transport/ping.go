@@ -15,7 +15,9 @@
 package transport
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +29,46 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 )
 
+// ErrNotRegistry is returned by NewWithContext when strict pinging is enabled
+// (see WithStrictPing) and the /v2/ endpoint doesn't look like a registry.
+var ErrNotRegistry = errors.New("not a container registry")
+
+// apiVersionHeader is set by registries that implement the distribution API.
+const apiVersionHeader = "Docker-Distribution-Api-Version"
+
+type strictPingKey struct{}
+
+// WithStrictPing returns a context that makes NewWithContext verify that a
+// successful response to the /v2/ ping actually came from a registry, i.e.
+// that it either sets the "Docker-Distribution-Api-Version: registry/2.0"
+// header or has a JSON body, rather than e.g. a web server's landing page.
+func WithStrictPing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strictPingKey{}, true)
+}
+
+func isStrictPing(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictPingKey{}).(bool)
+	return strict
+}
+
+// checkRegistry returns ErrNotRegistry if resp doesn't look like it came from
+// a registry's /v2/ endpoint.
+func checkRegistry(resp *http.Response) error {
+	if strings.HasPrefix(strings.ToLower(resp.Header.Get(apiVersionHeader)), "registry/2.0") {
+		return nil
+	}
+	// Not all registries set the header, but they should all respond with
+	// JSON, usually just "{}".
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(b)) != 0 && json.Valid(b) {
+		return nil
+	}
+	return fmt.Errorf("GET %s: %w: missing %s header and response is not JSON", resp.Request.URL, ErrNotRegistry, apiVersionHeader)
+}
+
 type challenge string
 
 const (
@@ -81,7 +123,7 @@ func ping(ctx context.Context, reg name.Registry, t http.RoundTripper) (*pingRes
 
 	var errs []error
 	for _, scheme := range schemes {
-		url := fmt.Sprintf("%s://%s/v2/", scheme, reg.Name())
+		url := fmt.Sprintf("%s://%s/v2/", scheme, reg.APIHost())
 		req, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
 			return nil, err
@@ -101,6 +143,11 @@ func ping(ctx context.Context, reg name.Registry, t http.RoundTripper) (*pingRes
 
 		switch resp.StatusCode {
 		case http.StatusOK:
+			if isStrictPing(ctx) {
+				if err := checkRegistry(resp); err != nil {
+					return nil, err
+				}
+			}
 			// If we get a 200, then no authentication is needed.
 			return &pingResp{
 				challenge: anonymous,
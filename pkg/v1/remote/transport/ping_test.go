@@ -16,10 +16,13 @@ package transport
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -215,6 +218,47 @@ func TestUnsupportedStatus(t *testing.T) {
 	}
 }
 
+func TestPingDockerHubAPIHost(t *testing.T) {
+	var mu sync.Mutex
+	hosts := []string{}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hosts = append(hosts, r.Host)
+			mu.Unlock()
+			http.Error(w, "no tunnels here", http.StatusForbidden)
+		}))
+	defer server.Close()
+	tprt := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+
+	for _, alias := range []string{"docker.io", "index.docker.io", "registry-1.docker.io"} {
+		reg, err := name.NewRegistry(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		hosts = []string{}
+		mu.Unlock()
+		// This fails, because we can't tunnel to the registry.
+		ping(context.Background(), reg, tprt)
+		mu.Lock()
+		got := hosts
+		mu.Unlock()
+		if len(got) == 0 {
+			t.Fatalf("ping(%q) didn't send any requests", alias)
+		}
+		for _, host := range got {
+			if h, _, err := net.SplitHostPort(host); err != nil || h != "registry-1.docker.io" {
+				t.Errorf("ping(%q) connected to %q, want registry-1.docker.io", alias, host)
+			}
+		}
+	}
+}
+
 func TestPingHttpFallback(t *testing.T) {
 	tests := []struct {
 		reg       name.Registry
@@ -293,3 +337,55 @@ func mustInsecureRegistry(r string) name.Registry {
 	}
 	return reg
 }
+
+func TestPingStrict(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		header  string
+		body    string
+		wantErr bool
+	}{{
+		name:   "header",
+		header: "registry/2.0",
+	}, {
+		name: "json body",
+		body: "{}",
+	}, {
+		name:    "web page",
+		body:    "<html>hello</html>",
+		wantErr: true,
+	}, {
+		name:    "empty body",
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tc.header != "" {
+						w.Header().Set("Docker-Distribution-Api-Version", tc.header)
+					}
+					w.Write([]byte(tc.body))
+				}))
+			defer server.Close()
+			tprt := &http.Transport{
+				Proxy: func(req *http.Request) (*url.URL, error) {
+					return url.Parse(server.URL)
+				},
+			}
+
+			// Lenient pings accept anything.
+			if _, err := ping(context.Background(), testRegistry, tprt); err != nil {
+				t.Errorf("ping() = %v", err)
+			}
+
+			_, err := ping(WithStrictPing(context.Background()), testRegistry, tprt)
+			if tc.wantErr {
+				if !errors.Is(err, ErrNotRegistry) {
+					t.Errorf("ping(strict) = %v, want %v", err, ErrNotRegistry)
+				}
+			} else if err != nil {
+				t.Errorf("ping(strict) = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// unwrapper is implemented by RoundTrippers that only decorate requests to an
+// inner RoundTripper, so that we can find the underlying transport that
+// actually talks to the registry.
+type unwrapper interface {
+	Unwrap() http.RoundTripper
+}
+
+// hostHeaderer is implemented by RoundTrippers that send requests to the
+// registry with a different Host header, which the registry may answer
+// differently, e.g. if it serves several virtual hosts.
+type hostHeaderer interface {
+	HostHeader() string
+}
+
+// pingKey identifies a cached ping response. The same registry can respond
+// differently depending on how we reach it (e.g. via a proxy), so responses
+// are only shared between callers that use the same underlying transport.
+type pingKey struct {
+	t        http.RoundTripper
+	registry string
+	scheme   string
+	// host is the Host header the registry is reached with, if it's
+	// overridden.
+	host string
+	// Strict pings check more than lenient ones, so they're cached separately.
+	strict bool
+}
+
+const (
+	// pingTTL is how long a cached ping response is used for. Registries
+	// rarely change how they authenticate, but long-running processes
+	// shouldn't hold on to a response forever.
+	pingTTL = 10 * time.Minute
+
+	// maxPings bounds the size of the cache, since processes that create a
+	// transport per operation would otherwise add an entry each time.
+	maxPings = 1024
+)
+
+type pingEntry struct {
+	pr      *pingResp
+	expires time.Time
+}
+
+// pingCache holds the results of pinging /v2/ for each registry, so that we
+// only need to discover the auth scheme once per transport.
+type pingCache struct {
+	sync.Mutex
+	pings map[pingKey]pingEntry
+	clock clock.Clock
+}
+
+var pings = &pingCache{pings: map[pingKey]pingEntry{}}
+
+// baseTransport strips any of our decorating RoundTrippers from t, returning
+// the Host header that requests end up being sent with, if any of them
+// override it.
+func baseTransport(t http.RoundTripper) (base http.RoundTripper, host string) {
+	for {
+		// The innermost override is the one that's sent.
+		if hh, ok := t.(hostHeaderer); ok {
+			host = hh.HostHeader()
+		}
+		switch tt := t.(type) {
+		case *userAgentTransport:
+			t = tt.inner
+		case *retryTransport:
+			t = tt.inner
+		case *logTransport:
+			t = tt.inner
+		case *schemeTransport:
+			t = tt.inner
+		case unwrapper:
+			t = tt.Unwrap()
+		default:
+			return t, host
+		}
+	}
+}
+
+// keyFor returns the cache key for reg and t, or false if the underlying
+// transport can't be used as a key.
+func keyFor(ctx context.Context, reg name.Registry, t http.RoundTripper) (pingKey, bool) {
+	base, host := baseTransport(t)
+	if base == nil || !reflect.TypeOf(base).Comparable() {
+		return pingKey{}, false
+	}
+	return pingKey{
+		t:        base,
+		registry: reg.Name(),
+		scheme:   reg.Scheme(),
+		host:     host,
+		strict:   isStrictPing(ctx),
+	}, true
+}
+
+// ping returns the cached ping response for reg, pinging it if we haven't
+// seen reg through t before. The returned invalidate func drops the
+// cached response, e.g. when the registry starts responding with a different
+// challenge.
+func (c *pingCache) ping(ctx context.Context, reg name.Registry, t http.RoundTripper) (pr *pingResp, cached bool, invalidate func(), err error) {
+	key, ok := keyFor(ctx, reg, t)
+	if !ok {
+		pr, err := ping(ctx, reg, t)
+		return pr, false, func() {}, err
+	}
+	invalidate = func() {
+		c.Lock()
+		defer c.Unlock()
+		delete(c.pings, key)
+	}
+
+	c.Lock()
+	e, ok := c.pings[key]
+	c.Unlock()
+	if ok && clock.OrReal(c.clock).Now().Before(e.expires) {
+		return e.pr, true, invalidate, nil
+	}
+
+	pr, err = ping(ctx, reg, t)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	now := clock.OrReal(c.clock).Now()
+	if _, ok := c.pings[key]; !ok && len(c.pings) >= maxPings {
+		c.evict(now)
+	}
+	c.pings[key] = pingEntry{pr: pr, expires: now.Add(pingTTL)}
+	return pr, false, invalidate, nil
+}
+
+// evict makes room for a new entry by dropping expired entries or, if none
+// have expired, the one that expires soonest. It must be called with c held.
+func (c *pingCache) evict(now time.Time) {
+	var (
+		oldest    pingKey
+		oldestExp time.Time
+	)
+	for k, e := range c.pings {
+		if !now.Before(e.expires) {
+			delete(c.pings, k)
+			continue
+		}
+		if oldestExp.IsZero() || e.expires.Before(oldestExp) {
+			oldest, oldestExp = k, e.expires
+		}
+	}
+	if len(c.pings) >= maxPings {
+		delete(c.pings, oldest)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/internal/clock"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestPingCache(t *testing.T) {
+	var (
+		pinged     int32
+		wantBearer int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			atomic.AddInt32(&pinged, 1)
+		case "/token":
+			w.Write([]byte(`{"token": "mytoken"}`))
+			return
+		}
+		if atomic.LoadInt32(&wantBearer) == 1 && r.Header.Get("Authorization") != "Bearer mytoken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token"`, r.Host))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := name.NewRegistry(u.Host, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &http.Transport{}
+	get := func(tr http.RoundTripper) *http.Response {
+		t.Helper()
+		client := http.Client{Transport: tr}
+		resp, err := client.Get(fmt.Sprintf("http://%s/v2/foo/manifests/latest", u.Host))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// The ping is only sent once for the same underlying transport, even if
+	// it's wrapped differently.
+	for _, tr := range []http.RoundTripper{inner, NewRetry(inner), NewUserAgent(NewLogger(inner), "test")} {
+		if _, err := NewWithContext(context.Background(), reg, authn.Anonymous, tr, nil); err != nil {
+			t.Fatalf("NewWithContext() = %v", err)
+		}
+	}
+	if got, want := atomic.LoadInt32(&pinged), int32(1); got != want {
+		t.Errorf("pings: got %d, want %d", got, want)
+	}
+
+	// A different transport pings again.
+	if _, err := NewWithContext(context.Background(), reg, authn.Anonymous, &http.Transport{}, nil); err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	if got, want := atomic.LoadInt32(&pinged), int32(2); got != want {
+		t.Errorf("pings: got %d, want %d", got, want)
+	}
+
+	// If the registry starts responding with a different challenge, the
+	// cached response is dropped.
+	tr, err := NewWithContext(context.Background(), reg, authn.Anonymous, inner, nil)
+	if err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	atomic.StoreInt32(&wantBearer, 1)
+	if resp := get(tr); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("stale transport: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	tr, err = NewWithContext(context.Background(), reg, authn.Anonymous, inner, nil)
+	if err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	if got, want := atomic.LoadInt32(&pinged), int32(3); got != want {
+		t.Errorf("pings: got %d, want %d", got, want)
+	}
+	if resp := get(tr); resp.StatusCode != http.StatusOK {
+		t.Errorf("fresh transport: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestPingCacheExpiry(t *testing.T) {
+	var pinged int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pinged, 1)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := name.NewRegistry(u.Host, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := clock.NewFake(time.Now())
+	c := &pingCache{pings: map[pingKey]pingEntry{}, clock: fake}
+	ping := func(want int32) {
+		t.Helper()
+		if _, _, _, err := c.ping(context.Background(), reg, server.Client().Transport); err != nil {
+			t.Fatal(err)
+		}
+		if got := atomic.LoadInt32(&pinged); got != want {
+			t.Errorf("pings: got %d, want %d", got, want)
+		}
+	}
+	ping(1)
+	fake.Advance(pingTTL - time.Second)
+	ping(1)
+	fake.Advance(time.Second)
+	ping(2)
+}
+
+func TestPingCacheEvict(t *testing.T) {
+	now := time.Now()
+	c := &pingCache{pings: map[pingKey]pingEntry{}}
+	for i := 0; i < maxPings; i++ {
+		key := pingKey{registry: fmt.Sprintf("registry-%d", i)}
+		c.pings[key] = pingEntry{pr: &pingResp{}, expires: now.Add(time.Duration(i+1) * time.Minute)}
+	}
+
+	// With nothing expired, the entry that expires soonest goes.
+	c.evict(now)
+	if got, want := len(c.pings), maxPings-1; got != want {
+		t.Errorf("len: got %d, want %d", got, want)
+	}
+	if _, ok := c.pings[pingKey{registry: "registry-0"}]; ok {
+		t.Error("registry-0: still cached, want evicted")
+	}
+
+	// Otherwise, everything that has expired goes.
+	c.evict(now.Add(10 * time.Minute))
+	if got, want := len(c.pings), maxPings-10; got != want {
+		t.Errorf("len: got %d, want %d", got, want)
+	}
+}
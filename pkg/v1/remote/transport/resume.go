@@ -0,0 +1,181 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/internal/redact"
+	"github.com/google/go-containerregistry/pkg/logs"
+)
+
+// isBlobDownload returns true if resp is the full response to a GET of a
+// blob, possibly after following redirects to e.g. a CDN.
+func isBlobDownload(req *http.Request, resp *http.Response) bool {
+	if req == nil || resp == nil || resp.Body == nil {
+		return false
+	}
+	if req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || req.Header.Get("Range") != "" {
+		return false
+	}
+	orig := req
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+	return strings.HasPrefix(orig.URL.Path, "/v2/") && strings.Contains(orig.URL.Path, "/blobs/")
+}
+
+// rangeCache records whether hosts honor Range requests for blobs, so that we
+// don't send Range requests to hosts that would ignore them.
+type rangeCache struct {
+	sync.Mutex
+	hosts map[string]bool
+}
+
+var ranges = &rangeCache{hosts: map[string]bool{}}
+
+// supported returns whether host honors Range requests, and whether we know.
+func (c *rangeCache) supported(host string) (supported, known bool) {
+	c.Lock()
+	defer c.Unlock()
+	supported, known = c.hosts[host]
+	return
+}
+
+func (c *rangeCache) set(host string, supported bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.hosts[host] = supported
+}
+
+// observe records the Accept-Ranges advertised by resp for the host of req.
+// Responses without Accept-Ranges don't tell us anything.
+func (c *rangeCache) observe(req *http.Request, resp *http.Response) {
+	ar := resp.Header.Get("Accept-Ranges")
+	if ar == "" {
+		return
+	}
+	supported := false
+	for _, unit := range strings.Split(ar, ",") {
+		if strings.TrimSpace(unit) == "bytes" {
+			supported = true
+		}
+	}
+	c.set(req.URL.Host, supported)
+}
+
+// resumingBody wraps the body of a blob download so that, if reading it fails
+// partway through (e.g. the connection drops), the download is resumed with a
+// Range request for the remaining bytes instead of failing.
+//
+// Range requests are only sent to hosts that aren't known to ignore them,
+// either because they don't advertise "Accept-Ranges: bytes" or because they
+// ignored a previous Range request. Otherwise, and if the host ignores the
+// Range header anyway, the whole blob is downloaded again and we skip the
+// bytes we've already returned.
+//
+// Callers are expected to verify the digest of what they read, as remote does.
+type resumingBody struct {
+	t    *retryTransport
+	req  *http.Request
+	body io.ReadCloser
+
+	// read is the number of bytes returned by Read so far.
+	read    int64
+	resumes int
+}
+
+// Read implements io.Reader.
+func (b *resumingBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.read += int64(n)
+		if err == nil || err == io.EOF || !b.resumable(err) {
+			return n, err
+		}
+		if rerr := b.resume(); rerr != nil {
+			logs.Warn.Printf("resuming download of %s: %v", redact.URL(b.req.URL), rerr)
+			return n, err
+		}
+		// Return what we got before the error, the next Read continues from the
+		// resumed body.
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close implements io.Closer.
+func (b *resumingBody) Close() error {
+	return b.body.Close()
+}
+
+func (b *resumingBody) resumable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || b.req.Context().Err() != nil {
+		return false
+	}
+	return b.resumes < b.t.backoff.Steps
+}
+
+// resume replaces b.body with a response that continues at byte b.read.
+func (b *resumingBody) resume() error {
+	b.resumes++
+	b.body.Close()
+
+	host := b.req.URL.Host
+	req := b.req.Clone(b.req.Context())
+	supported, known := ranges.supported(host)
+	sendRange := supported || !known
+	if sendRange {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.read))
+	}
+	resp, err := b.t.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-", b.read)) {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected Content-Range %q, want bytes %d-", cr, b.read)
+		}
+		ranges.set(host, true)
+	case http.StatusOK:
+		// The registry doesn't support Range (or we didn't ask), start over but
+		// skip what we've already returned.
+		if sendRange {
+			ranges.set(host, false)
+		}
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, b.read); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	logs.Warn.Printf("resumed download of %s at byte %d", redact.URL(b.req.URL), b.read)
+	b.body = resp.Body
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/internal/retry"
 )
 
@@ -36,6 +37,7 @@ type retryTransport struct {
 	inner     http.RoundTripper
 	backoff   retry.Backoff
 	predicate retry.Predicate
+	clock     clock.Clock
 }
 
 // Option is a functional option for retryTransport.
@@ -44,6 +46,7 @@ type Option func(*options)
 type options struct {
 	backoff   retry.Backoff
 	predicate retry.Predicate
+	clock     clock.Clock
 }
 
 // Backoff is an alias of retry.Backoff to expose this configuration option to consumers of this lib
@@ -63,11 +66,19 @@ func WithRetryPredicate(predicate func(error) bool) Option {
 	}
 }
 
+// withClock sets the clock used to wait between retries, for tests.
+func withClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
 // NewRetry returns a transport that retries errors.
 func NewRetry(inner http.RoundTripper, opts ...Option) http.RoundTripper {
 	o := &options{
 		backoff:   defaultBackoff,
 		predicate: retry.IsTemporary,
+		clock:     clock.Real,
 	}
 
 	for _, opt := range opts {
@@ -78,6 +89,7 @@ func NewRetry(inner http.RoundTripper, opts ...Option) http.RoundTripper {
 		inner:     inner,
 		backoff:   o.backoff,
 		predicate: o.predicate,
+		clock:     o.clock,
 	}
 }
 
@@ -86,6 +98,16 @@ func (t *retryTransport) RoundTrip(in *http.Request) (out *http.Response, err er
 		out, err = t.inner.RoundTrip(in)
 		return err
 	}
-	retry.Retry(roundtrip, t.predicate, t.backoff)
+	c := t.clock
+	if in != nil {
+		if cc := clock.FromContext(in.Context()); cc != nil {
+			c = cc
+		}
+	}
+	retry.RetryWithClock(roundtrip, t.predicate, t.backoff, c)
+	if err == nil && isBlobDownload(in, out) {
+		ranges.observe(in, out)
+		out.Body = &resumingBody{t: t, req: in, body: out.Body}
+	}
 	return
 }
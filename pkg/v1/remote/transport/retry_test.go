@@ -15,13 +15,18 @@
 package transport
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/internal/retry"
 )
 
@@ -81,6 +86,53 @@ func TestRetryTransport(t *testing.T) {
 	}
 }
 
+func TestRetryTransportBackoff(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	mt := mockTransport{
+		errs: []error{temp{}, temp{}, temp{}, temp{}, temp{}},
+	}
+	tr := NewRetry(&mt, withClock(c))
+
+	start := time.Now()
+	if _, err := tr.RoundTrip(nil); err != (temp{}) {
+		t.Errorf("RoundTrip() = %v, want %v", err, temp{})
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("RoundTrip() took %v, want it to use the fake clock", time.Since(start))
+	}
+
+	// The default backoff, give or take its jitter.
+	want := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, 2700 * time.Millisecond}
+	got := c.Sleeps()
+	if len(got) != len(want) {
+		t.Fatalf("slept %v, want about %v", got, want)
+	}
+	for i := range want {
+		if limit := time.Duration(float64(want[i]) * (1 + defaultBackoff.Jitter)); got[i] < want[i] || got[i] > limit {
+			t.Errorf("sleep %d = %v, want between %v and %v", i, got[i], want[i], limit)
+		}
+	}
+}
+
+func TestRetryTransportContextClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	mt := mockTransport{
+		errs: []error{temp{}, perm{}},
+	}
+	// The clock in the request's context wins over the real one.
+	tr := NewRetry(&mt)
+	req, err := http.NewRequestWithContext(clock.NewContext(context.Background(), c), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.RoundTrip(req); err != (perm{}) {
+		t.Errorf("RoundTrip() = %v, want %v", err, perm{})
+	}
+	if got := c.Sleeps(); len(got) != 1 {
+		t.Errorf("slept %v, want one sleep on the fake clock", got)
+	}
+}
+
 func TestRetryDefaults(t *testing.T) {
 	tr := NewRetry(http.DefaultTransport)
 	rt, ok := tr.(*retryTransport)
@@ -130,3 +182,137 @@ func TestTimeoutContext(t *testing.T) {
 		t.Fatalf("deadline was not recognized by transport")
 	}
 }
+
+func TestRetryTransportResumesBlobDownload(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, test := range []struct {
+		name          string
+		supportsRange bool
+		acceptRanges  string
+		wantRanges    []string
+	}{{
+		name:          "range",
+		supportsRange: true,
+		wantRanges:    []string{"", "bytes=5000-"},
+	}, {
+		name:       "no range",
+		wantRanges: []string{"", "bytes=5000-"},
+	}, {
+		name:          "advertised range",
+		supportsRange: true,
+		acceptRanges:  "bytes",
+		wantRanges:    []string{"", "bytes=5000-"},
+	}, {
+		name:         "advertised no range",
+		acceptRanges: "none",
+		wantRanges:   []string{"", ""},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			var ranges []string
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				if len(ranges) == 1 {
+					// Send half the blob, then drop the connection.
+					if test.acceptRanges != "" {
+						w.Header().Set("Accept-Ranges", test.acceptRanges)
+					}
+					w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(blob[:len(blob)/2])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				if !test.supportsRange {
+					r.Header.Del("Range")
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+			}))
+			defer s.Close()
+
+			client := &http.Client{Transport: NewRetry(http.DefaultTransport)}
+			resp, err := client.Get(s.URL + "/v2/foo/blobs/sha256:deadbeef")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			if !bytes.Equal(got, blob) {
+				t.Errorf("got %d bytes, want %d bytes of blob", len(got), len(blob))
+			}
+			if diff := cmp.Diff(test.wantRanges, ranges); diff != "" {
+				t.Errorf("Range headers (-want +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRemembersRangeSupport(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") == "" && len(ranges)%2 == 1 {
+			// Send half the blob, then drop the connection.
+			w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(blob[:len(blob)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		// Silently ignore Range requests.
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		w.Write(blob)
+	}))
+	defer s.Close()
+
+	client := &http.Client{Transport: NewRetry(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(s.URL + "/v2/foo/blobs/sha256:deadbeef")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		}
+		if !bytes.Equal(got, blob) {
+			t.Errorf("got %d bytes, want %d bytes of blob", len(got), len(blob))
+		}
+	}
+
+	// After the first resume is ignored, we shouldn't try Range again.
+	want := []string{"", "bytes=5000-", "", ""}
+	if diff := cmp.Diff(want, ranges); diff != "" {
+		t.Errorf("Range headers (-want +got) = %s", diff)
+	}
+}
+
+func TestRetryTransportDoesNotResumeManifests(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer s.Close()
+
+	client := &http.Client{Transport: NewRetry(http.DefaultTransport)}
+	resp, err := client.Get(s.URL + "/v2/foo/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err == nil {
+		t.Error("ReadAll() = nil, wanted error")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
@@ -49,8 +49,9 @@ func NewWithContext(ctx context.Context, reg name.Registry, auth authn.Authentic
 	//     Perform an initial refresh to seed the bearer token.
 
 	// First we ping the registry to determine the parameters of the authentication handshake
-	// (if one is even necessary).
-	pr, err := ping(ctx, reg, t)
+	// (if one is even necessary). The response is cached per registry and transport, so
+	// repeated operations against the same registry skip the redundant round-trip.
+	pr, cached, invalidate, err := pings.ping(ctx, reg, t)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +61,22 @@ func NewWithContext(ctx context.Context, reg name.Registry, auth authn.Authentic
 		t = NewUserAgent(t, "")
 	}
 
+	rt, err := fromPing(ctx, reg, auth, t, scopes, pr, invalidate)
+	if err != nil && cached {
+		// The registry may have changed how it does auth since we cached the
+		// ping response, so try again with a fresh one.
+		invalidate()
+		pr, _, invalidate, err = pings.ping(ctx, reg, t)
+		if err != nil {
+			return nil, err
+		}
+		return fromPing(ctx, reg, auth, t, scopes, pr, invalidate)
+	}
+	return rt, err
+}
+
+// fromPing sets up the appropriate auth transport for the given ping response.
+func fromPing(ctx context.Context, reg name.Registry, auth authn.Authenticator, t http.RoundTripper, scopes []string, pr *pingResp, invalidate func()) (http.RoundTripper, error) {
 	// Wrap t in a transport that selects the appropriate scheme based on the ping response.
 	t = &schemeTransport{
 		scheme:   pr.scheme,
@@ -69,7 +86,7 @@ func NewWithContext(ctx context.Context, reg name.Registry, auth authn.Authentic
 
 	switch pr.challenge.Canonical() {
 	case anonymous, basic:
-		return &Wrapper{&basicTransport{inner: t, auth: auth, target: reg.RegistryStr()}}, nil
+		return &Wrapper{&basicTransport{inner: t, auth: auth, target: reg.APIHost(), invalidate: invalidate}}, nil
 	case bearer:
 		// We require the realm, which tells us where to send our Basic auth to turn it into Bearer auth.
 		realm, ok := pr.parameters["realm"]
@@ -83,13 +100,14 @@ func NewWithContext(ctx context.Context, reg name.Registry, auth authn.Authentic
 			service = reg.String()
 		}
 		bt := &bearerTransport{
-			inner:    t,
-			basic:    auth,
-			realm:    realm,
-			registry: reg,
-			service:  service,
-			scopes:   scopes,
-			scheme:   pr.scheme,
+			inner:      t,
+			basic:      auth,
+			realm:      realm,
+			registry:   reg,
+			service:    service,
+			scopes:     scopes,
+			scheme:     pr.scheme,
+			invalidate: invalidate,
 		}
 		if err := bt.refresh(ctx); err != nil {
 			return nil, err
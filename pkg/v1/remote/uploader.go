@@ -0,0 +1,169 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
+)
+
+// Uploader uploads blobs to repositories the same way Write does: blobs that
+// already exist are skipped, blobs from a MountableLayer are mounted from
+// their source repository if possible, and uploads are retried and report
+// progress according to the Uploader's options.
+//
+// An Uploader is safe for concurrent use, and reuses its authorized
+// transport for each combination of repository and scopes it has uploaded
+// with.
+type Uploader struct {
+	o *options
+
+	// Shared by all of the writers, so that progress is reported across
+	// every upload.
+	lastUpdate    *v1.Update
+	layerProgress *layerProgress
+
+	mu      sync.Mutex
+	writers map[string]*writer
+	repos   map[string]*repoBlobs
+	closed  sync.Once
+}
+
+// repoBlobs is what an Uploader knows about the blobs in one repository,
+// shared by the writers for that repository whatever their scopes.
+type repoBlobs struct {
+	present   map[v1.Hash]bool
+	emptyJSON *knownBlob
+}
+
+// NewUploader returns an Uploader that uses the given options for every
+// upload.
+//
+// If WithProgress or WithPerLayerProgress are given, the Uploader reports on
+// all of its uploads, with the total growing as blobs are uploaded, and only
+// closes the channels when Close is called.
+//
+// Blobs that are found to exist, or that were uploaded, are only known to
+// exist in that repository, e.g. the empty JSON blob is only checked for, or
+// uploaded, once per repository. Blobs given to WithExistingBlobs are assumed
+// to exist in every repository the Uploader uploads to.
+//
+// As an Uploader can upload to many registries, WithHostHeader can't be used.
+func NewUploader(options ...Option) (*Uploader, error) {
+	o, err := makeOptions(nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newUploader(o), nil
+}
+
+func newUploader(o *options) *Uploader {
+	u := &Uploader{
+		o:             o,
+		layerProgress: newLayerProgress(o.layerProgress),
+		writers:       map[string]*writer{},
+		repos:         map[string]*repoBlobs{},
+	}
+	if o.updates != nil {
+		u.lastUpdate = &v1.Update{}
+	}
+	return u
+}
+
+// UploadBlob uploads l to repo.
+func (u *Uploader) UploadBlob(repo name.Repository, l v1.Layer) error {
+	if u.o.updates != nil {
+		// TODO: support streaming layers which update the total count as they write.
+		if _, ok := l.(*stream.Layer); ok {
+			return errors.New("cannot use stream.Layer and WithProgress")
+		}
+		size, err := l.Size()
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&u.lastUpdate.Total, size)
+	}
+	w, err := u.writer(repo, scopesForUploadingImage(repo, []v1.Layer{l}))
+	if err != nil {
+		return err
+	}
+	return w.uploadOne(u.o.context, l)
+}
+
+// Close closes the channels given to WithProgress and WithPerLayerProgress,
+// once the caller has finished uploading. The Uploader can't be used
+// afterwards.
+func (u *Uploader) Close() error {
+	u.close(nil)
+	return nil
+}
+
+// close sends err, if any, and closes the progress channels.
+func (u *Uploader) close(err error) {
+	u.closed.Do(func() {
+		if u.o.updates != nil {
+			_ = sendError(u.o.updates, err)
+			close(u.o.updates)
+		}
+		u.layerProgress.closeAll(err)
+	})
+}
+
+// writer returns a writer for repo, with a client authorized for scopes.
+func (u *Uploader) writer(repo name.Repository, scopes []string) (*writer, error) {
+	key := repo.String() + " " + strings.Join(scopes, " ")
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if w, ok := u.writers[key]; ok {
+		return w, nil
+	}
+	auth := u.o.auth
+	if u.o.keychain != nil {
+		auth = &keychainAuth{keys: u.o.keychain, target: repo}
+	}
+	tr, err := transport.NewWithContext(u.o.context, repo.Registry, auth, u.o.transport, scopes)
+	if err != nil {
+		return nil, err
+	}
+	w := newWriter(repo, u.o.newClient(tr), u.o)
+	w.uploader = u
+	rb, ok := u.repos[repo.String()]
+	if !ok {
+		rb = &repoBlobs{present: u.o.presentBlobs(), emptyJSON: &knownBlob{}}
+		u.repos[repo.String()] = rb
+	}
+	w.lastUpdate, w.layerProgress = u.lastUpdate, u.layerProgress
+	w.present, w.emptyJSON = rb.present, rb.emptyJSON
+	u.writers[key] = w
+	return w, nil
+}
+
+// imageWriter returns a writer for pushing img to ref, with a transport that
+// has also been scoped to pull any layers we might be able to mount.
+func (u *Uploader) imageWriter(ref name.Reference, img v1.Image) (*writer, error) {
+	ls, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	return u.writer(ref.Context(), scopesForUploadingImage(ref.Context(), ls))
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestUploader(t *testing.T) {
+	var patches int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			atomic.AddInt32(&patches, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/test/uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers := make([]v1.Layer, 5)
+	for i := range layers {
+		if layers[i], err = random.Layer(1024, types.DockerLayer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, err := NewUploader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(layers))
+	for i, l := range layers {
+		i, l := i, l
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = up.UploadBlob(repo, l)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("UploadBlob(layers[%d]) = %v", i, err)
+		}
+	}
+	if got, want := len(up.writers), 1; got != want {
+		t.Errorf("got %d writers, want %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&patches), int32(len(layers)); got != want {
+		t.Errorf("got %d PATCH requests, want %d", got, want)
+	}
+
+	for i, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Layer(repo.Digest(h.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Layer(got); err != nil {
+			t.Errorf("validate.Layer(layers[%d]) = %v", i, err)
+		}
+	}
+
+	// Uploading again skips existing blobs.
+	if err := up.UploadBlob(repo, layers[0]); err != nil {
+		t.Fatalf("UploadBlob() = %v", err)
+	}
+	if got, want := atomic.LoadInt32(&patches), int32(len(layers)); got != want {
+		t.Errorf("got %d PATCH requests after re-upload, want %d", got, want)
+	}
+}
+
+func TestUploaderRepositories(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo, err := name.NewRepository(u.Host + "/test/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar, err := name.NewRepository(u.Host + "/test/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := NewUploader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What the Uploader knows about the empty JSON blob in one repository
+	// mustn't stop it from being uploaded to another.
+	l := static.NewLayer([]byte(empty.JSON), types.OCIEmptyJSON)
+	for _, repo := range []name.Repository{foo, bar, foo} {
+		if err := up.UploadBlob(repo, l); err != nil {
+			t.Fatalf("UploadBlob(%s) = %v", repo, err)
+		}
+	}
+	if got, want := len(up.repos), 2; got != want {
+		t.Errorf("got %d repositories, want %d", got, want)
+	}
+	for _, repo := range []name.Repository{foo, bar} {
+		got, err := Layer(repo.Digest(empty.JSONDigest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := got.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("reading empty JSON from %s: %v", repo, err)
+		} else if string(b) != empty.JSON {
+			t.Errorf("empty JSON in %s = %q, want %q", repo, b, empty.JSON)
+		}
+	}
+}
+
+func TestUploaderProgress(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/test/uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := make(chan v1.Update)
+	done := make(chan v1.Update)
+	go func() {
+		var last v1.Update
+		for update := range updates {
+			last = update
+		}
+		done <- last
+	}()
+
+	up, err := NewUploader(WithProgress(updates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Progress is reported across uploads, and the channel stays open
+	// until the Uploader is closed.
+	var total int64
+	for i := 0; i < 3; i++ {
+		l, err := random.Layer(1024, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := l.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += size
+		if err := up.UploadBlob(repo, l); err != nil {
+			t.Fatalf("UploadBlob() = %v", err)
+		}
+	}
+	if err := up.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if last := <-done; last.Error != nil || last.Complete != total || last.Total != total {
+		t.Errorf("last update = %+v, want %d complete", last, total)
+	}
+
+	if _, err := NewUploader(WithHostHeader("example.com")); err == nil {
+		t.Error("NewUploader(WithHostHeader) = nil, wanted error")
+	}
+}
+
+func TestWithChunkSize(t *testing.T) {
+	var chunks int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			if r.Header.Get("Content-Range") == "" {
+				t.Errorf("PATCH without Content-Range")
+			}
+			if r.ContentLength > 100 {
+				t.Errorf("PATCH of %d bytes, want at most 100", r.ContentLength)
+			}
+			atomic.AddInt32(&chunks, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img, WithChunkSize(100)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if atomic.LoadInt32(&chunks) < 20 {
+		t.Errorf("got %d chunks, want at least 20", chunks)
+	}
+
+	got, err := Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	if err := Write(ref, img, WithChunkSize(0)); err == nil {
+		t.Error("Write(WithChunkSize(0)) = nil, wanted error")
+	}
+}
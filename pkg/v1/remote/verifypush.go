@@ -0,0 +1,153 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// WithVerifyAfterPush causes Write and WriteIndex to check that the registry
+// really has everything that was pushed once they're done, for registries
+// that acknowledge uploads that they then lose. The manifest is fetched back
+// by digest, along with the manifests of any children of an index, and every
+// blob they reference is checked for with a HEAD request. Any missing
+// manifests or blobs are reported in the returned error.
+//
+// This costs a request per manifest and blob, so it's off by default.
+func WithVerifyAfterPush() Option {
+	return func(o *options) error {
+		o.verifyAfterPush = true
+		return nil
+	}
+}
+
+// verifyPush checks that the manifest of t and everything it references exist
+// in w.repo, see WithVerifyAfterPush.
+func (w *writer) verifyPush(ctx context.Context, t Taggable, allowNondistributableArtifacts bool) error {
+	_, desc, err := unpackTaggable(t)
+	if err != nil {
+		return err
+	}
+	h := desc.Digest
+
+	pv := &pushVerifier{
+		w: w,
+		f: fetcher{
+			Ref:     w.repo.Digest(h.String()),
+			Client:  w.client,
+			context: ctx,
+		},
+		allowNondistributableArtifacts: allowNondistributableArtifacts,
+		seen:                           map[v1.Hash]bool{},
+	}
+	if err := pv.manifest(h); err != nil {
+		return fmt.Errorf("verifying push of %s: %w", h, err)
+	}
+	if len(pv.missing) != 0 {
+		return fmt.Errorf("verifying push of %s: registry is missing %s", h, strings.Join(pv.missing, ", "))
+	}
+	return nil
+}
+
+type pushVerifier struct {
+	w                              *writer
+	f                              fetcher
+	allowNondistributableArtifacts bool
+
+	seen    map[v1.Hash]bool
+	missing []string
+}
+
+// manifest fetches the manifest h and checks everything it references.
+func (pv *pushVerifier) manifest(h v1.Hash) error {
+	if pv.seen[h] {
+		return nil
+	}
+	pv.seen[h] = true
+
+	acceptable := append(append([]types.MediaType{}, acceptableImageMediaTypes...), acceptableIndexMediaTypes...)
+	raw, desc, err := pv.f.fetchManifest(pv.w.repo.Digest(h.String()), acceptable)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			pv.missing = append(pv.missing, "manifest "+h.String())
+			return nil
+		}
+		return err
+	}
+
+	switch {
+	case desc.MediaType.IsIndex():
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		for _, child := range index.Manifests {
+			if child.MediaType.IsImage() || child.MediaType.IsIndex() {
+				err = pv.manifest(child.Digest)
+			} else {
+				// Workaround for #819: writeIndex pushes these as blobs.
+				err = pv.blob(child)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		m, err := v1.ParseManifest(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		if err := pv.blob(m.Config); err != nil {
+			return err
+		}
+		for _, l := range m.Layers {
+			if err := pv.blob(l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blob checks that the blob desc exists, unless it's one that we wouldn't
+// have pushed.
+func (pv *pushVerifier) blob(desc v1.Descriptor) error {
+	if !desc.MediaType.IsDistributable() && !pv.allowNondistributableArtifacts {
+		return nil
+	}
+	if pv.seen[desc.Digest] {
+		return nil
+	}
+	pv.seen[desc.Digest] = true
+
+	existing, err := pv.w.checkExistingBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if !existing {
+		pv.missing = append(pv.missing, "blob "+desc.Digest.String())
+	}
+	return nil
+}
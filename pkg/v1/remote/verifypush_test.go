@@ -0,0 +1,131 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// forgetfulRegistry acknowledges the upload of the forgotten blob, and then
+// pretends that it doesn't exist.
+type forgetfulRegistry struct {
+	sync.Mutex
+	handler  http.Handler
+	forget   string
+	uploaded bool
+}
+
+func (f *forgetfulRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	gone := f.uploaded && f.forget != ""
+	f.Unlock()
+	if gone && strings.HasSuffix(r.URL.Path, "/blobs/"+f.forget) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.handler.ServeHTTP(w, r)
+	if r.Method == http.MethodPut && r.URL.Query().Get("digest") == f.forget {
+		f.Lock()
+		f.uploaded = true
+		f.Unlock()
+	}
+}
+
+func TestWithVerifyAfterPush(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := layers[1].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+
+	for _, tc := range []struct {
+		name   string
+		forget v1.Hash
+		write  func(host string, opts ...Option) error
+	}{{
+		name: "image",
+		write: func(host string, opts ...Option) error {
+			return Write(mustNewTag(t, host+"/repo:tag"), img, opts...)
+		},
+	}, {
+		name:   "image missing blob",
+		forget: lost,
+		write: func(host string, opts ...Option) error {
+			return Write(mustNewTag(t, host+"/repo:tag"), img, opts...)
+		},
+	}, {
+		name: "index",
+		write: func(host string, opts ...Option) error {
+			return WriteIndex(mustNewTag(t, host+"/repo:tag"), idx, opts...)
+		},
+	}, {
+		name:   "index missing blob",
+		forget: lost,
+		write: func(host string, opts ...Option) error {
+			return WriteIndex(mustNewTag(t, host+"/repo:tag"), idx, opts...)
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := &forgetfulRegistry{handler: registry.New()}
+			if tc.forget != (v1.Hash{}) {
+				reg.forget = tc.forget.String()
+			}
+			s := httptest.NewServer(reg)
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Without verification, the push looks like it succeeded.
+			if err := tc.write(u.Host); err != nil {
+				t.Fatalf("write() = %v", err)
+			}
+
+			err = tc.write(u.Host, WithVerifyAfterPush())
+			if tc.forget == (v1.Hash{}) {
+				if err != nil {
+					t.Errorf("write(WithVerifyAfterPush()) = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("write(WithVerifyAfterPush()) = nil, want error")
+			}
+			if !strings.Contains(err.Error(), "blob "+tc.forget.String()) {
+				t.Errorf("write(WithVerifyAfterPush()) = %v, want it to report %s", err, tc.forget)
+			}
+		})
+	}
+}
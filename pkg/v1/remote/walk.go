@@ -0,0 +1,100 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"golang.org/x/sync/errgroup"
+)
+
+// WalkRepositoriesFunc is called by WalkRepositories with the tags of each
+// repository it visits.
+type WalkRepositoriesFunc func(repo name.Repository, tags []string) error
+
+// WalkRepositories uses the catalog API to find every repository in the
+// registry that is equal to or nested under prefix, lists the tags of each of
+// them, and calls fn with the results. An empty prefix matches every
+// repository.
+//
+// Tags are listed concurrently, up to the number of jobs set by WithJobs, but
+// calls to fn are serialized. Walking stops at the first error returned by fn
+// or encountered while listing a repository's tags.
+func WalkRepositories(target name.Registry, prefix string, fn WalkRepositoriesFunc, options ...Option) error {
+	o, err := makeOptions(target, options...)
+	if err != nil {
+		return err
+	}
+
+	repos, err := Catalog(o.context, target, options...)
+	if err != nil {
+		return fmt.Errorf("listing repositories: %w", err)
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	matched := []name.Repository{}
+	for _, r := range repos {
+		if prefix != "" && r != prefix && !strings.HasPrefix(r, prefix+"/") {
+			continue
+		}
+		repo, err := name.NewRepository(target.Name() + "/" + r)
+		if err != nil {
+			return err
+		}
+		// Preserve any options (e.g. name.Insecure) of the target registry.
+		repo.Registry = target
+		matched = append(matched, repo)
+	}
+
+	var mu sync.Mutex
+	repoChan := make(chan name.Repository, 2*o.jobs)
+	g, gctx := errgroup.WithContext(o.context)
+	// Cap the slice so that concurrent appends can't share its backing array.
+	opts := append(options[:len(options):len(options)], WithContext(gctx))
+	for i := 0; i < o.jobs; i++ {
+		// Start N workers listing tags.
+		g.Go(func() error {
+			for repo := range repoChan {
+				tags, err := List(repo, opts...)
+				if err != nil {
+					return fmt.Errorf("listing tags for %s: %w", repo, err)
+				}
+
+				mu.Lock()
+				err = fn(repo, tags)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(repoChan)
+		for _, repo := range matched {
+			select {
+			case repoChan <- repo:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	return g.Wait()
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestWalkRepositories(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{
+		"foo:a",
+		"foo:b",
+		"foo/bar:c",
+		"foo/bar/baz:d",
+		"foobar:e",
+		"other:f",
+	} {
+		if err := Write(mustNewTag(t, u.Host+"/"+ref), img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg, err := name.NewRegistry(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	if err := WalkRepositories(reg, "foo/", func(repo name.Repository, tags []string) error {
+		sort.Strings(tags)
+		got[repo.RepositoryStr()] = tags
+		return nil
+	}, WithJobs(2)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"foo":         {"a", "b"},
+		"foo/bar":     {"c"},
+		"foo/bar/baz": {"d"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WalkRepositories (-want +got) = %s", diff)
+	}
+
+	all := 0
+	if err := WalkRepositories(reg, "", func(name.Repository, []string) error {
+		all++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if all != 5 {
+		t.Errorf("WalkRepositories(\"\"): visited %d repos, want %d", all, 5)
+	}
+
+	errStop := errors.New("stop")
+	if err := WalkRepositories(reg, "", func(name.Repository, []string) error {
+		return errStop
+	}); !errors.Is(err, errStop) {
+		t.Errorf("WalkRepositories: got %v, want %v", err, errStop)
+	}
+}
+
+func TestWalkRepositoriesPaginated(t *testing.T) {
+	reg := registry.New()
+	pages := [][]string{
+		{"foo", "foo/bar"},
+		{"foobar", "foo/baz"},
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			reg.ServeHTTP(w, r)
+			return
+		}
+		page := 0
+		if r.URL.Query().Get("last") != "" {
+			page = 1
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?n=2&last=%s>; rel="next"`, pages[0][1]))
+		}
+		json.NewEncoder(w).Encode(struct {
+			Repos []string `json:"repositories"`
+		}{pages[page]})
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"foo:a", "foo/bar:b", "foobar:c", "foo/baz:d"} {
+		if err := Write(mustNewTag(t, u.Host+"/"+ref), img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target, err := name.NewRegistry(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	if err := WalkRepositories(target, "foo", func(repo name.Repository, tags []string) error {
+		got[repo.RepositoryStr()] = tags
+		return nil
+	}, WithPageSize(2), WithJobs(2)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"foo":     {"a"},
+		"foo/bar": {"b"},
+		"foo/baz": {"d"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WalkRepositories (-want +got) = %s", diff)
+	}
+}
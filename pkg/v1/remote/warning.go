@@ -0,0 +1,123 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// WarningHandler is called with the text of each Warning header returned by
+// the registry in response to a manifest or blob request.
+type WarningHandler func(ref name.Reference, warning string)
+
+// warningTransport wraps a RoundTripper and passes any Warning headers in the
+// responses for manifests and blobs to a WarningHandler.
+type warningTransport struct {
+	inner   http.RoundTripper
+	handler WarningHandler
+}
+
+var _ http.RoundTripper = (*warningTransport)(nil)
+
+// Unwrap returns the inner RoundTripper, so that the transport package can
+// cache ping responses for it.
+func (t *warningTransport) Unwrap() http.RoundTripper {
+	return t.inner
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *warningTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(in)
+	if err != nil {
+		return resp, err
+	}
+	warnings := resp.Header.Values("Warning")
+	if len(warnings) == 0 {
+		return resp, nil
+	}
+	ref, ok := refFromURL(in)
+	if !ok {
+		return resp, nil
+	}
+	for _, w := range warnings {
+		t.handler(ref, warningText(w))
+	}
+	return resp, nil
+}
+
+// refFromURL reconstructs the reference being requested from the path of a
+// manifest or blob request, e.g. /v2/<repo>/manifests/<tag or digest>.
+func refFromURL(in *http.Request) (name.Reference, bool) {
+	p := strings.TrimPrefix(in.URL.Path, "/v2/")
+	if p == in.URL.Path {
+		return nil, false
+	}
+	if i := strings.LastIndex(p, "/manifests/"); i != -1 {
+		repo, id := p[:i], p[i+len("/manifests/"):]
+		var (
+			ref name.Reference
+			err error
+		)
+		if strings.Contains(id, ":") {
+			ref, err = name.NewDigest(in.URL.Host + "/" + repo + "@" + id)
+		} else {
+			ref, err = name.NewTag(in.URL.Host + "/" + repo + ":" + id)
+		}
+		return ref, err == nil
+	}
+	if i := strings.LastIndex(p, "/blobs/"); i != -1 {
+		ref, err := name.NewDigest(in.URL.Host + "/" + p[:i] + "@" + p[i+len("/blobs/"):])
+		return ref, err == nil
+	}
+	return nil, false
+}
+
+// warningText extracts the warn-text from a Warning header of the form:
+//
+//	warn-code SP warn-agent SP warn-text [ SP warn-date ]
+//
+// See https://tools.ietf.org/html/rfc7234#section-5.5
+//
+// If the header isn't well-formed, it is returned as-is.
+func warningText(h string) string {
+	parts := strings.SplitN(h, " ", 3)
+	if len(parts) != 3 || len(parts[0]) != 3 {
+		return h
+	}
+	if _, err := strconv.Atoi(parts[0]); err != nil {
+		return h
+	}
+	text := parts[2]
+	if !strings.HasPrefix(text, `"`) {
+		return h
+	}
+	// Find the closing quote, skipping any escaped characters.
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			if s, err := strconv.Unquote(text[:i+1]); err == nil {
+				return s
+			}
+			return text[1:i]
+		}
+	}
+	return h
+}
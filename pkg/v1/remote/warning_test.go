@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestWarningHandler(t *testing.T) {
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodGet {
+			w.Header().Add("Warning", `299 - "this image is deprecated"`)
+			w.Header().Add("Warning", `299 - "use example.com/new instead" "Sat, 25 Aug 2012 23:34:45 GMT"`)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustNewTag(t, u.Host+"/repo:latest")
+	if err := Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	handler := func(ref name.Reference, warning string) {
+		if ref.String() != tag.String() {
+			t.Errorf("ref: got %v, want %v", ref, tag)
+		}
+		got = append(got, warning)
+	}
+	if _, err := Get(tag, WithWarningHandler(handler)); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	want := []string{"this image is deprecated", "use example.com/new instead"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("warnings (-want +got) = %s", diff)
+	}
+}
+
+func TestWarningText(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   string
+	}{{
+		header: `299 - "deprecated"`,
+		want:   "deprecated",
+	}, {
+		header: `299 registry.example.com:443 "escaped \"quotes\"" "Sat, 25 Aug 2012 23:34:45 GMT"`,
+		want:   `escaped "quotes"`,
+	}, {
+		header: `not a warning`,
+		want:   `not a warning`,
+	}, {
+		header: `299 - unquoted`,
+		want:   `299 - unquoted`,
+	}} {
+		if got := warningText(tc.header); got != tc.want {
+			t.Errorf("warningText(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
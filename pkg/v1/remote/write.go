@@ -20,16 +20,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/internal/redact"
 	"github.com/google/go-containerregistry/internal/retry"
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
@@ -48,39 +52,68 @@ func Write(ref name.Reference, img v1.Image, options ...Option) (rerr error) {
 	if err != nil {
 		return err
 	}
-
-	var lastUpdate *v1.Update
+	if o.inlineThreshold > 0 {
+		if _, ok := asDigest(ref); ok {
+			return fmt.Errorf("cannot inline data when writing to digest reference %s", ref)
+		}
+		if img, err = newInlinedImage(img, o.inlineThreshold); err != nil {
+			return err
+		}
+	}
+	if o.manifestMediaType != "" {
+		if err := checkOverrideRef(ref); err != nil {
+			return err
+		}
+		if img, err = newOverriddenImage(img, o.manifestMediaType); err != nil {
+			return err
+		}
+	}
+	u := newUploader(o)
+	defer func() { u.close(rerr) }()
+	w, err := u.imageWriter(ref, img)
+	if err != nil {
+		return err
+	}
+	if err := w.checkManifestBlobs(img, o.remoteBlobCheck); err != nil {
+		return fmt.Errorf("writing %s: %w", ref, err)
+	}
 	if o.updates != nil {
-		lastUpdate = &v1.Update{}
-		lastUpdate.Total, err = countImage(img, o.allowNondistributableArtifacts)
+		w.lastUpdate.Total, err = w.countImage(img, o.allowNondistributableArtifacts)
 		if err != nil {
 			return err
 		}
-		defer close(o.updates)
-		defer func() { _ = sendError(o.updates, rerr) }()
 	}
-	return writeImage(o.context, ref, img, o, lastUpdate)
+	if err := w.writeImage(o.context, ref, img, o); err != nil {
+		return err
+	}
+	if o.verifyAfterPush {
+		return w.verifyPush(o.context, img, o.allowNondistributableArtifacts)
+	}
+	return nil
 }
 
-func writeImage(ctx context.Context, ref name.Reference, img v1.Image, o *options, lastUpdate *v1.Update) error {
-	ls, err := img.Layers()
-	if err != nil {
-		return err
+// newWriter returns a writer for pushing to repo with client, which must be
+// authorized for the necessary scopes.
+func newWriter(repo name.Repository, client *http.Client, o *options) *writer {
+	return &writer{
+		repo:           repo,
+		client:         client,
+		context:        o.context,
+		updates:        o.updates,
+		backoff:        o.retryBackoff,
+		predicate:      o.retryPredicate,
+		expectedDigest: o.expectedDigest,
+		chunkSize:      o.chunkSize,
+		emptyJSON:      &knownBlob{},
+		clock:          o.clock,
 	}
-	scopes := scopesForUploadingImage(ref.Context(), ls)
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+}
+
+func (w *writer) writeImage(ctx context.Context, ref name.Reference, img v1.Image, o *options) error {
+	ls, err := img.Layers()
 	if err != nil {
 		return err
 	}
-	w := writer{
-		repo:       ref.Context(),
-		client:     &http.Client{Transport: tr},
-		context:    ctx,
-		updates:    o.updates,
-		lastUpdate: lastUpdate,
-		backoff:    o.retryBackoff,
-		predicate:  o.retryPredicate,
-	}
 
 	// Upload individual blobs and collect any errors.
 	blobChan := make(chan v1.Layer, 2*o.jobs)
@@ -174,10 +207,48 @@ type writer struct {
 	client  *http.Client
 	context context.Context
 
+	// uploader made this writer, and makes the writers for the images of an
+	// index. It's nil for writers made by MultiWrite.
+	uploader *Uploader
+
 	updates    chan<- v1.Update
 	lastUpdate *v1.Update
 	backoff    Backoff
 	predicate  retry.Predicate
+
+	// layerProgress hands out the per-layer progress channels, if
+	// WithPerLayerProgress is used.
+	layerProgress *layerProgress
+
+	// present holds the blobs that were found to already exist in the
+	// repository when computing lastUpdate.Total, or that were given to
+	// WithExistingBlobs. These are excluded from progress updates entirely. It
+	// is only written to before uploading.
+	present map[v1.Hash]bool
+
+	// expectedDigest, if set, is the digest that a tag must point at for us
+	// to overwrite it. See WithExpectedDigest.
+	expectedDigest *v1.Hash
+
+	// chunkSize, if positive, is the maximum size of each PATCH request when
+	// uploading blobs. See WithChunkSize.
+	chunkSize int64
+
+	// emptyJSON tracks whether the empty JSON blob, which OCI artifacts share
+	// as their config, is known to exist in the repository, so that writing
+	// many artifacts only checks for or uploads it once. It's shared by the
+	// Uploader's writers for the repository, so it only lasts as long as the
+	// Uploader does: for Write and WriteIndex, that's a single call.
+	emptyJSON *knownBlob
+
+	// clock is used to wait between retries; the real clock if nil.
+	clock clock.Clock
+}
+
+// knownBlob records whether a blob is known to exist in a repository.
+type knownBlob struct {
+	sync.Mutex
+	present bool
 }
 
 func sendError(ch chan<- v1.Update, err error) error {
@@ -191,16 +262,30 @@ func sendError(ch chan<- v1.Update, err error) error {
 func (w *writer) url(path string) url.URL {
 	return url.URL{
 		Scheme: w.repo.Registry.Scheme(),
-		Host:   w.repo.RegistryStr(),
+		Host:   w.repo.Registry.APIHost(),
 		Path:   path,
 	}
 }
 
 // nextLocation extracts the fully-qualified URL to which we should send the next request in an upload sequence.
-func (w *writer) nextLocation(resp *http.Response) (string, error) {
+//
+// Registries may return a Location relative to the request, which we resolve,
+// and some expect the query parameters of the upload session (e.g. state or
+// signatures) to be sent back even if their next Location leaves them out.
+// If carry is set, any parameters of the request that resp answers which the
+// Location doesn't set are carried forward. It isn't set for the initial POST,
+// whose parameters (e.g. mount) don't belong to the session.
+//
+// If the Location header is missing, we fall back to the session named by the
+// Docker-Upload-UUID header.
+func (w *writer) nextLocation(resp *http.Response, carry bool) (string, error) {
 	loc := resp.Header.Get("Location")
 	if len(loc) == 0 {
-		return "", errors.New("missing Location header")
+		uuid := resp.Header.Get("Docker-Upload-UUID")
+		if uuid == "" {
+			return "", errors.New("missing Location header")
+		}
+		loc = fmt.Sprintf("/v2/%s/blobs/uploads/%s", w.repo.RepositoryStr(), url.PathEscape(uuid))
 	}
 	u, err := url.Parse(loc)
 	if err != nil {
@@ -209,7 +294,20 @@ func (w *writer) nextLocation(resp *http.Response) (string, error) {
 
 	// If the location header returned is just a url path, then fully qualify it.
 	// We cannot simply call w.url, since there might be an embedded query string.
-	return resp.Request.URL.ResolveReference(u).String(), nil
+	next := resp.Request.URL.ResolveReference(u)
+	if carry {
+		q, carried := next.Query(), false
+		for k, v := range resp.Request.URL.Query() {
+			if _, ok := q[k]; !ok {
+				q[k], carried = v, true
+			}
+		}
+		// Leave the query alone otherwise, in case it's signed.
+		if carried {
+			next.RawQuery = q.Encode()
+		}
+	}
+	return next.String(), nil
 }
 
 // checkExistingBlob checks if a blob exists already in the repository by making a
@@ -300,7 +398,7 @@ func (w *writer) initiateUpload(from, mount string) (location string, mounted bo
 		return "", true, nil
 	case http.StatusAccepted:
 		// Proceed to PATCH, upload has begun.
-		loc, err := w.nextLocation(resp)
+		loc, err := w.nextLocation(resp, false)
 		return loc, false, err
 	default:
 		panic("Unreachable: initiateUpload")
@@ -323,7 +421,7 @@ func (r *progressReader) Read(b []byte) (int, error) {
 	atomic.AddInt64(r.count, int64(n))
 	// TODO: warn/debug log if sending takes too long, or if sending is blocked while context is cancelled.
 	r.updates <- v1.Update{
-		Total:    r.lastUpdate.Total,
+		Total:    atomic.LoadInt64(&r.lastUpdate.Total),
 		Complete: atomic.AddInt64(&r.lastUpdate.Complete, int64(n)),
 	}
 	return n, nil
@@ -331,23 +429,34 @@ func (r *progressReader) Read(b []byte) (int, error) {
 
 func (r *progressReader) Close() error { return r.rc.Close() }
 
+// trackProgress wraps blob to report the bytes read from it, if WithProgress
+// is used. The returned reset func takes them back, for when an upload fails.
+func (w *writer) trackProgress(blob io.ReadCloser) (io.ReadCloser, func()) {
+	if w.updates == nil {
+		return blob, func() {}
+	}
+	var count int64
+	return &progressReader{rc: blob, updates: w.updates, lastUpdate: w.lastUpdate, count: &count}, func() {
+		w.updates <- v1.Update{
+			Total:    atomic.LoadInt64(&w.lastUpdate.Total),
+			Complete: atomic.AddInt64(&w.lastUpdate.Complete, -count),
+		}
+	}
+}
+
 // streamBlob streams the contents of the blob to the specified location.
 // On failure, this will return an error.  On success, this will return the location
 // header indicating how to commit the streamed blob.
 func (w *writer) streamBlob(ctx context.Context, blob io.ReadCloser, streamLocation string) (commitLocation string, rerr error) {
-	reset := func() {}
+	blob, reset := w.trackProgress(blob)
 	defer func() {
 		if rerr != nil {
 			reset()
 		}
 	}()
-	if w.updates != nil {
-		var count int64
-		blob = &progressReader{rc: blob, updates: w.updates, lastUpdate: w.lastUpdate, count: &count}
-		reset = func() {
-			atomic.AddInt64(&w.lastUpdate.Complete, -count)
-			w.updates <- *w.lastUpdate
-		}
+
+	if w.chunkSize > 0 {
+		return w.streamChunks(ctx, blob, streamLocation)
 	}
 
 	req, err := http.NewRequest(http.MethodPatch, streamLocation, blob)
@@ -368,12 +477,73 @@ func (w *writer) streamBlob(ctx context.Context, blob io.ReadCloser, streamLocat
 
 	// The blob has been uploaded, return the location header indicating
 	// how to commit this layer.
-	return w.nextLocation(resp)
+	return w.nextLocation(resp, true)
+}
+
+// streamChunks uploads the blob in a series of PATCH requests of at most
+// w.chunkSize bytes each, returning the location to commit the blob to.
+func (w *writer) streamChunks(ctx context.Context, blob io.ReadCloser, location string) (string, error) {
+	defer blob.Close()
+	buf := make([]byte, w.chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(blob, buf)
+		if err == io.EOF {
+			// Nothing left to upload.
+			return location, nil
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		last := err == io.ErrUnexpectedEOF
+
+		req, err := http.NewRequest(http.MethodPatch, location, bytes.NewReader(buf[:n]))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(n)-1))
+
+		resp, err := w.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		if err := transport.CheckError(resp, http.StatusNoContent, http.StatusAccepted, http.StatusCreated); err != nil {
+			resp.Body.Close()
+			return "", err
+		}
+		location, err = w.nextLocation(resp, true)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		offset += int64(n)
+		if last {
+			return location, nil
+		}
+	}
 }
 
 // commitBlob commits this blob by sending a PUT to the location returned from
 // streaming the blob.
 func (w *writer) commitBlob(location, digest string) error {
+	return w.putBlob(w.context, location, digest, nil, 0)
+}
+
+// uploadMonolithic uploads the whole blob in the PUT that commits it, for
+// registries that don't support streaming it with PATCH first.
+func (w *writer) uploadMonolithic(ctx context.Context, blob io.ReadCloser, size int64, location, digest string) (rerr error) {
+	blob, reset := w.trackProgress(blob)
+	defer func() {
+		if rerr != nil {
+			reset()
+		}
+	}()
+	return w.putBlob(ctx, location, digest, blob, size)
+}
+
+// putBlob sends the PUT that completes an upload, with the rest of the blob,
+// if any, in body.
+func (w *writer) putBlob(ctx context.Context, location, digest string, body io.ReadCloser, size int64) error {
 	u, err := url.Parse(location)
 	if err != nil {
 		return err
@@ -382,13 +552,19 @@ func (w *writer) commitBlob(location, digest string) error {
 	v.Set("digest", digest)
 	u.RawQuery = v.Encode()
 
-	req, err := http.NewRequest(http.MethodPut, u.String(), nil)
+	var req *http.Request
+	if body != nil {
+		req, err = http.NewRequest(http.MethodPut, u.String(), body)
+		req.ContentLength = size
+	} else {
+		req, err = http.NewRequest(http.MethodPut, u.String(), nil)
+	}
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
 
-	resp, err := w.client.Do(req.WithContext(w.context))
+	resp, err := w.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -397,21 +573,65 @@ func (w *writer) commitBlob(location, digest string) error {
 	return transport.CheckError(resp, http.StatusCreated)
 }
 
+// patchUnsupported returns whether err means that the registry doesn't
+// support uploading blobs with PATCH.
+func patchUnsupported(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.Request != nil && terr.Request.Method == http.MethodPatch &&
+		(terr.StatusCode == http.StatusMethodNotAllowed || terr.StatusCode == http.StatusNotImplemented)
+}
+
 // incrProgress increments and sends a progress update, if WithProgress is used.
 func (w *writer) incrProgress(written int64) {
 	if w.updates == nil {
 		return
 	}
 	w.updates <- v1.Update{
-		Total:    w.lastUpdate.Total,
+		Total:    atomic.LoadInt64(&w.lastUpdate.Total),
 		Complete: atomic.AddInt64(&w.lastUpdate.Complete, written),
 	}
 }
 
 // uploadOne performs a complete upload of a single layer.
-func (w *writer) uploadOne(ctx context.Context, l v1.Layer) error {
+func (w *writer) uploadOne(ctx context.Context, l v1.Layer) (rerr error) {
 	var from, mount string
+	var lu *layerUpdates
 	if h, err := l.Digest(); err == nil {
+		if w.layerProgress != nil {
+			size, err := l.Size()
+			if err != nil {
+				return err
+			}
+			lu = w.layerProgress.start(h, size)
+			defer func() { lu.finish(rerr) }()
+		}
+
+		// We already know this blob exists and didn't count it towards the
+		// total, so skip it without reporting progress.
+		if w.present[h] {
+			lu.skip()
+			logs.Progress.Printf("existing blob: %v", h)
+			return nil
+		}
+
+		// Every artifact that uses the empty JSON blob would otherwise check
+		// for it (and maybe upload it) on its own, so only do that once.
+		if h == empty.JSONHash && w.emptyJSON != nil {
+			w.emptyJSON.Lock()
+			defer w.emptyJSON.Unlock()
+			if w.emptyJSON.present {
+				w.incrProgress(int64(len(empty.JSON)))
+				lu.skip()
+				logs.Progress.Printf("existing blob: %v", h)
+				return nil
+			}
+			defer func() {
+				if rerr == nil {
+					w.emptyJSON.present = true
+				}
+			}()
+		}
+
 		// If we know the digest, this isn't a streaming layer. Do an existence
 		// check so we can skip uploading the layer if possible.
 		existing, err := w.checkExistingBlob(h)
@@ -424,6 +644,7 @@ func (w *writer) uploadOne(ctx context.Context, l v1.Layer) error {
 				return err
 			}
 			w.incrProgress(size)
+			lu.skip()
 			logs.Progress.Printf("existing blob: %v", h)
 			return nil
 		}
@@ -446,6 +667,7 @@ func (w *writer) uploadOne(ctx context.Context, l v1.Layer) error {
 				return err
 			}
 			w.incrProgress(size)
+			lu.skip()
 			h, err := l.Digest()
 			if err != nil {
 				return err
@@ -465,14 +687,38 @@ func (w *writer) uploadOne(ctx context.Context, l v1.Layer) error {
 			ctx = redact.NewContext(ctx, "omitting binary blobs from logs")
 		}
 
-		blob, err := l.Compressed()
+		open := func() (io.ReadCloser, error) {
+			if mount == empty.JSONDigest {
+				// We know what's in it, so there's no need to read it from l,
+				// which may well be another registry.
+				return ioutil.NopCloser(strings.NewReader(empty.JSON)), nil
+			}
+			return l.Compressed()
+		}
+		blob, err := open()
 		if err != nil {
 			return err
 		}
-		location, err = w.streamBlob(ctx, blob, location)
-		if err != nil {
+		commitLocation, err := w.streamBlob(ctx, lu.wrap(blob), location)
+		if patchUnsupported(err) && mount != "" {
+			// Fall back to a monolithic upload, which needs the digest up
+			// front, so streaming layers can't use it.
+			size, err := l.Size()
+			if err != nil {
+				return err
+			}
+			if blob, err = open(); err != nil {
+				return err
+			}
+			if err := w.uploadMonolithic(ctx, lu.wrap(blob), size, location, mount); err != nil {
+				return err
+			}
+			logs.Progress.Printf("pushed blob: %s", mount)
+			return nil
+		} else if err != nil {
 			return err
 		}
+		location = commitLocation
 
 		h, err := l.Digest()
 		if err != nil {
@@ -487,34 +733,32 @@ func (w *writer) uploadOne(ctx context.Context, l v1.Layer) error {
 		return nil
 	}
 
-	return retry.Retry(tryUpload, w.predicate, w.backoff)
+	return retry.RetryWithClock(tryUpload, w.predicate, w.backoff, w.clock)
 }
 
 type withLayer interface {
 	Layer(v1.Hash) (v1.Layer, error)
 }
 
-func (w *writer) writeIndex(ctx context.Context, ref name.Reference, ii v1.ImageIndex, options ...Option) error {
+func (w *writer) writeIndex(ctx context.Context, ref name.Reference, ii v1.ImageIndex) error {
 	index, err := ii.IndexManifest()
 	if err != nil {
 		return err
 	}
-
-	o, err := makeOptions(ref.Context(), options...)
-	if err != nil {
-		return err
-	}
+	o := w.uploader.o
 
 	// TODO(#803): Pipe through remote.WithJobs and upload these in parallel.
 	for _, desc := range index.Manifests {
 		ref := ref.Context().Digest(desc.Digest.String())
-		exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
-		if err != nil {
-			return err
-		}
-		if exists {
-			logs.Progress.Print("existing manifest: ", desc.Digest)
-			continue
+		if !o.force {
+			exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
+			if err != nil {
+				return err
+			}
+			if exists {
+				logs.Progress.Print("existing manifest: ", desc.Digest)
+				continue
+			}
 		}
 
 		switch desc.MediaType {
@@ -523,7 +767,7 @@ func (w *writer) writeIndex(ctx context.Context, ref name.Reference, ii v1.Image
 			if err != nil {
 				return err
 			}
-			if err := w.writeIndex(ctx, ref, ii, options...); err != nil {
+			if err := w.writeIndex(ctx, ref, ii); err != nil {
 				return err
 			}
 		case types.OCIManifestSchema1, types.DockerManifestSchema2:
@@ -531,7 +775,11 @@ func (w *writer) writeIndex(ctx context.Context, ref name.Reference, ii v1.Image
 			if err != nil {
 				return err
 			}
-			if err := writeImage(ctx, ref, img, o, w.lastUpdate); err != nil {
+			iw, err := w.uploader.imageWriter(ref, img)
+			if err != nil {
+				return err
+			}
+			if err := iw.writeImage(ctx, ref, img, o); err != nil {
 				return err
 			}
 		default:
@@ -557,6 +805,10 @@ type withMediaType interface {
 	MediaType() (types.MediaType, error)
 }
 
+type withDigest interface {
+	Digest() (v1.Hash, error)
+}
+
 // This is really silly, but go interfaces don't let me satisfy remote.Taggable
 // with remote.Descriptor because of name collisions between method names and
 // struct fields.
@@ -583,7 +835,17 @@ func unpackTaggable(t Taggable) ([]byte, *v1.Descriptor, error) {
 		mt = m
 	}
 
-	h, sz, err := v1.SHA256(bytes.NewReader(b))
+	// Use the same algorithm as the Taggable's own digest, if it has one, since
+	// it may not be sha256.
+	algorithm := "sha256"
+	if wd, ok := t.(withDigest); ok {
+		d, err := wd.Digest()
+		if err != nil {
+			return nil, nil, err
+		}
+		algorithm = d.Algorithm
+	}
+	h, sz, err := v1.ComputeHash(algorithm, bytes.NewReader(b))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -597,6 +859,13 @@ func unpackTaggable(t Taggable) ([]byte, *v1.Descriptor, error) {
 
 // commitManifest does a PUT of the image's manifest.
 func (w *writer) commitManifest(ctx context.Context, t Taggable, ref name.Reference) error {
+	conditional := w.conditional(ref)
+	if conditional {
+		if err := w.checkExpectedDigest(ctx, ref); err != nil {
+			return err
+		}
+	}
+
 	tryUpload := func() error {
 		raw, desc, err := unpackTaggable(t)
 		if err != nil {
@@ -611,6 +880,9 @@ func (w *writer) commitManifest(ctx context.Context, t Taggable, ref name.Refere
 			return err
 		}
 		req.Header.Set("Content-Type", string(desc.MediaType))
+		if conditional {
+			req.Header.Set("If-Match", fmt.Sprintf("%q", w.expectedDigest.String()))
+		}
 
 		resp, err := w.client.Do(req.WithContext(ctx))
 		if err != nil {
@@ -618,6 +890,10 @@ func (w *writer) commitManifest(ctx context.Context, t Taggable, ref name.Refere
 		}
 		defer resp.Body.Close()
 
+		if conditional && resp.StatusCode == http.StatusPreconditionFailed {
+			return &ConflictError{Ref: ref, Expected: *w.expectedDigest}
+		}
+
 		if err := transport.CheckError(resp, http.StatusOK, http.StatusCreated, http.StatusAccepted); err != nil {
 			return err
 		}
@@ -628,7 +904,7 @@ func (w *writer) commitManifest(ctx context.Context, t Taggable, ref name.Refere
 		return nil
 	}
 
-	return retry.Retry(tryUpload, w.predicate, w.backoff)
+	return retry.RetryWithClock(tryUpload, w.predicate, w.backoff, w.clock)
 }
 
 func scopesForUploadingImage(repo name.Repository, layers []v1.Layer) []string {
@@ -659,42 +935,54 @@ func scopesForUploadingImage(repo name.Repository, layers []v1.Layer) []string {
 // WriteIndex pushes the provided ImageIndex to the specified image reference.
 // WriteIndex will attempt to push all of the referenced manifests before
 // attempting to push the ImageIndex, to retain referential integrity.
+//
+// However many of the manifests are artifacts that use the empty JSON blob as
+// their config, it's only checked for, or uploaded, once. That doesn't carry
+// over to later calls; each one checks for the blob again.
 func WriteIndex(ref name.Reference, ii v1.ImageIndex, options ...Option) (rerr error) {
 	o, err := makeOptions(ref.Context(), options...)
 	if err != nil {
 		return err
 	}
+	if o.manifestMediaType != "" {
+		if err := checkOverrideRef(ref); err != nil {
+			return err
+		}
+		if ii, err = newOverriddenIndex(ii, o.manifestMediaType); err != nil {
+			return err
+		}
+	}
 
-	scopes := []string{ref.Scope(transport.PushScope)}
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+	u := newUploader(o)
+	defer func() { u.close(rerr) }()
+	w, err := u.writer(ref.Context(), []string{ref.Scope(transport.PushScope)})
 	if err != nil {
 		return err
 	}
-	w := writer{
-		repo:      ref.Context(),
-		client:    &http.Client{Transport: tr},
-		context:   o.context,
-		updates:   o.updates,
-		backoff:   o.retryBackoff,
-		predicate: o.retryPredicate,
-	}
-
 	if o.updates != nil {
-		w.lastUpdate = &v1.Update{}
-		w.lastUpdate.Total, err = countIndex(ii, o.allowNondistributableArtifacts)
+		w.lastUpdate.Total, err = w.countIndex(ii, o.allowNondistributableArtifacts, map[v1.Hash]bool{})
 		if err != nil {
 			return err
 		}
-		defer close(o.updates)
-		defer func() { sendError(o.updates, rerr) }()
 	}
 
-	return w.writeIndex(o.context, ref, ii, options...)
+	if err := w.writeIndex(o.context, ref, ii); err != nil {
+		return err
+	}
+	if o.verifyAfterPush {
+		return w.verifyPush(o.context, ii, o.allowNondistributableArtifacts)
+	}
+	return nil
 }
 
 // countImage counts the total size of all layers + config blob + manifest for
-// an image. It de-dupes duplicate layers.
-func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error) {
+// an image that will actually be uploaded. It de-dupes duplicate layers and
+// skips any blobs that already exist in the repository, recording them in
+// w.present so that uploadOne doesn't report progress for them.
+//
+// Blobs that end up being mounted from another repository can't be detected
+// ahead of time, so they are counted here and reported once mounted.
+func (w *writer) countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error) {
 	var total int64
 	ls, err := img.Layers()
 	if err != nil {
@@ -726,18 +1014,26 @@ func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error
 		}
 		seen[d] = true
 
-		size, err := l.Size()
+		size, err := w.countBlob(d, l.Size)
 		if err != nil {
 			return 0, err
 		}
 		total += size
 	}
-	b, err := img.RawConfigFile()
+	cl, err := partial.ConfigLayer(img)
+	if err != nil {
+		return 0, err
+	}
+	d, err := cl.Digest()
+	if err != nil {
+		return 0, err
+	}
+	size, err := w.countBlob(d, cl.Size)
 	if err != nil {
 		return 0, err
 	}
-	total += int64(len(b))
-	size, err := img.Size()
+	total += size
+	size, err = img.Size()
 	if err != nil {
 		return 0, err
 	}
@@ -745,9 +1041,28 @@ func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error
 	return total, nil
 }
 
-// countIndex counts the total size of all images + sub-indexes for an index.
-// It does not attempt to de-dupe duplicate images, etc.
-func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64, error) {
+// countBlob returns the size of the blob with the given digest, or zero if it
+// already exists in the repository.
+func (w *writer) countBlob(h v1.Hash, size func() (int64, error)) (int64, error) {
+	if w.present[h] {
+		return 0, nil
+	}
+	existing, err := w.checkExistingBlob(h)
+	if err != nil {
+		return 0, err
+	}
+	if existing {
+		w.present[h] = true
+		return 0, nil
+	}
+	return size()
+}
+
+// countIndex counts the total size of all images + sub-indexes for an index
+// that will actually be uploaded. Children that already exist in the
+// repository are skipped, as writeIndex will skip them too. Children that
+// appear more than once are only counted the first time they are seen.
+func (w *writer) countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool, seen map[v1.Hash]bool) (int64, error) {
 	var total int64
 	mf, err := idx.IndexManifest()
 	if err != nil {
@@ -755,23 +1070,42 @@ func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64,
 	}
 
 	for _, desc := range mf.Manifests {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
 		switch desc.MediaType {
 		case types.OCIImageIndex, types.DockerManifestList:
+			exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
+			if err != nil {
+				return 0, err
+			}
+			if exists {
+				continue
+			}
 			sidx, err := idx.ImageIndex(desc.Digest)
 			if err != nil {
 				return 0, err
 			}
-			size, err := countIndex(sidx, allowNondistributableArtifacts)
+			size, err := w.countIndex(sidx, allowNondistributableArtifacts, seen)
 			if err != nil {
 				return 0, err
 			}
 			total += size
 		case types.OCIManifestSchema1, types.DockerManifestSchema2:
+			exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
+			if err != nil {
+				return 0, err
+			}
+			if exists {
+				continue
+			}
 			simg, err := idx.Image(desc.Digest)
 			if err != nil {
 				return 0, err
 			}
-			size, err := countImage(simg, allowNondistributableArtifacts)
+			size, err := w.countImage(simg, allowNondistributableArtifacts)
 			if err != nil {
 				return 0, err
 			}
@@ -783,7 +1117,7 @@ func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64,
 				if err != nil {
 					return 0, err
 				}
-				size, err := layer.Size()
+				size, err := w.countBlob(desc.Digest, layer.Size)
 				if err != nil {
 					return 0, err
 				}
@@ -801,40 +1135,16 @@ func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64,
 }
 
 // WriteLayer uploads the provided Layer to the specified repo.
+//
+// See Uploader to upload many layers with the same options.
 func WriteLayer(repo name.Repository, layer v1.Layer, options ...Option) (rerr error) {
 	o, err := makeOptions(repo, options...)
 	if err != nil {
 		return err
 	}
-	scopes := scopesForUploadingImage(repo, []v1.Layer{layer})
-	tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, scopes)
-	if err != nil {
-		return err
-	}
-	w := writer{
-		repo:      repo,
-		client:    &http.Client{Transport: tr},
-		context:   o.context,
-		updates:   o.updates,
-		backoff:   o.retryBackoff,
-		predicate: o.retryPredicate,
-	}
-
-	if o.updates != nil {
-		defer close(o.updates)
-		defer func() { sendError(o.updates, rerr) }()
-
-		// TODO: support streaming layers which update the total count as they write.
-		if _, ok := layer.(*stream.Layer); ok {
-			return errors.New("cannot use stream.Layer and WithProgress")
-		}
-		size, err := layer.Size()
-		if err != nil {
-			return err
-		}
-		w.lastUpdate = &v1.Update{Total: size}
-	}
-	return w.uploadOne(o.context, layer)
+	u := newUploader(o)
+	defer func() { u.close(rerr) }()
+	return u.UploadBlob(repo, layer)
 }
 
 // Tag adds a tag to the given Taggable via PUT /v2/.../manifests/<tag>
@@ -868,6 +1178,14 @@ func Put(ref name.Reference, t Taggable, options ...Option) error {
 	if err != nil {
 		return err
 	}
+	if o.manifestMediaType != "" {
+		if err := checkOverrideRef(ref); err != nil {
+			return err
+		}
+		if t, err = overriddenTaggable(t, o.manifestMediaType); err != nil {
+			return err
+		}
+	}
 	scopes := []string{ref.Scope(transport.PushScope)}
 
 	// TODO: This *always* does a token exchange. For some registries,
@@ -881,11 +1199,12 @@ func Put(ref name.Reference, t Taggable, options ...Option) error {
 		return err
 	}
 	w := writer{
-		repo:      ref.Context(),
-		client:    &http.Client{Transport: tr},
-		context:   o.context,
-		backoff:   o.retryBackoff,
-		predicate: o.retryPredicate,
+		repo:           ref.Context(),
+		client:         o.newClient(tr),
+		context:        o.context,
+		backoff:        o.retryBackoff,
+		predicate:      o.retryPredicate,
+		expectedDigest: o.expectedDigest,
 	}
 
 	return w.commitManifest(o.context, t, ref)
@@ -27,12 +27,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/go-containerregistry/internal/clock"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -82,14 +85,51 @@ func TestUrl(t *testing.T) {
 
 func TestNextLocation(t *testing.T) {
 	tests := []struct {
+		name     string
+		request  string
 		location string
+		uuid     string
+		carry    bool
 		url      string
 	}{{
+		name:     "absolute",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/",
 		location: "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
 		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
 	}, {
+		name:     "absolute path",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/",
 		location: "/v2/foo/bar/blobs/uploads/1234567?baz=blah",
 		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
+	}, {
+		name:     "relative path",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/?mount=sha256:abc&from=foo/baz",
+		location: "1234567?baz=blah",
+		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
+	}, {
+		name:     "relative path from a session",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
+		location: "../uploads/7654321",
+		carry:    true,
+		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/7654321?baz=blah",
+	}, {
+		name:     "new params replace old ones",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah&_state=old",
+		location: "/v2/foo/bar/blobs/uploads/1234567?_state=new",
+		carry:    true,
+		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?_state=new&baz=blah",
+	}, {
+		name:     "params are left alone if there's nothing to carry",
+		request:  "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?b=2&a=1",
+		location: "/v2/foo/bar/blobs/uploads/1234567?b=3&a=1",
+		carry:    true,
+		url:      "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?b=3&a=1",
+	}, {
+		name:    "upload UUID",
+		request: "https://gcr.io/v2/foo/bar/blobs/uploads/1234567?baz=blah",
+		uuid:    "7654321",
+		carry:   true,
+		url:     "https://gcr.io/v2/foo/bar/blobs/uploads/7654321?baz=blah",
 	}}
 
 	ref := mustNewTag(t, "gcr.io/foo/bar:latest")
@@ -98,26 +138,38 @@ func TestNextLocation(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		resp := &http.Response{
-			Header: map[string][]string{
-				"Location": {test.location},
-			},
-			Request: &http.Request{
-				URL: &url.URL{
-					Scheme: ref.Registry.Scheme(),
-					Host:   ref.RegistryStr(),
-				},
-			},
-		}
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{
+				Header:  http.Header{},
+				Request: &http.Request{URL: u},
+			}
+			if test.location != "" {
+				resp.Header.Set("Location", test.location)
+			}
+			if test.uuid != "" {
+				resp.Header.Set("Docker-Upload-UUID", test.uuid)
+			}
 
-		got, err := w.nextLocation(resp)
-		if err != nil {
-			t.Errorf("nextLocation(%v) = %v", resp, err)
-		}
-		want := test.url
-		if got != want {
-			t.Errorf("nextLocation(%v) = %v, want %v", resp, got, want)
-		}
+			got, err := w.nextLocation(resp, test.carry)
+			if err != nil {
+				t.Fatalf("nextLocation() = %v", err)
+			}
+			if got != test.url {
+				t.Errorf("nextLocation() = %v, want %v", got, test.url)
+			}
+		})
+	}
+
+	resp := &http.Response{
+		Header:  http.Header{},
+		Request: &http.Request{URL: &url.URL{Scheme: "https", Host: "gcr.io"}},
+	}
+	if _, err := w.nextLocation(resp, true); err == nil {
+		t.Error("nextLocation() without Location or Docker-Upload-UUID: expected error")
 	}
 }
 
@@ -1563,3 +1615,355 @@ func BenchmarkWrite(b *testing.B) {
 		}
 	}
 }
+
+func TestWriteInlineData(t *testing.T) {
+	var blobGets int32
+	handler := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			atomic.AddInt32(&blobGets, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small, err := random.Layer(100, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := mustNewTag(t, u.Host+"/inline:latest")
+	if err := Write(tag, img, WithInlineDataThreshold(1<<10)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Everything should be readable from the manifest alone.
+	atomic.StoreInt32(&blobGets, 0)
+	got, err := Image(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := got.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Config.Data == nil || m.Layers[0].Data == nil {
+		t.Fatalf("blobs weren't inlined: %+v", m)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	if n := atomic.LoadInt32(&blobGets); n != 0 {
+		t.Errorf("reading inlined image fetched %d blobs, want 0", n)
+	}
+
+	// The blobs must still have been uploaded.
+	for _, desc := range []v1.Descriptor{m.Config, m.Layers[0]} {
+		l, err := Layer(tag.Context().Digest(desc.Digest.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := partial.Exists(l); err != nil || !ok {
+			t.Errorf("Exists(%s) = %t, %v", desc.Digest, ok, err)
+		}
+	}
+
+	// Inlining changes the digest, so writing by digest doesn't make sense.
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(tag.Context().Digest(d.String()), img, WithInlineDataThreshold(1<<10)); err == nil {
+		t.Error("Write(digest, WithInlineDataThreshold) = nil, want error")
+	}
+	if err := Write(tag, img, WithInlineDataThreshold(-1)); err == nil {
+		t.Error("Write(WithInlineDataThreshold(-1)) = nil, want error")
+	}
+}
+
+// emptyConfigArtifact is an OCI artifact whose config is the empty JSON blob.
+type emptyConfigArtifact struct {
+	layer    v1.Layer
+	manifest []byte
+}
+
+func newEmptyConfigArtifact(t *testing.T) v1.Image {
+	t.Helper()
+	layer, err := random.Layer(64, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := partial.Descriptor(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := empty.JSONDescriptor()
+	cd.Data = nil
+	raw, err := json.Marshal(v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		Config:        cd,
+		Layers:        []v1.Descriptor{*ld},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := partial.CompressedToImage(&emptyConfigArtifact{layer: layer, manifest: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func (a *emptyConfigArtifact) RawConfigFile() ([]byte, error) { return []byte(empty.JSON), nil }
+func (a *emptyConfigArtifact) RawManifest() ([]byte, error)   { return a.manifest, nil }
+func (a *emptyConfigArtifact) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+func (a *emptyConfigArtifact) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if d, err := a.layer.Digest(); err != nil {
+		return nil, err
+	} else if d == h {
+		return a.layer, nil
+	}
+	return nil, fmt.Errorf("unknown blob %s", h)
+}
+
+func TestWriteEmptyJSONOnce(t *testing.T) {
+	var heads, uploads int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && strings.HasSuffix(r.URL.Path, "/blobs/"+empty.JSONDigest) {
+			atomic.AddInt32(&heads, 1)
+		}
+		if r.Method == http.MethodPut && r.URL.Query().Get("digest") == empty.JSONDigest {
+			atomic.AddInt32(&uploads, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(tag string) {
+		var adds []mutate.IndexAddendum
+		for i := 0; i < 5; i++ {
+			adds = append(adds, mutate.IndexAddendum{Add: newEmptyConfigArtifact(t)})
+		}
+		idx := mutate.AppendManifests(empty.Index, adds...)
+		ref := mustNewTag(t, fmt.Sprintf("%s/artifacts:%s", u.Host, tag))
+		if err := WriteIndex(ref, idx); err != nil {
+			t.Fatalf("WriteIndex() = %v", err)
+		}
+	}
+
+	write("first")
+	if got, want := atomic.LoadInt32(&heads), int32(1); got != want {
+		t.Errorf("checked for the empty JSON blob %d times, want %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&uploads), int32(1); got != want {
+		t.Errorf("uploaded the empty JSON blob %d times, want %d", got, want)
+	}
+
+	// It exists now, so it's only checked for.
+	write("second")
+	if got, want := atomic.LoadInt32(&heads), int32(2); got != want {
+		t.Errorf("checked for the empty JSON blob %d times, want %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&uploads), int32(1); got != want {
+		t.Errorf("uploaded the empty JSON blob %d times, want %d", got, want)
+	}
+
+	repo := mustNewTag(t, u.Host+"/artifacts").Context()
+	rc, err := Layer(repo.Digest(empty.JSONDigest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := rc.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	b, err := ioutil.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != empty.JSON {
+		t.Errorf("empty JSON blob = %q, want %q", b, empty.JSON)
+	}
+}
+
+func TestWriteRetryClock(t *testing.T) {
+	var failed int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first upload.
+		if r.Method == http.MethodPatch && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewFake(time.Unix(0, 0))
+	backoff := Backoff{Duration: time.Hour, Factor: 2, Steps: 3}
+	if err := Write(mustNewTag(t, u.Host+"/repo:tag"), img, WithRetryBackoff(backoff), WithJobs(1), withClock(c)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if diff := cmp.Diff([]time.Duration{time.Hour}, c.Sleeps()); diff != "" {
+		t.Errorf("sleeps (-want +got) = %s", diff)
+	}
+}
+
+// rewriteUploads serves reg, letting edit change the headers of responses to
+// blob upload requests before they're sent.
+func rewriteUploads(t *testing.T, reg http.Handler, edit func(*http.Request, http.Header)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/blobs/uploads/") {
+			reg.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, r)
+		edit(r, rec.Header())
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+}
+
+func TestWriteUploadLocations(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		edit func(t *testing.T, r *http.Request, h http.Header)
+	}{{
+		// Return Locations relative to the request, with a session parameter
+		// that is only returned once but has to be sent with every request.
+		name: "relative locations with session params",
+		edit: func(t *testing.T, r *http.Request, h http.Header) {
+			loc := h.Get("Location")
+			if loc == "" {
+				return
+			}
+			if r.Method == http.MethodPost {
+				h.Set("Location", path.Base(loc)+"?session=secret")
+				return
+			}
+			if got := r.URL.Query().Get("session"); got != "secret" {
+				t.Errorf("%s %s: session = %q, want it carried forward", r.Method, r.URL, got)
+			}
+			h.Set("Location", "./"+path.Base(loc))
+		},
+	}, {
+		// Only name the session with Docker-Upload-UUID.
+		name: "upload UUID",
+		edit: func(t *testing.T, r *http.Request, h http.Header) {
+			if loc := h.Get("Location"); loc != "" {
+				h.Del("Location")
+				h.Set("Docker-Upload-UUID", path.Base(loc))
+			}
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := rewriteUploads(t, registry.New(), func(r *http.Request, h http.Header) { tc.edit(t, r, h) })
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref := mustNewTag(t, u.Host+"/test/locations:latest")
+			img, err := random.Image(1024, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Write(ref, img, WithChunkSize(300)); err != nil {
+				t.Fatalf("Write() = %v", err)
+			}
+			got, err := Image(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validate.Image(got); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteMonolithicFallback(t *testing.T) {
+	reg := registry.New()
+	var patches, puts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/uploads/") {
+			switch r.Method {
+			case http.MethodPatch:
+				atomic.AddInt32(&patches, 1)
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			case http.MethodPut:
+				atomic.AddInt32(&puts, 1)
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := mustNewTag(t, u.Host+"/test/monolithic:latest")
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	// Two layers and the config.
+	if got, want := atomic.LoadInt32(&puts), int32(3); got != want {
+		t.Errorf("got %d monolithic PUTs, want %d", got, want)
+	}
+	if atomic.LoadInt32(&patches) == 0 {
+		t.Error("expected PATCH to be tried first")
+	}
+	got, err := Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	// Streaming layers need PATCH, since we don't know their digest yet.
+	sl := stream.NewLayer(ioutil.NopCloser(bytes.NewReader(make([]byte, 1024))))
+	simg, err := mutate.AppendLayers(empty.Image, sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(mustNewTag(t, u.Host+"/test/monolithic:stream"), simg); err == nil {
+		t.Error("Write() of a streaming layer without PATCH: expected error")
+	}
+}
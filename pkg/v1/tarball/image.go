@@ -66,6 +66,9 @@ func pathOpener(path string) Opener {
 }
 
 // ImageFromPath returns a v1.Image from a tarball located on path.
+//
+// Besides `docker save` style tarballs, this also reads OCI archives, see
+// Image.
 func ImageFromPath(path string, tag *name.Tag) (v1.Image, error) {
 	return Image(pathOpener(path), tag)
 }
@@ -87,12 +90,20 @@ func LoadManifest(opener Opener) (Manifest, error) {
 }
 
 // Image exposes an image from the tarball at the provided path.
+//
+// If the tarball has no manifest.json but contains an OCI image layout (an
+// OCI archive, as produced by Podman or skopeo), the image is read from the
+// layout instead, selecting the entry whose ref name annotation matches tag,
+// see OCIArchiveImage.
 func Image(opener Opener, tag *name.Tag) (v1.Image, error) {
 	img := &image{
 		opener: opener,
 		tag:    tag,
 	}
 	if err := img.loadTarDescriptorAndConfig(); err != nil {
+		if errors.Is(err, errFileNotFound) && isOCIArchive(opener) {
+			return ociArchiveImageForTag(opener, tag)
+		}
 		return nil, err
 	}
 
@@ -212,6 +223,9 @@ type tarFile struct {
 	io.Closer
 }
 
+// errFileNotFound is returned by extractFileFromTar for missing files.
+var errFileNotFound = errors.New("not found in tar")
+
 func extractFileFromTar(opener Opener, filePath string) (io.ReadCloser, error) {
 	f, err := opener()
 	if err != nil {
@@ -233,7 +247,8 @@ func extractFileFromTar(opener Opener, filePath string) (io.ReadCloser, error) {
 		if err != nil {
 			return nil, err
 		}
-		if hdr.Name == filePath {
+		// Some tools prefix every entry with "./".
+		if path.Clean(hdr.Name) == filePath {
 			if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
 				currentDir := filepath.Dir(filePath)
 				return extractFileFromTar(opener, path.Join(currentDir, path.Clean(hdr.Linkname)))
@@ -245,7 +260,7 @@ func extractFileFromTar(opener Opener, filePath string) (io.ReadCloser, error) {
 			}, nil
 		}
 	}
-	return nil, fmt.Errorf("file %s not found in tar", filePath)
+	return nil, fmt.Errorf("file %s %w", filePath, errFileNotFound)
 }
 
 // uncompressedLayerFromTarball implements partial.UncompressedLayer
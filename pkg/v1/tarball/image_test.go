@@ -137,3 +137,71 @@ func TestLoadManifest(t *testing.T) {
 		t.Fatalf("get nothing")
 	}
 }
+
+func TestOCIArchive(t *testing.T) {
+	const path = "testdata/oci_archive.tar"
+	for _, tc := range []struct {
+		name       string
+		load       func() (v1.Image, error)
+		wantDigest string
+	}{{
+		name: "by ref name",
+		load: func() (v1.Image, error) {
+			return ImageFromOCIArchive(path, "v1")
+		},
+		wantDigest: "sha256:0449afd27dd031e8e15e722de0bb8d896d876b3df40418d968b6be0c2089c18b",
+	}, {
+		name: "by digest",
+		load: func() (v1.Image, error) {
+			return ImageFromOCIArchive(path, "sha256:c50527d1220d347571e2ec3b3683b40c758a5099956cfdbcc30b34248b0c0c78")
+		},
+		wantDigest: "sha256:c50527d1220d347571e2ec3b3683b40c758a5099956cfdbcc30b34248b0c0c78",
+	}, {
+		name: "ImageFromPath with tag",
+		load: func() (v1.Image, error) {
+			tag, err := name.NewTag("example.com/test:v2")
+			if err != nil {
+				return nil, err
+			}
+			return ImageFromPath(path, &tag)
+		},
+		wantDigest: "sha256:c50527d1220d347571e2ec3b3683b40c758a5099956cfdbcc30b34248b0c0c78",
+	}, {
+		name: "ImageFromPath with bare tag",
+		load: func() (v1.Image, error) {
+			tag, err := name.NewTag("whatever:v1")
+			if err != nil {
+				return nil, err
+			}
+			return ImageFromPath(path, &tag)
+		},
+		wantDigest: "sha256:0449afd27dd031e8e15e722de0bb8d896d876b3df40418d968b6be0c2089c18b",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := tc.load()
+			if err != nil {
+				t.Fatalf("loading image: %v", err)
+			}
+			if err := validate.Image(img); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+			d, err := img.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.String() != tc.wantDigest {
+				t.Errorf("Digest() = %s, want %s", d, tc.wantDigest)
+			}
+		})
+	}
+
+	// The archive has multiple images, so they have to be picked by name.
+	for _, refName := range []string{"", "v3"} {
+		if _, err := ImageFromOCIArchive(path, refName); err == nil {
+			t.Errorf("ImageFromOCIArchive(%q) = nil, want error", refName)
+		}
+	}
+	if _, err := ImageFromPath(path, nil); err == nil {
+		t.Error("ImageFromPath(nil) = nil, want error")
+	}
+}
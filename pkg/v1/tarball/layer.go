@@ -15,18 +15,22 @@
 package tarball
 
 import (
+	"archive/tar"
 	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/internal/and"
 	gestargz "github.com/google/go-containerregistry/internal/estargz"
 	ggzip "github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -38,9 +42,18 @@ type layer struct {
 	compressedopener   Opener
 	uncompressedopener Opener
 	compression        int
+	fastGzip           bool
 	annotations        map[string]string
 	estgzopts          []estargz.Option
 	mediaType          types.MediaType
+	algorithm          string
+
+	// Filled in once the digest is known, see WithTarSplit.
+	tarSplit *TarSplitCompression
+
+	// Only used by LayerFromDir.
+	modTime  time.Time
+	uid, gid int
 }
 
 // Descriptor implements partial.withDescriptor.
@@ -49,10 +62,15 @@ func (l *layer) Descriptor() (*v1.Descriptor, error) {
 	if err != nil {
 		return nil, err
 	}
+	var annotations map[string]string
+	if len(l.annotations) != 0 {
+		// Omit the empty map, so the descriptor round-trips through JSON.
+		annotations = l.annotations
+	}
 	return &v1.Descriptor{
 		Size:        l.size,
 		Digest:      digest,
-		Annotations: l.annotations,
+		Annotations: annotations,
 		MediaType:   l.mediaType,
 	}, nil
 }
@@ -92,12 +110,27 @@ type LayerOption func(*layer)
 
 // WithCompressionLevel is a functional option for overriding the default
 // compression level used for compressing uncompressed tarballs.
+//
+// Compression is deterministic, so the same input and level always produce
+// the same digest, but changing the level changes the digest (and size) of
+// the compressed layer. The DiffID is unaffected.
 func WithCompressionLevel(level int) LayerOption {
 	return func(l *layer) {
 		l.compression = level
 	}
 }
 
+// WithFastGzip is a functional option that compresses uncompressed tarballs
+// with github.com/klauspost/compress/gzip instead of compress/gzip, which is
+// considerably faster at the same compression level.
+//
+// The output is deterministic for a given input and level, but is different
+// from that of compress/gzip, so this changes the digest of the compressed
+// layer. The DiffID is unaffected.
+func WithFastGzip(l *layer) {
+	l.fastGzip = true
+}
+
 // WithMediaType is a functional option for overriding the layer's media type.
 func WithMediaType(mt types.MediaType) LayerOption {
 	return func(l *layer) {
@@ -141,6 +174,39 @@ func WithEstargzOptions(opts ...estargz.Option) LayerOption {
 	}
 }
 
+// WithModTime is a functional option for overriding the modification time of
+// every entry in the tarball constructed by LayerFromDir. This is only
+// meaningful for LayerFromDir.
+//
+// The default is the Unix epoch, to produce reproducible layers.
+func WithModTime(t time.Time) LayerOption {
+	return func(l *layer) {
+		l.modTime = t
+	}
+}
+
+// WithOwner is a functional option for overriding the uid and gid of every
+// entry in the tarball constructed by LayerFromDir. This is only meaningful
+// for LayerFromDir.
+//
+// The default is 0:0 (root), to produce reproducible layers.
+func WithOwner(uid, gid int) LayerOption {
+	return func(l *layer) {
+		l.uid = uid
+		l.gid = gid
+	}
+}
+
+// WithDigestAlgorithm is a functional option for overriding the algorithm
+// (e.g. "sha512") used to compute the digest and diffID of the layer.
+//
+// The default is "sha256".
+func WithDigestAlgorithm(algorithm string) LayerOption {
+	return func(l *layer) {
+		l.algorithm = algorithm
+	}
+}
+
 // WithEstargz is a functional option that explicitly enables estargz support.
 func WithEstargz(l *layer) {
 	oguncompressed := l.uncompressedopener
@@ -188,10 +254,108 @@ func LayerFromFile(path string, opts ...LayerOption) (v1.Layer, error) {
 	return LayerFromOpener(opener, opts...)
 }
 
+// LayerFromDir returns a v1.Layer containing the contents of the directory at
+// path, without first writing a tarball to disk.
+//
+// The tarball is constructed on the fly each time the layer is read, so it is
+// deterministic: entries are sorted by path, and each entry's modification
+// time and owner are normalized (see WithModTime and WithOwner). File modes
+// and symlinks are preserved. Entries are named relative to path, so the
+// contents of path end up at the root of the layer.
+func LayerFromDir(path string, opts ...LayerOption) (v1.Layer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+
+	layer := newLayer()
+	layer.modTime = time.Unix(0, 0)
+	layer.uncompressedopener = func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(layer.writeDir(pw, path))
+		}()
+		return pr, nil
+	}
+	layer.compressedopener = layer.compressUncompressed
+
+	return layer.finish(opts)
+}
+
+// writeDir writes the contents of root as a tarball to w.
+func (l *layer) writeDir(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+
+	// filepath.Walk visits entries in lexical order, which keeps this deterministic.
+	if err := filepath.Walk(root, func(fp string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, fp)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fp); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.ModTime = l.modTime
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uid = l.uid
+		hdr.Gid = l.gid
+		hdr.Uname = ""
+		hdr.Gname = ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
 // LayerFromOpener returns a v1.Layer given an Opener function.
 // The Opener may return either an uncompressed tarball (common),
 // or a compressed tarball (uncommon).
 //
+// The compression is detected from the first bytes of the content: gzip and
+// zstd compressed tarballs are used as-is (the latter with the
+// types.OCILayerZStd media type, unless overridden), while uncompressed
+// tarballs are gzipped. To keep an uncompressed tarball uncompressed, pass
+// WithMediaType with types.OCIUncompressedLayer or
+// types.DockerUncompressedLayer, in which case Compressed returns the tarball
+// unchanged.
+//
 // When using this in conjunction with something like remote.Write
 // the uncompressed path may end up gzipping things multiple times:
 //  1. Compute the layer SHA256
@@ -205,22 +369,18 @@ func LayerFromOpener(opener Opener, opts ...LayerOption) (v1.Layer, error) {
 	}
 	defer rc.Close()
 
-	compressed, err := ggzip.Is(rc)
+	gzipped, pr, err := ggzip.Peek(rc)
 	if err != nil {
 		return nil, err
 	}
-
-	layer := &layer{
-		compression: gzip.BestSpeed,
-		annotations: make(map[string]string, 1),
-		mediaType:   types.DockerLayer,
-	}
-
-	if estgz := os.Getenv("GGCR_EXPERIMENT_ESTARGZ"); estgz == "1" {
-		opts = append([]LayerOption{WithEstargz}, opts...)
+	zstdCompressed, _, err := zstd.Peek(pr)
+	if err != nil {
+		return nil, err
 	}
 
-	if compressed {
+	layer := newLayer()
+	switch {
+	case gzipped:
 		layer.compressedopener = opener
 		layer.uncompressedopener = func() (io.ReadCloser, error) {
 			urc, err := opener()
@@ -229,33 +389,84 @@ func LayerFromOpener(opener Opener, opts ...LayerOption) (v1.Layer, error) {
 			}
 			return ggzip.UnzipReadCloser(urc)
 		}
-	} else {
-		layer.uncompressedopener = opener
-		layer.compressedopener = func() (io.ReadCloser, error) {
-			crc, err := opener()
+	case zstdCompressed:
+		layer.mediaType = types.OCILayerZStd
+		layer.compressedopener = opener
+		layer.uncompressedopener = func() (io.ReadCloser, error) {
+			urc, err := opener()
 			if err != nil {
 				return nil, err
 			}
-			return ggzip.ReadCloserLevel(crc, layer.compression), nil
+			return zstd.UnzipReadCloser(urc)
 		}
+	default:
+		layer.uncompressedopener = opener
+		layer.compressedopener = layer.compressUncompressed
+	}
+
+	return layer.finish(opts)
+}
+
+// newLayer returns a layer with the default options applied.
+func newLayer() *layer {
+	return &layer{
+		compression: gzip.BestSpeed,
+		annotations: make(map[string]string, 1),
+		mediaType:   types.DockerLayer,
+		algorithm:   "sha256",
+	}
+}
+
+// compressUncompressed gzips the uncompressed opener at the configured level,
+// unless the layer's media type says it should stay uncompressed.
+func (l *layer) compressUncompressed() (io.ReadCloser, error) {
+	crc, err := l.uncompressedopener()
+	if err != nil {
+		return nil, err
+	}
+	switch l.mediaType {
+	case types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer, types.DockerUncompressedLayer:
+		return crc, nil
+	}
+	if l.fastGzip {
+		return ggzip.FastReadCloserLevel(crc, l.compression), nil
+	}
+	return ggzip.ReadCloserLevel(crc, l.compression), nil
+}
+
+// finish applies opts to the layer, then computes its digest, size and diffID.
+func (l *layer) finish(opts []LayerOption) (v1.Layer, error) {
+	if estgz := os.Getenv("GGCR_EXPERIMENT_ESTARGZ"); estgz == "1" {
+		opts = append([]LayerOption{WithEstargz}, opts...)
 	}
 
 	for _, opt := range opts {
-		opt(layer)
+		opt(l)
 	}
 
-	if layer.digest, layer.size, err = computeDigest(layer.compressedopener); err != nil {
+	var err error
+	if l.digest, l.size, err = computeDigest(l.algorithm, l.compressedopener); err != nil {
 		return nil, err
 	}
 
+	// The estargz optimization above only knows about sha256 diffIDs.
 	empty := v1.Hash{}
-	if layer.diffID == empty {
-		if layer.diffID, err = computeDiffID(layer.uncompressedopener); err != nil {
+	if l.diffID == empty || l.diffID.Algorithm != l.algorithm {
+		if l.diffID, err = computeDiffID(l.algorithm, l.uncompressedopener); err != nil {
 			return nil, err
 		}
 	}
 
-	return layer, nil
+	if l.tarSplit != nil {
+		*l.tarSplit = TarSplitCompression{
+			MediaType: l.mediaType,
+			Level:     l.compression,
+			FastGzip:  l.fastGzip,
+			Digest:    l.digest,
+		}
+	}
+
+	return l, nil
 }
 
 // LayerFromReader returns a v1.Layer given a io.Reader.
@@ -274,23 +485,23 @@ func LayerFromReader(reader io.Reader, opts ...LayerOption) (v1.Layer, error) {
 	return LayerFromFile(tmp.Name(), opts...)
 }
 
-func computeDigest(opener Opener) (v1.Hash, int64, error) {
+func computeDigest(algorithm string, opener Opener) (v1.Hash, int64, error) {
 	rc, err := opener()
 	if err != nil {
 		return v1.Hash{}, 0, err
 	}
 	defer rc.Close()
 
-	return v1.SHA256(rc)
+	return v1.ComputeHash(algorithm, rc)
 }
 
-func computeDiffID(opener Opener) (v1.Hash, error) {
+func computeDiffID(algorithm string, opener Opener) (v1.Hash, error) {
 	rc, err := opener()
 	if err != nil {
 		return v1.Hash{}, err
 	}
 	defer rc.Close()
 
-	digest, _, err := v1.SHA256(rc)
+	digest, _, err := v1.ComputeHash(algorithm, rc)
 	return digest, err
 }
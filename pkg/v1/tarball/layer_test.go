@@ -15,17 +15,22 @@
 package tarball
 
 import (
+	"archive/tar"
 	"bytes"
 	"compress/gzip"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/internal/compare"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestLayerFromFile(t *testing.T) {
@@ -79,6 +84,58 @@ func TestLayerFromFile(t *testing.T) {
 	}
 }
 
+func TestLayerFromFileFastGzip(t *testing.T) {
+	setupFixtures(t)
+	defer teardownFixtures(t)
+
+	tarLayer, err := LayerFromFile("testdata/content.tar")
+	if err != nil {
+		t.Fatalf("Unable to create layer from tar file: %v", err)
+	}
+
+	fastLayer, err := LayerFromFile("testdata/content.tar", WithFastGzip)
+	if err != nil {
+		t.Fatalf("Unable to create layer with fast gzip from tar file: %v", err)
+	}
+
+	if err := validate.Layer(fastLayer); err != nil {
+		t.Errorf("validate.Layer(fastLayer): %v", err)
+	}
+
+	want, err := tarLayer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fastLayer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("DiffID() = %s, want %s", got, want)
+	}
+
+	// Compressing the same input at the same level must be reproducible.
+	again, err := LayerFromFile("testdata/content.tar", WithFastGzip, WithCompressionLevel(gzip.BestCompression))
+	if err != nil {
+		t.Fatal(err)
+	}
+	another, err := LayerFromFile("testdata/content.tar", WithFastGzip, WithCompressionLevel(gzip.BestCompression))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := again.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := another.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 {
+		t.Errorf("expected digests to match: %s != %s", d1, d2)
+	}
+}
+
 func TestLayerFromFileEstargz(t *testing.T) {
 	setupFixtures(t)
 	defer teardownFixtures(t)
@@ -255,6 +312,179 @@ func TestWithMediaType(t *testing.T) {
 	}
 }
 
+func TestLayerFromOpenerCompression(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	content := []byte("hello, world")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	raw := tarBuf.Bytes()
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	if _, err := gw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var zstdBuf bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		opts []LayerOption
+		// the expected media type, and compressed bytes, if they should be
+		// passed through unchanged.
+		wantMT         types.MediaType
+		wantCompressed []byte
+	}{{
+		name:           "gzip",
+		in:             gzBuf.Bytes(),
+		wantMT:         types.DockerLayer,
+		wantCompressed: gzBuf.Bytes(),
+	}, {
+		name:           "zstd",
+		in:             zstdBuf.Bytes(),
+		wantMT:         types.OCILayerZStd,
+		wantCompressed: zstdBuf.Bytes(),
+	}, {
+		name:   "tar",
+		in:     raw,
+		wantMT: types.DockerLayer,
+	}, {
+		name:           "oci uncompressed tar",
+		in:             raw,
+		opts:           []LayerOption{WithMediaType(types.OCIUncompressedLayer)},
+		wantMT:         types.OCIUncompressedLayer,
+		wantCompressed: raw,
+	}, {
+		name:           "docker uncompressed tar",
+		in:             raw,
+		opts:           []LayerOption{WithMediaType(types.DockerUncompressedLayer)},
+		wantMT:         types.DockerUncompressedLayer,
+		wantCompressed: raw,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.in
+			opener := func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(in)), nil
+			}
+			l, err := LayerFromOpener(opener, tc.opts...)
+			if err != nil {
+				t.Fatalf("LayerFromOpener: %v", err)
+			}
+			if err := validate.Layer(l); err != nil {
+				t.Errorf("validate.Layer: %v", err)
+			}
+
+			mt, err := l.MediaType()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt != tc.wantMT {
+				t.Errorf("MediaType() = %s, want %s", mt, tc.wantMT)
+			}
+
+			rc, err := l.Uncompressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, raw) {
+				t.Errorf("Uncompressed() didn't return the original tarball")
+			}
+
+			rc, err = l.Compressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			got, err = ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantCompressed != nil {
+				if !bytes.Equal(got, tc.wantCompressed) {
+					t.Errorf("Compressed() didn't return the input unchanged")
+				}
+			} else if bytes.Equal(got, raw) {
+				t.Errorf("Compressed() returned the uncompressed tarball")
+			}
+		})
+	}
+}
+
+func TestWithDigestAlgorithm(t *testing.T) {
+	setupFixtures(t)
+	defer teardownFixtures(t)
+
+	l, err := LayerFromFile("testdata/content.tar", WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatalf("Unable to create layer from tar file: %v", err)
+	}
+
+	digest, err := l.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	defer rc.Close()
+	want, _, err := v1.ComputeHash("sha512", rc)
+	if err != nil {
+		t.Fatalf("ComputeHash: %v", err)
+	}
+	if digest != want {
+		t.Errorf("Digest: got %v, want %v", digest, want)
+	}
+
+	diffID, err := l.DiffID()
+	if err != nil {
+		t.Fatalf("DiffID: %v", err)
+	}
+	urc, err := l.Uncompressed()
+	if err != nil {
+		t.Fatalf("Uncompressed: %v", err)
+	}
+	defer urc.Close()
+	want, _, err = v1.ComputeHash("sha512", urc)
+	if err != nil {
+		t.Fatalf("ComputeHash: %v", err)
+	}
+	if diffID != want {
+		t.Errorf("DiffID: got %v, want %v", diffID, want)
+	}
+
+	if _, err := LayerFromFile("testdata/content.tar", WithDigestAlgorithm("md5")); err == nil {
+		t.Error("LayerFromFile(md5) = nil, wanted error")
+	}
+}
+
 func TestLayerFromReader(t *testing.T) {
 	setupFixtures(t)
 	defer teardownFixtures(t)
@@ -319,3 +549,108 @@ func teardownFixtures(t *testing.T) {
 		t.Errorf("Error tearing down fixtures: %v", err)
 	}
 }
+
+func TestLayerFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-from-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bin", "run"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/run", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := LayerFromDir(dir)
+	if err != nil {
+		t.Fatalf("LayerFromDir: %v", err)
+	}
+	if err := validate.Layer(layer); err != nil {
+		t.Errorf("validate.Layer: %v", err)
+	}
+
+	// Changing timestamps should not change the digest.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LayerFromDir(dir)
+	if err != nil {
+		t.Fatalf("LayerFromDir: %v", err)
+	}
+	if err := compare.Layers(layer, again); err != nil {
+		t.Errorf("compare.Layers: %v", err)
+	}
+
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	want := []struct {
+		name     string
+		mode     int64
+		linkname string
+	}{
+		{"a.txt", 0644, ""},
+		{"bin/", 0755, ""},
+		{"bin/run", 0755, ""},
+		{"link", 0777, "bin/run"},
+	}
+	for _, w := range want {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		if hdr.Name != w.name {
+			t.Errorf("Name: got %q, want %q", hdr.Name, w.name)
+		}
+		if hdr.Mode != w.mode {
+			t.Errorf("%s: Mode: got %o, want %o", hdr.Name, hdr.Mode, w.mode)
+		}
+		if hdr.Linkname != w.linkname {
+			t.Errorf("%s: Linkname: got %q, want %q", hdr.Name, hdr.Linkname, w.linkname)
+		}
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) {
+			t.Errorf("%s: ModTime: got %v, want epoch", hdr.Name, hdr.ModTime)
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s: owner: got %d:%d, want 0:0", hdr.Name, hdr.Uid, hdr.Gid)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("expected EOF after %d entries, got %v", len(want), err)
+	}
+
+	// Options take effect.
+	mtime := time.Unix(1234567890, 0)
+	custom, err := LayerFromDir(dir, WithModTime(mtime), WithOwner(1000, 1000))
+	if err != nil {
+		t.Fatalf("LayerFromDir: %v", err)
+	}
+	rc, err = custom.Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	hdr, err := tar.NewReader(rc).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Uid != 1000 || hdr.Gid != 1000 {
+		t.Errorf("owner: got %d:%d, want 1000:1000", hdr.Uid, hdr.Gid)
+	}
+	if !hdr.ModTime.Equal(mtime) {
+		t.Errorf("ModTime: got %v, want %v", hdr.ModTime, mtime)
+	}
+}
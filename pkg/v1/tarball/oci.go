@@ -0,0 +1,203 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// The files that identify an OCI image layout, see
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+const (
+	ociLayoutFile = "oci-layout"
+	ociIndexFile  = "index.json"
+)
+
+// ImageFromOCIArchive returns a v1.Image from the OCI archive (an OCI image
+// layout inside a tarball, as produced by e.g. "podman save --format
+// oci-archive" or skopeo) located on path, see OCIArchiveImage.
+func ImageFromOCIArchive(path, refName string) (v1.Image, error) {
+	return OCIArchiveImage(pathOpener(path), refName)
+}
+
+// OCIArchiveImage exposes an image from the OCI archive opened by opener.
+//
+// The image is selected from the archive's index.json by refName, which is
+// matched against the "org.opencontainers.image.ref.name" annotation and the
+// digest of each entry. If refName is empty, the archive must contain exactly
+// one image.
+func OCIArchiveImage(opener Opener, refName string) (v1.Image, error) {
+	return ociArchiveImage(opener, func(desc v1.Descriptor) bool {
+		return desc.Annotations[specsv1.AnnotationRefName] == refName || desc.Digest.String() == refName
+	}, refName)
+}
+
+// isOCIArchive returns true if the tarball opened by opener contains an OCI
+// image layout.
+func isOCIArchive(opener Opener) bool {
+	rc, err := extractFileFromTar(opener, ociLayoutFile)
+	if err != nil {
+		return false
+	}
+	rc.Close()
+	return true
+}
+
+// ociArchiveImageForTag returns the image tagged tag from an OCI archive. The
+// ref name annotation may hold just the tag or the full reference.
+func ociArchiveImageForTag(opener Opener, tag *name.Tag) (v1.Image, error) {
+	if tag == nil {
+		return ociArchiveImage(opener, nil, "")
+	}
+	return ociArchiveImage(opener, func(desc v1.Descriptor) bool {
+		switch desc.Annotations[specsv1.AnnotationRefName] {
+		case tag.TagStr(), tag.Name(), tag.String():
+			return true
+		}
+		return false
+	}, tag.String())
+}
+
+func ociArchiveImage(opener Opener, matches func(v1.Descriptor) bool, refName string) (v1.Image, error) {
+	rc, err := extractFileFromTar(opener, ociIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	index, err := v1.ParseIndexManifest(rc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ociIndexFile, err)
+	}
+
+	var found []v1.Descriptor
+	for _, desc := range index.Manifests {
+		if refName == "" || matches(desc) {
+			found = append(found, desc)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return nil, fmt.Errorf("no image named %q in OCI archive", refName)
+	case len(found) > 1 && refName == "":
+		return nil, errors.New("OCI archive contains multiple images, specify one by name")
+	case len(found) > 1:
+		return nil, fmt.Errorf("multiple images named %q in OCI archive", refName)
+	case !found[0].MediaType.IsImage():
+		return nil, fmt.Errorf("%s in OCI archive is a %s, not an image", found[0].Digest, found[0].MediaType)
+	}
+
+	img := &ociArchive{
+		opener: opener,
+		desc:   found[0],
+	}
+	if img.manifest, err = img.blob(img.desc.Digest); err != nil {
+		return nil, err
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(img.manifest))
+	if err != nil {
+		return nil, err
+	}
+	img.layers = m.Layers
+	if img.config, err = img.blob(m.Config.Digest); err != nil {
+		return nil, err
+	}
+	return partial.CompressedToImage(img)
+}
+
+// ociArchive implements partial.CompressedImageCore for an image in an OCI
+// archive.
+type ociArchive struct {
+	opener   Opener
+	desc     v1.Descriptor
+	manifest []byte
+	config   []byte
+	layers   []v1.Descriptor
+}
+
+var _ partial.CompressedImageCore = (*ociArchive)(nil)
+
+// blobPath returns the path of the blob h in the archive.
+func blobPath(h v1.Hash) string {
+	return path.Join("blobs", h.Algorithm, h.Hex)
+}
+
+func (i *ociArchive) blob(h v1.Hash) ([]byte, error) {
+	rc, err := extractFileFromTar(i.opener, blobPath(h))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func (i *ociArchive) MediaType() (types.MediaType, error) {
+	return i.desc.MediaType, nil
+}
+
+func (i *ociArchive) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+func (i *ociArchive) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+func (i *ociArchive) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.layers {
+		if desc.Digest == h {
+			return &ociArchiveLayer{opener: i.opener, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in OCI archive", h)
+}
+
+// ociArchiveLayer implements partial.CompressedLayer for a layer in an OCI
+// archive.
+type ociArchiveLayer struct {
+	opener Opener
+	desc   v1.Descriptor
+}
+
+func (l *ociArchiveLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *ociArchiveLayer) Compressed() (io.ReadCloser, error) {
+	return extractFileFromTar(l.opener, blobPath(l.desc.Digest))
+}
+
+func (l *ociArchiveLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *ociArchiveLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
+
+// Descriptor implements partial.withDescriptor, preserving e.g. annotations.
+func (l *ociArchiveLayer) Descriptor() (*v1.Descriptor, error) {
+	return &l.desc, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-containerregistry/internal/and"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/vbatts/tar-split/tar/asm"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// TarSplitCompression records how the compressed contents of a layer were
+// produced from its uncompressed tarball, so that LayerFromTarSplit can
+// reproduce them, and therefore the layer's digest, exactly.
+type TarSplitCompression struct {
+	MediaType types.MediaType `json:"mediaType"`
+	Level     int             `json:"level"`
+	FastGzip  bool            `json:"fastGzip,omitempty"`
+	// Digest is the digest of the original compressed contents, which the
+	// reproduced ones are checked against.
+	Digest v1.Hash `json:"digest"`
+}
+
+// WithTarSplit is a functional option that writes tar-split metadata for the
+// layer's uncompressed tarball to w, in the newline-delimited JSON format used
+// by github.com/vbatts/tar-split (and containers/storage), and, if c is not
+// nil, records how the tarball was compressed in c.
+//
+// The metadata records the raw tar headers and padding along with the name,
+// size and checksum of each file, so that once the layer has been extracted,
+// TarFromSplit can reproduce the exact uncompressed tarball, and therefore
+// its DiffID, from the extracted files. Given c too, LayerFromTarSplit can
+// reproduce the exact compressed contents, and therefore the digest, as long
+// as this package compressed them, i.e. they weren't already compressed when
+// the layer was constructed.
+//
+// Metadata is only written for the first full read of the uncompressed
+// contents, which happens while the layer is being constructed (to compute
+// its digest or DiffID).
+func WithTarSplit(w io.Writer, c *TarSplitCompression) LayerOption {
+	return func(l *layer) {
+		l.tarSplit = c
+		var once sync.Once
+		og := l.uncompressedopener
+		l.uncompressedopener = func() (io.ReadCloser, error) {
+			rc, err := og()
+			if err != nil {
+				return nil, err
+			}
+			first := false
+			once.Do(func() { first = true })
+			if !first {
+				return rc, nil
+			}
+			r, err := asm.NewInputTarStream(rc, storage.NewJSONPacker(w), nil)
+			if err != nil {
+				rc.Close()
+				return nil, err
+			}
+			return &and.ReadCloser{
+				Reader: r,
+				CloseFunc: func() error {
+					// Unblock the disassembler if we didn't read everything.
+					if c, ok := r.(io.Closer); ok {
+						c.Close()
+					}
+					return rc.Close()
+				},
+			}, nil
+		}
+	}
+}
+
+// TarFromSplit reassembles the exact uncompressed tarball described by the
+// tar-split metadata, e.g. from WithTarSplit, reading the contents of each
+// file from files. To read files from a directory the layer was extracted
+// into, use storage.NewPathFileGetter.
+//
+// The contents of each file are checked against the checksum recorded in the
+// metadata, and reading fails if they don't match.
+func TarFromSplit(metadata io.Reader, files storage.FileGetter) io.ReadCloser {
+	return asm.NewOutputTarStream(files, storage.NewJSONUnpacker(metadata))
+}
+
+// LayerFromTarSplit returns a v1.Layer whose uncompressed contents are
+// reassembled from the given tar-split metadata and files, see TarFromSplit,
+// and compressed as recorded in c by WithTarSplit.
+//
+// The DiffID of the result matches that of the original layer. Since our
+// compression is deterministic, so does the digest, which is checked against
+// c.Digest; it's an error if they differ, e.g. because the original layer
+// wasn't compressed by this package. opts are applied after those from c.
+func LayerFromTarSplit(metadata []byte, files storage.FileGetter, c TarSplitCompression, opts ...LayerOption) (v1.Layer, error) {
+	copts := []LayerOption{WithMediaType(c.MediaType), WithCompressionLevel(c.Level)}
+	if c.FastGzip {
+		copts = append(copts, WithFastGzip)
+	}
+	l, err := LayerFromOpener(func() (io.ReadCloser, error) {
+		return TarFromSplit(bytes.NewReader(metadata), files), nil
+	}, append(copts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	h, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	if h != c.Digest {
+		return nil, fmt.Errorf("reassembled layer has digest %s, want %s", h, c.Digest)
+	}
+	return l, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestTarSplit(t *testing.T) {
+	// Build a tarball with some quirks that a naive re-tar wouldn't reproduce,
+	// like PAX records and trailing garbage after the end-of-archive marker.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name     string
+		contents string
+		typeflag byte
+	}{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", contents: "hello"},
+		{name: "dir/empty", contents: ""},
+		{name: "b.txt", contents: "world"},
+	} {
+		typeflag := f.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:       f.name,
+			Typeflag:   typeflag,
+			Size:       int64(len(f.contents)),
+			Mode:       0644,
+			PAXRecords: map[string]string{"user.comment": "quirky"},
+			Format:     tar.FormatPAX,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 4096))
+	original := buf.Bytes()
+
+	var metadata bytes.Buffer
+	var c TarSplitCompression
+	l, err := LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(original)), nil
+	}, WithTarSplit(&metadata, &c), WithCompressionLevel(gzip.BestCompression))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Len() == 0 {
+		t.Fatal("WithTarSplit() wrote no metadata")
+	}
+
+	// Extract the layer's files.
+	dir := t.TempDir()
+	tr := tar.NewReader(bytes.NewReader(original))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rc := TarFromSplit(bytes.NewReader(metadata.Bytes()), storage.NewPathFileGetter(dir))
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, original) {
+		t.Errorf("TarFromSplit() produced %d different bytes, want the original %d", len(got), len(original))
+	}
+
+	rl, err := LayerFromTarSplit(metadata.Bytes(), storage.NewPathFileGetter(dir), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotDigest, err := rl.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDigest, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotDigest != wantDigest {
+		t.Errorf("Digest: got %v, want %v", gotDigest, wantDigest)
+	}
+	gotDiffID, err := rl.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDiffID, err := l.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotDiffID != wantDiffID {
+		t.Errorf("DiffID: got %v, want %v", gotDiffID, wantDiffID)
+	}
+
+	// Compressing differently than recorded is detected.
+	other := c
+	other.Level = gzip.BestSpeed
+	if _, err := LayerFromTarSplit(metadata.Bytes(), storage.NewPathFileGetter(dir), other); err == nil {
+		t.Error("LayerFromTarSplit() with different compression = nil, wanted error")
+	}
+
+	// Modified files are detected.
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("WORLD"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc = TarFromSplit(bytes.NewReader(metadata.Bytes()), storage.NewPathFileGetter(dir))
+	defer rc.Close()
+	if _, err := ioutil.ReadAll(rc); err == nil {
+		t.Error("TarFromSplit() with modified file = nil, wanted error")
+	}
+}
@@ -111,7 +111,7 @@ func validateLayers(img v1.Image, opt ...Option) error {
 	}
 
 	if o.fast {
-		return layersExist(layers)
+		return validateLayerMetadata(img, layers)
 	}
 
 	digests := []v1.Hash{}
@@ -268,15 +268,91 @@ func validateManifest(img v1.Image) error {
 	return nil
 }
 
-func layersExist(layers []v1.Layer) error {
+// validateLayerMetadata checks that the layers of img are consistent with its
+// manifest and config file without reading any layer contents, then checks
+// that each layer exists with the size the manifest says it has.
+func validateLayerMetadata(img v1.Image, layers []v1.Layer) error {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return err
+	}
+
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+
 	errs := []string{}
-	for _, layer := range layers {
-		ok, err := partial.Exists(layer)
+	if len(layers) != len(m.Layers) {
+		errs = append(errs, fmt.Sprintf("mismatched layer count: len(Layers())=%d, len(Manifest.Layers)=%d", len(layers), len(m.Layers)))
+	}
+	if len(m.Layers) != len(cf.RootFS.DiffIDs) {
+		errs = append(errs, fmt.Sprintf("mismatched layer count: len(Manifest.Layers)=%d, len(ConfigFile.RootFS.DiffIDs)=%d", len(m.Layers), len(cf.RootFS.DiffIDs)))
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	for i, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		diffid, err := layer.DiffID()
+		if err != nil {
+			return err
+		}
+		size, err := layer.Size()
+		if err != nil {
+			return err
+		}
+		mediaType, err := layer.MediaType()
 		if err != nil {
-			errs = append(errs, err.Error())
+			return err
+		}
+
+		if m.Layers[i].Digest != digest {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] digest: Manifest.Layers[%d].Digest=%s, Digest()=%s", i, i, m.Layers[i].Digest, digest))
+		}
+
+		if cf.RootFS.DiffIDs[i] != diffid {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: ConfigFile.RootFS.DiffIDs[%d]=%s, DiffID()=%s", i, i, cf.RootFS.DiffIDs[i], diffid))
+		}
+
+		if m.Layers[i].Size != size {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Manifest.Layers[%d].Size=%d, Size()=%d", i, i, m.Layers[i].Size, size))
+		}
+
+		if m.Layers[i].MediaType != mediaType {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] mediaType: Manifest.Layers[%d].MediaType=%s, layer.MediaType()=%s", i, i, m.Layers[i].MediaType, mediaType))
 		}
-		if !ok {
-			errs = append(errs, "layer does not exist")
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return layersExist(layers, m)
+}
+
+func layersExist(layers []v1.Layer, m *v1.Manifest) error {
+	errs := []string{}
+	for i, layer := range layers {
+		// Where the layer is stored elsewhere, e.g. in a registry, check that
+		// it agrees with the manifest, since the layer's own Size() likely
+		// just comes from the manifest.
+		if size, ok, err := partial.StoredSize(layer); ok {
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("layer[%d]: %v", i, err))
+			} else if size != m.Layers[i].Size {
+				errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Manifest.Layers[%d].Size=%d, StoredSize()=%d", i, i, m.Layers[i].Size, size))
+			}
+			continue
+		}
+		ok, err := partial.Exists(layer)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("layer[%d]: %v", i, err))
+		} else if !ok {
+			errs = append(errs, fmt.Sprintf("layer[%d] does not exist", i))
 		}
 	}
 
@@ -0,0 +1,80 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestImageFastStoredSize(t *testing.T) {
+	// lie, if set, is the blob whose size the registry misreports.
+	var lie string
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && lie != "" && strings.HasSuffix(r.URL.Path, "/blobs/"+lie) {
+			w.Header().Set("Content-Length", strconv.Itoa(1))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/test/validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	rimg, err := remote.Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(rimg, Fast); err != nil {
+		t.Errorf("Image(Fast) = %v", err)
+	}
+
+	ls, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ls[1].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lie = h.String()
+	if err := Image(rimg, Fast); err == nil || !strings.Contains(err.Error(), "mismatched layer[1] size") {
+		t.Errorf("Image(Fast) with misreported size = %v, want mismatched layer[1] size", err)
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"io/ioutil"
 	"strings"
 
+	ggzip "github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 )
@@ -128,8 +130,8 @@ func computeLayer(layer v1.Layer) (*computedLayer, error) {
 		pw.CloseWithError(compressed.Close())
 	}()
 
-	// Read the bytes through gzip.Reader to compute the DiffID.
-	uncompressed, err := gzip.NewReader(pr)
+	// Read the bytes through a decompressor to compute the DiffID.
+	uncompressed, err := decompress(pr)
 	if err != nil {
 		return nil, err
 	}
@@ -190,3 +192,23 @@ func computeLayer(layer v1.Layer) (*computedLayer, error) {
 		uncompressedSize:   usize,
 	}, nil
 }
+
+// decompress returns a reader of the uncompressed contents of r, which may be
+// gzip or zstd compressed, or an uncompressed tarball that is passed through.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	gzipped, pr, err := ggzip.Peek(r)
+	if err != nil {
+		return nil, err
+	}
+	if gzipped {
+		return gzip.NewReader(pr)
+	}
+	zstdCompressed, pr, err := zstd.Peek(pr)
+	if err != nil {
+		return nil, err
+	}
+	if zstdCompressed {
+		return zstd.UnzipReadCloser(ioutil.NopCloser(pr))
+	}
+	return ioutil.NopCloser(pr), nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Manifest validates that raw is structurally valid as a manifest of media
+// type mt, i.e. that it has all the fields required by the OCI image spec or
+// the Docker image manifest spec, and that the descriptors it contains point
+// at the right kinds of things (e.g. that an image's config isn't a layer).
+//
+// This is meant to catch malformed manifests before they're pushed, since
+// registries tend to reject them with unhelpful errors. Only image manifests
+// and indexes are supported.
+func Manifest(raw []byte, mt types.MediaType) error {
+	if !mt.IsImage() && !mt.IsIndex() {
+		return fmt.Errorf("unsupported manifest media type: %q", mt)
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return fmt.Errorf("manifest is not a JSON object: %w", err)
+	}
+
+	errs := []string{}
+	var schemaVersion int64
+	if b, ok := m["schemaVersion"]; !ok {
+		errs = append(errs, "missing required field: schemaVersion")
+	} else if err := json.Unmarshal(b, &schemaVersion); err != nil {
+		errs = append(errs, fmt.Sprintf("schemaVersion: %v", err))
+	} else if schemaVersion != 2 {
+		errs = append(errs, fmt.Sprintf("schemaVersion: got %d, want 2", schemaVersion))
+	}
+
+	// The mediaType field is optional for OCI, but required by Docker.
+	if b, ok := m["mediaType"]; ok {
+		var got types.MediaType
+		if err := json.Unmarshal(b, &got); err != nil {
+			errs = append(errs, fmt.Sprintf("mediaType: %v", err))
+		} else if got != mt {
+			errs = append(errs, fmt.Sprintf("mediaType: got %q, want %q", got, mt))
+		}
+	} else if isDocker(mt) {
+		errs = append(errs, "missing required field: mediaType")
+	}
+
+	if mt.IsImage() {
+		errs = append(errs, validateImageFields(m, mt)...)
+	} else {
+		errs = append(errs, validateIndexFields(m, mt)...)
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func validateImageFields(m map[string]json.RawMessage, mt types.MediaType) []string {
+	errs := []string{}
+	if _, ok := m["manifests"]; ok {
+		errs = append(errs, "unexpected field for an image manifest: manifests")
+	}
+
+	if b, ok := m["config"]; !ok {
+		errs = append(errs, "missing required field: config")
+	} else {
+		var desc v1.Descriptor
+		if err := json.Unmarshal(b, &desc); err != nil {
+			errs = append(errs, fmt.Sprintf("config: %v", err))
+		} else {
+			errs = append(errs, validateDescriptor("config", desc)...)
+			switch {
+			case desc.MediaType == "":
+			case isDocker(mt) && desc.MediaType != types.DockerConfigJSON && desc.MediaType != types.DockerPluginConfig:
+				errs = append(errs, fmt.Sprintf("config.mediaType: got %q, want %q", desc.MediaType, types.DockerConfigJSON))
+			case desc.MediaType.IsImage(), desc.MediaType.IsIndex(), isLayer(desc.MediaType):
+				errs = append(errs, fmt.Sprintf("config.mediaType: %q is not a config media type", desc.MediaType))
+			}
+		}
+	}
+
+	if b, ok := m["layers"]; !ok {
+		errs = append(errs, "missing required field: layers")
+	} else {
+		var descs []v1.Descriptor
+		if err := json.Unmarshal(b, &descs); err != nil {
+			errs = append(errs, fmt.Sprintf("layers: %v", err))
+		}
+		for i, desc := range descs {
+			field := fmt.Sprintf("layers[%d]", i)
+			errs = append(errs, validateDescriptor(field, desc)...)
+			if desc.MediaType.IsImage() || desc.MediaType.IsIndex() || isConfig(desc.MediaType) {
+				errs = append(errs, fmt.Sprintf("%s.mediaType: %q is not a layer media type", field, desc.MediaType))
+			}
+		}
+	}
+	return errs
+}
+
+func validateIndexFields(m map[string]json.RawMessage, mt types.MediaType) []string {
+	errs := []string{}
+	for _, field := range []string{"config", "layers"} {
+		if _, ok := m[field]; ok {
+			errs = append(errs, "unexpected field for an index: "+field)
+		}
+	}
+
+	b, ok := m["manifests"]
+	if !ok {
+		return append(errs, "missing required field: manifests")
+	}
+	var descs []v1.Descriptor
+	if err := json.Unmarshal(b, &descs); err != nil {
+		return append(errs, fmt.Sprintf("manifests: %v", err))
+	}
+	for i, desc := range descs {
+		field := fmt.Sprintf("manifests[%d]", i)
+		errs = append(errs, validateDescriptor(field, desc)...)
+		switch {
+		case desc.MediaType == "":
+		case isDocker(mt) && !isDocker(desc.MediaType):
+			errs = append(errs, fmt.Sprintf("%s.mediaType: %q is not a Docker manifest media type", field, desc.MediaType))
+		case isLayer(desc.MediaType), isConfig(desc.MediaType):
+			errs = append(errs, fmt.Sprintf("%s.mediaType: %q is not a manifest media type", field, desc.MediaType))
+		}
+	}
+	return errs
+}
+
+// validateDescriptor checks that desc has the fields required of every
+// descriptor.
+func validateDescriptor(field string, desc v1.Descriptor) []string {
+	errs := []string{}
+	if desc.MediaType == "" {
+		errs = append(errs, fmt.Sprintf("%s: missing required field: mediaType", field))
+	}
+	if desc.Digest == (v1.Hash{}) {
+		errs = append(errs, fmt.Sprintf("%s: missing required field: digest", field))
+	}
+	if desc.Size < 0 {
+		errs = append(errs, fmt.Sprintf("%s.size: must not be negative, got %d", field, desc.Size))
+	}
+	return errs
+}
+
+func isDocker(mt types.MediaType) bool {
+	switch mt {
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed, types.DockerManifestSchema2, types.DockerManifestList:
+		return true
+	}
+	return false
+}
+
+func isLayer(mt types.MediaType) bool {
+	switch mt {
+	case types.OCILayer, types.OCIRestrictedLayer, types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer,
+		types.DockerLayer, types.DockerForeignLayer, types.DockerUncompressedLayer:
+		return true
+	}
+	return false
+}
+
+func isConfig(mt types.MediaType) bool {
+	switch mt {
+	case types.OCIConfigJSON, types.DockerConfigJSON, types.DockerPluginConfig:
+		return true
+	}
+	return false
+}
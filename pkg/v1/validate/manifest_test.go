@@ -0,0 +1,172 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	configDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	layerDigest  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+)
+
+func TestManifest(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawImg, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawIdx, err := idx.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		raw     string
+		mt      types.MediaType
+		wantErr string
+	}{{
+		name: "random image",
+		raw:  string(rawImg),
+		mt:   types.DockerManifestSchema2,
+	}, {
+		name: "random index",
+		raw:  string(rawIdx),
+		mt:   types.OCIImageIndex,
+	}, {
+		name: "oci image without mediaType",
+		raw:  `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:   types.OCIManifestSchema1,
+	}, {
+		name:    "unsupported media type",
+		raw:     `{}`,
+		mt:      types.OCILayer,
+		wantErr: "unsupported manifest media type",
+	}, {
+		name:    "not json",
+		raw:     `schemaVersion: 2`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "not a JSON object",
+	}, {
+		name:    "missing schemaVersion",
+		raw:     `{"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "missing required field: schemaVersion",
+	}, {
+		name:    "wrong schemaVersion",
+		raw:     `{"schemaVersion":1,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "schemaVersion: got 1, want 2",
+	}, {
+		name:    "docker image without mediaType",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:      types.DockerManifestSchema2,
+		wantErr: "missing required field: mediaType",
+	}, {
+		name:    "mismatched mediaType",
+		raw:     `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: `mediaType: got "application/vnd.oci.image.index.v1+json"`,
+	}, {
+		name:    "missing config",
+		raw:     `{"schemaVersion":2,"layers":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "missing required field: config",
+	}, {
+		name:    "missing layers",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"}}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "missing required field: layers",
+	}, {
+		name:    "config is a layer",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "is not a config media type",
+	}, {
+		name:    "docker config media type",
+		raw:     `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[]}`,
+		mt:      types.DockerManifestSchema2,
+		wantErr: "config.mediaType: got",
+	}, {
+		name:    "config missing digest",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2},"layers":[]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "config: missing required field: digest",
+	}, {
+		name:    "layer missing mediaType",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[{"size":2,"digest":"` + layerDigest + `"}]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "layers[0]: missing required field: mediaType",
+	}, {
+		name:    "negative layer size",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":-1,"digest":"` + layerDigest + `"}]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "layers[0].size: must not be negative",
+	}, {
+		name:    "invalid layer digest",
+		raw:     `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"` + configDigest + `"},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":2,"digest":"sha256:nope"}]}`,
+		mt:      types.OCIManifestSchema1,
+		wantErr: "layers:",
+	}, {
+		name:    "missing manifests",
+		raw:     `{"schemaVersion":2}`,
+		mt:      types.OCIImageIndex,
+		wantErr: "missing required field: manifests",
+	}, {
+		name:    "index with layers",
+		raw:     `{"schemaVersion":2,"manifests":[],"layers":[]}`,
+		mt:      types.OCIImageIndex,
+		wantErr: "unexpected field for an index: layers",
+	}, {
+		name:    "index of layers",
+		raw:     `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":2,"digest":"` + layerDigest + `"}]}`,
+		mt:      types.OCIImageIndex,
+		wantErr: "manifests[0].mediaType",
+	}, {
+		name:    "docker list of oci manifests",
+		raw:     `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","size":2,"digest":"` + layerDigest + `"}]}`,
+		mt:      types.DockerManifestList,
+		wantErr: "is not a Docker manifest media type",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Manifest([]byte(tc.raw), tc.mt)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Manifest() = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Manifest() = nil, wanted error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Manifest() = %v, wanted error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -32,6 +32,10 @@ func makeOptions(opts ...Option) options {
 }
 
 // Fast causes validate to skip reading and digesting layer bytes.
+//
+// Instead, layer metadata is checked for consistency with the manifest and
+// config file, and each layer is checked for existence, which for remote
+// images is a HEAD request rather than a full download.
 func Fast(o *options) {
 	o.fast = true
 }
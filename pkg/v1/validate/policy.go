@@ -0,0 +1,88 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Policy describes limits that an image must stay within, e.g. for admission
+// control. Zero values mean no limit.
+type Policy struct {
+	// MaxLayers caps the number of layers.
+	MaxLayers int
+	// MaxTotalSize caps the sum of the sizes of the config and layers, as
+	// stored in the registry (i.e. compressed), in bytes.
+	MaxTotalSize int64
+	// MaxLayerSize caps the (compressed) size of any single layer, in bytes.
+	MaxLayerSize int64
+	// MaxManifestSize caps the size of the manifest, in bytes.
+	MaxManifestSize int64
+	// DisallowedMediaTypes are media types that no layer may have, e.g.
+	// types.DockerForeignLayer.
+	DisallowedMediaTypes []types.MediaType
+}
+
+// CheckPolicy checks that img complies with policy, returning all violations.
+//
+// Unlike Image, this doesn't check that img is well formed. Sizes are taken
+// from the manifest, so no blobs are read, and for remote images only the
+// manifest is fetched.
+func CheckPolicy(img v1.Image, policy Policy) error {
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	size, err := img.Size()
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	if policy.MaxManifestSize > 0 && size > policy.MaxManifestSize {
+		errs = append(errs, fmt.Sprintf("manifest size %d exceeds maximum of %d", size, policy.MaxManifestSize))
+	}
+	if policy.MaxLayers > 0 && len(m.Layers) > policy.MaxLayers {
+		errs = append(errs, fmt.Sprintf("%d layers exceeds maximum of %d", len(m.Layers), policy.MaxLayers))
+	}
+
+	disallowed := map[types.MediaType]bool{}
+	for _, mt := range policy.DisallowedMediaTypes {
+		disallowed[mt] = true
+	}
+	total := m.Config.Size
+	for i, desc := range m.Layers {
+		total += desc.Size
+		if policy.MaxLayerSize > 0 && desc.Size > policy.MaxLayerSize {
+			errs = append(errs, fmt.Sprintf("layer[%d] (%s) size %d exceeds maximum of %d", i, desc.Digest, desc.Size, policy.MaxLayerSize))
+		}
+		if disallowed[desc.MediaType] {
+			errs = append(errs, fmt.Sprintf("layer[%d] (%s) has disallowed media type %s", i, desc.Digest, desc.MediaType))
+		}
+	}
+	if policy.MaxTotalSize > 0 && total > policy.MaxTotalSize {
+		errs = append(errs, fmt.Sprintf("total size %d exceeds maximum of %d", total, policy.MaxTotalSize))
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
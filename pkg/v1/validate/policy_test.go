@@ -0,0 +1,120 @@
+// Copyright 2022 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// unreadableImage fails if anything tries to read its layers.
+type unreadableImage struct {
+	v1.Image
+}
+
+func (unreadableImage) Layers() ([]v1.Layer, error) {
+	panic("layers should not be read")
+}
+
+func (unreadableImage) LayerByDigest(v1.Hash) (v1.Layer, error) {
+	panic("layers should not be read")
+}
+
+func TestCheckPolicy(t *testing.T) {
+	base, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := unreadableImage{base}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := img.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compressed sizes of random layers vary slightly.
+	total, largest, smallest := m.Config.Size, int64(0), m.Layers[0].Size
+	for _, l := range m.Layers {
+		total += l.Size
+		if l.Size > largest {
+			largest = l.Size
+		}
+		if l.Size < smallest {
+			smallest = l.Size
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{{
+		name: "no limits",
+	}, {
+		name: "within limits",
+		policy: Policy{
+			MaxLayers:            3,
+			MaxTotalSize:         total,
+			MaxLayerSize:         largest,
+			MaxManifestSize:      size,
+			DisallowedMediaTypes: []types.MediaType{types.DockerForeignLayer},
+		},
+	}, {
+		name:   "too many layers",
+		policy: Policy{MaxLayers: 2},
+		want:   []string{"3 layers exceeds maximum of 2"},
+	}, {
+		name: "everything",
+		policy: Policy{
+			MaxLayers:            1,
+			MaxTotalSize:         total - 1,
+			MaxLayerSize:         smallest - 1,
+			MaxManifestSize:      size - 1,
+			DisallowedMediaTypes: []types.MediaType{m.Layers[0].MediaType},
+		},
+		want: []string{
+			"manifest size",
+			"3 layers exceeds maximum of 1",
+			"layer[0]",
+			"layer[2]",
+			"disallowed media type",
+			"total size",
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckPolicy(img, tc.policy)
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Errorf("CheckPolicy() = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("CheckPolicy() = nil, want error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("CheckPolicy() = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}